@@ -0,0 +1,72 @@
+// Package admission implements paid membership of the relay. Pubkeys request access and are
+// issued a lightning invoice by the relay's wallet, once it is paid they become members until
+// their membership expires, and paying again extends it.
+package admission
+
+import (
+	"time"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/nwc"
+)
+
+// Day is the period the admission fee is counted in.
+const Day = 24 * time.Hour
+
+// Wallet issues invoices and reports whether they have been paid. It is implemented by
+// nwc.Client.
+type Wallet interface {
+	MakeInvoice(c context.T, amount nwc.Msat, description string,
+		expiry int) (li *nwc.LookupInvoice, err error)
+	LookupInvoice(c context.T, paymentHash []byte) (li *nwc.LookupInvoice, err error)
+}
+
+// Member is a pubkey that has paid for access to the relay.
+type Member struct {
+	// Pubkey is the hex encoded public key of the member.
+	Pubkey string `json:"pubkey" doc:"hex encoded public key"`
+	// Expires is the unix timestamp when the membership ends.
+	Expires int64 `json:"expires" doc:"unix timestamp when the membership ends"`
+}
+
+// Active returns true if the membership has not expired.
+func (m *Member) Active() bool { return m != nil && m.Expires > time.Now().Unix() }
+
+// Extend returns the membership of the pubkey after paying for the given number of days. An
+// active membership is extended from its expiry, otherwise it starts now.
+func Extend(m *Member, pubkey string, days int) (ext *Member) {
+	start := time.Now().Unix()
+	if m.Active() {
+		start = m.Expires
+	}
+	return &Member{
+		Pubkey:  pubkey,
+		Expires: start + int64(time.Duration(days)*Day/time.Second),
+	}
+}
+
+// Invoice is an unpaid invoice issued to a pubkey for admission to the relay.
+type Invoice struct {
+	// PaymentHash identifies the invoice to the wallet.
+	PaymentHash string `json:"payment_hash" doc:"payment hash of the invoice"`
+	// Invoice is the bolt11 encoded invoice to pay.
+	Invoice string `json:"invoice" doc:"bolt11 invoice to pay"`
+	// Pubkey is the hex encoded public key that is admitted when the invoice is paid.
+	Pubkey string `json:"pubkey" doc:"hex encoded public key admitted by the payment"`
+	// Amount is the amount of the invoice in sats.
+	Amount int `json:"amount" doc:"amount in sats"`
+	// Days is the number of days of membership the invoice pays for.
+	Days int `json:"days" doc:"days of membership paid for"`
+	// CreatedAt is the unix timestamp when the invoice was issued.
+	CreatedAt int64 `json:"created_at" doc:"unix timestamp when the invoice was issued"`
+	// ExpiresAt is the unix timestamp after which the invoice can't be paid.
+	ExpiresAt int64 `json:"expires_at" doc:"unix timestamp after which the invoice can't be paid"`
+}
+
+// Expired returns true if the invoice can no longer be paid.
+func (i *Invoice) Expired() bool { return i.ExpiresAt <= time.Now().Unix() }
+
+// Settled returns true if the wallet reports the invoice has been paid.
+func Settled(li *nwc.LookupInvoice) bool {
+	return li != nil && (li.SettledAt > 0 || len(li.Preimage) > 0)
+}
@@ -0,0 +1,40 @@
+package admission
+
+import (
+	"testing"
+	"time"
+
+	"relay.mleku.dev/nwc"
+)
+
+func TestExtend(t *testing.T) {
+	var m *Member
+	if m.Active() {
+		t.Fatal("nil membership should not be active")
+	}
+	m = Extend(m, "abcd", 30)
+	if !m.Active() {
+		t.Fatal("new membership should be active")
+	}
+	expires := m.Expires
+	m = Extend(m, "abcd", 30)
+	if m.Expires != expires+int64(30*Day/time.Second) {
+		t.Fatal("active membership should be extended from its expiry")
+	}
+	m.Expires = time.Now().Add(-time.Hour).Unix()
+	if m.Active() {
+		t.Fatal("expired membership should not be active")
+	}
+	if m = Extend(m, "abcd", 1); m.Expires < time.Now().Add(Day-time.Minute).Unix() {
+		t.Fatal("expired membership should start again from now")
+	}
+}
+
+func TestSettled(t *testing.T) {
+	if Settled(&nwc.LookupInvoice{}) {
+		t.Fatal("invoice without settlement should not be settled")
+	}
+	if !Settled(&nwc.LookupInvoice{SettledAt: time.Now().Unix()}) {
+		t.Fatal("invoice with settled_at should be settled")
+	}
+}
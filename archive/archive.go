@@ -0,0 +1,273 @@
+// Package archive encodes and decodes streams of events for exporting and importing the
+// contents of an event store, as line structured JSON, compressed line structured JSON, or a
+// binary format of length prefixed compact encoded events.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+)
+
+// Format is an encoding of a stream of events.
+type Format string
+
+const (
+	// JSONL is line structured minified JSON, one event per line.
+	JSONL Format = "jsonl"
+	// Gzip is JSONL compressed with gzip.
+	Gzip Format = "gzip"
+	// Zstd is JSONL compressed with zstd.
+	Zstd Format = "zstd"
+	// Binary is the Magic header followed by events in the event.MarshalCompact encoding, each
+	// prefixed with its length as an unsigned varint.
+	Binary Format = "binary"
+)
+
+// Formats are the formats that can be written.
+var Formats = []Format{JSONL, Gzip, Zstd, Binary}
+
+// Magic is the header of the Binary format, the last byte is the version.
+var Magic = []byte("NOSTRBIN\x01")
+
+// MaxEventSize is the largest encoded event a Reader accepts.
+const MaxEventSize = 500000000
+
+// ErrInvalid is wrapped by the errors Read returns for a record that is not a valid event,
+// after which reading can continue with the next record.
+var ErrInvalid = errors.New("invalid event")
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ContentType returns the HTTP content type of a format.
+func (f Format) ContentType() string {
+	switch f {
+	case Gzip:
+		return "application/gzip"
+	case Zstd:
+		return "application/zstd"
+	case Binary:
+		return "application/octet-stream"
+	}
+	return "application/nostr+jsonl"
+}
+
+// Valid returns true if the format is one of the Formats.
+func (f Format) Valid() bool {
+	for _, v := range Formats {
+		if f == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer encodes events to a stream in a Format.
+type Writer struct {
+	w      io.Writer
+	c      io.WriteCloser
+	format Format
+	buf    []byte
+}
+
+// NewWriter returns a Writer that writes events to w in the format, an empty format is JSONL.
+func NewWriter(w io.Writer, format Format) (aw *Writer, err error) {
+	if format == "" {
+		format = JSONL
+	}
+	aw = &Writer{w: w, format: format}
+	switch format {
+	case JSONL:
+	case Gzip:
+		aw.c = gzip.NewWriter(w)
+		aw.w = aw.c
+	case Zstd:
+		var zw *zstd.Encoder
+		if zw, err = zstd.NewWriter(w); chk.E(err) {
+			return
+		}
+		aw.c = zw
+		aw.w = zw
+	case Binary:
+		if _, err = w.Write(Magic); chk.E(err) {
+			return
+		}
+	default:
+		err = errorf.E("unknown export format %s", format)
+	}
+	return
+}
+
+// Write encodes an event to the stream.
+func (w *Writer) Write(ev *event.T) (err error) {
+	w.buf = w.buf[:0]
+	if w.format == Binary {
+		b := ev.MarshalCompact(nil)
+		w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+		w.buf = append(w.buf, b...)
+	} else {
+		w.buf = ev.Marshal(w.buf)
+		w.buf = append(w.buf, '\n')
+	}
+	_, err = w.w.Write(w.buf)
+	return
+}
+
+// Flush writes any events buffered by the compressor to the stream, so a client receives them
+// before the export is finished.
+func (w *Writer) Flush() (err error) {
+	if f, ok := w.c.(interface{ Flush() error }); ok {
+		err = f.Flush()
+	}
+	return
+}
+
+// Close finishes the stream, it does not close the underlying writer.
+func (w *Writer) Close() (err error) {
+	if w.c != nil {
+		err = w.c.Close()
+	}
+	return
+}
+
+// Reader decodes events from a stream in any of the Formats, which is detected from its first
+// bytes.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+	zr     *zstd.Decoder
+	buf    []byte
+	line   int
+}
+
+// NewReader returns a Reader for a stream of events, detecting its format.
+func NewReader(r io.Reader) (ar *Reader, err error) {
+	ar = &Reader{r: bufio.NewReaderSize(r, 1<<16), format: JSONL}
+	var head []byte
+	head, _ = ar.r.Peek(len(Magic))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		var gr *gzip.Reader
+		if gr, err = gzip.NewReader(ar.r); chk.E(err) {
+			return
+		}
+		ar.r = bufio.NewReaderSize(gr, 1<<16)
+		ar.format = Gzip
+	case bytes.HasPrefix(head, zstdMagic):
+		if ar.zr, err = zstd.NewReader(ar.r); chk.E(err) {
+			return
+		}
+		ar.r = bufio.NewReaderSize(ar.zr, 1<<16)
+		ar.format = Zstd
+	}
+	// a compressed stream may contain either encoding
+	head, _ = ar.r.Peek(len(Magic))
+	if bytes.Equal(head, Magic) {
+		if _, err = ar.r.Discard(len(Magic)); chk.E(err) {
+			return
+		}
+		ar.format = Binary
+	}
+	return
+}
+
+// Format returns the detected format of the stream. A compressed stream of binary encoded
+// events is reported as Binary.
+func (r *Reader) Format() Format { return r.format }
+
+// Line returns the number of the line of JSONL, or of the record of the binary format, that
+// was last read, counting from 1.
+func (r *Reader) Line() int { return r.line }
+
+// Read decodes the next event in the stream, it returns io.EOF at the end. If a record is not
+// a valid event the error wraps ErrInvalid, and the next can be read. Empty lines are skipped.
+func (r *Reader) Read() (ev *event.T, err error) {
+	if r.format == Binary {
+		return r.readBinary()
+	}
+	for {
+		var line []byte
+		if line, err = r.readLine(); err != nil {
+			return
+		}
+		r.line++
+		if len(line) == 0 {
+			continue
+		}
+		// the event refers to the bytes it is decoded from, so they can't be reused
+		ev = event.New()
+		if _, err = ev.Unmarshal(append([]byte(nil), line...)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		return
+	}
+}
+
+// readLine returns the next line of the stream without the line break.
+func (r *Reader) readLine() (line []byte, err error) {
+	r.buf = r.buf[:0]
+	for {
+		var b []byte
+		b, err = r.r.ReadSlice('\n')
+		r.buf = append(r.buf, b...)
+		if len(r.buf) > MaxEventSize {
+			err = errorf.E("line longer than %d bytes", MaxEventSize)
+			return
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(r.buf) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+		return bytes.TrimRight(r.buf, "\r\n"), nil
+	}
+}
+
+// readBinary decodes the next length prefixed compact event.
+func (r *Reader) readBinary() (ev *event.T, err error) {
+	var l uint64
+	if l, err = binary.ReadUvarint(r.r); err != nil {
+		return
+	}
+	if l > MaxEventSize {
+		err = errorf.E("event of %d bytes is larger than %d", l, MaxEventSize)
+		return
+	}
+	b := make([]byte, l)
+	if _, err = io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	r.line++
+	ev = event.New()
+	if _, err = ev.UnmarshalCompact(b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return
+}
+
+// Close releases the resources of the decompressor, it does not close the underlying reader.
+func (r *Reader) Close() {
+	if r.zr != nil {
+		r.zr.Close()
+	}
+}
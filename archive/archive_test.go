@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/p256k"
+)
+
+func generate(t *testing.T, n int) (evs []*event.T) {
+	signer := new(p256k.Signer)
+	if err := signer.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	for range n {
+		ev, err := event.GenerateRandomTextNoteEvent(signer, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evs = append(evs, ev)
+	}
+	return
+}
+
+func TestRoundTrip(t *testing.T) {
+	evs := generate(t, 200)
+	for _, format := range Formats {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range evs {
+			if err = w.Write(ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var r *Reader
+		if r, err = NewReader(buf); err != nil {
+			t.Fatal(err)
+		}
+		if r.Format() != format {
+			t.Fatalf("detected format %s, expected %s", r.Format(), format)
+		}
+		var n int
+		for {
+			var ev *event.T
+			if ev, err = r.Read(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if !bytes.Equal(ev.Serialize(), evs[n].Serialize()) {
+				t.Fatalf("%s: event %d mismatch\n%s\n%s", format, n, ev.Serialize(),
+					evs[n].Serialize())
+			}
+			n++
+		}
+		r.Close()
+		if n != len(evs) {
+			t.Fatalf("%s: read %d events, wrote %d", format, n, len(evs))
+		}
+	}
+}
+
+func TestInvalidLines(t *testing.T) {
+	line := generate(t, 1)[0].Serialize()
+	in := "not an event\n\n" + string(line)
+	r, err := NewReader(bytes.NewBufferString(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev *event.T
+	if _, err = r.Read(); !errors.Is(err, ErrInvalid) || r.Line() != 1 {
+		t.Fatalf("expected invalid event on line 1, got %v on line %d", err, r.Line())
+	}
+	if ev, err = r.Read(); err != nil || r.Line() != 3 {
+		t.Fatalf("expected event on line 3, got %v on line %d", err, r.Line())
+	}
+	if !bytes.Equal(ev.Serialize(), line) {
+		t.Fatalf("got %s", ev.Serialize())
+	}
+	if _, err = r.Read(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Package audit is the record of the administrative and moderation actions taken on a relay,
+// who took them, from where, with what parameters and what came of it.
+//
+// Entries can be published as application specific data events (NIP-78) signed by an auditor
+// key, each with its own d tag so none replaces another.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+// Ok is the result of an action that succeeded.
+const Ok = "ok"
+
+// Entry is an action recorded in the audit log.
+type Entry struct {
+	// Time is when the action was taken, in unix nanoseconds, which orders the log.
+	Time int64 `json:"time"`
+	// Actor is the hex encoded pubkey of who took the action, empty if they weren't
+	// authenticated by a pubkey.
+	Actor     string            `json:"actor,omitempty"`
+	Remote    string            `json:"remote,omitempty"`
+	Operation string            `json:"operation"`
+	Params    map[string]string `json:"params,omitempty"`
+	// Result is Ok or the error the action failed with.
+	Result string `json:"result"`
+}
+
+// New creates an entry for an action, with the result of the error it failed with, if any.
+func New(actor []byte, remote, operation string, params map[string]string,
+	err error) (e *Entry) {
+
+	e = &Entry{Time: time.Now().UnixNano(), Remote: remote, Operation: operation,
+		Params: params, Result: Ok}
+	if len(actor) > 0 {
+		e.Actor = hex.Enc(actor)
+	}
+	if err != nil {
+		e.Result = err.Error()
+	}
+	return
+}
+
+// Private are the parameters of entries that are written freely by who took the action, such
+// as the reason for a ban, which are kept out of published entries.
+var Private = []string{"reason"}
+
+// Public returns a copy of the entry without what may not be published, the remote address of
+// who took the action and the Private parameters.
+func (e *Entry) Public() (p *Entry) {
+	p = &Entry{Time: e.Time, Actor: e.Actor, Operation: e.Operation, Result: e.Result}
+	for k, v := range e.Params {
+		if slices.Contains(Private, k) {
+			continue
+		}
+		if p.Params == nil {
+			p.Params = make(map[string]string)
+		}
+		p.Params[k] = v
+	}
+	return
+}
+
+// Event returns the Public part of the entry as an unsigned application specific data event,
+// with it as its content, an op tag with the operation and a p tag with the actor.
+func (e *Entry) Event() (ev *event.T, err error) {
+	var content []byte
+	if content, err = json.Marshal(e.Public()); err != nil {
+		return
+	}
+	t := []*tag.T{
+		tag.New("d", fmt.Sprintf("audit:%d", e.Time)),
+		tag.New("t", "audit"),
+		tag.New("op", e.Operation),
+	}
+	if e.Actor != "" {
+		t = append(t, tag.New("p", e.Actor))
+	}
+	ev = &event.T{
+		CreatedAt: timestamp.FromUnix(e.Time / int64(time.Second)),
+		Kind:      kind.ApplicationSpecificData,
+		Tags:      tags.New(t...),
+		Content:   content,
+	}
+	return
+}
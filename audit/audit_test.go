@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"lukechampine.com/frand"
+
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/tag"
+)
+
+func TestEntry(t *testing.T) {
+	actor := frand.Bytes(32)
+	e := New(actor, "127.0.0.1", "nuke", nil, nil)
+	if e.Result != Ok || e.Actor != hex.Enc(actor) || e.Time == 0 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	e = New(nil, "127.0.0.1", "ban", map[string]string{"pubkey": "ab", "reason": "spam"},
+		errors.New("failed"))
+	if e.Result != "failed" || e.Actor != "" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	ev, err := e.Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Kind.Equal(kind.ApplicationSpecificData) || ev.CreatedAt.I64() != e.Time/1e9 {
+		t.Fatal("wrong kind or created_at")
+	}
+	if ev.Tags.GetFirst(tag.New("op")) == nil || ev.Tags.GetFirst(tag.New("p")) != nil {
+		t.Fatal("expected an op tag and no p tag")
+	}
+	var decoded Entry
+	if err = json.Unmarshal(ev.Content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Operation != "ban" || decoded.Params["pubkey"] != "ab" || decoded.Time != e.Time {
+		t.Fatalf("content does not match the entry %+v", decoded)
+	}
+	if decoded.Remote != "" || decoded.Params["reason"] != "" {
+		t.Fatalf("published entry has the remote address or private parameters %+v", decoded)
+	}
+	if e.Remote == "" || e.Params["reason"] != "spam" {
+		t.Fatal("the entry itself lost its remote address or private parameters")
+	}
+}
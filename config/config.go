@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"runtime/debug"
+	"time"
 
 	"github.com/pkg/profile"
 	"go-simpler.org/env"
@@ -24,6 +25,20 @@ type C struct {
 	Port     int    `env:"PORT" default:"3334" usage:"port to listen on"` // PORT is used by heroku
 	Pprof    bool   `env:"PPROF" default:"false" usage:"enable pprof on 127.0.0.1:6060"`
 	MemLimit int64  `env:"MEM_LIMIT" default:"250000000" usage:"set memory limit, default is 250Mb"`
+
+	MigrateDryRun bool `env:"MIGRATE_DRY_RUN" default:"false" usage:"check pending database migrations without applying them, and exit"`
+	MigrateBackup bool `env:"MIGRATE_BACKUP" default:"true" usage:"back up the database before migrating it"`
+
+	ZstdDictionary bool `env:"ZSTD_DICTIONARY" default:"false" usage:"compress event records with zstd dictionaries trained from the stored events, a rescan trains them again"`
+
+	ReadOnly       bool          `env:"READ_ONLY" default:"false" usage:"serve a read only snapshot of another relay's event store as a replica, events are rejected"`
+	ReplicaPath    string        `env:"REPLICA_PATH" usage:"directory of the snapshot a read only replica serves, or a symlink to it that is pointed at refreshed snapshots, the data directory if empty"`
+	ReplicaRefresh time.Duration `env:"REPLICA_REFRESH" default:"0s" usage:"how often a read only replica checks for a refreshed snapshot and reopens it, never if zero"`
+
+	Tenants []string `env:"TENANTS" usage:"virtual relays served by this process, each as name=host or name=/path, selected by the Host header or path of requests, with their own database, configuration, admins and APIs"`
+
+	IdentityPassword string `env:"IDENTITY_PASSWORD" usage:"password the relay identity key is encrypted with in the database, by default it is empty and the key is NOT encrypted at rest"`
+	AuditorKey       string `env:"AUDITOR_KEY" usage:"secret key, in hex or nsec, that the entries of the audit log are signed with and published as events, not published if empty"`
 }
 
 func New() (c *C) {
@@ -35,7 +50,14 @@ func New() (c *C) {
 	if err := env.Load(c, &env.Options{SliceSep: ","}); chk.T(err) {
 		return
 	}
-	log.I.S(c)
+	// the secrets are not logged
+	redacted := *c
+	for _, secret := range []*string{&redacted.IdentityPassword, &redacted.AuditorKey} {
+		if *secret != "" {
+			*secret = "<redacted>"
+		}
+	}
+	log.I.S(redacted)
 	if len(os.Args) == 2 && os.Args[1] == "help" {
 		fmt.Printf("\nenvironment variables that configure %s\n\n", c.AppName)
 		env.Usage(c, os.Stdout, nil)
@@ -54,7 +76,16 @@ commands:
 
       %s env 
 
-`, os.Args[0], os.Args[0], os.Args[0])
+  - check the consistency of the database, and repair the problems found if requested
+
+      %s fsck [repair]
+
+  - restore the backups in a directory into an empty data directory, optionally only those made
+    up to a unix timestamp
+
+      %s restore <backup directory> [timestamp]
+
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 		os.Exit(0)
 	}
 	if len(os.Args) == 2 && os.Args[1] == "env" {
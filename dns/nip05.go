@@ -5,6 +5,7 @@ package dns
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
 	"strings"
@@ -65,9 +66,17 @@ func ParseIdentifier(account string) (name, domain string, err error) {
 func QueryIdentifier(c context.T, account string) (prf *pointers.Profile,
 	err error) {
 
+	return QueryIdentifierWithClient(c, nil, account)
+}
+
+// QueryIdentifierWithClient is QueryIdentifier using the given HTTP client, if
+// it is nil a default client that doesn't follow redirects is used.
+func QueryIdentifierWithClient(c context.T, client *http.Client,
+	account string) (prf *pointers.Profile, err error) {
+
 	var result *WellKnownResponse
 	var name string
-	if result, name, err = Fetch(c, account); chk.E(err) {
+	if result, name, err = FetchWithClient(c, client, account); chk.E(err) {
 		return
 	}
 	pubkey, ok := result.Names[name]
@@ -94,6 +103,14 @@ func QueryIdentifier(c context.T, account string) (prf *pointers.Profile,
 func Fetch(c context.T, account string) (resp *WellKnownResponse,
 	name string, err error) {
 
+	return FetchWithClient(c, nil, account)
+}
+
+// FetchWithClient is Fetch using the given HTTP client, if it is nil a default
+// client that doesn't follow redirects is used.
+func FetchWithClient(c context.T, client *http.Client, account string) (
+	resp *WellKnownResponse, name string, err error) {
+
 	var domain string
 	if name, domain, err = ParseIdentifier(account); chk.E(err) {
 		err = errorf.E("failed to parse '%s': %w", account, err)
@@ -106,11 +123,13 @@ func Fetch(c context.T, account string) (resp *WellKnownResponse,
 
 		return resp, name, errorf.E("failed to create a request: %w", err)
 	}
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request,
-			via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	if client == nil {
+		client = &http.Client{
+			CheckRedirect: func(req *http.Request,
+				via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
 	}
 	var res *http.Response
 	if res, err = client.Do(req); chk.E(err) {
@@ -119,12 +138,14 @@ func Fetch(c context.T, account string) (resp *WellKnownResponse,
 	}
 	defer res.Body.Close()
 	resp = NewWellKnownResponse()
-	b := make([]byte, 65535)
-	var n int
-	if n, err = res.Body.Read(b); chk.E(err) {
+	if res.StatusCode != http.StatusOK {
+		err = errorf.E("request failed with status %d", res.StatusCode)
+		return
+	}
+	var b []byte
+	if b, err = io.ReadAll(io.LimitReader(res.Body, 65535)); chk.E(err) {
 		return
 	}
-	b = b[:n]
 	if err = json.Unmarshal(b, resp); chk.E(err) {
 		err = errorf.E("failed to decode json response: %w", err)
 	}
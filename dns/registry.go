@@ -0,0 +1,58 @@
+package dns
+
+import (
+	"regexp"
+	"strings"
+
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/keys"
+)
+
+// NameRegex matches the local part of a NIP-05 identifier the relay will register. Names are
+// case-insensitive, so they are stored in lower case.
+var NameRegex = regexp.MustCompile(`^[a-z0-9._-]{1,64}$`)
+
+// Registration is a name served by the relay's NIP-05 identity server.
+type Registration struct {
+	// Name is the local part of the identifier, <name>@<domain of the relay>.
+	Name string `json:"name" doc:"local part of the nip-05 identifier, _ is the domain itself"`
+	// Pubkey is the hex encoded public key the name points to.
+	Pubkey string `json:"pubkey" doc:"hex encoded public key"`
+	// Relays are recommended relays for the user, if empty the relay itself is recommended.
+	Relays []string `json:"relays,omitempty" doc:"relays the user can be found at"`
+	// Claimed is true if the user registered the name themselves, rather than an admin.
+	Claimed bool `json:"claimed,omitempty" doc:"name was claimed by the user"`
+}
+
+// Validate normalizes the name and checks that the name and pubkey are valid.
+func (r *Registration) Validate() (err error) {
+	r.Name = strings.ToLower(r.Name)
+	if !NameRegex.MatchString(r.Name) {
+		return errorf.E("invalid name '%s'", r.Name)
+	}
+	r.Pubkey = strings.ToLower(r.Pubkey)
+	if !keys.IsValidPublicKey(r.Pubkey) {
+		return errorf.E("invalid pubkey '%s'", r.Pubkey)
+	}
+	return
+}
+
+// NewRegistryResponse creates the /.well-known/nostr.json response for a set of registrations.
+// Registrations that don't list any relays get the defaultRelays.
+func NewRegistryResponse(regs []*Registration, defaultRelays ...string) (resp *WellKnownResponse) {
+	resp = &WellKnownResponse{
+		Names:  make(map[string]string),
+		Relays: make(map[string][]string),
+	}
+	for _, r := range regs {
+		resp.Names[r.Name] = r.Pubkey
+		relays := r.Relays
+		if len(relays) == 0 {
+			relays = defaultRelays
+		}
+		if len(relays) > 0 {
+			resp.Relays[r.Pubkey] = relays
+		}
+	}
+	return
+}
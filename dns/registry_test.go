@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"testing"
+)
+
+const testPubkey = "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+func TestRegistrationValidate(t *testing.T) {
+	r := &Registration{Name: "Alice", Pubkey: testPubkey}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "alice" {
+		t.Fatalf("name not normalized: %s", r.Name)
+	}
+	for _, bad := range []*Registration{
+		{Name: "al ice", Pubkey: testPubkey},
+		{Name: "", Pubkey: testPubkey},
+		{Name: "bob", Pubkey: "deadbeef"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Fatalf("registration %v should be invalid", bad)
+		}
+	}
+}
+
+func TestNewRegistryResponse(t *testing.T) {
+	resp := NewRegistryResponse([]*Registration{
+		{Name: "alice", Pubkey: testPubkey},
+	}, "wss://relay.example.com")
+	if resp.Names["alice"] != testPubkey {
+		t.Fatal("name missing from response")
+	}
+	if len(resp.Relays[testPubkey]) != 1 {
+		t.Fatal("default relay hint missing from response")
+	}
+}
@@ -0,0 +1,100 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"relay.mleku.dev/bech32encoding/pointers"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/hex"
+)
+
+// Verification is the cached result of checking the NIP-05 identifier in the profile of a
+// pubkey.
+type Verification struct {
+	// Pubkey is the hex encoded public key that was verified.
+	Pubkey string `json:"pubkey" doc:"hex encoded public key"`
+	// Identifier is the NIP-05 identifier found in the profile, if any.
+	Identifier string `json:"identifier,omitempty" doc:"nip-05 identifier in the user's profile"`
+	// Valid is true if the identifier is in an allowed domain and resolves to the pubkey.
+	Valid bool `json:"valid" doc:"identifier verified"`
+	// Error is the reason verification failed.
+	Error string `json:"error,omitempty" doc:"reason verification failed"`
+	// CheckedAt is the unix timestamp of when the verification was done.
+	CheckedAt int64 `json:"checked_at" doc:"unix timestamp of the verification"`
+}
+
+// Stale returns true if the verification is older than the ttl for its result, failed
+// verifications use the negativeTTL.
+func (v *Verification) Stale(ttl, negativeTTL time.Duration) bool {
+	if !v.Valid {
+		ttl = negativeTTL
+	}
+	return time.Since(time.Unix(v.CheckedAt, 0)) > ttl
+}
+
+// ProfileIdentifier returns the nip05 field of the content of a kind 0 profile event.
+func ProfileIdentifier(content []byte) (identifier string) {
+	var profile struct {
+		NIP05 string `json:"nip05"`
+	}
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return
+	}
+	return strings.TrimSpace(profile.NIP05)
+}
+
+// AllowedDomain returns true if the domain of the identifier is one of the domains, or a
+// subdomain of one of them.
+func AllowedDomain(identifier string, domains []string) bool {
+	_, domain, err := ParseIdentifier(identifier)
+	if err != nil {
+		return false
+	}
+	domain = strings.ToLower(domain)
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks that the identifier is in one of the allowed domains and that it resolves to
+// the pubkey, using the given HTTP client, which may be nil. The result is always returned,
+// failures are described in its Error field.
+func Verify(c context.T, client *http.Client, identifier string, pubkey []byte,
+	domains []string) (v *Verification) {
+
+	v = &Verification{
+		Pubkey:     hex.Enc(pubkey),
+		Identifier: identifier,
+		CheckedAt:  time.Now().Unix(),
+	}
+	var err error
+	switch {
+	case identifier == "":
+		err = errorf.E("profile has no nip-05 identifier")
+	case !AllowedDomain(identifier, domains):
+		err = errorf.E("nip-05 identifier '%s' is not in an allowed domain", identifier)
+	default:
+		var prf *pointers.Profile
+		if prf, err = QueryIdentifierWithClient(c, client, identifier); err != nil {
+			break
+		}
+		if !bytes.Equal(prf.PublicKey, pubkey) {
+			err = errorf.E("nip-05 identifier '%s' belongs to another pubkey", identifier)
+		}
+	}
+	if err != nil {
+		v.Error = err.Error()
+		return
+	}
+	v.Valid = true
+	return
+}
@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/keys"
+)
+
+// newTestClient returns a server serving a nostr.json with the given names and a client that
+// sends requests for every domain to it.
+func newTestClient(names map[string]string) (srv *httptest.Server, client *http.Client) {
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		resp := NewWellKnownResponse()
+		if pk, ok := names[r.URL.Query().Get("name")]; ok {
+			resp.Names[r.URL.Query().Get("name")] = pk
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	addr := srv.Listener.Addr().String()
+	client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(c context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(c, network, addr)
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	return
+}
+
+func newPubkey(t *testing.T) (pk []byte) {
+	var err error
+	var hpk string
+	if hpk, err = keys.GetPublicKeyHex(keys.GenerateSecretKeyHex()); err != nil {
+		t.Fatal(err)
+	}
+	if pk, err = keys.HexPubkeyToBytes(hpk); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestVerify(t *testing.T) {
+	pk, other := newPubkey(t), newPubkey(t)
+	srv, client := newTestClient(map[string]string{"bob": hex.Enc(pk)})
+	defer srv.Close()
+	c := context.Background()
+	domains := []string{"example.com"}
+	if v := Verify(c, client, "bob@example.com", pk, domains); !v.Valid {
+		t.Fatalf("verification should succeed: %s", v.Error)
+	}
+	if v := Verify(c, client, "bob@sub.example.com", pk, domains); !v.Valid {
+		t.Fatalf("subdomain verification should succeed: %s", v.Error)
+	}
+	if v := Verify(c, client, "bob@example.org", pk, domains); v.Valid {
+		t.Fatal("domain not on the allow list should fail")
+	}
+	if v := Verify(c, client, "bob@example.com", other, domains); v.Valid {
+		t.Fatal("identifier of another pubkey should fail")
+	}
+	if v := Verify(c, client, "alice@example.com", pk, domains); v.Valid {
+		t.Fatal("unknown name should fail")
+	}
+	if v := Verify(c, client, "", pk, domains); v.Valid {
+		t.Fatal("missing identifier should fail")
+	}
+}
+
+func TestStale(t *testing.T) {
+	v := &Verification{Valid: true, CheckedAt: time.Now().Add(-2 * time.Hour).Unix()}
+	if v.Stale(24*time.Hour, time.Hour) {
+		t.Fatal("valid verification should not be stale")
+	}
+	v.Valid = false
+	if !v.Stale(24*time.Hour, time.Hour) {
+		t.Fatal("failed verification should be stale")
+	}
+	if ProfileIdentifier([]byte(`{"name":"bob","nip05":" bob@example.com "}`)) !=
+		"bob@example.com" {
+		t.Fatal("nip05 not found in profile")
+	}
+}
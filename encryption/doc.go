@@ -1,3 +1,3 @@
 // Package encryption contains the message encryption schemes defined in NIP-04 and NIP-44, used
-// for encrypting the content of nostr messages.
+// for encrypting the content of nostr messages, and the secret key encryption of NIP-49.
 package encryption
@@ -0,0 +1,93 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+
+	"relay.mleku.dev/ec/bech32"
+	"relay.mleku.dev/errorf"
+)
+
+const (
+	// Nip49Version is the version of the NIP-49 encrypted secret key format.
+	Nip49Version byte = 2
+	// DefaultLogN is the scrypt work factor used for encrypting secret keys, 2^16 rounds
+	// needing 64Mb of memory.
+	DefaultLogN byte = 16
+	// KeySecurityUnknown marks an encrypted secret key as not known to have been handled
+	// either securely or insecurely before it was encrypted.
+	KeySecurityUnknown byte = 2
+)
+
+// EncryptedKeyHRP is the Human Readable Prefix of a NIP-49 encrypted secret key.
+var EncryptedKeyHRP = []byte("ncryptsec")
+
+// EncryptKey encrypts a secret key with a password as defined in NIP-49, with a scrypt work
+// factor of 2^logN, and returns it bech32 encoded as an ncryptsec.
+func EncryptKey(sec []byte, password string, logN byte) (ncryptsec []byte, err error) {
+	if len(sec) != 32 {
+		err = errorf.E("secret key must be 32 bytes, got %d", len(sec))
+		return
+	}
+	salt, nonce := make([]byte, 16), make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	var key []byte
+	if key, err = scrypt.Key([]byte(password), salt, 1<<logN, 8, 1, 32); err != nil {
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = chacha20poly1305.NewX(key); err != nil {
+		return
+	}
+	b := append([]byte{Nip49Version, logN}, salt...)
+	b = append(b, nonce...)
+	b = append(b, KeySecurityUnknown)
+	b = aead.Seal(b, nonce, sec, []byte{KeySecurityUnknown})
+	var b5 []byte
+	if b5, err = bech32.ConvertBits(b, 8, 5, true); err != nil {
+		return
+	}
+	return bech32.Encode(EncryptedKeyHRP, b5)
+}
+
+// DecryptKey decrypts a NIP-49 ncryptsec with a password and returns the secret key.
+func DecryptKey(ncryptsec []byte, password string) (sec []byte, err error) {
+	var hrp, b5 []byte
+	if hrp, b5, err = bech32.DecodeNoLimit(ncryptsec); err != nil {
+		return
+	}
+	if string(hrp) != string(EncryptedKeyHRP) {
+		err = errorf.E("not an encrypted secret key, prefix is '%s'", hrp)
+		return
+	}
+	var b []byte
+	if b, err = bech32.ConvertBits(b5, 5, 8, false); err != nil {
+		return
+	}
+	if len(b) != 91 || b[0] != Nip49Version {
+		err = errorf.E("unsupported encrypted secret key of %d bytes", len(b))
+		return
+	}
+	logN, salt, nonce, ad, ciphertext := b[1], b[2:18], b[18:42], b[42:43], b[43:]
+	var key []byte
+	if key, err = scrypt.Key([]byte(password), salt, 1<<logN, 8, 1, 32); err != nil {
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = chacha20poly1305.NewX(key); err != nil {
+		return
+	}
+	if sec, err = aead.Open(nil, nonce, ciphertext, ad); err != nil {
+		err = errorf.E("failed to decrypt secret key, wrong password?")
+		return
+	}
+	return
+}
@@ -0,0 +1,40 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+
+	"relay.mleku.dev/hex"
+)
+
+func TestDecryptKey(t *testing.T) {
+	ncryptsec := "ncryptsec1qgg9947rlpvqu76pj5ecreduf9jxhselq2nae2kghhvd5g7dgjtcxfqtd67p9m0w57lspw8gsq6yphnm8623nsl8xn9j4jdzz84zm3frztj3z7s35vpzmqf6ksu8r89qk5z2zxfmu5gv8th8wclt0h4p"
+	sec, err := DecryptKey([]byte(ncryptsec), "nostr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.Enc(sec) != "3501454135014541350145413501453fefb02227e449e57cf4d3a3ce05378683" {
+		t.Fatalf("wrong secret key %0x", sec)
+	}
+	if _, err = DecryptKey([]byte(ncryptsec), "rtson"); err == nil {
+		t.Fatal("decrypted with the wrong password")
+	}
+}
+
+func TestEncryptKey(t *testing.T) {
+	sec := bytes.Repeat([]byte{7}, 32)
+	ncryptsec, err := EncryptKey(sec, "password", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(ncryptsec, []byte("ncryptsec1")) {
+		t.Fatalf("not an ncryptsec: %s", ncryptsec)
+	}
+	var dec []byte
+	if dec, err = DecryptKey(ncryptsec, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, sec) {
+		t.Fatal("decrypted key differs")
+	}
+}
@@ -0,0 +1,307 @@
+// Package groups implements the state of NIP-29 relay based groups, the processing of the
+// moderation, join and leave events that change it, and the generation of the group metadata
+// events that the relay signs and publishes to describe it.
+//
+// Group events are identified by an `h` tag containing the group id. Moderation events (kinds
+// 9000-9020) may only be issued by group admins, or moderators for a subset of them, and the
+// group metadata events (kinds 39000-39003) are only ever created by the relay.
+package groups
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+
+	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+const (
+	// Admin is the role that can perform all moderation actions on a group.
+	Admin = "admin"
+	// Moderator is the role that can remove users and events and create invites.
+	Moderator = "moderator"
+)
+
+// Roles are the roles supported by groups on this relay, as advertised in the GroupRoles
+// event.
+var Roles = map[string]string{
+	Admin:     "can perform all moderation actions and edit the group metadata",
+	Moderator: "can remove users and events and create invite codes",
+}
+
+// ValidId matches the characters allowed in a group id.
+var ValidId = regexp.MustCompile(`^[a-zA-Z0-9\-_]{1,64}$`)
+
+// Group is the state of a relay based group.
+type Group struct {
+	Id      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Picture string `json:"picture,omitempty"`
+	About   string `json:"about,omitempty"`
+	// Private groups are only readable by their members.
+	Private bool `json:"private"`
+	// Closed groups only accept join requests that carry a valid invite code, others must be
+	// added by an admin.
+	Closed bool `json:"closed"`
+	// Members maps the hex encoded pubkey of each member to their roles, if any.
+	Members map[string][]string `json:"members"`
+	// Invites are the unused invite codes of the group.
+	Invites []string `json:"invites,omitempty"`
+	// CreatedAt is the timestamp of the event that created the group.
+	CreatedAt int64 `json:"created_at"`
+}
+
+// New creates a new open, public group with the creator as its admin.
+func New(id string, creator []byte, createdAt int64) (g *Group) {
+	return &Group{
+		Id:        id,
+		Name:      id,
+		Members:   map[string][]string{hex.Enc(creator): {Admin}},
+		CreatedAt: createdAt,
+	}
+}
+
+// Clone returns a deep copy of the group.
+func (g *Group) Clone() (c *Group) {
+	c = &Group{}
+	*c = *g
+	c.Members = make(map[string][]string, len(g.Members))
+	for pk, roles := range g.Members {
+		c.Members[pk] = slices.Clone(roles)
+	}
+	c.Invites = slices.Clone(g.Invites)
+	return
+}
+
+// GetId returns the group id from the `h` tag of an event, or an empty string if there is none.
+func GetId(ev *event.T) (id string) {
+	if ev == nil || ev.Tags == nil {
+		return
+	}
+	if t := ev.Tags.GetFirst(tag.New("h")); t != nil && t.Len() >= 2 {
+		id = string(t.Value())
+	}
+	return
+}
+
+// IsMember returns true if the pubkey is a member of the group.
+func (g *Group) IsMember(pubkey []byte) (is bool) {
+	if len(pubkey) == 0 {
+		return
+	}
+	_, is = g.Members[hex.Enc(pubkey)]
+	return
+}
+
+// HasRole returns true if the pubkey is a member of the group with the given role.
+func (g *Group) HasRole(pubkey []byte, role string) bool {
+	if len(pubkey) == 0 {
+		return false
+	}
+	return slices.Contains(g.Members[hex.Enc(pubkey)], role)
+}
+
+// CanModerate returns true if the pubkey may perform the moderation action of the given kind.
+func (g *Group) CanModerate(pubkey []byte, k *kind.T) bool {
+	if g.HasRole(pubkey, Admin) {
+		return true
+	}
+	if !g.HasRole(pubkey, Moderator) {
+		return false
+	}
+	return k.Equal(kind.GroupRemoveUser) || k.Equal(kind.GroupDeleteEvent) ||
+		k.Equal(kind.GroupCreateInvite)
+}
+
+// Apply changes the state of the group according to a moderation event. Removal of events and
+// of the group itself are the responsibility of the caller, as they concern the event store.
+func (g *Group) Apply(ev *event.T) (err error) {
+	switch {
+	case ev.Kind.Equal(kind.GroupPutUser):
+		var n int
+		for _, t := range ev.Tags.GetAll(tag.New("p")).ToSliceOfTags() {
+			var pk []byte
+			if pk, err = decodePubkey(t.Value()); err != nil {
+				return
+			}
+			var roles []string
+			for _, r := range t.ToStringSlice()[2:] {
+				if _, ok := Roles[r]; !ok {
+					return errorf.E("unknown role '%s'", r)
+				}
+				roles = append(roles, r)
+			}
+			g.Members[hex.Enc(pk)] = roles
+			n++
+		}
+		if n == 0 {
+			return errorf.E("no users to add in put-user event")
+		}
+	case ev.Kind.Equal(kind.GroupRemoveUser):
+		var n int
+		for _, t := range ev.Tags.GetAll(tag.New("p")).ToSliceOfTags() {
+			var pk []byte
+			if pk, err = decodePubkey(t.Value()); err != nil {
+				return
+			}
+			if g.HasRole(pk, Admin) && g.admins() == 1 {
+				return errorf.E("cannot remove the last admin of a group")
+			}
+			delete(g.Members, hex.Enc(pk))
+			n++
+		}
+		if n == 0 {
+			return errorf.E("no users to remove in remove-user event")
+		}
+	case ev.Kind.Equal(kind.GroupEditMetadata):
+		for _, t := range ev.Tags.ToSliceOfTags() {
+			switch string(t.Key()) {
+			case "name":
+				g.Name = string(t.Value())
+			case "picture":
+				g.Picture = string(t.Value())
+			case "about":
+				g.About = string(t.Value())
+			case "public":
+				g.Private = false
+			case "private":
+				g.Private = true
+			case "open":
+				g.Closed = false
+			case "closed":
+				g.Closed = true
+			}
+		}
+	case ev.Kind.Equal(kind.GroupCreateInvite):
+		var n int
+		for _, t := range ev.Tags.GetAll(tag.New("code")).ToSliceOfTags() {
+			if len(t.Value()) == 0 {
+				continue
+			}
+			if !slices.Contains(g.Invites, string(t.Value())) {
+				g.Invites = append(g.Invites, string(t.Value()))
+			}
+			n++
+		}
+		if n == 0 {
+			return errorf.E("no code in create-invite event")
+		}
+	case ev.Kind.Equal(kind.GroupDeleteEvent), ev.Kind.Equal(kind.GroupDelete):
+	default:
+		return errorf.E("kind %d is not a supported group moderation action", ev.Kind.K)
+	}
+	return
+}
+
+// Join processes a join request, returning true if the author was added to the group. Open
+// groups admit anyone, closed groups require an invite code, which is used up.
+func (g *Group) Join(ev *event.T) (joined bool) {
+	if g.IsMember(ev.Pubkey) {
+		return
+	}
+	if g.Closed {
+		code := ev.Tags.GetFirst(tag.New("code"))
+		if code == nil || code.Len() < 2 {
+			return
+		}
+		i := slices.Index(g.Invites, string(code.Value()))
+		if i < 0 {
+			return
+		}
+		g.Invites = slices.Delete(g.Invites, i, i+1)
+	}
+	g.Members[hex.Enc(ev.Pubkey)] = nil
+	return true
+}
+
+// Leave processes a leave request, returning true if the author was removed from the group.
+// The last admin may not leave a group.
+func (g *Group) Leave(ev *event.T) (left bool) {
+	if !g.IsMember(ev.Pubkey) ||
+		(g.HasRole(ev.Pubkey, Admin) && g.admins() == 1) {
+		return
+	}
+	delete(g.Members, hex.Enc(ev.Pubkey))
+	return true
+}
+
+// admins returns the number of admins of the group.
+func (g *Group) admins() (n int) {
+	for _, roles := range g.Members {
+		if slices.Contains(roles, Admin) {
+			n++
+		}
+	}
+	return
+}
+
+// Metadata generates the unsigned GroupMetadata, GroupAdmins, GroupMembers and GroupRoles events
+// describing the group, to be signed by the relay.
+func (g *Group) Metadata() (evs []*event.T) {
+	now := timestamp.Now()
+	meta := tags.New(tag.New("d", g.Id), tag.New("name", g.Name))
+	if g.Picture != "" {
+		meta = meta.AppendTags(tag.New("picture", g.Picture))
+	}
+	if g.About != "" {
+		meta = meta.AppendTags(tag.New("about", g.About))
+	}
+	if g.Private {
+		meta = meta.AppendTags(tag.New("private"))
+	} else {
+		meta = meta.AppendTags(tag.New("public"))
+	}
+	if g.Closed {
+		meta = meta.AppendTags(tag.New("closed"))
+	} else {
+		meta = meta.AppendTags(tag.New("open"))
+	}
+	admins := tags.New(tag.New("d", g.Id))
+	members := tags.New(tag.New("d", g.Id))
+	for _, pk := range g.pubkeys() {
+		members = members.AppendTags(tag.New("p", pk))
+		if roles := g.Members[pk]; len(roles) > 0 {
+			admins = admins.AppendTags(tag.New(append([]string{"p", pk}, roles...)...))
+		}
+	}
+	roles := tags.New(tag.New("d", g.Id))
+	for _, r := range []string{Admin, Moderator} {
+		roles = roles.AppendTags(tag.New("role", r, Roles[r]))
+	}
+	for _, e := range []struct {
+		k *kind.T
+		t *tags.T
+	}{
+		{kind.GroupMetadata, meta},
+		{kind.GroupAdmins, admins},
+		{kind.GroupMembers, members},
+		{kind.GroupRoles, roles},
+	} {
+		evs = append(evs, &event.T{CreatedAt: now, Kind: e.k, Tags: e.t})
+	}
+	return
+}
+
+// pubkeys returns the hex pubkeys of the members in sorted order, so the metadata is stable.
+func (g *Group) pubkeys() (pks []string) {
+	for pk := range g.Members {
+		pks = append(pks, pk)
+	}
+	sort.Strings(pks)
+	return
+}
+
+// decodePubkey decodes a hex pubkey from a tag value.
+func decodePubkey(v []byte) (pk []byte, err error) {
+	if pk, err = hex.Dec(string(v)); err != nil || len(pk) != schnorr.PubKeyBytesLen {
+		return nil, errorf.E("invalid pubkey '%s' in p tag", v)
+	}
+	return
+}
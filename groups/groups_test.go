@@ -0,0 +1,84 @@
+package groups
+
+import (
+	"testing"
+
+	"lukechampine.com/frand"
+
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+func makeEvent(k *kind.T, author []byte, t ...*tag.T) *event.T {
+	return &event.T{
+		Pubkey:    author,
+		CreatedAt: timestamp.Now(),
+		Kind:      k,
+		Tags:      tags.New(append([]*tag.T{tag.New("h", "test")}, t...)...),
+	}
+}
+
+func TestModeration(t *testing.T) {
+	admin, mod, user := frand.Bytes(32), frand.Bytes(32), frand.Bytes(32)
+	g := New("test", admin, timestamp.Now().I64())
+	if GetId(makeEvent(kind.GroupChatMessage, user)) != "test" {
+		t.Fatal("group id not found in h tag")
+	}
+	if !g.IsMember(admin) || !g.HasRole(admin, Admin) || g.IsMember(user) {
+		t.Fatal("new group should only have its creator as admin")
+	}
+	if err := g.Apply(makeEvent(kind.GroupPutUser, admin,
+		tag.New("p", hex.Enc(mod), Moderator))); err != nil {
+		t.Fatal(err)
+	}
+	if !g.CanModerate(mod, kind.GroupRemoveUser) || g.CanModerate(mod, kind.GroupPutUser) {
+		t.Fatal("moderator permissions incorrect")
+	}
+	if err := g.Apply(makeEvent(kind.GroupPutUser, admin,
+		tag.New("p", hex.Enc(user), "superuser"))); err == nil {
+		t.Fatal("unknown role should be rejected")
+	}
+	if err := g.Apply(makeEvent(kind.GroupRemoveUser, mod,
+		tag.New("p", hex.Enc(admin)))); err == nil {
+		t.Fatal("removing the last admin should fail")
+	}
+	if err := g.Apply(makeEvent(kind.GroupEditMetadata, admin,
+		tag.New("name", "Test"), tag.New("private"), tag.New("closed"))); err != nil {
+		t.Fatal(err)
+	}
+	if g.Name != "Test" || !g.Private || !g.Closed {
+		t.Fatal("metadata not applied")
+	}
+	if len(g.Metadata()) != 4 {
+		t.Fatal("expected 4 metadata events")
+	}
+}
+
+func TestJoinLeave(t *testing.T) {
+	admin, user := frand.Bytes(32), frand.Bytes(32)
+	g := New("test", admin, timestamp.Now().I64())
+	g.Closed = true
+	if g.Join(makeEvent(kind.GroupJoinRequest, user)) {
+		t.Fatal("closed group should not admit without invite")
+	}
+	if err := g.Apply(makeEvent(kind.GroupCreateInvite, admin,
+		tag.New("code", "abc"))); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Join(makeEvent(kind.GroupJoinRequest, user, tag.New("code", "abc"))) {
+		t.Fatal("invite code should admit user")
+	}
+	if len(g.Invites) != 0 {
+		t.Fatal("invite code should be used up")
+	}
+	if g.Leave(makeEvent(kind.GroupLeaveRequest, admin)) {
+		t.Fatal("last admin should not be able to leave")
+	}
+	if !g.Leave(makeEvent(kind.GroupLeaveRequest, user)) || g.IsMember(user) {
+		t.Fatal("user should have left")
+	}
+}
@@ -65,8 +65,13 @@ func (k *T) Equal(k2 *T) bool {
 	return k.K == k2.K
 }
 
+// Privileged are the kinds that are only readable by the author and the pubkeys in the p tags
+// of the event, or in the case of gift wraps, only the p tag recipients.
 var Privileged = []*T{
 	EncryptedDirectMessage,
+	Seal,
+	PrivateDirectMessage,
+	FileMessage,
 	GiftWrap,
 	GiftWrapWithKind4,
 	JWTBinding,
@@ -84,6 +89,22 @@ func (k *T) IsPrivileged() (is bool) {
 	return
 }
 
+// IsGiftWrap returns true if the kind is a nip-59 gift wrap. The author of a gift wrap is a
+// random one-time key, so only the p tag recipient is party to it.
+func (k *T) IsGiftWrap() bool { return k.Equal(GiftWrap) || k.Equal(GiftWrapWithKind4) }
+
+// IsGroupModeration returns true if the kind is one of the nip-29 moderation actions, which may
+// only be performed by group admins.
+func (k *T) IsGroupModeration() bool {
+	return k != nil && k.K >= GroupPutUser.K && k.K <= GroupModerationEnd.K
+}
+
+// IsGroupMetadata returns true if the kind is one of the nip-29 group state events that are
+// generated and signed by the relay.
+func (k *T) IsGroupMetadata() bool {
+	return k != nil && k.K >= GroupMetadata.K && k.K <= GroupRoles.K
+}
+
 // Marshal renders the kind.T into bytes containing the ASCII string form of the kind number.
 func (k *T) Marshal(dst []byte) (b []byte) { return ints.New(k.ToU64()).Marshal(dst) }
 
@@ -176,6 +197,12 @@ var (
 	Reaction = &T{7}
 	// BadgeAward is an event type
 	BadgeAward = &T{8}
+	// GroupChatMessage is a nip-29 chat message posted in a relay based group.
+	GroupChatMessage = &T{9}
+	// GroupThread is a nip-29 thread root posted in a relay based group.
+	GroupThread = &T{11}
+	// GroupReply is a nip-29 reply to a GroupThread.
+	GroupReply = &T{12}
 	// Seal is an event that wraps a PrivateDirectMessage and is placed inside a GiftWrap or
 	// GiftWrapWithKind4
 	Seal = &T{13}
@@ -187,6 +214,9 @@ var (
 	// by the client, its distinctive feature is the "expiration" tag which indicates a time
 	// after which the marking expires
 	ReadReceipt = &T{15}
+	// FileMessage is a nip-17 encrypted file message, which like PrivateDirectMessage only
+	// should appear inside a Seal in a GiftWrap. It shares its number with ReadReceipt.
+	FileMessage = &T{15}
 	// GenericRepost is an event type that...
 	GenericRepost = &T{16}
 	// ChannelCreation is an event type that...
@@ -230,7 +260,29 @@ var (
 	JobResultStart        = &T{6000}
 	JobResultEnd          = &T{6999}
 	JobFeedback           = &T{7000}
-	ZapGoal               = &T{9041}
+	// GroupPutUser is a nip-29 moderation event that adds a user to a group with optional
+	// roles.
+	GroupPutUser = &T{9000}
+	// GroupRemoveUser is a nip-29 moderation event that removes a user from a group.
+	GroupRemoveUser = &T{9001}
+	// GroupEditMetadata is a nip-29 moderation event that changes the name, picture, about and
+	// the public/private and open/closed status of a group.
+	GroupEditMetadata = &T{9002}
+	// GroupDeleteEvent is a nip-29 moderation event that removes an event from a group.
+	GroupDeleteEvent = &T{9005}
+	// GroupCreate is a nip-29 request to create a new group.
+	GroupCreate = &T{9007}
+	// GroupDelete is a nip-29 moderation event that deletes a group.
+	GroupDelete = &T{9008}
+	// GroupCreateInvite is a nip-29 moderation event that creates an invite code.
+	GroupCreateInvite = &T{9009}
+	// GroupModerationEnd is the last of the range of nip-29 moderation kinds.
+	GroupModerationEnd = &T{9020}
+	// GroupJoinRequest is a nip-29 request from a user to join a group.
+	GroupJoinRequest = &T{9021}
+	// GroupLeaveRequest is a nip-29 request from a user to leave a group.
+	GroupLeaveRequest = &T{9022}
+	ZapGoal           = &T{9041}
 	// ZapRequest is an event type that...
 	ZapRequest = &T{9734}
 	// Zap is an event type that...
@@ -322,7 +374,15 @@ var (
 	// WaveLakeTrack which has no spec and uses malformed tags
 	WaveLakeTrack       = &T{32123}
 	CommunityDefinition = &T{34550}
-	ACLEvent            = &T{39998}
+	// GroupMetadata is the nip-29 group metadata, signed by the relay.
+	GroupMetadata = &T{39000}
+	// GroupAdmins is the nip-29 list of group admins and their roles, signed by the relay.
+	GroupAdmins = &T{39001}
+	// GroupMembers is the nip-29 list of group members, signed by the relay.
+	GroupMembers = &T{39002}
+	// GroupRoles is the nip-29 list of roles supported by a group, signed by the relay.
+	GroupRoles = &T{39003}
+	ACLEvent   = &T{39998}
 	// ParameterizedReplaceableEnd is an event type that...
 	ParameterizedReplaceableEnd = &T{40000}
 )
@@ -338,6 +398,9 @@ var Map = map[uint16]string{
 	Repost.K:                      "Repost",
 	Reaction.K:                    "Reaction",
 	BadgeAward.K:                  "BadgeAward",
+	GroupChatMessage.K:            "GroupChatMessage",
+	GroupThread.K:                 "GroupThread",
+	GroupReply.K:                  "GroupReply",
 	ReadReceipt.K:                 "ReadReceipt",
 	GenericRepost.K:               "GenericRepost",
 	ChannelCreation.K:             "ChannelCreation",
@@ -359,6 +422,15 @@ var Map = map[uint16]string{
 	JobResultStart.K:              "JobResultStart",
 	JobResultEnd.K:                "JobResultEnd",
 	JobFeedback.K:                 "JobFeedback",
+	GroupPutUser.K:                "GroupPutUser",
+	GroupRemoveUser.K:             "GroupRemoveUser",
+	GroupEditMetadata.K:           "GroupEditMetadata",
+	GroupDeleteEvent.K:            "GroupDeleteEvent",
+	GroupCreate.K:                 "GroupCreate",
+	GroupDelete.K:                 "GroupDelete",
+	GroupCreateInvite.K:           "GroupCreateInvite",
+	GroupJoinRequest.K:            "GroupJoinRequest",
+	GroupLeaveRequest.K:           "GroupLeaveRequest",
 	ZapGoal.K:                     "ZapGoal",
 	ZapRequest.K:                  "ZapRequest",
 	Zap.K:                         "Zap",
@@ -410,4 +482,8 @@ var Map = map[uint16]string{
 	HandlerRecommendation.K:       "HandlerRecommendation",
 	HandlerInformation.K:          "HandlerInformation",
 	CommunityDefinition.K:         "CommunityDefinition",
+	GroupMetadata.K:               "GroupMetadata",
+	GroupAdmins.K:                 "GroupAdmins",
+	GroupMembers.K:                "GroupMembers",
+	GroupRoles.K:                  "GroupRoles",
 }
@@ -35,3 +35,20 @@ func TestMarshalUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestIsPrivileged(t *testing.T) {
+	for _, k := range []*T{EncryptedDirectMessage, Seal, PrivateDirectMessage, FileMessage,
+		GiftWrap, GiftWrapWithKind4} {
+		if !k.IsPrivileged() {
+			t.Fatalf("kind %d should be privileged", k.K)
+		}
+	}
+	for _, k := range []*T{TextNote, ProfileMetadata, FollowList} {
+		if k.IsPrivileged() {
+			t.Fatalf("kind %d should not be privileged", k.K)
+		}
+	}
+	if !GiftWrap.IsGiftWrap() || Seal.IsGiftWrap() {
+		t.Fatal("gift wrap kinds not identified correctly")
+	}
+}
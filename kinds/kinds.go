@@ -41,9 +41,10 @@ func (k *T) Len() (l int) {
 // Less returns which of two elements of a kinds.T is lower.
 func (k *T) Less(i, j int) bool { return k.K[i].K < k.K[j].K }
 
-// Swap switches the position of two kinds.T elements.
+// Swap switches the position of two kinds.T elements. The kinds themselves are not changed, as
+// they may be shared, such as the kind variables of the kind package.
 func (k *T) Swap(i, j int) {
-	k.K[i].K, k.K[j].K = k.K[j].K, k.K[i].K
+	k.K[i], k.K[j] = k.K[j], k.K[i]
 }
 
 // ToUint16 returns a []uint16 version of the kinds.T.
@@ -1,6 +1,7 @@
 package kinds
 
 import (
+	"sort"
 	"testing"
 
 	"lukechampine.com/frand"
@@ -34,3 +35,15 @@ func TestUnmarshalKindsArray(t *testing.T) {
 		}
 	}
 }
+
+func TestSortKeepsKinds(t *testing.T) {
+	wrap, note := kind.New(uint16(1059)), kind.New(uint16(1))
+	k := New(wrap, note)
+	sort.Sort(k)
+	if k.K[0] != note || k.K[1] != wrap {
+		t.Fatalf("kinds not sorted: %v", k.ToUint16())
+	}
+	if wrap.K != 1059 || note.K != 1 {
+		t.Fatalf("sorting changed the kinds to %d and %d", wrap.K, note.K)
+	}
+}
@@ -244,19 +244,19 @@ func (b *Backend) SaveEvent(c context.T, ev *event.T) (err error) {
 
 // Import events to the layer2, if the events come up in searches they will be propagated down
 // to the layer1.
-func (b *Backend) Import(r io.Reader) {
+func (b *Backend) Import(r io.Reader, opts *store.ImportOptions) (rep *store.ImportReport) {
 	// we import up to the L2 directly, demanded data will be fetched from it by
 	// later queries.
-	b.L2.Import(r)
+	return b.L2.Import(r, opts)
 }
 
 // Export from the layer2, which is assumed to be the most authoritative (and large) store of
 // events available to the relay.
-func (b *Backend) Export(c context.T, w io.Writer, pubkeys ...[]byte) {
+func (b *Backend) Export(c context.T, w io.Writer, opts *store.ExportOptions) (err error) {
 	// export only from the L2 as it is considered to be the authoritative event
 	// store of the two, and this is generally an administrative or infrequent action
 	// and latency will not matter as it usually will be a big bulky download.
-	b.L2.Export(c, w, pubkeys...)
+	return b.L2.Export(c, w, opts)
 }
 
 // Sync triggers both layer1 and layer2 to flush their buffers and store any events in caches.
@@ -6,23 +6,31 @@ import (
 	"net/http/httputil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/adrg/xdg"
 
+	"relay.mleku.dev/bech32encoding"
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/config"
 	"relay.mleku.dev/context"
+	"relay.mleku.dev/errorf"
 	"relay.mleku.dev/gui/gui"
+	"relay.mleku.dev/hex"
 	"relay.mleku.dev/interrupt"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/lol"
 	"relay.mleku.dev/openapi"
+	"relay.mleku.dev/p256k"
 	"relay.mleku.dev/ratel"
 	"relay.mleku.dev/relay"
 	"relay.mleku.dev/servemux"
+	"relay.mleku.dev/signer"
 	"relay.mleku.dev/socketapi"
+	"relay.mleku.dev/store"
 	"relay.mleku.dev/units"
 	"relay.mleku.dev/version"
 )
@@ -33,33 +41,66 @@ func main() {
 	wg := &sync.WaitGroup{}
 	c, cancel := context.Cancel(context.Bg())
 	interrupt.AddHandler(func() { cancel() })
-	storage := ratel.New(
-		ratel.BackendParams{
-			Ctx:            c,
-			WG:             wg,
-			BlockCacheSize: 250 * units.Mb,
-			LogLevel:       lol.Info,
-			MaxLimit:       ratel.DefaultMaxLimit,
-			UseCompact:     false,
-			Compression:    "zstd",
-		},
-	)
+	params := ratel.BackendParams{
+		Ctx:            c,
+		WG:             wg,
+		BlockCacheSize: 250 * units.Mb,
+		LogLevel:       lol.Info,
+		MaxLimit:       ratel.DefaultMaxLimit,
+		UseCompact:     false,
+		Compression:    "zstd",
+		MigrateDryRun:  cfg.MigrateDryRun,
+		MigrateBackup:  cfg.MigrateBackup,
+		ZstdDictionary: cfg.ZstdDictionary,
+		ReadOnly:       cfg.ReadOnly,
+	}
+	storage := ratel.New(params)
 	var err error
-	if err = storage.Init(filepath.Join(xdg.DataHome, cfg.AppName)); chk.E(err) {
+	dataDir := filepath.Join(xdg.DataHome, cfg.AppName)
+	if cfg.ReadOnly && cfg.ReplicaPath != "" {
+		dataDir = cfg.ReplicaPath
+	}
+	if len(os.Args) >= 3 && os.Args[1] == "restore" {
+		restore(storage, dataDir, os.Args[2:])
+	}
+	if err = storage.Init(dataDir); errors.Is(err, ratel.ErrDryRun) {
+		os.Exit(0)
+	} else if chk.E(err) {
 		os.Exit(1)
 	}
+	if len(os.Args) >= 2 && os.Args[1] == "fsck" {
+		fsck(c, storage, len(os.Args) == 3 && os.Args[2] == "repair")
+	}
 	serveMux := servemux.New()
 	s := &relay.Server{
-		Name:     cfg.AppName,
-		Ctx:      c,
-		Cancel:   cancel,
-		WG:       wg,
-		Mux:      serveMux,
-		Address:  net.JoinHostPort(cfg.Listen, strconv.Itoa(cfg.Port)),
-		Store:    storage,
-		MaxLimit: ratel.DefaultMaxLimit,
+		Name:             cfg.AppName,
+		Ctx:              c,
+		Cancel:           cancel,
+		WG:               wg,
+		Mux:              serveMux,
+		Address:          net.JoinHostPort(cfg.Listen, strconv.Itoa(cfg.Port)),
+		Store:            storage,
+		MaxLimit:         ratel.DefaultMaxLimit,
+		ReadOnly:         cfg.ReadOnly,
+		IdentityPassword: cfg.IdentityPassword,
+	}
+	if cfg.AuditorKey != "" {
+		if s.Auditor, err = auditor(cfg.AuditorKey); chk.E(err) {
+			os.Exit(1)
+		}
+	}
+	if cfg.ReadOnly && cfg.ReplicaRefresh > 0 {
+		go s.RunReplica(cfg.ReplicaRefresh, replicaRefresh(params, dataDir))
+	}
+	if len(cfg.Tenants) > 0 {
+		if cfg.ReadOnly {
+			log.W.Ln("virtual relays are not served by a read only replica")
+		} else if s.Tenants, err = tenants(c, wg, params, dataDir, cfg); chk.E(err) {
+			os.Exit(1)
+		}
 	}
 	openapi.New(s, cfg.AppName, version.V, version.Description, "/api", serveMux)
+	serveMux.HandleFunc("/.well-known/nostr.json", s.HandleNIP05)
 	socketapi.New(s, "/{$}", serveMux)
 	gui.New("/ui", serveMux)
 	interrupt.AddHandler(func() { s.Shutdown() })
@@ -70,3 +111,124 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// validTenant matches the names of virtual relays, which are also the names of the directories
+// of their databases.
+var validTenant = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// tenants opens the databases of the virtual relays in the tenants directory of the data
+// directory, and sets up their APIs, each as name=host or name=/path.
+func tenants(c context.T, wg *sync.WaitGroup, params ratel.BackendParams, dataDir string,
+	cfg *config.C) (ts []*relay.Server, err error) {
+
+	for _, spec := range cfg.Tenants {
+		name, at, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		at = strings.TrimSuffix(at, "/")
+		if !ok || !validTenant.MatchString(name) || at == "" {
+			err = errorf.E("invalid tenant '%s', must be name=host or name=/path", spec)
+			return
+		}
+		mux := servemux.New()
+		tc, cancel := context.Cancel(c)
+		t := &relay.Server{
+			Name:             name,
+			Ctx:              tc,
+			Cancel:           cancel,
+			WG:               wg,
+			Mux:              mux,
+			MaxLimit:         ratel.DefaultMaxLimit,
+			IdentityPassword: cfg.IdentityPassword,
+		}
+		if strings.HasPrefix(at, "/") {
+			t.Path = at
+		} else {
+			t.Host = at
+		}
+		sto := ratel.New(params)
+		if err = sto.Init(filepath.Join(dataDir, "tenants", name)); chk.E(err) {
+			return
+		}
+		t.Store = sto
+		openapi.New(t, name, version.V, version.Description, t.Path+"/api", mux)
+		if t.Path != "" {
+			socketapi.New(t, t.Path, mux)
+		} else {
+			// nip-05 names are served from the root of the domain
+			mux.HandleFunc("/.well-known/nostr.json", t.HandleNIP05)
+			socketapi.New(t, "/{$}", mux)
+		}
+		ts = append(ts, t)
+	}
+	return
+}
+
+// replicaRefresh returns a function that opens the snapshot at dataDir as a new read only
+// store when it has changed since it was last opened.
+func replicaRefresh(params ratel.BackendParams, dataDir string) func() (store.I, error) {
+	var err error
+	var opened string
+	if opened, err = ratel.SnapshotId(dataDir); chk.E(err) {
+	}
+	return func() (sto store.I, err error) {
+		var id string
+		if id, err = ratel.SnapshotId(dataDir); err != nil || id == opened {
+			return
+		}
+		// the replaced store waits for its own queries when it is closed
+		params.WG = &sync.WaitGroup{}
+		snapshot := ratel.New(params)
+		if err = snapshot.Init(dataDir); err != nil {
+			return
+		}
+		opened = id
+		return snapshot, nil
+	}
+}
+
+// auditor returns the signer of the audit log entries for a secret key in hex or nsec.
+func auditor(key string) (sign signer.I, err error) {
+	var sec []byte
+	if strings.HasPrefix(key, "nsec") {
+		if sec, err = bech32encoding.NsecToBytes([]byte(key)); err != nil {
+			return
+		}
+	} else if sec, err = hex.Dec(key); err != nil {
+		return
+	}
+	s := &p256k.Signer{}
+	if err = s.InitSec(sec); err != nil {
+		return
+	}
+	log.I.F("audit log entries are signed by %0x", s.Pub())
+	return s, nil
+}
+
+// fsck checks the consistency of the event store, and exits with an error if problems were
+// found that were not repaired.
+func fsck(c context.T, storage *ratel.T, repair bool) {
+	var err error
+	var rep *store.FsckReport
+	rep, err = storage.Fsck(c, os.Stdout, repair)
+	chk.E(storage.Close())
+	if chk.E(err) || (rep.Problems() > 0 && !repair) {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// restore loads the backups in a backup directory into the empty data directory, up to the
+// unix timestamp after the directory if one is given.
+func restore(storage *ratel.T, dataDir string, args []string) {
+	var err error
+	var until int64
+	if len(args) > 1 {
+		if until, err = strconv.ParseInt(args[1], 10, 64); chk.E(err) {
+			os.Exit(1)
+		}
+	}
+	if err = storage.Restore(dataDir, args[0], until); chk.E(err) {
+		os.Exit(1)
+	}
+	chk.E(storage.Close())
+	os.Exit(0)
+}
@@ -0,0 +1,229 @@
+// Package moderation implements the handling of NIP-56 reports, the cases they open against
+// the events and users they report, and the actions moderators take on them.
+//
+// A report (kind 1984) reports a user with a p tag, or events of a user with e tags and a p tag
+// for their author, and the type of the report is the third field of the tag. Each target has a
+// case collecting the reports about it, with a score summing the weight of each reporter, which
+// hides the target once it crosses a threshold, until a moderator decides the case.
+//
+// Hidden events and users are not deleted, their events are kept and served to their authors
+// only, so moderators can hide them instead of removing them and undo it later.
+package moderation
+
+import (
+	"slices"
+
+	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/sha256"
+)
+
+const (
+	// TargetEvent is a case about an event.
+	TargetEvent = "event"
+	// TargetPubkey is a case about a user.
+	TargetPubkey = "pubkey"
+)
+
+const (
+	// Open is a case that no moderator has decided.
+	Open = "open"
+	// Approved is a case a moderator decided the target of is acceptable, it is not hidden by
+	// more reports.
+	Approved = "approved"
+	// Hidden is a case a moderator hid the target of, it is kept but not served to anyone but
+	// its author, until the case is decided otherwise.
+	Hidden = "hidden"
+	// Removed is a case a moderator removed the target of, the reported event or all the events
+	// of the reported user are deleted.
+	Removed = "removed"
+	// Banned is a case a moderator removed the target of and banned its author from the relay.
+	Banned = "banned"
+)
+
+// Actions are the statuses moderators can decide a case with, by the name of the action.
+var Actions = map[string]string{
+	"approve": Approved,
+	"hide":    Hidden,
+	"remove":  Removed,
+	"ban":     Banned,
+}
+
+// Types are the report types defined by NIP-56.
+var Types = []string{"nudity", "malware", "profanity", "illegal", "spam", "impersonation",
+	"other"}
+
+// Target is an event or user reported by a report.
+type Target struct {
+	Kind string
+	// Id is the event id or pubkey of the target.
+	Id []byte
+	// Pubkey is the author of a reported event, if the report names them.
+	Pubkey []byte
+	// Type is the report type, other if it is not one of Types.
+	Type string
+}
+
+// Report is a report about the target of a case.
+type Report struct {
+	Id        string `json:"id"`
+	Reporter  string `json:"reporter"`
+	Type      string `json:"type"`
+	Content   string `json:"content,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Case is the reports about an event or user, and the decision of the moderators about it.
+type Case struct {
+	Kind string `json:"kind"`
+	// Target is the hex encoded event id or pubkey the case is about.
+	Target string `json:"target"`
+	// Pubkey is the hex encoded author of a reported event, if it is known.
+	Pubkey  string   `json:"pubkey,omitempty"`
+	Reports []Report `json:"reports"`
+	// Score is the sum of the weights of the reporters.
+	Score float64 `json:"score"`
+	// Hidden is set when the score crosses the threshold while the case is open, and the target
+	// is not served to anyone but its author.
+	Hidden bool   `json:"hidden"`
+	Status string `json:"status"`
+	// Moderator is the hex encoded pubkey of the moderator who decided the case.
+	Moderator string `json:"moderator,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// Hide is an event, or all the events of a user, hidden from everyone but the author. The
+// events are kept, so hiding them can be undone.
+type Hide struct {
+	Kind string `json:"kind"`
+	// Target is the hex encoded event id or pubkey that is hidden.
+	Target string `json:"target"`
+	Reason string `json:"reason,omitempty"`
+	// Moderator is the hex encoded pubkey of the moderator who hid the target, empty if it was
+	// hidden by reports.
+	Moderator string `json:"moderator,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Ban is a user banned from publishing to the relay.
+type Ban struct {
+	Pubkey    string `json:"pubkey"`
+	Reason    string `json:"reason,omitempty"`
+	Moderator string `json:"moderator,omitempty"`
+	// Case is the target of the case the ban was decided in, if any.
+	Case      string `json:"case,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Targets returns the events and users a report is about. A report with e tags is about the
+// events, and the p tag names their author, otherwise it is about the users in its p tags.
+func Targets(ev *event.T) (ts []Target) {
+	if !ev.Kind.Equal(kind.Reporting) {
+		return
+	}
+	var ids, pubkeys []Target
+	for _, t := range ev.Tags.ToSliceOfTags() {
+		if t.Len() < 2 {
+			continue
+		}
+		var tt Target
+		var size int
+		switch string(t.Key()) {
+		case "e":
+			tt.Kind, size = TargetEvent, sha256.Size
+		case "p":
+			tt.Kind, size = TargetPubkey, schnorr.PubKeyBytesLen
+		default:
+			continue
+		}
+		var err error
+		if tt.Id, err = hex.Dec(string(t.Value())); err != nil || len(tt.Id) != size {
+			continue
+		}
+		tt.Type = "other"
+		if t.Len() > 2 && slices.Contains(Types, t.S(2)) {
+			tt.Type = t.S(2)
+		}
+		if tt.Kind == TargetEvent {
+			ids = append(ids, tt)
+		} else {
+			pubkeys = append(pubkeys, tt)
+		}
+	}
+	if len(ids) == 0 {
+		return pubkeys
+	}
+	for _, id := range ids {
+		if len(pubkeys) > 0 {
+			id.Pubkey = pubkeys[0].Id
+			if id.Type == "other" {
+				id.Type = pubkeys[0].Type
+			}
+		}
+		ts = append(ts, id)
+	}
+	return
+}
+
+// New creates an open case about a target.
+func New(t Target) (c *Case) {
+	c = &Case{Kind: t.Kind, Target: hex.Enc(t.Id), Status: Open}
+	if len(t.Pubkey) > 0 {
+		c.Pubkey = hex.Enc(t.Pubkey)
+	}
+	return
+}
+
+// Add adds a report to the case, replacing an older one by the same reporter, and returns false
+// if the case already has it or a newer one by the reporter.
+func (c *Case) Add(r Report) (added bool) {
+	for i := range c.Reports {
+		if c.Reports[i].Reporter != r.Reporter {
+			continue
+		}
+		if c.Reports[i].Id == r.Id || c.Reports[i].CreatedAt >= r.CreatedAt {
+			return false
+		}
+		c.Reports[i] = r
+		return true
+	}
+	c.Reports = append(c.Reports, r)
+	return true
+}
+
+// Weigh sums the weight of each reporter into the score, and hides an open case once the score
+// reaches the threshold. A case that was hidden stays hidden until it is decided.
+func (c *Case) Weigh(weight func(reporter []byte) float64, threshold float64) {
+	c.Score = 0
+	for _, r := range c.Reports {
+		pk, err := hex.Dec(r.Reporter)
+		if err != nil {
+			continue
+		}
+		c.Score += weight(pk)
+	}
+	if c.Status == Open && threshold > 0 && c.Score >= threshold {
+		c.Hidden = true
+	}
+}
+
+// Decide sets the status of the case as decided by a moderator. A decided case is only hidden
+// if the moderator hid it, otherwise its target is either acceptable or removed.
+func (c *Case) Decide(status, moderator, reason string, at int64) {
+	c.Status, c.Moderator, c.Reason, c.UpdatedAt = status, moderator, reason, at
+	c.Hidden = status == Hidden
+}
+
+// Author returns the pubkey a ban for the case applies to, the reported user or the author of
+// the reported event, nil if it is not known.
+func (c *Case) Author() (pubkey []byte) {
+	pk := c.Pubkey
+	if c.Kind == TargetPubkey {
+		pk = c.Target
+	}
+	pubkey, _ = hex.Dec(pk)
+	return
+}
@@ -0,0 +1,92 @@
+package moderation
+
+import (
+	"bytes"
+	"testing"
+
+	"lukechampine.com/frand"
+
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+func makeReport(reporter []byte, t ...*tag.T) *event.T {
+	return &event.T{
+		Id:        frand.Bytes(32),
+		Pubkey:    reporter,
+		CreatedAt: timestamp.Now(),
+		Kind:      kind.Reporting,
+		Tags:      tags.New(t...),
+	}
+}
+
+func TestTargets(t *testing.T) {
+	reporter, author, id := frand.Bytes(32), frand.Bytes(32), frand.Bytes(32)
+	ts := Targets(makeReport(reporter, tag.New("p", hex.Enc(author), "impersonation")))
+	if len(ts) != 1 || ts[0].Kind != TargetPubkey || !bytes.Equal(ts[0].Id, author) ||
+		ts[0].Type != "impersonation" {
+		t.Fatalf("expected a report of the user, got %+v", ts)
+	}
+	ts = Targets(makeReport(reporter, tag.New("e", hex.Enc(id), "spam"),
+		tag.New("p", hex.Enc(author)), tag.New("e", "nothex")))
+	if len(ts) != 1 || ts[0].Kind != TargetEvent || !bytes.Equal(ts[0].Id, id) ||
+		!bytes.Equal(ts[0].Pubkey, author) || ts[0].Type != "spam" {
+		t.Fatalf("expected a report of the event by its author, got %+v", ts)
+	}
+	ts = Targets(makeReport(reporter, tag.New("e", hex.Enc(id), "whatever")))
+	if len(ts) != 1 || ts[0].Type != "other" || ts[0].Pubkey != nil {
+		t.Fatalf("expected an event report of type other, got %+v", ts)
+	}
+}
+
+func TestCase(t *testing.T) {
+	owner, guest := frand.Bytes(32), frand.Bytes(32)
+	weight := func(pk []byte) float64 {
+		if bytes.Equal(pk, owner) {
+			return 3
+		}
+		return 1
+	}
+	c := New(Target{Kind: TargetPubkey, Id: frand.Bytes(32)})
+	r := Report{Id: "a", Reporter: hex.Enc(guest), Type: "spam", CreatedAt: 10}
+	if !c.Add(r) || c.Add(r) {
+		t.Fatal("a report should only be added once")
+	}
+	if c.Add(Report{Id: "b", Reporter: hex.Enc(guest), CreatedAt: 5}) {
+		t.Fatal("an older report by the same reporter should not be added")
+	}
+	if !c.Add(Report{Id: "c", Reporter: hex.Enc(guest), CreatedAt: 20}) || len(c.Reports) != 1 {
+		t.Fatal("a newer report by the same reporter should replace the older one")
+	}
+	c.Weigh(weight, 3)
+	if c.Score != 1 || c.Hidden {
+		t.Fatalf("expected score 1 and not hidden, got %v %v", c.Score, c.Hidden)
+	}
+	c.Add(Report{Id: "d", Reporter: hex.Enc(owner), CreatedAt: 20})
+	c.Weigh(weight, 3)
+	if c.Score != 4 || !c.Hidden {
+		t.Fatalf("expected score 4 and hidden, got %v %v", c.Score, c.Hidden)
+	}
+	c.Decide(Approved, hex.Enc(owner), "", 30)
+	c.Add(Report{Id: "e", Reporter: hex.Enc(frand.Bytes(32)), CreatedAt: 40})
+	c.Weigh(weight, 3)
+	if c.Hidden || c.Score != 5 {
+		t.Fatal("an approved case should not be hidden by more reports")
+	}
+	c.Decide(Hidden, hex.Enc(owner), "", 50)
+	if !c.Hidden {
+		t.Fatal("a case decided hidden should be hidden")
+	}
+	if !bytes.Equal(c.Author(), mustDec(c.Target)) {
+		t.Fatal("the author of a user case is the user")
+	}
+}
+
+func mustDec(s string) []byte {
+	b, _ := hex.Dec(s)
+	return b
+}
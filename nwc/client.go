@@ -0,0 +1,192 @@
+package nwc
+
+import (
+	"encoding/json"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/encryption"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/filters"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/signer"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+	"relay.mleku.dev/ws"
+)
+
+// RequestMarshaler is a request that can be encoded to send to a wallet service.
+type RequestMarshaler interface {
+	Requester
+	Marshal(dst []byte) (b []byte)
+}
+
+// Client sends requests to a wallet service over a wallet connection.
+type Client struct {
+	params       *ConnectionParams
+	walletPubkey []byte
+	sign         signer.I
+	// secret is the NIP-04 shared secret of the connection secret and the wallet pubkey.
+	secret []byte
+}
+
+// NewClient creates a client from a nostr+walletconnect:// URI.
+func NewClient(uri string) (cl *Client, err error) {
+	cl = &Client{}
+	if cl.params, err = ParseConnectionURI(uri); err != nil {
+		return
+	}
+	if cl.walletPubkey, err = hex.Dec(cl.params.WalletPubkey); chk.E(err) {
+		return
+	}
+	var sec []byte
+	if sec, err = hex.Dec(cl.params.Secret); chk.E(err) {
+		return
+	}
+	sign := &p256k.Signer{}
+	if err = sign.InitSec(sec); chk.E(err) {
+		return
+	}
+	cl.sign = sign
+	if cl.secret, err = encryption.ComputeSharedSecret(cl.params.WalletPubkey,
+		cl.params.Secret); chk.E(err) {
+		return
+	}
+	return
+}
+
+// Request sends a request to the wallet service and waits for its response, returning the
+// decrypted JSON of the response. The context should have a deadline, as wallets may never
+// answer.
+func (cl *Client) Request(c context.T, req RequestMarshaler) (res []byte, err error) {
+	var content []byte
+	if content, err = encryption.EncryptNip4(string(req.Marshal(nil)), cl.secret); chk.E(err) {
+		return
+	}
+	ev := &event.T{
+		CreatedAt: timestamp.Now(),
+		Kind:      kind.WalletRequest,
+		Tags:      tags.New(tag.New("p", cl.params.WalletPubkey)),
+		Content:   content,
+	}
+	if err = ev.Sign(cl.sign); chk.E(err) {
+		return
+	}
+	var relay *ws.Client
+	if relay, err = ws.RelayConnect(c, cl.params.Relays[0]); err != nil {
+		err = errorf.E("failed to connect to wallet relay %s: %w", cl.params.Relays[0], err)
+		return
+	}
+	defer relay.Close()
+	var sub *ws.Subscription
+	if sub, err = relay.Subscribe(c, filters.New(&filter.T{
+		Kinds:   kinds.New(kind.WalletResponse),
+		Authors: tag.New(cl.walletPubkey),
+		Tags:    tags.New(tag.New([]byte("#e"), ev.Id)),
+	})); err != nil {
+		return
+	}
+	defer sub.Unsub()
+	if err = relay.Publish(c, ev); err != nil {
+		err = errorf.E("failed to publish wallet request: %w", err)
+		return
+	}
+	select {
+	case <-c.Done():
+		err = errorf.E("no response from wallet: %w", c.Err())
+		return
+	case resp := <-sub.Events:
+		if resp == nil {
+			err = errorf.E("wallet response subscription closed")
+			return
+		}
+		if res, err = encryption.DecryptNip4(string(resp.Content), cl.secret); chk.E(err) {
+			return
+		}
+	}
+	return
+}
+
+// MakeInvoice asks the wallet service for an invoice for the amount.
+func (cl *Client) MakeInvoice(c context.T, amount Msat, description string,
+	expiry int) (li *LookupInvoice, err error) {
+
+	var res []byte
+	if res, err = cl.Request(c, NewMakeInvoiceRequest(amount, []byte(description), nil,
+		expiry)); err != nil {
+		return
+	}
+	return ParseInvoiceResponse(res)
+}
+
+// LookupInvoice asks the wallet service for the state of the invoice with the payment hash.
+func (cl *Client) LookupInvoice(c context.T, paymentHash []byte) (li *LookupInvoice,
+	err error) {
+
+	var res []byte
+	if res, err = cl.Request(c, NewLookupInvoiceRequest(paymentHash, nil)); err != nil {
+		return
+	}
+	return ParseInvoiceResponse(res)
+}
+
+// ParseInvoiceResponse decodes the JSON of a make_invoice or lookup_invoice response. If the
+// wallet returned an error it is returned as err.
+func ParseInvoiceResponse(b []byte) (li *LookupInvoice, err error) {
+	var resp struct {
+		ResultType string `json:"result_type"`
+		Error      *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Result *struct {
+			Type            string `json:"type"`
+			Invoice         string `json:"invoice"`
+			Description     string `json:"description"`
+			DescriptionHash string `json:"description_hash"`
+			Preimage        string `json:"preimage"`
+			PaymentHash     string `json:"payment_hash"`
+			Amount          uint64 `json:"amount"`
+			FeesPaid        uint64 `json:"fees_paid"`
+			CreatedAt       int64  `json:"created_at"`
+			ExpiresAt       int64  `json:"expires_at"`
+			SettledAt       int64  `json:"settled_at"`
+		} `json:"result"`
+	}
+	if err = json.Unmarshal(b, &resp); err != nil {
+		err = errorf.E("failed to decode wallet response: %w", err)
+		return
+	}
+	if resp.Error != nil {
+		err = errorf.E("wallet error %s: %s", resp.Error.Code, resp.Error.Message)
+		return
+	}
+	if resp.Result == nil {
+		err = errorf.E("wallet response has no result")
+		return
+	}
+	r := resp.Result
+	li = &LookupInvoice{
+		Response: Response{Type: []byte(resp.ResultType)},
+		InvoiceResponse: InvoiceResponse{
+			Type:            []byte(r.Type),
+			Invoice:         []byte(r.Invoice),
+			Description:     []byte(r.Description),
+			DescriptionHash: []byte(r.DescriptionHash),
+			Preimage:        []byte(r.Preimage),
+			PaymentHash:     []byte(r.PaymentHash),
+			Amount:          Msat(r.Amount),
+			FeesPaid:        Msat(r.FeesPaid),
+			CreatedAt:       r.CreatedAt,
+			ExpiresAt:       r.ExpiresAt,
+		},
+		SettledAt: r.SettledAt,
+	}
+	return
+}
@@ -0,0 +1,40 @@
+package nwc
+
+import (
+	"testing"
+)
+
+func TestParseConnectionURI(t *testing.T) {
+	uri := "nostr+walletconnect://b889ff5b1513b641e2a139f661a661364979c5beee91842f8f0ef42ab558e9d4" +
+		"?relay=wss%3A%2F%2Frelay.damus.io&secret=71a8c14c1407c113601079c4302dab36460f0ccd0ad506f1f2dc73b5100e4f3c"
+	p, err := ParseConnectionURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.WalletPubkey != "b889ff5b1513b641e2a139f661a661364979c5beee91842f8f0ef42ab558e9d4" ||
+		len(p.Relays) != 1 || p.Relays[0] != "wss://relay.damus.io" {
+		t.Fatalf("wrong connection params %#v", p)
+	}
+	if _, err = ParseConnectionURI("https://example.com"); err == nil {
+		t.Fatal("wrong scheme should fail")
+	}
+	if _, err = ParseConnectionURI(uri[:len(uri)-4]); err == nil {
+		t.Fatal("short secret should fail")
+	}
+}
+
+func TestParseInvoiceResponse(t *testing.T) {
+	li, err := ParseInvoiceResponse([]byte(`{"result_type":"lookup_invoice","result":{` +
+		`"type":"incoming","invoice":"lnbc210n1...","payment_hash":"abcd","amount":21000,` +
+		`"created_at":1700000000,"settled_at":1700000100}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(li.PaymentHash) != "abcd" || li.Amount != 21000 || li.SettledAt != 1700000100 {
+		t.Fatalf("wrong invoice %#v", li)
+	}
+	if _, err = ParseInvoiceResponse([]byte(`{"result_type":"lookup_invoice",` +
+		`"error":{"code":"NOT_FOUND","message":"no such invoice"}}`)); err == nil {
+		t.Fatal("wallet error should be returned")
+	}
+}
@@ -13,6 +13,3 @@ var Kinds = []*kind.T{
 
 type Server struct {
 }
-
-type Client struct {
-}
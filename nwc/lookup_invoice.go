@@ -1,5 +1,9 @@
 package nwc
 
+import (
+	"relay.mleku.dev/text"
+)
+
 type LookupInvoiceRequest struct {
 	Request
 	PaymentHash, Invoice []byte
@@ -24,3 +28,28 @@ type LookupInvoiceResponse struct {
 func NewLookupInvoiceResponse(resp LookupInvoice) LookupInvoiceResponse {
 	return LookupInvoiceResponse{Response{Type: Methods.LookupInvoice}, resp}
 }
+
+func (l LookupInvoiceRequest) Marshal(dst []byte) (b []byte) {
+	// open parentheses
+	dst = append(dst, '{')
+	// method
+	dst = text.JSONKey(dst, Keys.Method)
+	dst = text.Quote(dst, l.RequestType())
+	dst = append(dst, ',')
+	// Params
+	dst = text.JSONKey(dst, Keys.Params)
+	dst = append(dst, '{')
+	// PaymentHash or Invoice, one is required
+	if len(l.PaymentHash) > 0 {
+		dst = text.JSONKey(dst, Keys.PaymentHash)
+		dst = text.AppendQuote(dst, l.PaymentHash, text.Noop)
+	} else {
+		dst = text.JSONKey(dst, Keys.Invoice)
+		dst = text.AppendQuote(dst, l.Invoice, text.Noop)
+	}
+	// close parentheses
+	dst = append(dst, '}')
+	dst = append(dst, '}')
+	b = dst
+	return
+}
@@ -1,5 +1,10 @@
 package nwc
 
+import (
+	"relay.mleku.dev/ints"
+	"relay.mleku.dev/text"
+)
+
 type MakeInvoiceRequest struct {
 	Request
 	Amount          Msat
@@ -27,3 +32,41 @@ type MakeInvoiceResponse struct {
 func NewMakeInvoiceResponse(resp InvoiceResponse) MakeInvoiceResponse {
 	return MakeInvoiceResponse{Response{Type: Methods.MakeInvoice}, resp}
 }
+
+func (m MakeInvoiceRequest) Marshal(dst []byte) (b []byte) {
+	// open parentheses
+	dst = append(dst, '{')
+	// method
+	dst = text.JSONKey(dst, Keys.Method)
+	dst = text.Quote(dst, m.RequestType())
+	dst = append(dst, ',')
+	// Params
+	dst = text.JSONKey(dst, Keys.Params)
+	dst = append(dst, '{')
+	// Amount
+	dst = text.JSONKey(dst, Keys.Amount)
+	dst = m.Amount.Bytes(dst)
+	// Description - optional
+	if len(m.Description) > 0 {
+		dst = append(dst, ',')
+		dst = text.JSONKey(dst, Keys.Description)
+		dst = text.AppendQuote(dst, m.Description, text.NostrEscape)
+	}
+	// DescriptionHash - optional
+	if len(m.DescriptionHash) > 0 {
+		dst = append(dst, ',')
+		dst = text.JSONKey(dst, Keys.DescriptionHash)
+		dst = text.AppendQuote(dst, m.DescriptionHash, text.Noop)
+	}
+	// Expiry - optional
+	if m.Expiry > 0 {
+		dst = append(dst, ',')
+		dst = text.JSONKey(dst, Keys.Expiry)
+		dst = ints.New(m.Expiry).Marshal(dst)
+	}
+	// close parentheses
+	dst = append(dst, '}')
+	dst = append(dst, '}')
+	b = dst
+	return
+}
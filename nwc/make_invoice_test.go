@@ -0,0 +1,15 @@
+package nwc
+
+import (
+	"fmt"
+)
+
+func ExampleMakeInvoiceRequest_Marshal() {
+	mr := NewMakeInvoiceRequest(21000, []byte("relay \"admission\""), nil, 3600)
+	fmt.Printf("%s\n", mr.Marshal(nil))
+	lr := NewLookupInvoiceRequest([]byte("0123abcd"), nil)
+	fmt.Printf("%s\n", lr.Marshal(nil))
+	// Output:
+	// {"method":"make_invoice","params":{"amount":21000,"description":"relay \"admission\"","expiry":3600}}
+	// {"method":"lookup_invoice","params":{"payment_hash":"0123abcd"}}
+}
@@ -0,0 +1,57 @@
+package nwc
+
+import (
+	"net/url"
+
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/keys"
+)
+
+// ConnectionParams are the parameters of a wallet connection URI.
+type ConnectionParams struct {
+	// WalletPubkey is the hex encoded public key of the wallet service.
+	WalletPubkey string
+	// Relays are the relays the wallet service listens for requests on.
+	Relays []string
+	// Secret is the hex encoded secret key the client signs and encrypts requests with.
+	Secret string
+	// Lud16 is the lightning address of the wallet, if any.
+	Lud16 string
+}
+
+// ParseConnectionURI decodes a nostr+walletconnect:// URI.
+func ParseConnectionURI(uri string) (p *ConnectionParams, err error) {
+	var u *url.URL
+	if u, err = url.Parse(uri); err != nil {
+		err = errorf.E("invalid wallet connection uri: %w", err)
+		return
+	}
+	if u.Scheme != "nostr+walletconnect" && u.Scheme != "nostrwalletconnect" {
+		err = errorf.E("invalid wallet connection uri scheme '%s'", u.Scheme)
+		return
+	}
+	p = &ConnectionParams{
+		WalletPubkey: u.Host,
+		Relays:       u.Query()["relay"],
+		Secret:       u.Query().Get("secret"),
+		Lud16:        u.Query().Get("lud16"),
+	}
+	if p.WalletPubkey == "" {
+		// some wallets omit the // after the scheme.
+		p.WalletPubkey = u.Opaque
+	}
+	if !keys.IsValidPublicKey(p.WalletPubkey) {
+		err = errorf.E("invalid wallet pubkey '%s'", p.WalletPubkey)
+		return
+	}
+	if len(p.Relays) == 0 {
+		err = errorf.E("wallet connection uri has no relay")
+		return
+	}
+	if sec, e := hex.Dec(p.Secret); e != nil || len(sec) != 32 {
+		err = errorf.E("invalid wallet connection secret")
+		return
+	}
+	return
+}
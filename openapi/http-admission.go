@@ -0,0 +1,208 @@
+package openapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/admission"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/httpauth"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
+)
+
+// AdmissionTerms is the price of access to the relay.
+type AdmissionTerms struct {
+	Enabled bool `json:"enabled" doc:"relay requires payment for access"`
+	Fee     int  `json:"fee,omitempty" doc:"admission fee in sats"`
+	Days    int  `json:"days,omitempty" doc:"days of access the fee pays for"`
+}
+
+// AdmissionOutput is the price of access to the relay.
+type AdmissionOutput struct {
+	Body *AdmissionTerms
+}
+
+// AdmissionInvoiceInput is the parameters for the HTTP API method to request an admission
+// invoice.
+type AdmissionInvoiceInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// AdmissionInvoiceOutput is the invoice to pay for admission.
+type AdmissionInvoiceOutput struct {
+	Body *admission.Invoice
+}
+
+// AdmissionStatusInput is the parameters for the HTTP API method to get the membership of the
+// authenticated user.
+type AdmissionStatusInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// AdmissionStatusOutput is the membership of a user.
+type AdmissionStatusOutput struct {
+	Body *admission.Member
+}
+
+// MembersInput is the parameters for the HTTP API method to list the paid members.
+type MembersInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// MembersOutput is the list of paid members.
+type MembersOutput struct {
+	Body []*admission.Member `doc:"the paid memberships, including expired ones"`
+}
+
+// userAuth checks the nip-98 authorization of a request and returns the pubkey.
+func userAuth(r *http.Request) (pubkey []byte, err error) {
+	var valid bool
+	if valid, pubkey, err = httpauth.CheckAuth(r); err != nil &&
+		!errors.Is(err, httpauth.ErrMissingKey) {
+		err = huma.Error400BadRequest(err.Error())
+		return
+	}
+	err = nil
+	if !valid || len(pubkey) == 0 {
+		err = huma.Error401Unauthorized("nip-98 authorization required")
+	}
+	return
+}
+
+// RegisterAdmission implements the HTTP API method that describes the price of access to the
+// relay, this is the payments_url in the relay information document.
+func (x *Operations) RegisterAdmission(api huma.API) {
+	name := "Admission"
+	description := "Get the fee for access to the relay, pay it by requesting an invoice from admission/invoice"
+	path := x.path + "/admission"
+	scopes := []string{"user", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admission"},
+		Description: helpers.GenerateDescription(description, scopes),
+	}, func(ctx context.T, input *struct{}) (output *AdmissionOutput, err error) {
+		fee, days, ok := x.PaidAdmission()
+		output = &AdmissionOutput{Body: &AdmissionTerms{Enabled: ok}}
+		if ok {
+			output.Body.Fee, output.Body.Days = fee, days
+		}
+		return
+	})
+}
+
+// RegisterAdmissionInvoice implements the HTTP API method to request an invoice for admission
+// to the relay.
+func (x *Operations) RegisterAdmissionInvoice(api huma.API) {
+	name := "AdmissionInvoice"
+	description := "Request a lightning invoice that grants the authenticated user access to the relay once it is paid"
+	path := x.path + "/admission/invoice"
+	scopes := []string{"user", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admission"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *AdmissionInvoiceInput) (output *AdmissionInvoiceOutput,
+		err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		if _, _, ok := x.PaidAdmission(); !ok {
+			err = huma.Error404NotFound("this relay does not have paid admission")
+			return
+		}
+		var pubkey []byte
+		if pubkey, err = userAuth(r); err != nil {
+			return
+		}
+		log.I.F("%s requesting admission invoice for %0x", remote, pubkey)
+		output = &AdmissionInvoiceOutput{}
+		if output.Body, err = x.RequestAdmission(ctx, pubkey); chk.E(err) {
+			err = huma.Error502BadGateway("failed to get an invoice from the wallet", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterAdmissionStatus implements the HTTP API method to get the membership of the
+// authenticated user.
+func (x *Operations) RegisterAdmissionStatus(api huma.API) {
+	name := "AdmissionStatus"
+	description := "Get the paid membership of the authenticated user"
+	path := x.path + "/admission/status"
+	scopes := []string{"user", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admission"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *AdmissionStatusInput) (output *AdmissionStatusOutput,
+		err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		var pubkey []byte
+		if pubkey, err = userAuth(r); err != nil {
+			return
+		}
+		m := x.Member(pubkey)
+		if m == nil {
+			err = huma.Error404NotFound("not a member")
+			return
+		}
+		output = &AdmissionStatusOutput{Body: m}
+		return
+	})
+}
+
+// RegisterMembers implements the HTTP API method to list the paid members of the relay.
+func (x *Operations) RegisterMembers(api huma.API) {
+	name := "Members"
+	description := "List the paid members of the relay"
+	path := x.path + "/admission/members"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *MembersInput) (output *MembersOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		ms, ok := x.Storage().(store.Memberships)
+		if !ok {
+			err = huma.Error501NotImplemented("event store does not support memberships")
+			return
+		}
+		output = &MembersOutput{}
+		if output.Body, err = ms.Members(); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to list members", err)
+			return
+		}
+		return
+	})
+}
@@ -0,0 +1,132 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/audit"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
+)
+
+// AuditInput is the parameters for the HTTP API methods to read the audit log.
+type AuditInput struct {
+	Auth  string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Since int64  `query:"since" doc:"unix timestamp of the earliest entry to return"`
+	Until int64  `query:"until" doc:"unix timestamp the returned entries are before, no limit if zero"`
+	Limit int    `query:"limit" default:"100" minimum:"1" maximum:"10000" doc:"the most entries to return, ignored by the export"`
+}
+
+// AuditOutput is the entries of the audit log matching an AuditInput.
+type AuditOutput struct {
+	Body []*audit.Entry `doc:"the entries of the audit log, newest first"`
+}
+
+// auditRange returns the time range of an AuditInput in unix nanoseconds.
+func (a *AuditInput) auditRange() (since, until int64) {
+	since = a.Since * int64(time.Second)
+	if a.Until > 0 {
+		until = a.Until * int64(time.Second)
+	}
+	return
+}
+
+// RegisterAudit implements the HTTP API method to read the audit log.
+func (x *Operations) RegisterAudit(api huma.API) {
+	name := "Audit"
+	description := "List the entries of the audit log of administrative and moderation actions, newest first"
+	path := x.path + "/audit"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *AuditInput) (output *AuditOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		a, ok := x.Storage().(store.Auditor)
+		if !ok {
+			err = huma.Error501NotImplemented("event store does not support an audit log")
+			return
+		}
+		output = &AuditOutput{Body: []*audit.Entry{}}
+		since, until := input.auditRange()
+		if err = a.AuditLog(since, until, true, func(e *audit.Entry) bool {
+			output.Body = append(output.Body, e)
+			return len(output.Body) < input.Limit
+		}); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to read the audit log", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterAuditExport implements the HTTP API method to export the audit log as line structured
+// JSON.
+func (x *Operations) RegisterAuditExport(api huma.API) {
+	name := "AuditExport"
+	description := "Export the entries of the audit log as line structured JSON, oldest first (only works with NIP-98/JWT capable client, will not work with UI)"
+	path := x.path + "/audit/export"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *AuditInput) (resp *huma.StreamResponse, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, pubkey := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		if _, ok := x.Storage().(store.Auditor); !ok {
+			err = huma.Error501NotImplemented("event store does not support an audit log")
+			return
+		}
+		log.I.F("%s export of the audit log requested on admin port pubkey %0x",
+			remote, pubkey)
+		since, until := input.auditRange()
+		resp = &huma.StreamResponse{
+			Body: func(ctx huma.Context) {
+				sto, release := x.AcquireStorage()
+				defer release()
+				a, ok := sto.(store.Auditor)
+				if !ok {
+					return
+				}
+				ctx.SetHeader("Content-Type", "application/jsonl")
+				enc := json.NewEncoder(ctx.BodyWriter())
+				chk.E(a.AuditLog(since, until, false, func(e *audit.Entry) bool {
+					return !chk.E(enc.Encode(e))
+				}))
+				if f, ok := ctx.BodyWriter().(http.Flusher); ok {
+					f.Flush()
+				}
+			},
+		}
+		return
+	})
+}
@@ -2,6 +2,7 @@ package openapi
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/danielgtaylor/huma/v2"
 
@@ -49,7 +50,7 @@ func (x *Operations) RegisterConfigurationSet(api huma.API) {
 	}, func(ctx context.T, input *ConfigurationSetInput) (wgh *struct{}, err error) {
 		r := ctx.Value("http-request").(*http.Request)
 		remote := helpers.GetRemoteFromReq(r)
-		authed, _ := x.AdminAuth(r, remote)
+		authed, pubkey := x.AdminAuth(r, remote)
 		if !authed {
 			log.I.F("checking first time password %s %s %v",
 				input.Auth, x.Configuration().FirstTime,
@@ -78,7 +79,15 @@ func (x *Operations) RegisterConfigurationSet(api huma.API) {
 				}
 			}
 		}
+		prev := x.Configuration()
+		changed := map[string]string{"fields": strings.Join(input.Body.Changes(&prev), ",")}
+		if err = input.Body.Validate(); err != nil {
+			x.Audit(pubkey, remote, "configuration", changed, err)
+			err = huma.Error400BadRequest(err.Error())
+			return
+		}
 		x.SetConfiguration(input.Body)
+		x.Audit(pubkey, remote, "configuration", changed, nil)
 		return
 	})
 }
@@ -60,7 +60,8 @@ func (x *Operations) RegisterEvent(api huma.API) {
 			return
 		}
 		var ok bool
-		sto := x.Storage()
+		sto, release := x.AcquireStorage()
+		defer release()
 		if sto == nil {
 			panic("no event store has been set to store event")
 		}
@@ -207,7 +208,7 @@ func (x *Operations) RegisterEvent(api huma.API) {
 		} else {
 			err = huma.Error500InternalServerError(string(reason))
 		}
-		if after != nil {
+		if ok && after != nil {
 			// do this in the background and let the http response close
 			go after()
 		}
@@ -1,6 +1,7 @@
 package openapi
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/context"
 	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
 	"relay.mleku.dev/hex"
 	"relay.mleku.dev/httpauth"
 	"relay.mleku.dev/relay/helpers"
@@ -92,7 +95,8 @@ func (x *Operations) RegisterEvents(api huma.API) {
 			err = huma.Error401Unauthorized("Authorization header is invalid")
 			return
 		}
-		sto := x.Storage()
+		sto, release := x.AcquireStorage()
+		defer release()
 		var evIds [][]byte
 		for _, id := range input.Body {
 			var idb []byte
@@ -106,6 +110,37 @@ func (x *Operations) RegisterEvents(api huma.API) {
 			}
 			evIds = append(evIds, idb)
 		}
+		// privileged events are only returned to the parties of the conversation, and private
+		// group events to the group members, so look them up first and remove the ones the
+		// user may not see.
+		var hidden [][]byte
+		for i := 0; i < len(evIds); i += 1000 {
+			batch := evIds[i:min(i+1000, len(evIds))]
+			var evs event.Ts
+			if evs, err = sto.QueryEvents(x.Context(),
+				&filter.T{IDs: tag.New(batch...)}); chk.E(err) {
+				err = huma.Error500InternalServerError("error querying for events", err)
+				return
+			}
+			for _, ev := range evs {
+				if !x.Server.Readable(ev, pubkey) {
+					hidden = append(hidden, ev.Id)
+				}
+			}
+		}
+		if len(hidden) > 0 {
+			var permitted [][]byte
+		next:
+			for _, id := range evIds {
+				for _, h := range hidden {
+					if bytes.Equal(id, h) {
+						continue next
+					}
+				}
+				permitted = append(permitted, id)
+			}
+			evIds = permitted
+		}
 		if idsWriter, ok := sto.(store.GetIdsWriter); ok {
 			output = &huma.StreamResponse{
 				func(ctx huma.Context) {
@@ -0,0 +1,74 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
+)
+
+// ExplainInput is the parameters for the HTTP API Explain method.
+type ExplainInput struct {
+	Auth   string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Filter string `query:"filter" doc:"nostr filter in JSON to explain the search for" required:"true"`
+}
+
+// ExplainOutput is the plan chosen to search for the events matching the filter and the work
+// the search took.
+type ExplainOutput struct{ Body *store.Explanation }
+
+// RegisterExplain implements the HTTP API method that runs a query and reports how the event
+// store searched for it.
+func (x *Operations) RegisterExplain(api huma.API) {
+	name := "Explain"
+	description := "Search for the events matching a filter and report the indexes considered with their estimated sizes, the ones chosen, and the index keys scanned and events decoded"
+	path := x.path + "/explain"
+	scopes := []string{"admin"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *ExplainInput) (output *ExplainOutput, err error) {
+		if !x.Server.Configured() {
+			err = huma.Error404NotFound("server is not configured")
+			return
+		}
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, pubkey := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("not authorized")
+			return
+		}
+		explainer, ok := x.Storage().(store.Explainer)
+		if !ok {
+			err = huma.Error501NotImplemented("event store does not support explaining queries")
+			return
+		}
+		f := filter.New()
+		if _, err = f.Unmarshal([]byte(input.Filter)); err != nil {
+			err = huma.Error422UnprocessableEntity("invalid filter: " + err.Error())
+			return
+		}
+		log.I.F("%s explain requested on admin port pubkey %0x: %s", remote, pubkey,
+			input.Filter)
+		var ex *store.Explanation
+		if ex, err = explainer.Explain(x.Context(), f); chk.E(err) {
+			err = huma.Error422UnprocessableEntity(err.Error())
+			return
+		}
+		output = &ExplainOutput{Body: ex}
+		return
+	})
+}
@@ -5,24 +5,32 @@ import (
 
 	"github.com/danielgtaylor/huma/v2"
 
+	"relay.mleku.dev/archive"
+	"relay.mleku.dev/chk"
 	"relay.mleku.dev/context"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
 )
 
 // ExportInput is the parameters for the HTTP API Export method.
 type ExportInput struct {
-	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Auth   string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Filter string `query:"filter" doc:"nostr filter in JSON selecting the events to export, all events if empty (the limit is ignored)"`
+	Format string `query:"format" enum:"jsonl,gzip,zstd,binary" default:"jsonl" doc:"line structured JSON, compressed with gzip or zstd, or length prefixed binary events"`
+	After  string `query:"after" doc:"hex encoded id of the last event received from an interrupted export, to resume after it"`
 }
 
-// ExportOutput is the return value of Export. It usually will be line structured JSON. In
-// future there may be more output formats.
+// ExportOutput is the return value of Export. It is line structured JSON, optionally
+// compressed, or the binary format of the archive package.
 type ExportOutput struct{ RawBody []byte }
 
 // RegisterExport implements the Export HTTP API method.
 func (x *Operations) RegisterExport(api huma.API) {
 	name := "Export"
-	description := "Export all events (only works with NIP-98/JWT capable client, will not work with UI)"
+	description := "Export all events, or those matching a filter, optionally resuming an interrupted export (only works with NIP-98/JWT capable client, will not work with UI)"
 	path := x.path + "/export"
 	scopes := []string{"admin", "read"}
 	method := http.MethodGet
@@ -49,13 +57,28 @@ func (x *Operations) RegisterExport(api huma.API) {
 			err = huma.Error401Unauthorized("Not Authorized")
 			return
 		}
+		opts := &store.ExportOptions{Format: archive.Format(input.Format)}
+		if input.Filter != "" {
+			opts.Filter = filter.New()
+			if _, err = opts.Filter.Unmarshal([]byte(input.Filter)); err != nil {
+				err = huma.Error422UnprocessableEntity("invalid filter: " + err.Error())
+				return
+			}
+		}
+		if input.After != "" {
+			if opts.After, err = hex.Dec(input.After); err != nil || len(opts.After) != 32 {
+				err = huma.Error422UnprocessableEntity("after must be a hex encoded event id")
+				return
+			}
+		}
 		log.I.F("%s export of event data requested on admin port pubkey %0x",
 			remote, pubkey)
-		sto := x.Storage()
 		resp = &huma.StreamResponse{
-			func(ctx huma.Context) {
-				ctx.SetHeader("Content-Type", "application/nostr+jsonl")
-				sto.Export(x.Context(), ctx.BodyWriter())
+			Body: func(ctx huma.Context) {
+				sto, release := x.AcquireStorage()
+				defer release()
+				ctx.SetHeader("Content-Type", opts.Format.ContentType())
+				chk.E(sto.Export(x.Context(), ctx.BodyWriter(), opts))
 				if f, ok := ctx.BodyWriter().(http.Flusher); ok {
 					f.Flush()
 				} else {
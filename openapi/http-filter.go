@@ -19,6 +19,7 @@ import (
 	"relay.mleku.dev/kind"
 	"relay.mleku.dev/kinds"
 	"relay.mleku.dev/log"
+	"relay.mleku.dev/privileged"
 	"relay.mleku.dev/relay/helpers"
 	"relay.mleku.dev/store"
 	"relay.mleku.dev/tag"
@@ -35,12 +36,13 @@ type SimpleFilter struct {
 
 // FilterInput is the parameters for a Filter HTTP API call.
 type FilterInput struct {
-	Auth  string       `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"false"`
-	Since int64        `query:"since" doc:"timestamp of the oldest events to return (inclusive)"`
-	Until int64        `query:"until" doc:"timestamp of the newest events to return (inclusive)"`
-	Limit uint         `query:"limit" doc:"maximum number of results to return"`
-	Sort  string       `query:"sort" enum:"asc,desc" default:"desc" doc:"sort order by created_at timestamp"`
-	Body  SimpleFilter `body:"filter" doc:"filter criteria to match for events to return"`
+	Auth   string       `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"false"`
+	Since  int64        `query:"since" doc:"timestamp of the oldest events to return (inclusive)"`
+	Until  int64        `query:"until" doc:"timestamp of the newest events to return (inclusive)"`
+	Limit  uint         `query:"limit" doc:"maximum number of results to return"`
+	Sort   string       `query:"sort" enum:"asc,desc" default:"desc" doc:"sort order by created_at timestamp"`
+	Cursor string       `query:"cursor" doc:"the Next-Cursor of the previous page of results, to get the page after it with the same filter and sort order"`
+	Body   SimpleFilter `body:"filter" doc:"filter criteria to match for events to return"`
 }
 
 // ToFilter converts a SimpleFilter input to a regular nostr filter.T.
@@ -77,15 +79,17 @@ func (fi FilterInput) ToFilter() (f *filter.T, err error) {
 	return
 }
 
-// FilterOutput is a list of event Ids that match the query in the sort order requested.
+// FilterOutput is a list of event Ids that match the query in the sort order requested, and
+// the cursor for the next page if the limit was reached.
 type FilterOutput struct {
-	Body []string `doc:"list of event Ids that mach the query in the sort order requested"`
+	Cursor string   `header:"Next-Cursor" doc:"opaque cursor to get the next page of results with, absent on the last page"`
+	Body   []string `doc:"list of event Ids that mach the query in the sort order requested"`
 }
 
 // RegisterFilter is the implementation of the HTTP API Filter method.
 func (x *Operations) RegisterFilter(api huma.API) {
 	name := "Filter"
-	description := "Search for events and receive a sorted list of event Ids (one of authors, kinds or tags must be present)"
+	description := "Search for events and receive a sorted list of event Ids (one of authors, kinds or tags must be present), when the limit is reached the Next-Cursor header is the cursor parameter to get the next page with"
 	path := x.path + "/filter"
 	scopes := []string{"user", "read"}
 	method := http.MethodPost
@@ -144,50 +148,61 @@ func (x *Operations) RegisterFilter(api huma.API) {
 			err = huma.Error401Unauthorized("all kinds in event restricted; auth to get access for this filter")
 			return
 		}
-		if f.Kinds.IsPrivileged() {
-			if x.Server.AuthRequired() {
-				log.T.F("privileged request\n%s", f.Serialize())
-				senders := f.Authors
-				receivers := f.Tags.GetAll(tag.New("#p"))
-				switch {
-				case len(pubkey) == 0:
-					err = huma.Error401Unauthorized("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")
-					return
-				case senders.Contains(pubkey) || receivers.ContainsAny([]byte("#p"),
-					tag.New(pubkey)):
-					log.T.F("user %0x from %s allowed to query for privileged event",
-						pubkey, remote)
-				default:
-					err = huma.Error403Forbidden(fmt.Sprintf(
-						"authenticated user %0x does not have authorization for "+
-							"requested filters", pubkey))
-				}
+		// privileged kinds are only served to the parties of the conversation, and gift wraps
+		// only to their recipients.
+		if !privileged.FilterReadable(f, pubkey) {
+			if len(pubkey) == 0 {
+				err = huma.Error401Unauthorized("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")
+				return
 			}
-		}
-		sto := x.Storage()
-		var ok bool
-		var quer store.Querier
-		if quer, ok = sto.(store.Querier); !ok {
-			err = huma.Error501NotImplemented("simple filter request not implemented")
+			err = huma.Error403Forbidden(fmt.Sprintf(
+				"authenticated user %0x does not have authorization for "+
+					"requested filters", pubkey))
 			return
 		}
+		sto, release := x.AcquireStorage()
+		defer release()
 		var evs []store.IdTsPk
-		if evs, err = quer.QueryForIds(x.Context(), allowed.F[0]); chk.E(err) {
-			err = huma.Error500InternalServerError("error querying for events", err)
-			return
-		}
-		if input.Limit > 0 {
-			evs = evs[:input.Limit]
-		}
-		switch input.Sort {
-		case "asc":
-			sort.Slice(evs, func(i, j int) bool {
-				return evs[i].Ts < evs[j].Ts
-			})
-		case "desc":
-			sort.Slice(evs, func(i, j int) bool {
-				return evs[i].Ts > evs[j].Ts
-			})
+		var next *store.Cursor
+		if pager, ok := sto.(store.Pager); ok {
+			opts := &store.PageOptions{Limit: int(input.Limit), Ascending: input.Sort == "asc"}
+			if input.Cursor != "" {
+				if opts.After, err = store.ParseCursor(input.Cursor); err != nil {
+					err = huma.Error422UnprocessableEntity(err.Error())
+					return
+				}
+			}
+			if evs, next, err = pager.QueryPage(x.Context(), allowed.F[0], opts); chk.E(err) {
+				err = huma.Error500InternalServerError("error querying for events", err)
+				return
+			}
+		} else {
+			if input.Cursor != "" {
+				err = huma.Error501NotImplemented("event store does not support cursors")
+				return
+			}
+			var quer store.Querier
+			if quer, ok = sto.(store.Querier); !ok {
+				err = huma.Error501NotImplemented("simple filter request not implemented")
+				return
+			}
+			if evs, err = quer.QueryForIds(x.Context(), allowed.F[0]); chk.E(err) {
+				err = huma.Error500InternalServerError("error querying for events", err)
+				return
+			}
+			switch input.Sort {
+			case "asc":
+				sort.Slice(evs, func(i, j int) bool {
+					return evs[i].Ts < evs[j].Ts
+				})
+			case "desc":
+				sort.Slice(evs, func(i, j int) bool {
+					return evs[i].Ts > evs[j].Ts
+				})
+			}
+			if input.Limit > 0 && len(evs) > int(input.Limit) {
+				evs = evs[:input.Limit]
+			}
 		}
 		if len(pubkey) > 0 {
 			// remove events from results if we find the user's mute list, that are present
@@ -221,7 +236,18 @@ func (x *Operations) RegisterFilter(api huma.API) {
 				evs = tmp
 			}
 		}
+		// hidden events are only served to their authors
+		var visible []store.IdTsPk
+		for _, ev := range evs {
+			if x.Visible(ev.Id, ev.Pub, pubkey) {
+				visible = append(visible, ev)
+			}
+		}
+		evs = visible
 		output = &FilterOutput{}
+		if next != nil {
+			output.Cursor = next.String()
+		}
 		for _, ev := range evs {
 			output.Body = append(output.Body, hex.Enc(ev.Id))
 		}
@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
+)
+
+// FsckInput is the parameters for the HTTP API Fsck method.
+type FsckInput struct {
+	Auth   string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Repair bool   `query:"repair" doc:"fix the problems that are found where possible" default:"false"`
+}
+
+// RegisterFsck implements the HTTP API method to check the consistency of the event store,
+// streaming a line for each problem found and a summary at the end.
+func (x *Operations) RegisterFsck(api huma.API) {
+	name := "Fsck"
+	description := "Check the consistency of the event store indexes and events, and optionally repair them"
+	path := x.path + "/fsck"
+	scopes := []string{"admin"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *FsckInput) (resp *huma.StreamResponse, err error) {
+		if !x.Server.Configured() {
+			err = huma.Error404NotFound("server is not configured")
+			return
+		}
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, pubkey := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("not authorized")
+			return
+		}
+		checker, ok := x.Storage().(store.Checker)
+		if !ok {
+			err = huma.Error501NotImplemented("event store does not support consistency checks")
+			return
+		}
+		log.I.F("%s consistency check requested on admin port pubkey %0x repair %v",
+			remote, pubkey, input.Repair)
+		resp = &huma.StreamResponse{
+			Body: func(ctx huma.Context) {
+				ctx.SetHeader("Content-Type", "text/plain")
+				if _, err := checker.Fsck(x.Context(), flushWriter{ctx.BodyWriter()},
+					input.Repair); chk.E(err) {
+				}
+			},
+		}
+		return
+	})
+}
+
+// flushWriter flushes each line of a report to the client as it is written.
+type flushWriter struct{ io.Writer }
+
+func (w flushWriter) Write(p []byte) (n int, err error) {
+	if n, err = w.Writer.Write(p); err != nil {
+		return
+	}
+	if f, ok := w.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
+	return
+}
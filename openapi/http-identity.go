@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/relay/helpers"
+)
+
+// IdentityRotateInput is the parameters for the HTTP API method to rotate the relay identity.
+type IdentityRotateInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// IdentityRotateOutput is the new relay identity and the statement naming it the successor of
+// the previous one.
+type IdentityRotateOutput struct {
+	Body struct {
+		Pubkey    string `json:"pubkey" doc:"hex encoded pubkey of the new relay identity"`
+		Previous  string `json:"previous" doc:"hex encoded pubkey of the previous relay identity"`
+		Statement string `json:"statement" doc:"hex encoded id of the successor statement signed by the previous identity"`
+	}
+}
+
+// RegisterIdentityRotate implements the HTTP API method to rotate the relay identity.
+func (x *Operations) RegisterIdentityRotate(api huma.API) {
+	name := "IdentityRotate"
+	description := "Replace the key the relay signs its own events with, the previous key signs a statement naming the new one as its successor"
+	path := x.path + "/identity/rotate"
+	scopes := []string{"admin", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *IdentityRotateInput) (output *IdentityRotateOutput,
+		err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, pubkey := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var prev string
+		if sign := x.Identity(); sign != nil {
+			prev = hex.Enc(sign.Pub())
+		}
+		var statement *event.T
+		statement, err = x.RotateIdentity(x.Context())
+		params := map[string]string{"previous": prev}
+		if err == nil {
+			params["pubkey"] = hex.Enc(x.Identity().Pub())
+		}
+		x.Audit(pubkey, remote, "rotate-identity", params, err)
+		if chk.E(err) {
+			err = huma.Error500InternalServerError("failed to rotate the relay identity", err)
+			return
+		}
+		output = &IdentityRotateOutput{}
+		output.Body.Pubkey = params["pubkey"]
+		output.Body.Previous = prev
+		output.Body.Statement = hex.Enc(statement.Id)
+		return
+	})
+}
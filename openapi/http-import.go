@@ -2,6 +2,7 @@ package openapi
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,38 +10,42 @@ import (
 
 	"github.com/danielgtaylor/huma/v2"
 
+	"relay.mleku.dev/chk"
 	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
 )
 
-// ImportInput is the parameters of an import operation, authentication and the stream of line
-// structured JSON events.
+// ImportInput is the parameters of an import operation, authentication and the stream of
+// events, in any of the export formats.
+//
+// The response is line structured JSON, a line for each event that was not imported with the
+// reason, and the report of the import in the last line.
 type ImportInput struct {
 	Auth    string `header:"Authorization" doc:"nostr nip-98 token for authentication" required:"true"`
+	DryRun  bool   `query:"dry_run" doc:"check the events without saving them" default:"false"`
+	Policy  bool   `query:"policy" doc:"only import events the relay's policies accept" default:"false"`
 	RawBody []byte
 }
 
-// ImportOutput is nothing, basically, a 204 or 200 status is expected.
-type ImportOutput struct{}
-
 // RegisterImport is the implementation of the Import operation.
 func (x *Operations) RegisterImport(api huma.API) {
 	name := "Import"
-	description := "Import events from line structured JSON (jsonl)"
+	description := "Import events from line structured JSON (jsonl), optionally compressed with gzip or zstd, or the binary export format"
 	path := x.path + "/import"
 	scopes := []string{"admin", "write"}
 	method := http.MethodPost
 	huma.Register(api, huma.Operation{
-		OperationID:   name,
-		Summary:       name,
-		Path:          path,
-		Method:        method,
-		Tags:          []string{"admin"},
-		Description:   helpers.GenerateDescription(description, scopes),
-		Security:      []map[string][]string{{"auth": scopes}},
-		DefaultStatus: 204,
-	}, func(ctx context.T, input *ImportInput) (wgh *ImportOutput, err error) {
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *ImportInput) (resp *huma.StreamResponse, err error) {
 		if !x.Server.Configured() {
 			err = huma.Error404NotFound("server is not configured")
 			return
@@ -54,20 +59,43 @@ func (x *Operations) RegisterImport(api huma.API) {
 				fmt.Sprintf("user %0x not authorized for action", pubkey))
 			return
 		}
-		sto := x.Storage()
+		var read io.Reader
 		if len(input.RawBody) > 0 {
-			read := bytes.NewBuffer(input.RawBody)
-			sto.Import(read)
-			x.Server.ZeroLists()
-			x.Server.CheckOwnerLists(context.Bg())
+			read = bytes.NewBuffer(input.RawBody)
 		} else {
-			log.I.F("import of event data requested on admin port from %s pubkey %0x", remote,
-				pubkey)
-			read := io.LimitReader(r.Body, r.ContentLength)
-			sto.Import(read)
-			x.Server.ZeroLists()
-			x.Server.CheckOwnerLists(context.Bg())
-
+			read = io.LimitReader(r.Body, r.ContentLength)
+		}
+		log.I.F("import of event data requested on admin port from %s pubkey %0x dry run %v",
+			remote, pubkey, input.DryRun)
+		sto := x.Storage()
+		resp = &huma.StreamResponse{
+			Body: func(ctx huma.Context) {
+				ctx.SetHeader("Content-Type", "application/x-ndjson")
+				w := flushWriter{ctx.BodyWriter()}
+				enc := json.NewEncoder(w)
+				opts := &store.ImportOptions{
+					DryRun: input.DryRun,
+					OnFailure: func(f *store.ImportFailure) {
+						chk.E(enc.Encode(f))
+					},
+				}
+				if input.Policy {
+					opts.Accept = func(c context.T, ev *event.T) (accept bool, notice string,
+						afterSave func()) {
+						// a valid signature doesn't authenticate the author to the relay, the
+						// events are judged as published by the admin
+						return x.Server.AcceptEvent(c, ev, r, pubkey, remote)
+					}
+				}
+				rep := sto.Import(read, opts)
+				if !input.DryRun {
+					x.Server.ZeroLists()
+					x.Server.CheckOwnerLists(context.Bg())
+				}
+				// the failures have been streamed already
+				rep.Failures = nil
+				chk.E(enc.Encode(rep))
+			},
 		}
 		return
 	})
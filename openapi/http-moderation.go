@@ -0,0 +1,401 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/keys"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/moderation"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/store"
+)
+
+// ModerationCasesInput is the parameters for the HTTP API method to list the moderation queue.
+type ModerationCasesInput struct {
+	Auth   string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Status string `query:"status" doc:"status of the cases to list" enum:"open,approved,hidden,removed,banned,all" default:"open"`
+}
+
+// ModerationCasesOutput is the list of moderation cases.
+type ModerationCasesOutput struct {
+	Body []*moderation.Case `doc:"the moderation cases, the most reported first"`
+}
+
+// ModerateInput is the parameters for the HTTP API method to decide a moderation case.
+type ModerateInput struct {
+	Auth   string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Target string `query:"target" doc:"hex encoded event id or pubkey the case is about" required:"true"`
+	Action string `query:"action" doc:"approve keeps the target, hide keeps it but serves it only to its author, remove deletes the reported event or all the events of the reported user, ban also bans the author" enum:"approve,hide,remove,ban" required:"true"`
+	Reason string `query:"reason" doc:"reason for the decision"`
+}
+
+// ModerateOutput is the decided moderation case.
+type ModerateOutput struct {
+	Body *moderation.Case
+}
+
+// BansInput is the parameters for the HTTP API method to list the banned users.
+type BansInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// BansOutput is the list of banned users.
+type BansOutput struct {
+	Body []*moderation.Ban `doc:"the banned users"`
+}
+
+// BanInput is the parameters for the HTTP API methods to ban a user and lift a ban.
+type BanInput struct {
+	Auth   string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Pubkey string `query:"pubkey" doc:"hex encoded public key of the user" required:"true"`
+	Reason string `query:"reason" doc:"reason for the ban"`
+}
+
+// HiddenInput is the parameters for the HTTP API method to list the hidden events and users.
+type HiddenInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// HiddenOutput is the list of hidden events and users.
+type HiddenOutput struct {
+	Body []*moderation.Hide `doc:"the hidden events and users"`
+}
+
+// HideInput is the parameters for the HTTP API methods to hide an event or user and to make it
+// visible again.
+type HideInput struct {
+	Auth   string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Target string `query:"target" doc:"hex encoded event id or pubkey" required:"true"`
+	Kind   string `query:"kind" doc:"whether the target is an event or a user (for hiding)" enum:"event,pubkey" default:"event"`
+	Reason string `query:"reason" doc:"reason for hiding the target"`
+}
+
+// RegisterModerationCases implements the HTTP API method to list the moderation queue, the
+// cases opened by nip-56 reports.
+func (x *Operations) RegisterModerationCases(api huma.API) {
+	name := "ModerationCases"
+	description := "List the moderation cases opened by nip-56 reports of events and users"
+	path := x.path + "/moderation/cases"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *ModerationCasesInput) (output *ModerationCasesOutput,
+		err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		if _, ok := x.Storage().(store.Moderator); !ok {
+			err = huma.Error501NotImplemented("event store does not support moderation")
+			return
+		}
+		status := input.Status
+		if status == "all" {
+			status = ""
+		}
+		output = &ModerationCasesOutput{}
+		if output.Body, err = x.ModerationCases(status); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to list moderation cases", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterModerate implements the HTTP API method to decide a moderation case.
+func (x *Operations) RegisterModerate(api huma.API) {
+	name := "Moderate"
+	description := "Decide a moderation case, approving, hiding, removing or banning the author of the reported event or user"
+	path := x.path + "/moderation/decide"
+	scopes := []string{"admin", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *ModerateInput) (output *ModerateOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, pubkey := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		if _, ok := x.Storage().(store.Moderator); !ok {
+			err = huma.Error501NotImplemented("event store does not support moderation")
+			return
+		}
+		var target []byte
+		if target, err = hex.Dec(input.Target); err != nil || len(target) != sha256.Size {
+			err = huma.Error400BadRequest("target must be a hex encoded event id or pubkey")
+			return
+		}
+		log.I.F("%s deciding moderation case %s: %s", remote, input.Target, input.Action)
+		output = &ModerateOutput{}
+		output.Body, err = x.Moderate(ctx, target, input.Action, input.Reason, pubkey)
+		x.Audit(pubkey, remote, "moderate", map[string]string{"target": input.Target,
+			"action": input.Action, "reason": input.Reason}, err)
+		if chk.E(err) {
+			err = huma.Error500InternalServerError("failed to decide moderation case", err)
+			return
+		}
+		if output.Body == nil {
+			err = huma.Error404NotFound("no moderation case about " + input.Target)
+			return
+		}
+		return
+	})
+}
+
+// RegisterBans implements the HTTP API method to list the users banned from publishing to the
+// relay.
+func (x *Operations) RegisterBans(api huma.API) {
+	name := "Bans"
+	description := "List the users banned from publishing to the relay"
+	path := x.path + "/moderation/bans"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *BansInput) (output *BansOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		m, ok := x.Storage().(store.Moderator)
+		if !ok {
+			err = huma.Error501NotImplemented("event store does not support moderation")
+			return
+		}
+		output = &BansOutput{}
+		if output.Body, err = m.Bans(); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to list bans", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterBan implements the HTTP API method to ban a user from publishing to the relay.
+func (x *Operations) RegisterBan(api huma.API) {
+	name := "Ban"
+	description := "Ban a user from publishing to the relay"
+	path := x.path + "/moderation/bans"
+	scopes := []string{"admin", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *BanInput) (output *struct{}, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, moderator := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var pubkey []byte
+		if pubkey, err = keys.HexPubkeyToBytes(input.Pubkey); err != nil {
+			err = huma.Error400BadRequest("invalid pubkey", err)
+			return
+		}
+		err = x.Ban(&moderation.Ban{Pubkey: hex.Enc(pubkey), Reason: input.Reason,
+			Moderator: hex.Enc(moderator)})
+		x.Audit(moderator, remote, "ban", map[string]string{"pubkey": hex.Enc(pubkey),
+			"reason": input.Reason}, err)
+		if err != nil {
+			err = huma.Error400BadRequest("failed to ban user", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterUnban implements the HTTP API method to lift the ban of a user.
+func (x *Operations) RegisterUnban(api huma.API) {
+	name := "Unban"
+	description := "Lift the ban of a user"
+	path := x.path + "/moderation/bans"
+	scopes := []string{"admin", "write"}
+	method := http.MethodDelete
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *BanInput) (output *struct{}, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, moderator := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var pubkey []byte
+		if pubkey, err = keys.HexPubkeyToBytes(input.Pubkey); err != nil {
+			err = huma.Error400BadRequest("invalid pubkey", err)
+			return
+		}
+		err = x.Unban(pubkey)
+		x.Audit(moderator, remote, "unban", map[string]string{"pubkey": hex.Enc(pubkey)}, err)
+		if chk.E(err) {
+			err = huma.Error500InternalServerError("failed to lift ban", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterHidden implements the HTTP API method to list the events and users hidden from
+// everyone but their authors.
+func (x *Operations) RegisterHidden(api huma.API) {
+	name := "Hidden"
+	description := "List the events and users hidden from everyone but their authors"
+	path := x.path + "/moderation/hidden"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *HiddenInput) (output *HiddenOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		h, ok := x.Storage().(store.Hider)
+		if !ok {
+			err = huma.Error501NotImplemented("event store does not support hiding events")
+			return
+		}
+		output = &HiddenOutput{}
+		if output.Body, err = h.Hidden(); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to list hidden events", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterHide implements the HTTP API method to shadow ban an event or user, the events are
+// still accepted and stored, but only served to their author.
+func (x *Operations) RegisterHide(api huma.API) {
+	name := "Hide"
+	description := "Hide an event, or all the events of a user, from everyone but their author, without deleting them"
+	path := x.path + "/moderation/hidden"
+	scopes := []string{"admin", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *HideInput) (output *struct{}, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, moderator := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var target []byte
+		if target, err = hex.Dec(input.Target); err != nil || len(target) != sha256.Size {
+			err = huma.Error400BadRequest("target must be a hex encoded event id or pubkey")
+			return
+		}
+		err = x.Hide(&moderation.Hide{Kind: input.Kind, Target: hex.Enc(target),
+			Reason: input.Reason, Moderator: hex.Enc(moderator)})
+		x.Audit(moderator, remote, "hide", map[string]string{"target": hex.Enc(target),
+			"kind": input.Kind, "reason": input.Reason}, err)
+		if err != nil {
+			err = huma.Error400BadRequest("failed to hide "+input.Kind, err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterUnhide implements the HTTP API method to make a hidden event or user visible again.
+func (x *Operations) RegisterUnhide(api huma.API) {
+	name := "Unhide"
+	description := "Make a hidden event or user visible again"
+	path := x.path + "/moderation/hidden"
+	scopes := []string{"admin", "write"}
+	method := http.MethodDelete
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *HideInput) (output *struct{}, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, moderator := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var target []byte
+		if target, err = hex.Dec(input.Target); err != nil || len(target) != sha256.Size {
+			err = huma.Error400BadRequest("target must be a hex encoded event id or pubkey")
+			return
+		}
+		err = x.Unhide(target)
+		x.Audit(moderator, remote, "unhide", map[string]string{"target": hex.Enc(target)}, err)
+		if chk.E(err) {
+			err = huma.Error500InternalServerError("failed to unhide", err)
+			return
+		}
+		return
+	})
+}
@@ -0,0 +1,256 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
+)
+
+// NIP05SetInput is the parameters for the HTTP API method to register a NIP-05 name.
+type NIP05SetInput struct {
+	Auth string            `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Body *dns.Registration `doc:"the name to register"`
+}
+
+// NIP05DeleteInput is the parameters for the HTTP API method to remove a NIP-05 name.
+type NIP05DeleteInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Name string `query:"name" doc:"the name to remove" required:"true"`
+}
+
+// NIP05ListInput is the parameters for the HTTP API method to list the NIP-05 names.
+type NIP05ListInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// NIP05ListOutput is the list of registered NIP-05 names.
+type NIP05ListOutput struct {
+	Body []*dns.Registration `doc:"the registered names"`
+}
+
+// NIP05Claim is the name a user wants to claim and the relays they can be found at.
+type NIP05Claim struct {
+	Name   string   `json:"name" doc:"local part of the nip-05 identifier"`
+	Relays []string `json:"relays,omitempty" doc:"relays the user can be found at"`
+}
+
+// NIP05ClaimInput is the parameters for the HTTP API method for users to claim a NIP-05 name.
+type NIP05ClaimInput struct {
+	Auth string      `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Body *NIP05Claim `doc:"the name to claim"`
+}
+
+// namer returns the store.Namer of the event store, or an error if it doesn't have one.
+func (x *Operations) namer() (namer store.Namer, err error) {
+	var ok bool
+	if namer, ok = x.Storage().(store.Namer); !ok {
+		err = huma.Error501NotImplemented("event store does not support nip-05 names")
+	}
+	return
+}
+
+// RegisterNIP05Set implements the HTTP API method to register a NIP-05 name.
+func (x *Operations) RegisterNIP05Set(api huma.API) {
+	name := "NIP05Set"
+	description := "Register or update a nip-05 name served by the relay"
+	path := x.path + "/nip05/set"
+	scopes := []string{"admin", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID:   name,
+		Summary:       name,
+		Path:          path,
+		Method:        method,
+		Tags:          []string{"admin"},
+		Description:   helpers.GenerateDescription(description, scopes),
+		Security:      []map[string][]string{{"auth": scopes}},
+		DefaultStatus: 204,
+	}, func(ctx context.T, input *NIP05SetInput) (wgh *struct{}, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, pubkey := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var namer store.Namer
+		if namer, err = x.namer(); err != nil {
+			return
+		}
+		if input.Body == nil {
+			err = huma.Error400BadRequest("no registration given")
+			return
+		}
+		if err = input.Body.Validate(); err != nil {
+			err = huma.Error400BadRequest(err.Error())
+			return
+		}
+		input.Body.Claimed = false
+		log.I.F("%s admin %0x registering nip-05 name %s for %s", remote, pubkey,
+			input.Body.Name, input.Body.Pubkey)
+		if err = namer.SetName(input.Body); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to store name", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterNIP05Delete implements the HTTP API method to remove a NIP-05 name.
+func (x *Operations) RegisterNIP05Delete(api huma.API) {
+	name := "NIP05Delete"
+	description := "Remove a nip-05 name served by the relay"
+	path := x.path + "/nip05/delete"
+	scopes := []string{"admin", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID:   name,
+		Summary:       name,
+		Path:          path,
+		Method:        method,
+		Tags:          []string{"admin"},
+		Description:   helpers.GenerateDescription(description, scopes),
+		Security:      []map[string][]string{{"auth": scopes}},
+		DefaultStatus: 204,
+	}, func(ctx context.T, input *NIP05DeleteInput) (wgh *struct{}, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, pubkey := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var namer store.Namer
+		if namer, err = x.namer(); err != nil {
+			return
+		}
+		log.I.F("%s admin %0x removing nip-05 name %s", remote, pubkey, input.Name)
+		if err = namer.DeleteName(strings.ToLower(input.Name)); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to remove name", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterNIP05List implements the HTTP API method to list the NIP-05 names.
+func (x *Operations) RegisterNIP05List(api huma.API) {
+	name := "NIP05List"
+	description := "List the nip-05 names served by the relay"
+	path := x.path + "/nip05/list"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *NIP05ListInput) (output *NIP05ListOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var namer store.Namer
+		if namer, err = x.namer(); err != nil {
+			return
+		}
+		output = &NIP05ListOutput{}
+		if output.Body, err = namer.Names(); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to list names", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterNIP05Claim implements the HTTP API method for users followed by the owners to claim
+// a NIP-05 name for themselves. Each user may hold one claimed name, claiming another releases
+// the previous one.
+func (x *Operations) RegisterNIP05Claim(api huma.API) {
+	name := "NIP05Claim"
+	description := "Claim a nip-05 name on the relay's domain for the authenticated user"
+	path := x.path + "/nip05/claim"
+	scopes := []string{"user", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID:   name,
+		Summary:       name,
+		Path:          path,
+		Method:        method,
+		Tags:          []string{"nip05"},
+		Description:   helpers.GenerateDescription(description, scopes),
+		Security:      []map[string][]string{{"auth": scopes}},
+		DefaultStatus: 204,
+	}, func(ctx context.T, input *NIP05ClaimInput) (wgh *struct{}, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		if !x.NIP05Claims() {
+			err = huma.Error403Forbidden("this relay does not allow claiming names")
+			return
+		}
+		var pubkey []byte
+		if pubkey, err = userAuth(r); err != nil {
+			return
+		}
+		if !x.isFollowed(pubkey) {
+			err = huma.Error403Forbidden("only users followed by the relay owners may claim names")
+			return
+		}
+		var namer store.Namer
+		if namer, err = x.namer(); err != nil {
+			return
+		}
+		if input.Body == nil {
+			err = huma.Error400BadRequest("no name given")
+			return
+		}
+		reg := &dns.Registration{
+			Name:    input.Body.Name,
+			Pubkey:  hex.Enc(pubkey),
+			Relays:  input.Body.Relays,
+			Claimed: true,
+		}
+		if err = reg.Validate(); err != nil {
+			err = huma.Error400BadRequest(err.Error())
+			return
+		}
+		if err = namer.ClaimName(reg); err != nil {
+			if errors.Is(err, store.ErrNameTaken) {
+				err = huma.Error409Conflict("name is already taken")
+				return
+			}
+			chk.E(err)
+			err = huma.Error500InternalServerError("failed to store name", err)
+			return
+		}
+		log.I.F("%s user %0x claimed nip-05 name %s", remote, pubkey, reg.Name)
+		return
+	})
+}
+
+// isFollowed returns true if the pubkey is one of the owners or is followed by them.
+func (x *Operations) isFollowed(pubkey []byte) bool {
+	for _, o := range x.Owners() {
+		if bytes.Equal(o, pubkey) {
+			return true
+		}
+	}
+	return x.OwnersFollowed(string(pubkey))
+}
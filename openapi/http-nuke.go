@@ -63,10 +63,12 @@ func (x *Operations) RegisterNuke(api huma.API) {
 		log.I.F("nuking")
 		if nuke, ok := sto.(store.Nukener); ok {
 			log.I.F("nuking")
-			if err = nuke.Nuke(); chk.E(err) {
-				if strings.HasPrefix(err.Error(), "Value log GC attempt") {
-					err = nil
-				}
+			err = nuke.Nuke()
+			if err != nil && strings.HasPrefix(err.Error(), "Value log GC attempt") {
+				err = nil
+			}
+			x.Audit(pubkey, remote, "nuke", nil, err)
+			if chk.E(err) {
 				return
 			}
 		} else {
@@ -12,7 +12,6 @@ import (
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/httpauth"
 	"relay.mleku.dev/log"
-	"relay.mleku.dev/publish"
 	"relay.mleku.dev/relay/helpers"
 )
 
@@ -91,7 +90,7 @@ func (x *Operations) RegisterRelay(api huma.API) {
 
 		authRequired = x.Server.AuthRequired()
 
-		publish.P.Deliver(authRequired, x.PublicReadable(), ev)
+		x.Publisher().Deliver(authRequired, x.PublicReadable(), ev)
 		return
 	})
 }
@@ -50,7 +50,9 @@ func (x *Operations) RegisterRescan(api huma.API) {
 		sto := x.Storage()
 		if rescanner, ok := sto.(store.Rescanner); ok {
 			log.I.F("rescanning")
-			if err = rescanner.Rescan(); chk.E(err) {
+			err = rescanner.Rescan()
+			x.Audit(pubkey, remote, "rescan", nil, err)
+			if chk.E(err) {
 				return
 			}
 		}
@@ -38,11 +38,12 @@ func (x *Operations) RegisterShutdown(api huma.API) {
 		}
 		r := ctx.Value("http-request").(*http.Request)
 		remote := helpers.GetRemoteFromReq(r)
-		authed, _ := x.AdminAuth(r, remote)
+		authed, pubkey := x.AdminAuth(r, remote)
 		if !authed {
 			err = huma.Error401Unauthorized("authorization required")
 			return
 		}
+		x.Audit(pubkey, remote, "shutdown", nil, nil)
 		go func() {
 			time.Sleep(time.Second)
 			x.Shutdown()
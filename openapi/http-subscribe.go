@@ -18,7 +18,7 @@ import (
 	"relay.mleku.dev/kind"
 	"relay.mleku.dev/kinds"
 	"relay.mleku.dev/log"
-	"relay.mleku.dev/publish"
+	"relay.mleku.dev/privileged"
 	"relay.mleku.dev/relay/helpers"
 	"relay.mleku.dev/tag"
 	"relay.mleku.dev/tags"
@@ -115,29 +115,21 @@ func (x *Operations) RegisterSubscribe(api huma.API) {
 				err = huma.Error401Unauthorized("all kinds in event restricted; auth to get access for this filter")
 				return
 			}
-			if f.Kinds.IsPrivileged() {
-				if x.Server.AuthRequired() {
-					log.T.F("privileged request\n%s", f.Serialize())
-					senders := f.Authors
-					receivers := f.Tags.GetAll(tag.New("#p"))
-					switch {
-					case len(pubkey) == 0:
-						err = huma.Error401Unauthorized("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")
-						return
-					case senders.Contains(pubkey) || receivers.ContainsAny([]byte("#p"),
-						tag.New(pubkey)):
-						log.T.F("user %0x from %s allowed to query for privileged event",
-							pubkey, remote)
-					default:
-						err = huma.Error403Forbidden(fmt.Sprintf(
-							"authenticated user %0x does not have authorization for "+
-								"requested filters", pubkey))
-					}
+			// privileged kinds are only served to the parties of the conversation, and gift wraps
+			// only to their recipients.
+			if !privileged.FilterReadable(f, pubkey) {
+				if len(pubkey) == 0 {
+					err = huma.Error401Unauthorized("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")
+					return
 				}
+				err = huma.Error403Forbidden(fmt.Sprintf(
+					"authenticated user %0x does not have authorization for "+
+						"requested filters", pubkey))
+				return
 			}
 			// register the filter with the listeners
 			receiver := make(event.C, 32)
-			publish.P.Receive(&H{
+			x.Publisher().Receive(&H{
 				Ctx:      r.Context(),
 				Receiver: receiver,
 				Pubkey:   pubkey,
@@ -0,0 +1,124 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
+)
+
+// UsageInput is the parameters for the HTTP API method to get the storage used by the
+// authenticated user.
+type UsageInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// UserUsage is the storage used by a user and the quota that applies to them.
+type UserUsage struct {
+	store.Usage
+	Quota *config.Quota `json:"quota,omitempty" doc:"the storage quota of the user, if they have one"`
+}
+
+// UsageOutput is the storage used by a user.
+type UsageOutput struct {
+	Body *UserUsage
+}
+
+// UsageTopInput is the parameters for the HTTP API method to list the users using the most
+// storage.
+type UsageTopInput struct {
+	Auth  string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Limit int    `query:"limit" doc:"number of users to list" default:"20" minimum:"1" maximum:"1000"`
+}
+
+// UsageTopOutput is the list of the users using the most storage.
+type UsageTopOutput struct {
+	Body []*store.Usage `doc:"the users using the most storage, the most first"`
+}
+
+// accountant returns the event store if it keeps account of the storage used by each user.
+func (x *Operations) accountant() (acc store.Accountant, err error) {
+	var ok bool
+	if acc, ok = x.Storage().(store.Accountant); !ok {
+		err = huma.Error501NotImplemented("event store does not account for storage usage")
+	}
+	return
+}
+
+// RegisterUsage implements the HTTP API method to get the storage used by the events of the
+// authenticated user.
+func (x *Operations) RegisterUsage(api huma.API) {
+	name := "Usage"
+	description := "Get the number and size of the stored events of the authenticated user, and their storage quota"
+	path := x.path + "/usage"
+	scopes := []string{"user", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"usage"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *UsageInput) (output *UsageOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		var pubkey []byte
+		if pubkey, err = userAuth(r); err != nil {
+			return
+		}
+		var acc store.Accountant
+		if acc, err = x.accountant(); err != nil {
+			return
+		}
+		var u *store.Usage
+		if u, err = acc.Usage(pubkey); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to get usage", err)
+			return
+		}
+		output = &UsageOutput{Body: &UserUsage{Usage: *u, Quota: x.Quota(pubkey)}}
+		return
+	})
+}
+
+// RegisterUsageTop implements the HTTP API method to list the users whose events use the most
+// storage.
+func (x *Operations) RegisterUsageTop(api huma.API) {
+	name := "UsageTop"
+	description := "List the users whose stored events use the most bytes"
+	path := x.path + "/usage/top"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *UsageTopInput) (output *UsageTopOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var acc store.Accountant
+		if acc, err = x.accountant(); err != nil {
+			return
+		}
+		output = &UsageTopOutput{}
+		if output.Body, err = acc.TopUsage(input.Limit); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to list usage", err)
+			return
+		}
+		return
+	})
+}
@@ -0,0 +1,110 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/keys"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/store"
+)
+
+// VerificationsInput is the parameters for the HTTP API method to list the cached NIP-05
+// verifications.
+type VerificationsInput struct {
+	Auth string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+}
+
+// VerificationsOutput is the list of cached NIP-05 verifications.
+type VerificationsOutput struct {
+	Body []*dns.Verification `doc:"the cached verifications"`
+}
+
+// VerifyInput is the parameters for the HTTP API method to verify the NIP-05 identifier of a
+// pubkey.
+type VerifyInput struct {
+	Auth    string `header:"Authorization" doc:"nostr nip-98 (and expiring variant)" required:"true"`
+	Pubkey  string `query:"pubkey" doc:"hex encoded public key to verify" required:"true"`
+	Refresh bool   `query:"refresh" doc:"look up the identifier again instead of using the cached result" default:"false"`
+}
+
+// VerifyOutput is the result of verifying the NIP-05 identifier of a pubkey.
+type VerifyOutput struct {
+	Body *dns.Verification `doc:"the verification"`
+}
+
+// RegisterVerifications implements the HTTP API method to list the cached NIP-05
+// verifications used by the admission policy.
+func (x *Operations) RegisterVerifications(api huma.API) {
+	name := "Verifications"
+	description := "List the cached nip-05 verifications of users used for write admission"
+	path := x.path + "/nip05/verifications"
+	scopes := []string{"admin", "read"}
+	method := http.MethodGet
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *VerificationsInput) (output *VerificationsOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		cache, ok := x.Storage().(store.Verifications)
+		if !ok {
+			err = huma.Error501NotImplemented("event store does not cache verifications")
+			return
+		}
+		output = &VerificationsOutput{}
+		if output.Body, err = cache.Verifications(); chk.E(err) {
+			err = huma.Error500InternalServerError("failed to list verifications", err)
+			return
+		}
+		return
+	})
+}
+
+// RegisterVerify implements the HTTP API method to verify the NIP-05 identifier in the profile
+// of a pubkey.
+func (x *Operations) RegisterVerify(api huma.API) {
+	name := "Verify"
+	description := "Verify the nip-05 identifier in the profile of a user against the allowed domains"
+	path := x.path + "/nip05/verify"
+	scopes := []string{"admin", "write"}
+	method := http.MethodPost
+	huma.Register(api, huma.Operation{
+		OperationID: name,
+		Summary:     name,
+		Path:        path,
+		Method:      method,
+		Tags:        []string{"admin"},
+		Description: helpers.GenerateDescription(description, scopes),
+		Security:    []map[string][]string{{"auth": scopes}},
+	}, func(ctx context.T, input *VerifyInput) (output *VerifyOutput, err error) {
+		r := ctx.Value("http-request").(*http.Request)
+		remote := helpers.GetRemoteFromReq(r)
+		authed, _ := x.AdminAuth(r, remote)
+		if !authed {
+			err = huma.Error401Unauthorized("authorization required")
+			return
+		}
+		var pubkey []byte
+		if pubkey, err = keys.HexPubkeyToBytes(input.Pubkey); err != nil {
+			err = huma.Error400BadRequest("invalid pubkey", err)
+			return
+		}
+		output = &VerifyOutput{Body: x.VerifyNIP05(ctx, pubkey, input.Refresh)}
+		return
+	})
+}
@@ -19,14 +19,14 @@ func ExposeMiddleware(ctx huma.Context, next func(huma.Context)) {
 	next(ctx)
 }
 
-// NewHuma creates a new huma.API with a Scalar docs UI, and a middleware that allows methods to
-// access the http.Request and http.ResponseWriter.
-func NewHuma(router *servemux.S, name, version, description string) (api huma.API) {
+// NewHuma creates a new huma.API with a Scalar docs UI at path, and a middleware that allows
+// methods to access the http.Request and http.ResponseWriter.
+func NewHuma(router *servemux.S, name, version, description, path string) (api huma.API) {
 	config := huma.DefaultConfig(name, version)
 	config.Info.Description = description
 	config.DocsPath = ""
-	config.OpenAPIPath = "/api/openapi"
-	router.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+	config.OpenAPIPath = path + "/openapi"
+	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
 		w.Write([]byte(`<!DOCTYPE html>
 <html lang="en">
@@ -40,7 +40,7 @@ func NewHuma(router *servemux.S, name, version, description string) (api huma.AP
   <body>
     <script
       id="api-reference"
-      data-url="/api/openapi.json"></script>
+      data-url="` + path + `/openapi.json"></script>
     <script src="https://cdn.jsdelivr.net/npm/@scalar/api-reference"></script>
   </body>
 </html>`))
@@ -17,7 +17,10 @@ type Operations struct {
 func New(s interfaces.Server, name, version, description string, path string,
 	sm *servemux.S) {
 
-	a := NewHuma(sm, name, version, description)
+	a := NewHuma(sm, name, version, description, path)
+	pub := NewPublisher()
+	pub.Server = s
+	s.Publisher().Register(pub)
 	huma.AutoRegister(a, &Operations{Server: s, path: path})
 	return
 }
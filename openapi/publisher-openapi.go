@@ -1,15 +1,14 @@
 package openapi
 
 import (
-	"bytes"
 	"sync"
 
 	"relay.mleku.dev/context"
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/filter"
-	"relay.mleku.dev/publish"
+	"relay.mleku.dev/privileged"
 	"relay.mleku.dev/publish/publisher"
-	"relay.mleku.dev/tag"
+	"relay.mleku.dev/relay/interfaces"
 	"relay.mleku.dev/typer"
 )
 
@@ -30,10 +29,6 @@ type H struct {
 	Filter *filter.T
 }
 
-func init() {
-	publish.Register(NewPublisher())
-}
-
 func (h *H) Type() string { return Type }
 
 // Map is a collection of H TTP subscriptions.
@@ -44,6 +39,9 @@ type S struct {
 	Map
 	// HLock is the mutex that locks the Map.
 	Mx sync.Mutex
+	// Server decides which events subscribers may read, if it is not set only the rules for
+	// privileged events apply.
+	Server interfaces.Server
 }
 
 var _ publisher.I = &S{}
@@ -86,16 +84,11 @@ func (p *S) Deliver(authRequired, publicReadable bool, ev *event.T) {
 		if !sub.Filter.Matches(ev) {
 			continue
 		}
-		// if the filter is privileged and the user doesn't have matching auth, skip
-		if ev.Kind.IsPrivileged() {
-			ab := sub.Pubkey
-			var containsPubkey bool
-			if ev.Tags != nil {
-				containsPubkey = ev.Tags.ContainsAny([]byte{'p'}, tag.New(ab))
-			}
-			if !bytes.Equal(ev.Pubkey, ab) || containsPubkey {
-				continue
-			}
+		// if the event is privileged and the user isn't a party to it, or is in a private
+		// group the user isn't a member of, skip
+		if p.Server == nil && !privileged.Readable(ev, sub.Pubkey) ||
+			p.Server != nil && !p.Server.Readable(ev, sub.Pubkey) {
+			continue
 		}
 		// send the event to the subscriber
 		sub.Receiver <- ev
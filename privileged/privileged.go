@@ -0,0 +1,113 @@
+// Package privileged implements the access rules for privileged events, such as NIP-04
+// encrypted direct messages and the NIP-17/NIP-59 gift wraps, seals and chat messages, which
+// must only be sent to the parties of the conversation.
+//
+// Gift wraps are signed by a random one-time key so they are only ever readable by the p tag
+// recipient, all other privileged kinds are also readable by their author.
+package privileged
+
+import (
+	"bytes"
+
+	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/tag"
+)
+
+// Readable returns true if the holder of pubkey may be sent the event. Events that are not
+// privileged are always readable, privileged events are never readable without a pubkey.
+func Readable(ev *event.T, pubkey []byte) bool {
+	if ev == nil || !ev.Kind.IsPrivileged() {
+		return true
+	}
+	if len(pubkey) != schnorr.PubKeyBytesLen {
+		return false
+	}
+	if !ev.Kind.IsGiftWrap() && bytes.Equal(ev.Pubkey, pubkey) {
+		return true
+	}
+	return IsRecipient(ev, pubkey)
+}
+
+// IsRecipient returns true if the pubkey is in one of the p tags of the event.
+func IsRecipient(ev *event.T, pubkey []byte) bool {
+	if ev.Tags == nil || len(pubkey) != schnorr.PubKeyBytesLen {
+		return false
+	}
+	return ev.Tags.ContainsAny([]byte("p"), tag.New(hex.Enc(pubkey)))
+}
+
+// Recipients returns the decoded pubkeys found in the p tags of an event. Invalid values are
+// skipped.
+func Recipients(ev *event.T) (pubkeys [][]byte) {
+	if ev.Tags == nil {
+		return
+	}
+	for _, t := range ev.Tags.GetAll(tag.New("p")).ToSliceOfTags() {
+		var pk []byte
+		var err error
+		if pk, err = hex.Dec(string(t.Value())); err != nil ||
+			len(pk) != schnorr.PubKeyBytesLen {
+			continue
+		}
+		pubkeys = append(pubkeys, pk)
+	}
+	return
+}
+
+// FilterReadable returns true if a filter that requests privileged kinds can only match events
+// that are readable by the holder of pubkey. This is the case when all of the `#p` values are
+// the pubkey, or, for kinds other than gift wraps, when all the authors are the pubkey.
+//
+// Filters that don't name any privileged kinds always return true, the events they return must
+// still be checked with Readable.
+func FilterReadable(f *filter.T, pubkey []byte) bool {
+	if f == nil || !f.Kinds.IsPrivileged() {
+		return true
+	}
+	if len(pubkey) != schnorr.PubKeyBytesLen {
+		return false
+	}
+	if f.Tags != nil {
+		receivers := f.Tags.GetAll(tag.New("#p")).ToSliceOfTags()
+		if len(receivers) > 0 && allEqual(receivers, pubkey) {
+			return true
+		}
+	}
+	var giftWraps bool
+	for _, k := range f.Kinds.K {
+		if k.IsGiftWrap() {
+			giftWraps = true
+			break
+		}
+	}
+	if giftWraps || f.Authors.Len() == 0 {
+		return false
+	}
+	for _, a := range f.Authors.ToSliceOfBytes() {
+		if !bytes.Equal(a, pubkey) {
+			return false
+		}
+	}
+	return true
+}
+
+// allEqual returns true if every value of the filter tags is the pubkey. Filter `#p` values are
+// binary, but hex is also accepted as it might have been constructed by hand.
+func allEqual(receivers []*tag.T, pubkey []byte) bool {
+	pkHex := []byte(hex.Enc(pubkey))
+	for _, r := range receivers {
+		values := r.ToSliceOfBytes()[1:]
+		if len(values) == 0 {
+			return false
+		}
+		for _, v := range values {
+			if !bytes.Equal(v, pubkey) && !bytes.Equal(v, pkHex) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package privileged
+
+import (
+	"testing"
+
+	"lukechampine.com/frand"
+
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+func makeEvent(k *kind.T, author []byte, recipients ...[]byte) (ev *event.T) {
+	ev = &event.T{
+		Pubkey:    author,
+		CreatedAt: timestamp.Now(),
+		Kind:      k,
+		Tags:      tags.New(),
+	}
+	for _, r := range recipients {
+		ev.Tags = ev.Tags.AppendTags(tag.New("p", hex.Enc(r)))
+	}
+	return
+}
+
+func TestReadable(t *testing.T) {
+	author, recipient, other := frand.Bytes(32), frand.Bytes(32), frand.Bytes(32)
+	dm := makeEvent(kind.EncryptedDirectMessage, author, recipient)
+	if !Readable(dm, author) || !Readable(dm, recipient) {
+		t.Fatal("dm should be readable by its author and recipient")
+	}
+	if Readable(dm, other) || Readable(dm, nil) {
+		t.Fatal("dm should not be readable by a third party or unauthenticated user")
+	}
+	wrap := makeEvent(kind.GiftWrap, author, recipient)
+	if !Readable(wrap, recipient) {
+		t.Fatal("gift wrap should be readable by its recipient")
+	}
+	if Readable(wrap, author) || Readable(wrap, other) {
+		t.Fatal("gift wrap should only be readable by its recipient")
+	}
+	note := makeEvent(kind.TextNote, author, recipient)
+	if !Readable(note, nil) {
+		t.Fatal("text note should be readable by anyone")
+	}
+	if r := Recipients(wrap); len(r) != 1 || string(r[0]) != string(recipient) {
+		t.Fatal("failed to decode recipients")
+	}
+}
+
+func TestFilterReadable(t *testing.T) {
+	me, other := frand.Bytes(32), frand.Bytes(32)
+	f := &filter.T{Kinds: kinds.New(kind.GiftWrap),
+		Tags: tags.New(tag.New([]byte("#p"), me))}
+	if !FilterReadable(f, me) {
+		t.Fatal("gift wraps addressed to the user should be readable")
+	}
+	if FilterReadable(f, other) {
+		t.Fatal("gift wraps addressed to another user should not be readable")
+	}
+	f = &filter.T{Kinds: kinds.New(kind.GiftWrap), Authors: tag.New(me)}
+	if FilterReadable(f, me) {
+		t.Fatal("gift wraps by author are a scrape and should not be readable")
+	}
+	f = &filter.T{Kinds: kinds.New(kind.EncryptedDirectMessage), Authors: tag.New(me)}
+	if !FilterReadable(f, me) {
+		t.Fatal("dms authored by the user should be readable")
+	}
+	f = &filter.T{Kinds: kinds.New(kind.EncryptedDirectMessage), Authors: tag.New(me, other)}
+	if FilterReadable(f, me) {
+		t.Fatal("dms authored by other users should not be readable")
+	}
+	f = &filter.T{Kinds: kinds.New(kind.TextNote)}
+	if !FilterReadable(f, nil) {
+		t.Fatal("filter without privileged kinds should be readable")
+	}
+}
@@ -7,25 +7,23 @@ import (
 	"relay.mleku.dev/typer"
 )
 
-var publishers publisher.Publishers
-
-func Register(p publisher.I) {
-	publishers = append(publishers, p)
-}
-
-// S is the control structure for the subscription management scheme.
+// S is the control structure for the subscription management scheme. Each relay has its own,
+// so the events stored by one are only delivered to its own subscribers.
 type S struct{ publisher.Publishers }
 
 var _ publisher.I = &S{}
 
-var P = &S{publishers}
+// Register adds a publisher to S, which delivers events to all of them. Publishers are
+// registered when the relay is set up, before it serves requests.
+func (s *S) Register(p publisher.I) {
+	s.Publishers = append(s.Publishers, p)
+}
 
 func (s *S) Type() string { return "publish" }
 
 func (s *S) Deliver(authRequired, publicReadable bool, ev *event.T) {
 	for _, p := range s.Publishers {
 		p.Deliver(authRequired, publicReadable, ev)
-		return
 	}
 }
 
@@ -0,0 +1,81 @@
+package ratel
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/audit"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// Audit appends an entry to the audit log. Entries are never overwritten, if there is already
+// one at the time of the entry it is moved to the next free nanosecond.
+func (r *T) Audit(e *audit.Entry) (err error) {
+	if err = r.writable(); err != nil {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		for {
+			key := binary.BigEndian.AppendUint64(prefixes.Audit.Key(), uint64(e.Time))
+			if _, err = txn.Get(key); errors.Is(err, badger.ErrKeyNotFound) {
+				var b []byte
+				if b, err = json.Marshal(e); chk.E(err) {
+					return
+				}
+				return txn.Set(key, b)
+			} else if err != nil {
+				return
+			}
+			e.Time++
+		}
+	})
+	return
+}
+
+// AuditLog calls fn with each entry of the audit log from since until before until, in unix
+// nanoseconds, oldest first or newest first if reverse is set, until it returns false. An until
+// of zero is no limit.
+func (r *T) AuditLog(since, until int64, reverse bool,
+	fn func(e *audit.Entry) (more bool)) (err error) {
+
+	if until <= 0 {
+		until = math.MaxInt64
+	}
+	prf := prefixes.Audit.Key()
+	start := binary.BigEndian.AppendUint64(prefixes.Audit.Key(), uint64(max(since, 0)))
+	if reverse {
+		start = binary.BigEndian.AppendUint64(prefixes.Audit.Key(), uint64(until-1))
+	}
+	err = r.View(func(txn *badger.Txn) (err error) {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf, Reverse: reverse})
+		defer it.Close()
+		for it.Seek(start); it.ValidForPrefix(prf); it.Next() {
+			key := it.Item().Key()
+			if len(key) != len(prf)+8 {
+				continue
+			}
+			if t := int64(binary.BigEndian.Uint64(key[len(prf):])); t < since || t >= until {
+				return
+			}
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			e := &audit.Entry{}
+			if err = json.Unmarshal(b, e); chk.E(err) {
+				err = nil
+				continue
+			}
+			if !fn(e) {
+				return
+			}
+		}
+		return
+	})
+	return
+}
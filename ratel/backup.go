@@ -0,0 +1,305 @@
+package ratel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/eventid"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/keys/id"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+)
+
+const (
+	// BackupManifest is the name of the file in a backup directory that lists its backups.
+	BackupManifest = "manifest.json"
+	// backupSamples is how many event ids are recorded with a backup to verify a restore.
+	backupSamples = 16
+)
+
+// Backup is a record in the manifest of a backup directory. The first backup in a directory is
+// a full backup, and each one after contains the changes since the one before it.
+type Backup struct {
+	// File is the name of the backup file in the backup directory.
+	File string `json:"file"`
+	// Since is the version of the previous backup, only changes after it are included. It is 0
+	// for a full backup.
+	Since uint64 `json:"since"`
+	// Version is the database version of the last change in the backup.
+	Version uint64 `json:"version"`
+	// Time is the unix timestamp of when the backup was made.
+	Time int64 `json:"time"`
+	// Events is the number of events in the database when the backup was made.
+	Events int `json:"events"`
+	// Samples are the hex encoded ids of some of the events in the database when the backup was
+	// made, that must be present after a restore.
+	Samples []string `json:"samples"`
+}
+
+// Manifest lists the backups in a backup directory in the order they were made.
+type Manifest struct {
+	Backups []*Backup `json:"backups"`
+}
+
+// ReadManifest reads the manifest of a backup directory, it is empty if there is none.
+func ReadManifest(dir string) (m *Manifest, err error) {
+	m = &Manifest{}
+	var b []byte
+	if b, err = os.ReadFile(filepath.Join(dir, BackupManifest)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	if err = json.Unmarshal(b, m); chk.E(err) {
+		return
+	}
+	return
+}
+
+// write replaces the manifest of a backup directory.
+func (m *Manifest) write(dir string) (err error) {
+	var b []byte
+	if b, err = json.MarshalIndent(m, "", "  "); chk.E(err) {
+		return
+	}
+	tmp := filepath.Join(dir, BackupManifest+".tmp")
+	if err = os.WriteFile(tmp, b, 0600); chk.E(err) {
+		return
+	}
+	return os.Rename(tmp, filepath.Join(dir, BackupManifest))
+}
+
+// Backup writes a backup of the changes to the database since the last backup in the directory
+// and adds it to the manifest, or a full backup if there is none yet.
+func (r *T) Backup(dir string) (err error) {
+	r.WG.Add(1)
+	defer r.WG.Done()
+	r.backupMx.Lock()
+	defer r.backupMx.Unlock()
+	if err = os.MkdirAll(dir, 0700); chk.E(err) {
+		return
+	}
+	var m *Manifest
+	if m, err = ReadManifest(dir); chk.E(err) {
+		return
+	}
+	b := &Backup{Time: time.Now().Unix()}
+	if len(m.Backups) > 0 {
+		// badger only backs up the versions after since, so the changes at the version of the
+		// last backup, which are in it already, aren't repeated
+		b.Since = m.Backups[len(m.Backups)-1].Version
+	}
+	// the events are counted and sampled first, so all of them are in the backup
+	if b.Events, b.Samples, err = r.sampleEvents(); chk.E(err) {
+		return
+	}
+	// backups with nothing to back up have the same since as the next one, so they are
+	// numbered to keep them apart
+	b.File = fmt.Sprintf("backup-%d-%d-%d.bak", len(m.Backups), b.Time, b.Since)
+	path := filepath.Join(dir, b.File)
+	var f *os.File
+	if f, err = os.Create(path); chk.E(err) {
+		return
+	}
+	if b.Version, err = r.DB.Backup(f, b.Since); chk.E(err) {
+		f.Close()
+		return
+	}
+	if err = f.Sync(); chk.E(err) {
+		f.Close()
+		return
+	}
+	if err = f.Close(); chk.E(err) {
+		return
+	}
+	if b.Version < b.Since {
+		// nothing has changed since the last backup
+		b.Version = b.Since
+	}
+	m.Backups = append(m.Backups, b)
+	if err = m.write(dir); chk.E(err) {
+		return
+	}
+	log.I.F("backed up database version %d to %d with %d events to %s", b.Since, b.Version,
+		b.Events, path)
+	return
+}
+
+// LastBackup returns when the last backup in a backup directory was made, zero if there is none.
+func (r *T) LastBackup(dir string) (last time.Time, err error) {
+	var m *Manifest
+	if m, err = ReadManifest(dir); chk.E(err) {
+		return
+	}
+	if len(m.Backups) > 0 {
+		last = time.Unix(m.Backups[len(m.Backups)-1].Time, 0)
+	}
+	return
+}
+
+// sampleEvents counts the events in the database and picks a random sample of their ids.
+func (r *T) sampleEvents() (count int, samples []string, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			count++
+		}
+		it.Close()
+		prf = prefixes.FullIndex.Key()
+		it = txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		var n int
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			key := it.Item().Key()
+			if len(key) < 1+serial.Len+sha256.Size {
+				continue
+			}
+			eid := hex.Enc(key[1+serial.Len : 1+serial.Len+sha256.Size])
+			// reservoir sampling
+			if n++; len(samples) < backupSamples {
+				samples = append(samples, eid)
+			} else if i := rand.IntN(n); i < backupSamples {
+				samples[i] = eid
+			}
+		}
+		return
+	})
+	return
+}
+
+// Restore loads the backups in a backup directory into an empty data directory at path, and
+// opens it. If until is not zero only the backups made up to that unix timestamp are loaded,
+// restoring the database as it was then.
+//
+// The restored database is verified to have the number of events and the sampled events
+// recorded with the last backup that was loaded.
+func (r *T) Restore(path, dir string, until int64) (err error) {
+	var m *Manifest
+	if m, err = ReadManifest(dir); chk.E(err) {
+		return
+	}
+	var backups []*Backup
+	for _, b := range m.Backups {
+		if until != 0 && b.Time > until {
+			break
+		}
+		backups = append(backups, b)
+	}
+	if len(backups) == 0 {
+		return errorf.E("no backups to restore in %s", dir)
+	}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(path); err == nil && len(entries) > 0 {
+		return errorf.E("the data directory %s must be empty to restore into", path)
+	}
+	r.dataDir = path
+	var db *badger.DB
+	if db, err = badger.Open(r.options()); chk.E(err) {
+		return
+	}
+	for _, b := range backups {
+		log.I.F("restoring %s", b.File)
+		if err = loadBackup(db, filepath.Join(dir, b.File)); chk.E(err) {
+			db.Close()
+			return
+		}
+	}
+	if err = db.Close(); chk.E(err) {
+		return
+	}
+	if err = r.Init(path); chk.E(err) {
+		return
+	}
+	last := backups[len(backups)-1]
+	var count int
+	if count, _, err = r.sampleEvents(); chk.E(err) {
+		return
+	}
+	if count != last.Events {
+		log.W.F("restored %d events but the backup recorded %d", count, last.Events)
+		if count < last.Events {
+			return errorf.E("restored database has %d events, the backup had %d", count,
+				last.Events)
+		}
+	}
+	for _, s := range last.Samples {
+		if err = r.verifyEvent(s); chk.E(err) {
+			return
+		}
+	}
+	log.I.F("restored %d backups with %d events to %s as of %s", len(backups), count, path,
+		time.Unix(last.Time, 0))
+	return
+}
+
+// loadBackup loads a backup file into the database.
+func loadBackup(db *badger.DB, path string) (err error) {
+	var f *os.File
+	if f, err = os.Open(path); chk.E(err) {
+		return
+	}
+	defer f.Close()
+	return db.Load(f, 256)
+}
+
+// verifyEvent checks that the event with a hex encoded id is in the database and its id is the
+// hash of its content.
+func (r *T) verifyEvent(eidHex string) (err error) {
+	var eid []byte
+	if eid, err = hex.Dec(eidHex); chk.E(err) {
+		return
+	}
+	var found bool
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Id.Key(id.New(eventid.NewWith(eid)))
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf) && !found; it.Next() {
+			ser := serial.FromKey(it.Item().Key())
+			var item *badger.Item
+			if item, err = txn.Get(prefixes.Event.Key(ser)); err != nil {
+				if errors.Is(err, badger.ErrKeyNotFound) {
+					err = nil
+					continue
+				}
+				return
+			}
+			var val []byte
+			if val, err = item.ValueCopy(nil); chk.E(err) {
+				return
+			}
+			if len(val) == sha256.Size {
+				// a pruned event is a stub containing its id
+				found = bytes.Equal(val, eid)
+				continue
+			}
+			ev := event.New()
+			if _, err = r.Unmarshal(ev, val); chk.E(err) {
+				return
+			}
+			found = bytes.Equal(ev.Id, eid) && bytes.Equal(ev.GetIDBytes(), eid)
+		}
+		return
+	})
+	if err == nil && !found {
+		err = errorf.E("sampled event %s is missing or corrupt in the restored database",
+			eidHex)
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package ratel
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/lol"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/units"
+)
+
+// backupEvents returns the number of event records in a backup file.
+func backupEvents(t *testing.T, path string) (n int) {
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = loadBackup(db, path); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.View(func(txn *badger.Txn) error {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			n++
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestBackupIncremental(t *testing.T) {
+	r := openTest(t)
+	dir := t.TempDir()
+	if last, err := r.LastBackup(dir); err != nil || !last.IsZero() {
+		t.Fatalf("empty backup directory has a last backup at %v: %v", last, err)
+	}
+	evs := sampleEvents(t, 5, 30)
+	saveAll(t, r, evs[:20]...)
+	if err := r.Backup(dir); err != nil {
+		t.Fatal(err)
+	}
+	// nothing has changed
+	if err := r.Backup(dir); err != nil {
+		t.Fatal(err)
+	}
+	saveAll(t, r, evs[20:]...)
+	if err := r.Backup(dir); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Backups) != 3 {
+		t.Fatalf("manifest lists %d backups, expected 3", len(m.Backups))
+	}
+	// each backup has all the changes after the one before it and none of those in it
+	for i, want := range []int{20, 0, 10} {
+		b := m.Backups[i]
+		if i > 0 && b.Since != m.Backups[i-1].Version {
+			t.Errorf("backup %d is since version %d, the one before is version %d", i, b.Since,
+				m.Backups[i-1].Version)
+		}
+		if n := backupEvents(t, filepath.Join(dir, b.File)); n != want {
+			t.Errorf("backup %d has %d events, expected %d", i, n, want)
+		}
+	}
+	last, err := r.LastBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Unix() != m.Backups[2].Time {
+		t.Errorf("last backup is at %v, the manifest has %d", last, m.Backups[2].Time)
+	}
+	restored := New(BackendParams{Ctx: context.Bg(), WG: &sync.WaitGroup{},
+		BlockCacheSize: 16 * units.Mb})
+	restored.Logger = NewLogger(lol.Off, "RATEL")
+	if err = restored.Restore(t.TempDir(), dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if count, _, err := restored.sampleEvents(); err != nil || count != len(evs) {
+		t.Fatalf("restored %d events, expected %d: %v", count, len(evs), err)
+	}
+}
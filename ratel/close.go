@@ -11,13 +11,21 @@ func (r *T) Close() (err error) {
 	// chk.E(r.DB.Sync())
 	r.WG.Wait()
 	log.I.F("closing database %s", r.Path())
-	if r.Flatten {
-		if err = r.DB.Flatten(4); chk.E(err) {
+	if !r.ReadOnly {
+		chk.E(r.flushStats())
+		if r.Flatten {
+			if err = r.DB.Flatten(4); chk.E(err) {
+			}
+			log.D.F("database flattened")
+		}
+		if err = r.seq.Release(); chk.E(err) {
+		}
+		if err = r.pubkeySeq.Release(); chk.E(err) {
 		}
-		log.D.F("database flattened")
-	}
-	if err = r.seq.Release(); chk.E(err) {
 	}
+	r.dictionaries.Lock()
+	r.dictionaries.close()
+	r.dictionaries.Unlock()
 	log.D.F("database released")
 	if err = r.DB.Close(); chk.E(err) {
 	}
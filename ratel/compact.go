@@ -1,34 +1,60 @@
 package ratel
 
 import (
+	"errors"
+
 	"relay.mleku.dev/chk"
+	"relay.mleku.dev/errorf"
 	"relay.mleku.dev/event"
 )
 
-// Unmarshal an event from bytes, using compact encoding if configured.
+// errUnknownDictionary is wrapped by the errors of event records that were compressed with a
+// zstd dictionary, or refer to a pubkey serial, that is not in the database. The record itself
+// may be intact, and decodes if the dictionary is restored.
+var errUnknownDictionary = errors.New("the dictionary the record refers to is not known")
+
+// Unmarshal an event from bytes, in whichever of the pubkey dictionary, compact or JSON
+// encodings it was stored, and decompressing it if it was compressed with a zstd dictionary.
 func (r *T) Unmarshal(ev *event.T, evb []byte) (rem []byte, err error) {
-	if r.UseCompact {
-		if rem, err = ev.UnmarshalCompact(evb); chk.E(err) {
-			ev = nil
-			evb = evb[:0]
-			return
-		}
-	} else {
-		if rem, err = ev.Unmarshal(evb); chk.E(err) {
-			ev = nil
-			evb = evb[:0]
+	if len(evb) == 0 {
+		err = errorf.E("empty event record")
+		return
+	}
+	if evb[0] == zstdEncoding {
+		if evb, err = r.decompress(evb); chk.E(err) {
 			return
 		}
 	}
+	switch evb[0] {
+	case dictionaryEncoding:
+		rem, err = r.unmarshalDictionary(ev, evb)
+	case '[':
+		rem, err = ev.UnmarshalCompact(evb)
+	default:
+		rem, err = ev.Unmarshal(evb)
+	}
+	if chk.E(err) {
+		ev = nil
+		evb = evb[:0]
+		return
+	}
 	return
 }
 
-// Marshal an event using compact encoding if configured.
+// Marshal an event using the pubkey dictionary encoding, or if the event can't be encoded that
+// way, the compact encoding if configured, otherwise JSON. With ZstdDictionary it is then
+// compressed with the dictionary of its kind family.
 func (r *T) Marshal(ev *event.T, dst []byte) (b []byte) {
-	if r.UseCompact {
-		b = ev.MarshalCompact(dst)
-	} else {
-		b = ev.Marshal(dst)
+	var err error
+	if b, err = r.marshalDictionary(ev, dst); chk.E(err) {
+		if r.UseCompact {
+			b = ev.MarshalCompact(dst)
+		} else {
+			b = ev.Marshal(dst)
+		}
+	}
+	if r.ZstdDictionary {
+		b = append(dst, r.compress(ev.Kind, b[len(dst):])...)
 	}
 	return
 }
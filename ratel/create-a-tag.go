@@ -1,10 +1,14 @@
 package ratel
 
 import (
+	"bytes"
 	"strings"
 
+	"github.com/dgraph-io/badger/v4"
+
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/event"
 	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/ratel/keys"
@@ -15,6 +19,7 @@ import (
 	"relay.mleku.dev/ratel/keys/pubkey"
 	"relay.mleku.dev/ratel/keys/serial"
 	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
 	"relay.mleku.dev/tag/atag"
 )
 
@@ -34,7 +39,7 @@ func Create_a_Tag(tagKey, tagValue string, CA *createdat.T,
 			if pkk, err = pubkey.NewFromBytes(pkb); chk.E(err) {
 				return
 			}
-			prf, elems = prefixes.Tag32, keys.Make(pkk, ser)
+			prf, elems = prefixes.Tag32, keys.Make(pkk, CA, ser)
 			return
 		} else {
 			err = nil
@@ -64,3 +69,41 @@ func Create_a_Tag(tagKey, tagValue string, CA *createdat.T,
 	elems = keys.Make(arb.New(tagValue), CA, ser)
 	return
 }
+
+func init() {
+	RegisterMigration(&Migration{
+		Version:     5,
+		Description: "add the created_at to the index of the pubkeys and event ids in tags",
+		Prefix:      prefixes.Event.Key(),
+		Step:        migrateTag32,
+	})
+}
+
+// migrateTag32 replaces the Tag32 keys of an event, which had only the pubkey prefix and the
+// serial, with ones that have its created_at between them. Stubs of events stored in an L2
+// can't be decoded, so their keys are left as they are and aren't found by searches.
+func migrateTag32(r *T, txn *badger.Txn, key, val []byte) (err error) {
+	if len(val) == sha256.Size {
+		return
+	}
+	ev := event.New()
+	if _, err = r.Unmarshal(ev, val); err != nil {
+		log.W.F("event %0x can't be decoded, its tag index is not migrated: %v", key, err)
+		return nil
+	}
+	ser := serial.FromKey(key)
+	// the pubkey serial is not in the Tag32 keys
+	for _, k := range GetIndexKeysForEvent(ev, ser, serial.New(serial.Make(0))) {
+		if k[0] != prefixes.Tag32.B() {
+			continue
+		}
+		old := append(bytes.Clone(k[:1+pubkey.Len]), ser.Val...)
+		if err = txn.Delete(old); chk.E(err) {
+			return
+		}
+		if err = txn.Set(k, nil); chk.E(err) {
+			return
+		}
+	}
+	return
+}
@@ -1,6 +1,8 @@
 package ratel
 
 import (
+	"errors"
+
 	"github.com/dgraph-io/badger/v4"
 
 	"relay.mleku.dev/chk"
@@ -21,6 +23,9 @@ import (
 // DeleteEvent deletes an event if it exists, and writes a tombstone for the event unless
 // requested not to, so that the event can't be saved again.
 func (r *T) DeleteEvent(c context.T, eid *eventid.T, noTombstone ...bool) (err error) {
+	if err = r.writable(); err != nil {
+		return
+	}
 	var foundSerial []byte
 	seri := serial.New(nil)
 	err = r.View(func(txn *badger.Txn) (err error) {
@@ -69,7 +74,9 @@ func (r *T) DeleteEvent(c context.T, eid *eventid.T, noTombstone ...bool) (err e
 				log.I.S(rem)
 			}
 			// log.I.S(rem, ev, seri)
-			indexKeys = GetIndexKeysForEvent(ev, seri)
+			if indexKeys, err = r.indexKeysForEvent(ev, seri); chk.E(err) {
+				return
+			}
 			// we don't make tombstones for replacements, but it is better to shift that
 			// logic outside of this closure.
 			if len(noTombstone) > 0 && !noTombstone[0] {
@@ -83,7 +90,17 @@ func (r *T) DeleteEvent(c context.T, eid *eventid.T, noTombstone ...bool) (err e
 	if chk.E(err) {
 		return
 	}
-	err = r.Update(func(txn *badger.Txn) (err error) {
+	var existed bool
+	err = r.updateUsage(func(txn *badger.Txn) (err error) {
+		// the event may have been deleted since it was read
+		if _, err = txn.Get(evKey); err == nil {
+			existed = true
+			if err = addUsage(txn, ev.Pubkey, -1, -int64(len(evb))); chk.E(err) {
+				return
+			}
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return
+		}
 		if err = txn.Delete(evKey); chk.E(err) {
 		}
 		for _, key := range indexKeys {
@@ -99,5 +116,8 @@ func (r *T) DeleteEvent(c context.T, eid *eventid.T, noTombstone ...bool) (err e
 		}
 		return
 	})
+	if err == nil && existed && len(indexKeys) > 0 {
+		r.countEvent(ev, -1)
+	}
 	return
 }
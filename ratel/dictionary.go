@@ -0,0 +1,373 @@
+package ratel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/keys/fullpubkey"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+// dictionaryEncoding is the first byte of an event record in the pubkey dictionary encoding,
+// it can't be the first byte of a JSON or compact encoded event.
+//
+// The encoding is the pubkey serial, created_at and kind as unsigned varints, then the number
+// of tags, and for each tag the number of fields followed by the fields. Each field starts
+// with an unsigned varint, if its low bit is zero the rest is the length of the field that
+// follows, otherwise the rest is the pubkey serial of the hex pubkey in a p tag. Then the
+// length of the content and the content, and last the 64 byte signature.
+const dictionaryEncoding = 0x01
+
+// oldFullIndexLen is the length of a FullIndex key with the full pubkey, before the pubkey
+// dictionary.
+const oldFullIndexLen = 1 + serial.Len + sha256.Size + schnorr.PubKeyBytesLen + serial.Len
+
+func init() {
+	RegisterMigration(&Migration{
+		Version:     2,
+		Description: "store pubkeys in events, p tags and the full index as pubkey serials",
+		Prefix:      prefixes.Event.Key(),
+		Step:        migrateDictionary,
+	})
+}
+
+// dryRunSerials is the first serial given to the pubkeys a dry run of the migrations would add
+// to the dictionary.
+const dryRunSerials = 1 << 56
+
+// pubkeyCacheSize is the number of pubkeys the dictionary cache holds before it is emptied.
+const pubkeyCacheSize = 1 << 16
+
+// pubkeyCache keeps the most recently used entries of the pubkey dictionary in memory.
+type pubkeyCache struct {
+	sync.Mutex
+	serials map[string]uint64
+	pubkeys map[uint64][]byte
+}
+
+func (c *pubkeyCache) serial(pk []byte) (ser uint64, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	ser, ok = c.serials[string(pk)]
+	return
+}
+
+func (c *pubkeyCache) pubkey(ser uint64) (pk []byte, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	pk, ok = c.pubkeys[ser]
+	return
+}
+
+func (c *pubkeyCache) add(pk []byte, ser uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.serials == nil || len(c.serials) >= pubkeyCacheSize {
+		c.serials = make(map[string]uint64)
+		c.pubkeys = make(map[uint64][]byte)
+	}
+	c.serials[string(pk)] = ser
+	c.pubkeys[ser] = pk
+}
+
+func (c *pubkeyCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.serials, c.pubkeys = nil, nil
+}
+
+// pubkeySerial returns the serial of a pubkey in the dictionary, adding it if it is not there.
+func (r *T) pubkeySerial(pk []byte) (ser uint64, err error) {
+	if len(pk) != schnorr.PubKeyBytesLen {
+		err = errorf.E("pubkey is %d bytes, expected %d", len(pk), schnorr.PubKeyBytesLen)
+		return
+	}
+	var ok bool
+	if ser, ok = r.pubkeys.serial(pk); ok {
+		return
+	}
+	if ser, ok, err = r.findPubkeySerial(pk); err != nil || ok {
+		if ok {
+			r.pubkeys.add(append([]byte(nil), pk...), ser)
+		}
+		return
+	}
+	// only one new entry at a time, so a pubkey can't get two serials
+	r.pubkeyMx.Lock()
+	defer r.pubkeyMx.Unlock()
+	if ser, ok, err = r.findPubkeySerial(pk); err != nil || ok {
+		if ok {
+			r.pubkeys.add(append([]byte(nil), pk...), ser)
+		}
+		return
+	}
+	if r.dryRunPubkeys != nil {
+		// a dry run of the migrations doesn't write the dictionary, the serials it gives are
+		// above those of the sequence
+		if ser, ok = r.dryRunPubkeys[string(pk)]; !ok {
+			ser = dryRunSerials + uint64(len(r.dryRunPubkeys))
+			r.dryRunPubkeys[string(pk)] = ser
+		}
+		return
+	}
+	if ser, err = r.pubkeySeq.Next(); chk.E(err) {
+		return
+	}
+	pk = append([]byte(nil), pk...)
+	s := serial.New(serial.Make(ser))
+	if err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Set(prefixes.PubkeyIndex.Key(fullpubkey.New(pk), s), nil); chk.E(err) {
+			return
+		}
+		return txn.Set(prefixes.PubkeySerial.Key(s), pk)
+	}); chk.E(err) {
+		return
+	}
+	r.pubkeys.add(pk, ser)
+	return
+}
+
+// findPubkeySerial looks up the serial of a pubkey in the dictionary.
+func (r *T) findPubkeySerial(pk []byte) (ser uint64, found bool, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.PubkeyIndex.Key(fullpubkey.New(pk))
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		it.Seek(prf)
+		if it.ValidForPrefix(prf) {
+			ser, found = serial.FromKey(it.Item().Key()).Uint64(), true
+		}
+		return
+	})
+	return
+}
+
+// pubkeyOf returns the pubkey with a serial in the dictionary.
+func (r *T) pubkeyOf(ser uint64) (pk []byte, err error) {
+	var ok bool
+	if pk, ok = r.pubkeys.pubkey(ser); ok {
+		return
+	}
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var item *badger.Item
+		if item, err = txn.Get(prefixes.PubkeySerial.Key(serial.New(serial.Make(ser)))); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = errorf.E("pubkey serial %d: %w", ser, errUnknownDictionary)
+			}
+			return
+		}
+		pk, err = item.ValueCopy(nil)
+		return
+	})
+	if err != nil {
+		return
+	}
+	r.pubkeys.add(pk, ser)
+	return
+}
+
+// isPubkeyHex returns the pubkey if a tag field is a lowercase hex pubkey, that is encoded back
+// to the same string.
+func isPubkeyHex(field []byte) (pk []byte) {
+	if len(field) != 2*schnorr.PubKeyBytesLen {
+		return
+	}
+	var err error
+	if pk, err = hex.Dec(string(field)); err != nil || hex.Enc(pk) != string(field) {
+		return nil
+	}
+	return
+}
+
+// marshalDictionary encodes an event with its pubkey and the pubkeys in its p tags replaced by
+// their pubkey serials, adding them to the dictionary if they are new.
+func (r *T) marshalDictionary(ev *event.T, dst []byte) (b []byte, err error) {
+	if len(ev.Sig) != schnorr.SignatureSize {
+		err = errorf.E("signature is %d bytes, expected %d", len(ev.Sig),
+			schnorr.SignatureSize)
+		return
+	}
+	var ser uint64
+	if ser, err = r.pubkeySerial(ev.Pubkey); err != nil {
+		return
+	}
+	b = append(dst, dictionaryEncoding)
+	b = binary.AppendUvarint(b, ser)
+	b = binary.AppendUvarint(b, ev.CreatedAt.U64())
+	b = binary.AppendUvarint(b, uint64(ev.Kind.ToU16()))
+	var tt []*tag.T
+	if ev.Tags.Len() > 0 {
+		tt = ev.Tags.ToSliceOfTags()
+	}
+	b = binary.AppendUvarint(b, uint64(len(tt)))
+	for _, t := range tt {
+		fields := t.ToSliceOfBytes()
+		b = binary.AppendUvarint(b, uint64(len(fields)))
+		for i, f := range fields {
+			if i == tag.Value && string(fields[tag.Key]) == "p" {
+				if pk := isPubkeyHex(f); pk != nil {
+					if ser, err = r.pubkeySerial(pk); err != nil {
+						return
+					}
+					b = binary.AppendUvarint(b, ser<<1|1)
+					continue
+				}
+			}
+			b = binary.AppendUvarint(b, uint64(len(f))<<1)
+			b = append(b, f...)
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(ev.Content)))
+	b = append(b, ev.Content...)
+	b = append(b, ev.Sig...)
+	return
+}
+
+// unmarshalDictionary decodes an event in the pubkey dictionary encoding. The Id is the hash of
+// its canonical form.
+func (r *T) unmarshalDictionary(ev *event.T, b []byte) (rem []byte, err error) {
+	rem = b[1:]
+	next := func() (u uint64) {
+		if err != nil {
+			return
+		}
+		var n int
+		if u, n = binary.Uvarint(rem); n <= 0 {
+			err = errorf.E("invalid varint in dictionary encoded event")
+			return
+		}
+		rem = rem[n:]
+		return
+	}
+	bytesOf := func(l uint64) (f []byte) {
+		if err != nil {
+			return
+		}
+		if uint64(len(rem)) < l {
+			err = errorf.E("dictionary encoded event is truncated")
+			return
+		}
+		f, rem = rem[:l], rem[l:]
+		return
+	}
+	pks := next()
+	ca := next()
+	k := next()
+	nt := next()
+	if err != nil {
+		return
+	}
+	if ev.Pubkey, err = r.pubkeyOf(pks); err != nil {
+		return
+	}
+	ev.CreatedAt = timestamp.FromUnix(int64(ca))
+	ev.Kind = kind.New(uint16(k))
+	ev.Tags = tags.New()
+	for range nt {
+		nf := next()
+		if err != nil || nf > uint64(len(rem)) {
+			return rem, errorf.E("invalid tag in dictionary encoded event")
+		}
+		fields := make([][]byte, 0, nf)
+		for range nf {
+			h := next()
+			if h&1 == 1 {
+				var pk []byte
+				if pk, err = r.pubkeyOf(h >> 1); err != nil {
+					return
+				}
+				fields = append(fields, []byte(hex.Enc(pk)))
+				continue
+			}
+			fields = append(fields, bytesOf(h>>1))
+		}
+		if err != nil {
+			return
+		}
+		ev.Tags.AppendTags(tag.New(fields...))
+	}
+	ev.Content = bytesOf(next())
+	ev.Sig = bytesOf(schnorr.SignatureSize)
+	if err != nil {
+		return
+	}
+	ev.Id = event.Hash(ev.ToCanonical(nil))
+	return
+}
+
+// migrateDictionary converts an event record to the pubkey dictionary encoding, and its
+// FullIndex key to have the pubkey serial. Records that can't be decoded, or whose id is not
+// the hash of their content, are left as they are for fsck to report.
+//
+// In a dry run the pubkeys it would add to the dictionary are only kept in memory, see
+// pubkeySerial.
+func migrateDictionary(r *T, txn *badger.Txn, key, val []byte) (err error) {
+	ser := serial.FromKey(key)
+	if len(val) != sha256.Size && len(val) > 0 && val[0] != dictionaryEncoding {
+		ev := event.New()
+		if _, err = r.Unmarshal(ev, val); err != nil {
+			log.W.F("event serial %d can't be decoded, not migrating it: %v", ser.Uint64(), err)
+			err = nil
+		} else if !bytes.Equal(ev.GetIDBytes(), ev.Id) {
+			log.W.F("event serial %d has an invalid id, not migrating it", ser.Uint64())
+		} else {
+			var b []byte
+			if b, err = r.marshalDictionary(ev, nil); err != nil {
+				log.W.F("event serial %d can't be dictionary encoded: %v", ser.Uint64(), err)
+				err = nil
+			} else if err = txn.Set(key, b); chk.E(err) {
+				return
+			}
+		}
+	}
+	// only one iterator can be open in the migration's transaction, so the index keys are found
+	// in another.
+	var old [][]byte
+	if err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.FullIndex.Key(ser)
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			if k := it.Item().Key(); len(k) == oldFullIndexLen {
+				old = append(old, it.Item().KeyCopy(nil))
+			}
+		}
+		return
+	}); chk.E(err) {
+		return
+	}
+	for _, k := range old {
+		pk := k[1+serial.Len+sha256.Size : 1+serial.Len+sha256.Size+schnorr.PubKeyBytesLen]
+		var pks uint64
+		if pks, err = r.pubkeySerial(pk); chk.E(err) {
+			return
+		}
+		nk := make([]byte, 0, len(k))
+		nk = append(nk, k[:1+serial.Len+sha256.Size]...)
+		nk = append(nk, serial.Make(pks)...)
+		nk = append(nk, k[1+serial.Len+sha256.Size+schnorr.PubKeyBytesLen:]...)
+		if err = txn.Delete(k); chk.E(err) {
+			return
+		}
+		if err = txn.Set(nk, nil); chk.E(err) {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,201 @@
+package ratel
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+// signedTags makes a text note with tags signed by a new key.
+func signedTags(t *testing.T, tt *tags.T) (ev *event.T) {
+	sign := new(p256k.Signer)
+	if err := sign.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.TextNote, Tags: tt,
+		Content: []byte("hello")}
+	if err := ev.Sign(sign); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// sameEvent fails the test if a decoded event is not the original, with a valid signature.
+func sameEvent(t *testing.T, name string, got, want *event.T) {
+	t.Helper()
+	if !bytes.Equal(got.Id, want.Id) || !bytes.Equal(got.Serialize(), want.Serialize()) {
+		t.Fatalf("%s: decoded\n%s\nexpected\n%s", name, got.Serialize(), want.Serialize())
+	}
+	if ok, err := got.Verify(); !ok || err != nil {
+		t.Fatalf("%s: decoded event has an invalid signature: %v", name, err)
+	}
+}
+
+func TestDictionaryRoundTrip(t *testing.T) {
+	r := openTest(t)
+	pk := strings.Repeat("ab", 32)
+	for name, tt := range map[string]*tags.T{
+		"nil tags":         nil,
+		"no tags":          tags.New(),
+		"allocated tags":   tags.NewWithCap(4),
+		"empty tag":        tags.New(tag.New[[]byte]()),
+		"p tag":            tags.New(tag.New("p", pk, "wss://relay.example")),
+		"uppercase P tag":  tags.New(tag.New("P", pk)),
+		"uppercase pubkey": tags.New(tag.New("p", strings.ToUpper(pk))),
+		"short p tag":      tags.New(tag.New("p", "abcd"), tag.New("p")),
+	} {
+		ev := signedTags(t, tt)
+		b, err := r.marshalDictionary(ev, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := &event.T{}
+		if _, err = r.unmarshalDictionary(got, b); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		sameEvent(t, name, got, ev)
+		// only the pubkeys of lowercase p tags are in the dictionary
+		switch literal := bytes.Contains(b, []byte(pk)); {
+		case name == "p tag" && literal:
+			t.Errorf("%s: pubkey of the tag is not dictionary encoded", name)
+		case name == "uppercase P tag" && !literal:
+			t.Errorf("%s: pubkey of the tag is dictionary encoded", name)
+		}
+	}
+}
+
+func TestDictionaryMigration(t *testing.T) {
+	r := openTest(t)
+	pk := strings.Repeat("cd", 32)
+	compact := signedTags(t, tags.New(tag.New("p", pk), tag.New("P", pk)))
+	plain := signedTags(t, tags.New())
+	// version 1 records, the compact and JSON encodings, with the full pubkey in the FullIndex
+	type record struct {
+		ev       *event.T
+		ser      *serial.T
+		val      []byte
+		oldIndex []byte
+	}
+	var records []record
+	for i, rec := range []record{
+		{ev: compact, val: compact.MarshalCompact(nil)},
+		{ev: plain, val: plain.Marshal(nil)},
+	} {
+		rec.ser = serial.New(serial.Make(uint64(1<<40 + i)))
+		rec.oldIndex = append(prefixes.FullIndex.Key(rec.ser), rec.ev.Id...)
+		rec.oldIndex = append(rec.oldIndex, rec.ev.Pubkey...)
+		rec.oldIndex = append(rec.oldIndex, rec.ev.CreatedAt.Bytes()...)
+		if len(rec.oldIndex) != oldFullIndexLen {
+			t.Fatalf("old full index key is %d bytes, expected %d", len(rec.oldIndex),
+				oldFullIndexLen)
+		}
+		records = append(records, rec)
+	}
+	for _, rec := range records {
+		key := prefixes.Event.Key(rec.ser)
+		if err := r.Update(func(txn *badger.Txn) (err error) {
+			if err = txn.Set(key, rec.val); err != nil {
+				return
+			}
+			return txn.Set(rec.oldIndex, nil)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Update(func(txn *badger.Txn) error {
+			return migrateDictionary(r, txn, key, rec.val)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, rec := range records {
+		pks, err := r.pubkeySerial(rec.ev.Pubkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newIndex := append(prefixes.FullIndex.Key(rec.ser), rec.ev.Id...)
+		newIndex = append(newIndex, serial.Make(pks)...)
+		newIndex = append(newIndex, rec.oldIndex[oldFullIndexLen-serial.Len:]...)
+		if err = r.View(func(txn *badger.Txn) (err error) {
+			var item *badger.Item
+			if item, err = txn.Get(prefixes.Event.Key(rec.ser)); err != nil {
+				return
+			}
+			var val []byte
+			if val, err = item.ValueCopy(nil); err != nil {
+				return
+			}
+			if val[0] != dictionaryEncoding {
+				t.Errorf("record of %s was not migrated", rec.ev.Serialize())
+			}
+			got := &event.T{}
+			if _, err = r.Unmarshal(got, val); err != nil {
+				return
+			}
+			sameEvent(t, "migrated", got, rec.ev)
+			if _, err = txn.Get(rec.oldIndex); err == nil {
+				t.Error("old full index key was not removed")
+			}
+			if _, err = txn.Get(newIndex); err != nil {
+				t.Errorf("full index key with the pubkey serial was not written: %v", err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDictionaryMigrationDryRun(t *testing.T) {
+	r := openTest(t)
+	pk := strings.Repeat("ef", 32)
+	tagged, err := hex.Dec(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := signedTags(t, tags.New(tag.New("p", pk)))
+	ser := serial.New(serial.Make(1 << 40))
+	if err := r.Update(func(txn *badger.Txn) error {
+		return txn.Set(prefixes.Event.Key(ser), ev.Marshal(nil))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = []*Migration{{Version: Version, Description: "test",
+		Prefix: prefixes.Event.Key(), Step: migrateDictionary}}
+	if err := r.Update(func(txn *badger.Txn) error {
+		return r.bumpVersion(txn, Version-1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Migrate(true); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("dry run returned %v", err)
+	}
+	// neither the author nor the pubkey in the p tag were added to the dictionary
+	for _, pub := range [][]byte{ev.Pubkey, tagged} {
+		if _, found, err := r.findPubkeySerial(pub); err != nil || found {
+			t.Errorf("dry run added pubkey %0x to the dictionary: %v", pub, err)
+		}
+	}
+	if err := r.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	for _, pub := range [][]byte{ev.Pubkey, tagged} {
+		if _, found, err := r.findPubkeySerial(pub); err != nil || !found {
+			t.Errorf("migration did not add pubkey %0x to the dictionary: %v", pub, err)
+		}
+	}
+}
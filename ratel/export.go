@@ -2,200 +2,216 @@ package ratel
 
 import (
 	"errors"
-	"fmt"
 	"io"
+	"slices"
 
 	"github.com/dgraph-io/badger/v4"
 
+	"relay.mleku.dev/archive"
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/context"
+	"relay.mleku.dev/errorf"
 	"relay.mleku.dev/event"
+	"relay.mleku.dev/eventid"
 	"relay.mleku.dev/filter"
-	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
-	"relay.mleku.dev/qu"
+	"relay.mleku.dev/ratel/keys/fullid"
+	"relay.mleku.dev/ratel/keys/id"
 	"relay.mleku.dev/ratel/keys/serial"
 	"relay.mleku.dev/ratel/prefixes"
 	"relay.mleku.dev/sha256"
-	"relay.mleku.dev/tag"
-	"relay.mleku.dev/tags"
+	"relay.mleku.dev/store"
 )
 
-// Export the complete database of stored events to an io.Writer in line structured minified
-// JSON.
-func (r *T) Export(c context.T, w io.Writer, pubkeys ...[]byte) {
+// exportFlushInterval is how many events are exported between flushes of a compressed stream,
+// so that a client has all but the last few if the connection drops.
+const exportFlushInterval = 1000
+
+// Export the events in the database that match the filter in the options, or all of them, to
+// an io.Writer in the requested format. The events are written in the order they were stored,
+// so an interrupted export can be resumed after the last event that was received.
+//
+// If the filter has ids, authors, kinds or tags the indexes are used to find the events,
+// otherwise all of them are scanned.
+func (r *T) Export(c context.T, w io.Writer, opts *store.ExportOptions) (err error) {
+	if opts == nil {
+		opts = &store.ExportOptions{}
+	}
+	var aw *archive.Writer
+	if aw, err = archive.NewWriter(w, opts.Format); chk.E(err) {
+		return
+	}
+	// the serial to start from
+	var from uint64
+	if len(opts.After) > 0 {
+		var after uint64
+		if after, err = r.serialOf(opts.After); err != nil {
+			return
+		}
+		from = after + 1
+		log.I.F("resuming export after event %0x", opts.After)
+	}
+	f := opts.Filter
 	var counter int
-	var err error
-	if len(pubkeys) > 0 {
-		var pks []string
-		for i := range pubkeys {
-			pks = append(pks, hex.Enc(pubkeys[i]))
+	write := func(item *badger.Item) (err error) {
+		if r.HasL2 && item.ValueSize() == sha256.Size {
+			// we aren't fetching from L2 for export, so don't send this back.
+			return
 		}
-		o := "["
-		for _, pk := range pks {
-			o += pk + ","
+		var val []byte
+		if val, err = item.ValueCopy(nil); chk.E(err) {
+			return
 		}
-		o += "]"
-		log.I.F("exporting selected pubkeys:\n%s", o)
-		keyChan := make(chan []byte, 256)
-		// specific set of public keys, so we need to run a search
-		fa := &filter.T{Authors: tag.New(pubkeys...)}
-		var queries []query
-		if queries, _, _, err = PrepareQueries(fa); chk.E(err) {
+		ev := event.New()
+		if _, err = r.Unmarshal(ev, val); err != nil {
+			// skip records that can't be decoded, fsck reports them
+			return nil
+		}
+		if f != nil && !f.Matches(ev) {
 			return
 		}
-		pTag := [][]byte{[]byte("#b")}
-		pTag = append(pTag, pubkeys...)
-		fp := &filter.T{Tags: tags.New(tag.New(pTag...))}
-		var queries2 []query
-		if queries2, _, _, err = PrepareQueries(fp); chk.E(err) {
+		if err = aw.Write(ev); err != nil {
 			return
 		}
-		queries = append(queries, queries2...)
-		// start up writer loop
-		quit := qu.T()
-		go func() {
-			for {
-				select {
-				case <-r.Ctx.Done():
-					return
-				case <-c.Done():
-					return
-				case <-quit:
-					return
-				case eventKey := <-keyChan:
-					err = r.View(func(txn *badger.Txn) (err error) {
-						select {
-						case <-r.Ctx.Done():
-							return
-						case <-c.Done():
-							return
-						case <-quit:
-							return
-						default:
-						}
-						opts := badger.IteratorOptions{Reverse: false}
-						it := txn.NewIterator(opts)
-						defer it.Close()
-						var count int
-						for it.Seek(eventKey); it.ValidForPrefix(eventKey); it.Next() {
-							count++
-							item := it.Item()
-							if r.HasL2 && item.ValueSize() == sha256.Size {
-								// we aren't fetching from L2 for export, so don't send this back.
-								return
-							}
-							if err = item.Value(func(eventValue []byte) (err error) {
-								// send the event to client (no need to re-encode it)
-								if _, err = fmt.Fprintf(w, "%s\n", eventValue); chk.E(err) {
-									return
-								}
-								return
-							}); chk.E(err) {
-								return
-							}
-						}
-						return
-					})
-					if chk.E(err) {
-					}
-				}
-			}
-		}()
-		// stop the writer loop
-		defer quit.Q()
-		for _, q := range queries {
-			select {
-			case <-r.Ctx.Done():
-				return
-			case <-c.Done():
+		counter++
+		if counter%exportFlushInterval == 0 {
+			log.I.F("%d events exported", counter)
+			if err = aw.Flush(); err != nil {
 				return
-			default:
 			}
-			// search for the keys generated from the filter
-			err = r.View(func(txn *badger.Txn) (err error) {
-				select {
-				case <-r.Ctx.Done():
-					return
-				case <-c.Done():
-					return
-				default:
+		}
+		return
+	}
+	if f != nil && (f.IDs.Len() > 0 || f.Authors.Len() > 0 || f.Kinds.Len() > 0 ||
+		f.Tags.Len() > 0) {
+		// specific events requested, so we need to run a search
+		var sers []uint64
+		if sers, err = r.exportSerials(c, f); chk.E(err) {
+			return
+		}
+		err = r.View(func(txn *badger.Txn) (err error) {
+			for _, ser := range sers {
+				if ser < from {
+					continue
 				}
-				opts := badger.IteratorOptions{
-					Reverse: true,
+				if err = c.Err(); err != nil {
+					return
 				}
-				it := txn.NewIterator(opts)
-				defer it.Close()
-				for it.Seek(q.start); it.ValidForPrefix(q.searchPrefix); it.Next() {
-					item := it.Item()
-					k := item.KeyCopy(nil)
-					evKey := prefixes.Event.Key(serial.FromKey(k))
-					counter++
-					if counter%1000 == 0 && counter > 0 {
-						log.I.F("%d events exported", counter)
+				var item *badger.Item
+				key := prefixes.Event.Key(serial.New(serial.Make(ser)))
+				if item, err = txn.Get(key); err != nil {
+					if errors.Is(err, badger.ErrKeyNotFound) {
+						err = nil
+						continue
 					}
-					keyChan <- evKey
+					return
 				}
-				return
-			})
-			if chk.E(err) {
-				// this means shutdown, probably
-				if errors.Is(err, badger.ErrDBClosed) {
+				if err = write(item); err != nil {
 					return
 				}
 			}
-		}
+			return
+		})
 	} else {
 		// blanket download requested
 		err = r.View(func(txn *badger.Txn) (err error) {
-			it := txn.NewIterator(badger.IteratorOptions{Prefix: prefixes.Event.Key()})
+			prf := prefixes.Event.Key()
+			it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
 			defer it.Close()
-			for it.Rewind(); it.Valid(); it.Next() {
+			it.Seek(prefixes.Event.Key(serial.New(serial.Make(from))))
+			for ; it.ValidForPrefix(prf); it.Next() {
 				select {
 				case <-r.Ctx.Done():
-					return
+					return r.Ctx.Err()
 				case <-c.Done():
-					return
+					return c.Err()
 				default:
 				}
-				item := it.Item()
-				b, e := item.ValueCopy(nil)
-				if chk.E(e) {
-					// already isn't the same as the return value!
-					// err = nil
-					continue
-				}
-				// send the event to client
-				if r.UseCompact {
-					ev := &event.T{}
-					var rem []byte
-					rem, err = ev.UnmarshalCompact(b)
-					if chk.E(err) {
-						err = nil
-						continue
-					}
-					if len(rem) > 0 {
-						log.I.S(rem)
-					}
-					if _, err = fmt.Fprintf(w, "%s\n", ev.Marshal(nil)); chk.E(err) {
-						return
-					}
-
-				} else {
-					// the database stores correct JSON versions so no need to decode/encode.
-					if _, err = fmt.Fprintf(w, "%s\n", b); chk.E(err) {
-						return
-					}
-				}
-				counter++
-				if counter%1000 == 0 && counter > 0 {
-					log.I.F("%d events exported", counter)
+				if err = write(it.Item()); err != nil {
+					return
 				}
 			}
 			return
 		})
-		chk.E(err)
+	}
+	if err != nil {
+		log.I.F("export stopped after %d events: %v", counter, err)
+		return
+	}
+	if err = aw.Close(); chk.E(err) {
+		return
 	}
 	log.I.Ln("exported", counter, "events")
 	return
 }
+
+// exportSerials returns the serials of the events found by the index searches for a filter,
+// in the order they were stored.
+func (r *T) exportSerials(c context.T, f *filter.T) (sers []uint64, err error) {
+	var queries []query
+	if queries, _, _, err = PrepareQueries(f); chk.E(err) {
+		return
+	}
+	found := make(map[uint64]struct{})
+	err = r.View(func(txn *badger.Txn) (err error) {
+		for _, q := range queries {
+			if len(q.searchPrefix) == 0 {
+				continue
+			}
+			it := txn.NewIterator(badger.IteratorOptions{Reverse: true})
+			start := q.start
+			if start == nil {
+				start = append(append([]byte(nil), q.searchPrefix...), 0xff)
+			}
+			for it.Seek(start); it.ValidForPrefix(q.searchPrefix); it.Next() {
+				if err = c.Err(); err != nil {
+					break
+				}
+				found[serial.FromKey(it.Item().Key()).Uint64()] = struct{}{}
+			}
+			it.Close()
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	for ser := range found {
+		sers = append(sers, ser)
+	}
+	slices.Sort(sers)
+	return
+}
+
+// serialOf returns the serial of the event with an id.
+func (r *T) serialOf(eid []byte) (ser uint64, err error) {
+	var found bool
+	err = r.View(func(txn *badger.Txn) (err error) {
+		ser, found = findSerial(txn, eid)
+		return
+	})
+	if err == nil && !found {
+		err = errorf.E("event %0x to resume the export after was not found", eid)
+	}
+	return
+}
+
+// findSerial returns the serial of the event with an id, and whether it was found.
+func findSerial(txn *badger.Txn, eid []byte) (ser uint64, found bool) {
+	prf := prefixes.Id.Key(id.New(eventid.NewWith(eid)))
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+	defer it.Close()
+	for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+		s := serial.FromKey(it.Item().Key())
+		// the id index has only a prefix of the id, the full id index has all of it
+		full := prefixes.FullIndex.Key(s, fullid.New(eventid.NewWith(eid)))
+		fit := txn.NewIterator(badger.IteratorOptions{Prefix: full})
+		fit.Seek(full)
+		found = fit.ValidForPrefix(full)
+		fit.Close()
+		if found {
+			return s.Uint64(), true
+		}
+	}
+	return
+}
@@ -42,23 +42,16 @@ func (r *T) FetchIds(c context.T, evIds *tag.T, out io.Writer) (err error) {
 			if b, err = item.ValueCopy(nil); chk.E(err) {
 				return
 			}
-			if r.UseCompact {
-				ev := &event.T{}
-				var rem []byte
-				if rem, err = ev.UnmarshalCompact(b); chk.E(err) {
-					return
-				}
-				if len(rem) > 0 {
-					log.I.S(rem)
-				}
-				if _, err = out.Write(ev.Serialize()); chk.E(err) {
-					return
-				}
-			} else {
-				// if db isn't using compact encoding the bytes are already right
-				if _, err = out.Write(b); chk.E(err) {
-					return
-				}
+			ev := &event.T{}
+			var rem []byte
+			if rem, err = r.Unmarshal(ev, b); chk.E(err) {
+				return
+			}
+			if len(rem) > 0 {
+				log.I.S(rem)
+			}
+			if _, err = out.Write(ev.Serialize()); chk.E(err) {
+				return
 			}
 			// add the new line after entries
 			if _, err = out.Write([]byte{'\n'}); chk.E(err) {
@@ -0,0 +1,229 @@
+package ratel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/keys"
+	"relay.mleku.dev/ratel/keys/createdat"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/timestamp"
+)
+
+// Fsck checks the consistency of the database, writing a line to w for each problem it finds
+// and a summary at the end.
+//
+// Every event record is decoded and its id and signature checked, and the index keys
+// GetIndexKeysForEvent generates for it must exist. Then the index and counter tables are
+// scanned for keys that refer to events that don't exist.
+//
+// With repair, missing index keys are written, and orphan index keys are deleted. Event records
+// that can't be decoded or are invalid are deleted along with their index keys, as they can't
+// be served. Records compressed with a zstd dictionary, or referring to a pubkey serial, that
+// is not in the database are only reported, the dictionary may have been lost and not the
+// record.
+func (r *T) Fsck(c context.T, w io.Writer, repair bool) (rep *store.FsckReport, err error) {
+	r.WG.Add(1)
+	defer r.WG.Done()
+	rep = &store.FsckReport{}
+	if repair {
+		if err = r.writable(); chk.E(err) {
+			return
+		}
+	}
+	wb := r.NewWriteBatch()
+	defer wb.Cancel()
+	report := func(format string, args ...any) {
+		if _, err := fmt.Fprintf(w, format+"\n", args...); err != nil {
+			log.D.F("fsck report: %v", err)
+		}
+	}
+	// the serials of the events that exist, or will after the repair
+	serials := make(map[uint64]struct{})
+	if err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf, PrefetchValues: true,
+			PrefetchSize: 100})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			if err = c.Err(); err != nil {
+				return
+			}
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			if len(key) != 1+serial.Len {
+				report("malformed event key %0x", key)
+				rep.Undecodable++
+				if repair {
+					if err = wb.Delete(key); chk.E(err) {
+						return
+					}
+					rep.Repaired++
+				}
+				continue
+			}
+			ser := serial.FromKey(key)
+			rep.Events++
+			if item.ValueSize() == sha256.Size {
+				rep.Stubs++
+				serials[ser.Uint64()] = struct{}{}
+				continue
+			}
+			var val []byte
+			if val, err = item.ValueCopy(nil); chk.E(err) {
+				return
+			}
+			var bad string
+			ev := event.New()
+			var valid bool
+			if _, err = r.Unmarshal(ev, val); errors.Is(err, errUnknownDictionary) {
+				// the record may be intact, it is kept until the dictionary is restored
+				report("event serial %d refers to an unknown dictionary: %v", ser.Uint64(), err)
+				rep.UnknownDictionary++
+				serials[ser.Uint64()] = struct{}{}
+				err = nil
+				continue
+			} else if err != nil {
+				report("undecodable event serial %d: %v", ser.Uint64(), err)
+				rep.Undecodable++
+				bad, err = "undecodable", nil
+			} else if id := indexedId(txn, ser); !bytes.Equal(ev.GetIDBytes(), ev.Id) ||
+				(id != nil && !bytes.Equal(ev.Id, id)) {
+				// the dictionary encoding has no id, it is the hash of the decoded event, so
+				// it is checked against the id in the FullIndex key.
+				report("id mismatch in event %0x serial %d", ev.Id, ser.Uint64())
+				rep.IdMismatches++
+				bad = "id mismatch"
+			} else if valid, err = ev.Verify(); err != nil || !valid {
+				report("bad signature on event %0x serial %d", ev.Id, ser.Uint64())
+				rep.BadSignatures++
+				bad, err = "bad signature", nil
+			}
+			if bad != "" {
+				if !repair {
+					serials[ser.Uint64()] = struct{}{}
+					continue
+				}
+				// the index keys are removed with the orphans
+				log.W.F("fsck deleting event serial %d: %s", ser.Uint64(), bad)
+				if err = wb.Delete(key); chk.E(err) {
+					return
+				}
+				rep.Repaired++
+				continue
+			}
+			serials[ser.Uint64()] = struct{}{}
+			var indexKeys [][]byte
+			if indexKeys, err = r.indexKeysForEvent(ev, ser); err != nil {
+				return
+			}
+			for _, k := range indexKeys {
+				if _, err = txn.Get(k); err == nil {
+					continue
+				} else if !errors.Is(err, badger.ErrKeyNotFound) {
+					return
+				}
+				err = nil
+				report("missing index %0x for event %0x serial %d", k, ev.Id, ser.Uint64())
+				rep.MissingIndexes++
+				if repair {
+					var v []byte
+					if k[0] == prefixes.Counter.B() {
+						v = keys.Write(createdat.New(timestamp.Now()))
+					}
+					if err = wb.Set(k, v); chk.E(err) {
+						return
+					}
+					rep.Repaired++
+				}
+			}
+			if rep.Events%10000 == 0 {
+				log.I.F("fsck checked %d events", rep.Events)
+			}
+		}
+		it.Close()
+		// the indexes are scanned in the same transaction as the events, so the events saved
+		// while the check runs are in neither, and their indexes are not taken for orphans.
+		tables := append([][]byte{prefixes.Counter.Key()}, prefixes.FilterPrefixes...)
+		for _, prf := range tables {
+			it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+			for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+				if err = c.Err(); err != nil {
+					break
+				}
+				key := it.Item().Key()
+				if ser, ok := indexSerial(key); ok {
+					if _, ok = serials[ser]; ok {
+						continue
+					}
+				}
+				if prf[0] == prefixes.Counter.B() {
+					report("orphan counter %0x", key)
+					rep.OrphanCounters++
+				} else {
+					report("orphan index %0x", key)
+					rep.OrphanIndexes++
+				}
+				if repair {
+					if err = wb.Delete(it.Item().KeyCopy(nil)); chk.E(err) {
+						break
+					}
+					rep.Repaired++
+				}
+			}
+			it.Close()
+			if err != nil {
+				return
+			}
+		}
+		return
+	}); err != nil {
+		return
+	}
+	if repair {
+		if err = wb.Flush(); chk.E(err) {
+			return
+		}
+	}
+	report("%s", rep)
+	return
+}
+
+// indexedId returns the event id in the FullIndex key of a serial, or nil if it has none.
+func indexedId(txn *badger.Txn, ser *serial.T) (id []byte) {
+	prf := prefixes.FullIndex.Key(ser)
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+	defer it.Close()
+	it.Seek(prf)
+	if it.ValidForPrefix(prf) {
+		if k := it.Item().Key(); len(k) >= len(prf)+sha256.Size {
+			id = bytes.Clone(k[len(prf) : len(prf)+sha256.Size])
+		}
+	}
+	return
+}
+
+// indexSerial returns the serial of the event an index key refers to. Most indexes end with
+// the serial, the full id index and counters have it after the prefix.
+func indexSerial(key []byte) (ser uint64, ok bool) {
+	if len(key) < 1+serial.Len {
+		return
+	}
+	switch key[0] {
+	case prefixes.FullIndex.B(), prefixes.Counter.B():
+		return binary.BigEndian.Uint64(key[1 : 1+serial.Len]), true
+	}
+	return binary.BigEndian.Uint64(key[len(key)-serial.Len:]), true
+}
@@ -0,0 +1,148 @@
+package ratel
+
+import (
+	"io"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/tags"
+)
+
+// changeRecord replaces the stored record of an event with what change returns for it.
+func changeRecord(t *testing.T, r *T, id []byte, change func(val []byte) []byte) {
+	s, err := r.serialOf(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := prefixes.Event.Key(serial.New(serial.Make(s)))
+	if err = r.Update(func(txn *badger.Txn) (err error) {
+		var item *badger.Item
+		if item, err = txn.Get(key); err != nil {
+			return
+		}
+		var val []byte
+		if val, err = item.ValueCopy(nil); err != nil {
+			return
+		}
+		return txn.Set(key, change(val))
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFsckIdMismatch(t *testing.T) {
+	r := openTest(t)
+	ev := signedTags(t, tags.New())
+	saveAll(t, r, ev)
+	// the dictionary encoding has no id, so a changed content makes another one
+	changeRecord(t, r, ev.Id, func(val []byte) []byte {
+		if val[0] != dictionaryEncoding {
+			t.Fatalf("record is not dictionary encoded")
+		}
+		// the content is before the signature
+		val[len(val)-len(ev.Sig)-1] ^= 1
+		return val
+	})
+	rep, err := r.Fsck(context.Bg(), io.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.IdMismatches != 1 {
+		t.Fatalf("changed content of a dictionary encoded event is not an id mismatch: %s",
+			rep)
+	}
+}
+
+func TestFsckRepairWhileSaving(t *testing.T) {
+	r := openTest(t)
+	evs := sampleEvents(t, 20, 3000)
+	saveAll(t, r, evs[:500]...)
+	// events are saved while the repair runs, none of their indexes may be taken for orphans
+	done := make(chan error)
+	go func() {
+		var err error
+		for _, ev := range evs[500:] {
+			if err = r.SaveEvent(context.Bg(), ev); err != nil {
+				break
+			}
+		}
+		done <- err
+	}()
+	for saving := true; saving; {
+		if _, err := r.Fsck(context.Bg(), io.Discard, true); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			saving = false
+		default:
+		}
+	}
+	rep, err := r.Fsck(context.Bg(), io.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Events != len(evs) || rep.MissingIndexes != 0 || rep.OrphanIndexes != 0 {
+		t.Fatalf("repair while saving broke the indexes: %s", rep)
+	}
+}
+
+func TestFsckUnknownDictionary(t *testing.T) {
+	r := openBench(t, t.TempDir(), "none", true)
+	defer r.Close()
+	evs := sampleEvents(t, 20, 1000)
+	saveAll(t, r, evs...)
+	if err := r.Rescan(); err != nil {
+		t.Fatal(err)
+	}
+	// the dictionary of the text notes is lost, their records are intact
+	if err := r.Update(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Dictionary.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		var lost [][]byte
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			if k := it.Item().Key(); len(k) > len(prf) && k[len(prf)] == familyText {
+				lost = append(lost, it.Item().KeyCopy(nil))
+			}
+		}
+		it.Close()
+		if len(lost) == 0 {
+			t.Fatal("text notes have no dictionary")
+		}
+		for _, k := range lost {
+			if err = txn.Delete(k); err != nil {
+				return
+			}
+		}
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.loadDictionaries(); err != nil {
+		t.Fatal(err)
+	}
+	// a record that can't be decoded whatever the dictionaries
+	changeRecord(t, r, evs[2].Id, func([]byte) []byte { return []byte("garbage") })
+	rep, err := r.Fsck(context.Bg(), io.Discard, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.UnknownDictionary == 0 || rep.Undecodable != 1 {
+		t.Fatalf("expected text notes with an unknown dictionary and one undecodable: %s", rep)
+	}
+	after, err := r.Fsck(context.Bg(), io.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Events != len(evs)-1 || after.UnknownDictionary != rep.UnknownDictionary ||
+		after.Undecodable != 0 {
+		t.Fatalf("repair deleted records with an unknown dictionary: %s", after)
+	}
+}
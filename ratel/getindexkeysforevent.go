@@ -10,7 +10,6 @@ import (
 	"relay.mleku.dev/ratel/keys"
 	"relay.mleku.dev/ratel/keys/createdat"
 	"relay.mleku.dev/ratel/keys/fullid"
-	"relay.mleku.dev/ratel/keys/fullpubkey"
 	"relay.mleku.dev/ratel/keys/id"
 	"relay.mleku.dev/ratel/keys/index"
 	"relay.mleku.dev/ratel/keys/kinder"
@@ -22,8 +21,8 @@ import (
 
 // GetIndexKeysForEvent generates all the index keys required to filter for events. evtSerial
 // should be the output of Serial() which gets a unique, monotonic counter value for each new
-// event.
-func GetIndexKeysForEvent(ev *event.T, ser *serial.T) (keyz [][]byte) {
+// event, and pks is the serial of the event's pubkey in the pubkey dictionary.
+func GetIndexKeysForEvent(ev *event.T, ser, pks *serial.T) (keyz [][]byte) {
 
 	var err error
 	keyz = make([][]byte, 0, 18)
@@ -32,7 +31,6 @@ func GetIndexKeysForEvent(ev *event.T, ser *serial.T) (keyz [][]byte) {
 	K := kinder.New(ev.Kind.ToU16())
 	PK, _ := pubkey.New(ev.Pubkey)
 	FID := fullid.New(eventid.NewWith(ev.Id))
-	FPK := fullpubkey.New(ev.Pubkey)
 	// indexes
 	{ // ~ by id
 		k := prefixes.Id.Key(ID, ser)
@@ -95,8 +93,19 @@ func GetIndexKeysForEvent(ev *event.T, ser *serial.T) (keyz [][]byte) {
 		keyz = append(keyz, k)
 	}
 	{ // - full Id index - enabling retrieving the event Id without unmarshalling the data
-		k := prefixes.FullIndex.Key(ser, FID, FPK, CA)
+		k := prefixes.FullIndex.Key(ser, FID, pks, CA)
 		keyz = append(keyz, k)
 	}
 	return
 }
+
+// indexKeysForEvent generates the index keys for an event, with the serial of its pubkey in the
+// pubkey dictionary, adding it if it is new.
+func (r *T) indexKeysForEvent(ev *event.T, ser *serial.T) (keyz [][]byte, err error) {
+	var pks uint64
+	if pks, err = r.pubkeySerial(ev.Pubkey); chk.E(err) {
+		return
+	}
+	keyz = GetIndexKeysForEvent(ev, ser, serial.New(serial.Make(pks)))
+	return
+}
@@ -17,7 +17,7 @@ import (
 //
 // - TagAddr:   [ 8 ][ 2b Kind ][ 8b Pubkey ][ address/URL ][ 8b Serial ]
 //
-// - Tag32:     [ 7 ][ 8b Pubkey ][ 8b Serial ]
+// - Tag32:     [ 7 ][ 8b Pubkey ][ 8b Timestamp ][ 8b Serial ]
 //
 // - Tag:       [ 6 ][ address/URL ][ 8b Serial ]
 //
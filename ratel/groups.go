@@ -0,0 +1,85 @@
+package ratel
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/groups"
+	"relay.mleku.dev/ratel/keys/arb"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// GetGroup returns the stored state of a NIP-29 group, or nil if the group doesn't exist.
+func (r *T) GetGroup(id string) (g *groups.Group, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var it *badger.Item
+		if it, err = txn.Get(prefixes.Group.Key(arb.New(id))); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		var b []byte
+		if b, err = it.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		g = &groups.Group{}
+		if err = json.Unmarshal(b, g); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// SetGroup stores the state of a NIP-29 group.
+func (r *T) SetGroup(g *groups.Group) (err error) {
+	var b []byte
+	if b, err = json.Marshal(g); chk.E(err) {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Set(prefixes.Group.Key(arb.New(g.Id)), b); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// DeleteGroup removes the state of a NIP-29 group.
+func (r *T) DeleteGroup(id string) (err error) {
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Delete(prefixes.Group.Key(arb.New(id))); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// Groups returns the state of all the NIP-29 groups stored in the database.
+func (r *T) Groups() (gs []*groups.Group, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Group.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			g := &groups.Group{}
+			if err = json.Unmarshal(b, g); chk.E(err) {
+				continue
+			}
+			gs = append(gs, g)
+		}
+		err = nil
+		return
+	})
+	return
+}
@@ -0,0 +1,39 @@
+package ratel
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// GetIdentity returns the stored secret key of the relay, or nil if none has been stored yet.
+func (r *T) GetIdentity() (sec []byte, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var it *badger.Item
+		if it, err = txn.Get(prefixes.Identity.Key()); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		if sec, err = it.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// SetIdentity stores the secret key of the relay.
+func (r *T) SetIdentity(sec []byte) (err error) {
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Set(prefixes.Identity.Key(), sec); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
@@ -1,49 +1,156 @@
 package ratel
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"io"
 
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/archive"
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/event"
+	"relay.mleku.dev/eventid"
+	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/keys/id"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/store"
 )
 
-const maxLen = 500000000
-
-// Import a collection of events in line structured minified JSON format (JSONL).
-func (r *T) Import(rr io.Reader) {
-	r.Flatten = true
+// Import a collection of events in any of the archive formats, which is detected from the
+// start of the stream. Each event's id and signature are verified, and if the options have an
+// Accept function it must accept the event. The events that are not saved are reported with
+// the reason.
+func (r *T) Import(rr io.Reader, opts *store.ImportOptions) (rep *store.ImportReport) {
+	if opts == nil {
+		opts = &store.ImportOptions{}
+	}
+	rep = &store.ImportReport{DryRun: opts.DryRun}
+	if err := r.writable(); err != nil && !opts.DryRun {
+		rep.Error = err.Error()
+		return
+	}
+	if !opts.DryRun {
+		r.Flatten = true
+	}
 	var err error
-	scan := bufio.NewScanner(rr)
-	buf := make([]byte, maxLen)
-	scan.Buffer(buf, maxLen)
-	var count, total int
-	for scan.Scan() {
-		b := scan.Bytes()
-		total += len(b) + 1
-		if len(b) < 1 {
+	var ar *archive.Reader
+	if ar, err = archive.NewReader(rr); chk.E(err) {
+		rep.Error = err.Error()
+		return
+	}
+	defer ar.Close()
+	rep.Format = string(ar.Format())
+	log.I.F("importing events in %s format, dry run %v", ar.Format(), opts.DryRun)
+	// the ids seen in a dry run, as they aren't saved to find duplicates with
+	seen := make(map[string]struct{})
+	for {
+		var ev *event.T
+		if ev, err = ar.Read(); err != nil {
+			if errors.Is(err, archive.ErrInvalid) {
+				rep.Read++
+				rep.Fail(&store.ImportFailure{Line: ar.Line(), Reason: store.ImportInvalid,
+					Message: err.Error()}, opts)
+				continue
+			}
+			if err != io.EOF {
+				log.E.F("import stopped at line %d: %v", ar.Line(), err)
+				rep.Error = err.Error()
+			}
+			break
+		}
+		rep.Read++
+		fail := func(reason, message string) {
+			rep.Fail(&store.ImportFailure{Line: ar.Line(), Id: hex.Enc(ev.Id),
+				Reason: reason, Message: message}, opts)
+		}
+		if !bytes.Equal(ev.GetIDBytes(), ev.Id) {
+			fail(store.ImportBadId, "id is not the hash of the event")
+			continue
+		}
+		var valid bool
+		if valid, err = ev.Verify(); err != nil || !valid {
+			fail(store.ImportBadSignature, "signature does not verify")
+			continue
+		}
+		if reason := r.importStatus(ev); reason != "" {
+			fail(reason, "")
 			continue
 		}
-		ev := &event.T{}
-		if _, err = ev.Unmarshal(b); err != nil {
+		var afterSave func()
+		if opts.Accept != nil {
+			var accept bool
+			var notice string
+			if accept, notice, afterSave = opts.Accept(r.Ctx, ev); !accept {
+				fail(store.ImportRejected, notice)
+				continue
+			}
+		}
+		if opts.DryRun {
+			if _, ok := seen[string(ev.Id)]; ok {
+				fail(store.ImportDuplicate, "")
+				continue
+			}
+			seen[string(ev.Id)] = struct{}{}
+			rep.Saved++
 			continue
 		}
 		if err = r.SaveEvent(r.Ctx, ev); err != nil {
+			if errors.Is(err, store.ErrDupEvent) {
+				fail(store.ImportDuplicate, "")
+			} else {
+				fail(store.ImportError, err.Error())
+			}
 			continue
 		}
-		count++
-		if count%1000 == 0 {
-			log.I.F("received %d events", count)
+		if afterSave != nil {
+			afterSave()
+		}
+		rep.Saved++
+		if rep.Saved%1000 == 0 {
+			log.I.F("received %d events", rep.Saved)
 		}
-		if count > 0 && count%10000 == 0 {
+		if rep.Saved%10000 == 0 {
 			chk.T(r.DB.Sync())
 			chk.T(r.DB.RunValueLogGC(0.5))
 		}
 	}
-	log.I.F("read %d bytes and saved %d events", total, count)
-	err = scan.Err()
-	if chk.E(err) {
-	}
+	log.I.F("read %d events and saved %d, failures: %v", rep.Read, rep.Saved, rep.Failed)
+	return
+}
+
+// importStatus returns the reason an event can't be imported if it has been deleted or is
+// already stored.
+func (r *T) importStatus(ev *event.T) (reason string) {
+	chk.E(r.View(func(txn *badger.Txn) (err error) {
+		ts := prefixes.Tombstone.Key(id.New(eventid.NewWith(ev.Id)))
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: ts})
+		it.Seek(ts)
+		tombstoned := it.ValidForPrefix(ts)
+		it.Close()
+		if tombstoned {
+			reason = store.ImportTombstoned
+			return
+		}
+		ser, found := findSerial(txn, ev.Id)
+		if !found {
+			return
+		}
+		var item *badger.Item
+		if item, err = txn.Get(prefixes.Event.Key(serial.New(serial.Make(ser)))); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		// a pruned event can be restored by importing it
+		if item.ValueSize() != sha256.Size {
+			reason = store.ImportDuplicate
+		}
+		return
+	}))
 	return
 }
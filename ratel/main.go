@@ -31,6 +31,17 @@ type T struct {
 	*badger.DB
 	// seq is the monotonic collision free index for raw event storage.
 	seq *badger.Sequence
+	// pubkeySeq is the sequence of the serials in the pubkey dictionary.
+	pubkeySeq *badger.Sequence
+	// pubkeyMx stops a pubkey being added to the dictionary twice.
+	pubkeyMx sync.Mutex
+	// usageMx stops the usage of authors being updated while it is recounted.
+	usageMx sync.RWMutex
+	// pubkeys caches the recently used entries of the pubkey dictionary.
+	pubkeys pubkeyCache
+	// dryRunPubkeys are the pubkeys a dry run of the migrations would add to the dictionary,
+	// with the serials they are given in memory. It is nil except during a dry run.
+	dryRunPubkeys map[string]uint64
 	// Threads is how many CPU threads we dedicate to concurrent actions, flatten and GC mark
 	Threads int
 	// MaxLimit is a default limit that applies to a query without a limit, to avoid sending out
@@ -40,12 +51,34 @@ type T struct {
 	// by running an import
 	Flatten bool
 	// UseCompact uses a compact encoding based on the canonical format (generate hash of it to
-	// get Id field with the signature in raw binary after.
+	// get Id field with the signature in raw binary after, for events that can't be stored in
+	// the pubkey dictionary encoding, otherwise they are stored as JSON.
 	UseCompact bool
-	// Compression sets the compression to use, none/snappy/zstd. If zstd compression is enabled
-	// there is less benefit to UseCompact, and instead of having to re-marshal the event it can
-	// be directly delivered from the form returned from the database.
+	// Compression sets the compression to use, none/snappy/zstd.
 	Compression string
+	// ZstdDictionary compresses each event record with a zstd dictionary trained from the
+	// stored events of its kind family. The dictionaries are trained when the database is
+	// opened if there are none, and again by a Rescan, which compresses all the records with
+	// the new ones.
+	ZstdDictionary bool
+	// dictionaries are the zstd dictionaries event records are compressed with.
+	dictionaries zstdDictionaries
+	// MigrateDryRun runs pending migrations without keeping their changes, to check them
+	// before they are applied. The store can't be opened until they are applied.
+	MigrateDryRun bool
+	// MigrateBackup writes a backup of the database to its directory before migrating it.
+	MigrateBackup bool
+	// stats are the changes to the event counts the query planner uses that are not yet
+	// written.
+	stats statistics
+	// ReadOnly opens the database read only, for a replica that serves queries from a
+	// snapshot of a database. Events can't be saved or deleted, and the access counters,
+	// statistics and migrations are not written.
+	ReadOnly bool
+	// retention is the rules for which events are kept, the others are pruned periodically.
+	retention retention
+	// backupMx stops incremental backups to the same directory running at the same time.
+	backupMx sync.Mutex
 }
 
 var _ store.I = (*T)(nil)
@@ -57,13 +90,28 @@ type BackendParams struct {
 	HasL2, UseCompact                  bool
 	BlockCacheSize, LogLevel, MaxLimit int
 	Compression                        string // none,snappy,zstd
+	ZstdDictionary                     bool
+	MigrateDryRun, MigrateBackup       bool
+	ReadOnly                           bool
 	Extra                              []int
 }
 
 // New configures a a new ratel.T event store.
-func New(p BackendParams) *T {
-	return GetBackend(p.Ctx, p.WG, p.HasL2, p.UseCompact, p.BlockCacheSize, p.LogLevel,
+func New(p BackendParams) (b *T) {
+	b = GetBackend(p.Ctx, p.WG, p.HasL2, p.UseCompact, p.BlockCacheSize, p.LogLevel,
 		p.MaxLimit, p.Compression)
+	b.MigrateDryRun, b.MigrateBackup = p.MigrateDryRun, p.MigrateBackup
+	b.ZstdDictionary = p.ZstdDictionary
+	b.ReadOnly = p.ReadOnly
+	return
+}
+
+// writable returns an error if the database is read only.
+func (r *T) writable() (err error) {
+	if r.ReadOnly {
+		err = store.ErrReadOnly
+	}
+	return
 }
 
 // GetBackend returns a reasonably configured badger.Backend.
@@ -0,0 +1,176 @@
+package ratel
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/admission"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/ratel/keys/arb"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// GetMember returns the paid membership of a pubkey, or nil if it has none.
+func (r *T) GetMember(pubkey []byte) (m *admission.Member, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var it *badger.Item
+		if it, err = txn.Get(prefixes.Member.Key(arb.New(pubkey))); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		var b []byte
+		if b, err = it.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		m = &admission.Member{}
+		if err = json.Unmarshal(b, m); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// SetMember stores the paid membership of a pubkey.
+func (r *T) SetMember(pubkey []byte, m *admission.Member) (err error) {
+	var b []byte
+	if b, err = json.Marshal(m); chk.E(err) {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Set(prefixes.Member.Key(arb.New(pubkey)), b); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// Members returns all the paid memberships, including expired ones.
+func (r *T) Members() (ms []*admission.Member, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prefixes.Member.Key()})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			m := &admission.Member{}
+			if err = json.Unmarshal(b, m); chk.E(err) {
+				continue
+			}
+			ms = append(ms, m)
+		}
+		err = nil
+		return
+	})
+	return
+}
+
+// SetInvoice stores an unpaid admission invoice.
+func (r *T) SetInvoice(inv *admission.Invoice) (err error) {
+	var b []byte
+	if b, err = json.Marshal(inv); chk.E(err) {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Set(prefixes.Invoice.Key(arb.New(inv.PaymentHash)), b); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// DeleteInvoice removes an admission invoice once it is paid or expired.
+func (r *T) DeleteInvoice(paymentHash string) (err error) {
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Delete(prefixes.Invoice.Key(arb.New(paymentHash))); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// SettleInvoice extends the membership of the pubkey of a paid admission invoice and removes
+// the invoice in one transaction, so it can't be counted twice. m is nil if the invoice is no
+// longer stored.
+func (r *T) SettleInvoice(paymentHash string) (m *admission.Member, err error) {
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		key := prefixes.Invoice.Key(arb.New(paymentHash))
+		var it *badger.Item
+		if it, err = txn.Get(key); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		var b []byte
+		if b, err = it.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		inv := &admission.Invoice{}
+		if err = json.Unmarshal(b, inv); chk.E(err) {
+			return
+		}
+		var pubkey []byte
+		if pubkey, err = hex.Dec(inv.Pubkey); chk.E(err) {
+			return
+		}
+		memberKey := prefixes.Member.Key(arb.New(pubkey))
+		var current *admission.Member
+		if it, err = txn.Get(memberKey); err == nil {
+			if b, err = it.ValueCopy(nil); chk.E(err) {
+				return
+			}
+			current = &admission.Member{}
+			if err = json.Unmarshal(b, current); chk.E(err) {
+				return
+			}
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return
+		}
+		ext := admission.Extend(current, inv.Pubkey, inv.Days)
+		if b, err = json.Marshal(ext); chk.E(err) {
+			return
+		}
+		if err = txn.Set(memberKey, b); chk.E(err) {
+			return
+		}
+		if err = txn.Delete(key); chk.E(err) {
+			return
+		}
+		m = ext
+		return
+	})
+	return
+}
+
+// Invoices returns the unpaid admission invoices.
+func (r *T) Invoices() (invs []*admission.Invoice, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prefixes.Invoice.Key()})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			inv := &admission.Invoice{}
+			if err = json.Unmarshal(b, inv); chk.E(err) {
+				continue
+			}
+			invs = append(invs, inv)
+		}
+		err = nil
+		return
+	})
+	return
+}
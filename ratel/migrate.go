@@ -0,0 +1,292 @@
+package ratel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// MigrationBatchSize is the number of records a migration changes in each transaction, and
+// how often it records a checkpoint to resume from.
+const MigrationBatchSize = 1000
+
+// Migration is a step that upgrades the database from the previous version to Version, by
+// applying Step to each record in the Prefix table.
+type Migration struct {
+	// Version is the database version after the migration.
+	Version uint16
+	// Description is logged when the migration runs.
+	Description string
+	// Prefix is the table the migration is applied to.
+	Prefix []byte
+	// Step changes one record, by setting or deleting keys in the transaction. It must not add
+	// keys to the Prefix table after the key it is given, or they will be visited again. If it
+	// returns an error the migration stops, and the batch it failed in is run again when the
+	// migration is resumed.
+	Step func(r *T, txn *badger.Txn, key, val []byte) (err error)
+}
+
+var migrations []*Migration
+
+// ErrDryRun is returned by Migrate after a dry run, so the relay exits after reporting instead
+// of serving. It is not a failure.
+var ErrDryRun = errors.New("dry run of migrations complete, the database was not changed")
+
+// RegisterMigration adds a migration to the list that is run when the database is opened.
+// Migrations are run in order of their version.
+func RegisterMigration(m *Migration) {
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+func init() {
+	RegisterMigration(&Migration{
+		Version:     1,
+		Description: "version 0 databases can't be migrated, only empty ones",
+		Prefix:      prefixes.Id.Key(),
+		Step: func(r *T, txn *badger.Txn, key, val []byte) (err error) {
+			return errorf.E("the database is at version 0, but in order to migrate up " +
+				"to version 1 you must manually export all the events and then import " +
+				"again:\n" +
+				"run an old version of this software, export the data, then delete the " +
+				"database files, run the new version, import the data back in")
+		},
+	})
+}
+
+// Migrate runs the migrations the database needs to reach the current Version. If a previous
+// migration was interrupted, it resumes from its checkpoint. Unless dryRun is set, a backup of
+// the database is written to its directory before a migration starts.
+//
+// With dryRun the migrations are run but their changes are discarded, to check that they will
+// succeed and how many records they change. ErrDryRun is returned if they would, even if there
+// are none to run.
+func (r *T) Migrate(dryRun bool) (err error) {
+	var version uint16
+	if version, err = r.version(); chk.E(err) {
+		return
+	}
+	var pending []*Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		if dryRun {
+			log.I.F("database is at version %d, no migrations are pending", version)
+			return ErrDryRun
+		}
+		return
+	}
+	if last := pending[len(pending)-1].Version; last != Version {
+		return errorf.E("migrations end at version %d but the current version is %d", last,
+			Version)
+	}
+	checkpointVersion, _ := r.migrationCheckpoint()
+	if dryRun {
+		r.pubkeyMx.Lock()
+		r.dryRunPubkeys = make(map[string]uint64)
+		r.pubkeyMx.Unlock()
+		defer func() {
+			r.pubkeyMx.Lock()
+			r.dryRunPubkeys = nil
+			r.pubkeyMx.Unlock()
+		}()
+	}
+	if !dryRun && checkpointVersion == 0 && r.MigrateBackup && !r.isEmpty() {
+		if err = r.backup(version); chk.E(err) {
+			return
+		}
+	}
+	for _, m := range pending {
+		if m.Version != version+1 {
+			return errorf.E("no migration from version %d to %d", version, version+1)
+		}
+		log.I.F("migrating database from version %d to %d: %s", version, m.Version,
+			m.Description)
+		var n int
+		if n, err = r.runMigration(m, dryRun); err != nil {
+			return
+		}
+		if dryRun {
+			log.I.F("dry run of migration to version %d would change %d records",
+				m.Version, n)
+			if len(r.dryRunPubkeys) > 0 {
+				log.I.F("dry run of migration to version %d would add %d pubkeys to the "+
+					"dictionary", m.Version, len(r.dryRunPubkeys))
+			}
+		} else {
+			log.I.F("migrated %d records to version %d", n, m.Version)
+		}
+		version = m.Version
+	}
+	if dryRun {
+		log.I.F("dry run of migrations complete, the database is still at version %d",
+			pending[0].Version-1)
+		return ErrDryRun
+	}
+	return
+}
+
+// version returns the version of the database, 0 if it has never been set.
+func (r *T) version() (version uint16, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var item *badger.Item
+		if item, err = txn.Get(prefixes.Version.Key()); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		return item.Value(func(val []byte) (err error) {
+			if len(val) >= 2 {
+				version = binary.BigEndian.Uint16(val)
+			}
+			return
+		})
+	})
+	return
+}
+
+// migrationCheckpoint returns the version being migrated to and the last key processed by an
+// interrupted migration, or zero if there is none.
+func (r *T) migrationCheckpoint() (version uint16, last []byte) {
+	chk.E(r.View(func(txn *badger.Txn) (err error) {
+		var item *badger.Item
+		if item, err = txn.Get(prefixes.Migration.Key()); err != nil {
+			return nil
+		}
+		var val []byte
+		if val, err = item.ValueCopy(nil); chk.E(err) || len(val) < 2 {
+			return
+		}
+		version, last = binary.BigEndian.Uint16(val), val[2:]
+		return
+	}))
+	return
+}
+
+// runMigration applies a migration in batches, recording a checkpoint with each batch so it
+// can resume, and sets the database version when it is complete.
+func (r *T) runMigration(m *Migration, dryRun bool) (n int, err error) {
+	var from []byte
+	if version, last := r.migrationCheckpoint(); version == m.Version && len(last) > 0 {
+		log.I.F("resuming migration to version %d after %d byte key %0x", m.Version,
+			len(last), last)
+		from = last
+	}
+	started := time.Now()
+	for {
+		var count int
+		var last []byte
+		batch := func(txn *badger.Txn) (err error) {
+			it := txn.NewIterator(badger.IteratorOptions{Prefix: m.Prefix,
+				PrefetchValues: true, PrefetchSize: 100})
+			defer it.Close()
+			if from == nil {
+				it.Seek(m.Prefix)
+			} else {
+				it.Seek(from)
+				if it.ValidForPrefix(m.Prefix) && bytes.Equal(it.Item().Key(), from) {
+					it.Next()
+				}
+			}
+			for ; it.ValidForPrefix(m.Prefix) && count < MigrationBatchSize; it.Next() {
+				key := it.Item().KeyCopy(nil)
+				var val []byte
+				if val, err = it.Item().ValueCopy(nil); chk.E(err) {
+					return
+				}
+				if err = m.Step(r, txn, key, val); err != nil {
+					return
+				}
+				last = key
+				count++
+			}
+			if dryRun || last == nil {
+				return
+			}
+			cp := binary.BigEndian.AppendUint16(nil, m.Version)
+			return txn.Set(prefixes.Migration.Key(), append(cp, last...))
+		}
+		if dryRun {
+			txn := r.NewTransaction(true)
+			err = batch(txn)
+			txn.Discard()
+		} else {
+			err = r.Update(batch)
+		}
+		if err != nil {
+			return
+		}
+		n += count
+		if count < MigrationBatchSize {
+			break
+		}
+		from = last
+		log.I.F("migration to version %d: %d records processed in %v", m.Version, n,
+			time.Since(started))
+	}
+	if dryRun {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = r.bumpVersion(txn, m.Version); chk.E(err) {
+			return
+		}
+		return txn.Delete(prefixes.Migration.Key())
+	})
+	return
+}
+
+func (r *T) bumpVersion(txn *badger.Txn, version uint16) error {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, version)
+	return txn.Set(prefixes.Version.Key(), buf)
+}
+
+// isEmpty returns true if the database has no events.
+func (r *T) isEmpty() (empty bool) {
+	empty = true
+	chk.E(r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		it.Seek(prf)
+		empty = !it.ValidForPrefix(prf)
+		return
+	}))
+	return
+}
+
+// backup writes a full backup of the database to its directory, as a checkpoint to restore if
+// a migration goes wrong.
+func (r *T) backup(version uint16) (err error) {
+	path := filepath.Join(r.dataDir, fmt.Sprintf("pre-migration-v%d-%d.bak", version,
+		time.Now().Unix()))
+	log.I.F("writing pre-migration backup to %s", path)
+	var f *os.File
+	if f, err = os.Create(path); chk.E(err) {
+		return
+	}
+	defer f.Close()
+	if _, err = r.DB.Backup(f, 0); chk.E(err) {
+		return
+	}
+	return f.Sync()
+}
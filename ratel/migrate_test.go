@@ -0,0 +1,135 @@
+package ratel
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// migratedPrefix is the table the test migration writes a key to for each event it visits.
+var migratedPrefix = []byte("test-migrated")
+
+// testMigration replaces the registered migrations with one from the previous version that
+// marks each event, failing once at the record failAt if it is not zero, and sets the database
+// back to the previous version.
+func testMigration(t *testing.T, r *T, failAt int) (steps *int) {
+	steps = new(int)
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = []*Migration{{
+		Version:     Version,
+		Description: "test",
+		Prefix:      prefixes.Event.Key(),
+		Step: func(r *T, txn *badger.Txn, key, val []byte) (err error) {
+			*steps++
+			if *steps == failAt {
+				failAt = 0
+				return errorf.E("failed at record %d", *steps)
+			}
+			return txn.Set(append(bytes.Clone(migratedPrefix), key...), nil)
+		},
+	}}
+	if err := r.Update(func(txn *badger.Txn) error {
+		return r.bumpVersion(txn, Version-1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// countMigrated returns the number of events the test migration has marked.
+func countMigrated(t *testing.T, r *T) (n int) {
+	if err := r.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: migratedPrefix})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestMigrateDryRunNothingPending(t *testing.T) {
+	r := openTest(t)
+	if err := r.Migrate(true); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("dry run with no pending migrations returned %v", err)
+	}
+	if err := r.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	r := openTest(t)
+	saveAll(t, r, sampleEvents(t, 5, 2500)...)
+	steps := testMigration(t, r, 0)
+	if err := r.Migrate(true); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("dry run of a pending migration returned %v", err)
+	}
+	if *steps != 2500 {
+		t.Fatalf("dry run visited %d records, expected 2500", *steps)
+	}
+	if n := countMigrated(t, r); n != 0 {
+		t.Fatalf("dry run kept the changes to %d records", n)
+	}
+	if version, err := r.version(); err != nil || version != Version-1 {
+		t.Fatalf("dry run changed the version to %d: %v", version, err)
+	}
+	if err := r.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	if n := countMigrated(t, r); n != 2500 {
+		t.Fatalf("migration changed %d records, expected 2500", n)
+	}
+	if version, err := r.version(); err != nil || version != Version {
+		t.Fatalf("migration left the database at version %d: %v", version, err)
+	}
+}
+
+func TestMigrateDryRunFails(t *testing.T) {
+	r := openTest(t)
+	saveAll(t, r, sampleEvents(t, 5, 100)...)
+	testMigration(t, r, 10)
+	if err := r.Migrate(true); err == nil || errors.Is(err, ErrDryRun) {
+		t.Fatalf("dry run of a failing migration returned %v", err)
+	}
+}
+
+func TestMigrateResume(t *testing.T) {
+	r := openTest(t)
+	saveAll(t, r, sampleEvents(t, 5, 2500)...)
+	steps := testMigration(t, r, MigrationBatchSize+10)
+	if err := r.Migrate(false); err == nil {
+		t.Fatal("failing migration did not return an error")
+	}
+	// the first batch is kept, the one that failed is run again
+	if n := countMigrated(t, r); n != MigrationBatchSize {
+		t.Fatalf("interrupted migration kept %d records, expected %d", n,
+			MigrationBatchSize)
+	}
+	if cp, _ := r.migrationCheckpoint(); cp != Version {
+		t.Fatalf("interrupted migration has checkpoint version %d", cp)
+	}
+	*steps = 0
+	if err := r.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	if *steps != 2500-MigrationBatchSize {
+		t.Fatalf("resumed migration visited %d records, expected %d", *steps,
+			2500-MigrationBatchSize)
+	}
+	if n := countMigrated(t, r); n != 2500 {
+		t.Fatalf("migration changed %d records, expected 2500", n)
+	}
+	if cp, _ := r.migrationCheckpoint(); cp != 0 {
+		t.Fatal("migration checkpoint was not removed when it completed")
+	}
+}
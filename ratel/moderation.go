@@ -0,0 +1,194 @@
+package ratel
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/moderation"
+	"relay.mleku.dev/ratel/keys/arb"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// getRecord decodes the JSON record stored at a key into v, found is false if there is none.
+func (r *T) getRecord(key []byte, v any) (found bool, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var it *badger.Item
+		if it, err = txn.Get(key); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		var b []byte
+		if b, err = it.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		if err = json.Unmarshal(b, v); chk.E(err) {
+			return
+		}
+		found = true
+		return
+	})
+	return
+}
+
+// setRecord stores v encoded as JSON at a key.
+func (r *T) setRecord(key []byte, v any) (err error) {
+	var b []byte
+	if b, err = json.Marshal(v); chk.E(err) {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Set(key, b); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// deleteRecord removes the record stored at a key.
+func (r *T) deleteRecord(key []byte) (err error) {
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Delete(key); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// GetCase returns the moderation case about an event id or pubkey, or nil if there is none.
+func (r *T) GetCase(target []byte) (c *moderation.Case, err error) {
+	c = &moderation.Case{}
+	var found bool
+	if found, err = r.getRecord(prefixes.Case.Key(arb.New(target)), c); err != nil || !found {
+		c = nil
+	}
+	return
+}
+
+// SetCase stores a moderation case.
+func (r *T) SetCase(c *moderation.Case) (err error) {
+	var target []byte
+	if target, err = hex.Dec(c.Target); chk.E(err) {
+		return
+	}
+	return r.setRecord(prefixes.Case.Key(arb.New(target)), c)
+}
+
+// DeleteCase removes the moderation case about an event id or pubkey.
+func (r *T) DeleteCase(target []byte) (err error) {
+	return r.deleteRecord(prefixes.Case.Key(arb.New(target)))
+}
+
+// Cases returns all the stored moderation cases.
+func (r *T) Cases() (cs []*moderation.Case, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Case.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			c := &moderation.Case{}
+			if err = json.Unmarshal(b, c); chk.E(err) {
+				continue
+			}
+			cs = append(cs, c)
+		}
+		err = nil
+		return
+	})
+	return
+}
+
+// GetBan returns the ban of a pubkey, or nil if it is not banned.
+func (r *T) GetBan(pubkey []byte) (b *moderation.Ban, err error) {
+	b = &moderation.Ban{}
+	var found bool
+	if found, err = r.getRecord(prefixes.Ban.Key(arb.New(pubkey)), b); err != nil || !found {
+		b = nil
+	}
+	return
+}
+
+// SetBan stores the ban of a pubkey.
+func (r *T) SetBan(b *moderation.Ban) (err error) {
+	var pubkey []byte
+	if pubkey, err = hex.Dec(b.Pubkey); chk.E(err) {
+		return
+	}
+	return r.setRecord(prefixes.Ban.Key(arb.New(pubkey)), b)
+}
+
+// DeleteBan lifts the ban of a pubkey.
+func (r *T) DeleteBan(pubkey []byte) (err error) {
+	return r.deleteRecord(prefixes.Ban.Key(arb.New(pubkey)))
+}
+
+// Bans returns all the banned pubkeys.
+func (r *T) Bans() (bs []*moderation.Ban, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Ban.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var v []byte
+			if v, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			b := &moderation.Ban{}
+			if err = json.Unmarshal(v, b); chk.E(err) {
+				continue
+			}
+			bs = append(bs, b)
+		}
+		err = nil
+		return
+	})
+	return
+}
+
+// Hide flags an event, or all the events of a pubkey, as hidden.
+func (r *T) Hide(h *moderation.Hide) (err error) {
+	var target []byte
+	if target, err = hex.Dec(h.Target); chk.E(err) {
+		return
+	}
+	return r.setRecord(prefixes.Hidden.Key(arb.New(target)), h)
+}
+
+// Unhide removes the hidden flag of an event id or pubkey.
+func (r *T) Unhide(target []byte) (err error) {
+	return r.deleteRecord(prefixes.Hidden.Key(arb.New(target)))
+}
+
+// Hidden returns all the hidden events and pubkeys.
+func (r *T) Hidden() (hs []*moderation.Hide, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Hidden.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			h := &moderation.Hide{}
+			if err = json.Unmarshal(b, h); chk.E(err) {
+				continue
+			}
+			hs = append(hs, h)
+		}
+		err = nil
+		return
+	})
+	return
+}
@@ -0,0 +1,140 @@
+package ratel
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/ratel/keys/arb"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/store"
+)
+
+// GetName returns the registration of a NIP-05 name, or nil if it isn't registered.
+func (r *T) GetName(name string) (reg *dns.Registration, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var it *badger.Item
+		if it, err = txn.Get(prefixes.Name.Key(arb.New(name))); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		var b []byte
+		if b, err = it.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		reg = &dns.Registration{}
+		if err = json.Unmarshal(b, reg); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// SetName stores the registration of a NIP-05 name.
+func (r *T) SetName(reg *dns.Registration) (err error) {
+	var b []byte
+	if b, err = json.Marshal(reg); chk.E(err) {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Set(prefixes.Name.Key(arb.New(reg.Name)), b); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// ClaimName stores the registration of a NIP-05 name claimed by a user, releasing the names
+// the user claimed before. The name is checked and set in one transaction, so of two users
+// claiming it at once only the first gets it, the other gets store.ErrNameTaken. A claim that
+// conflicts with another is run again so it sees the names as the other left them.
+func (r *T) ClaimName(reg *dns.Registration) (err error) {
+	var b []byte
+	if b, err = json.Marshal(reg); chk.E(err) {
+		return
+	}
+	key := prefixes.Name.Key(arb.New(reg.Name))
+	claim := func(txn *badger.Txn) (err error) {
+		var release [][]byte
+		prf := prefixes.Name.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		for it.Rewind(); it.Valid(); it.Next() {
+			var v []byte
+			if v, err = it.Item().ValueCopy(nil); chk.E(err) {
+				it.Close()
+				return
+			}
+			prev := &dns.Registration{}
+			if err = json.Unmarshal(v, prev); chk.E(err) {
+				err = nil
+				continue
+			}
+			if prev.Name == reg.Name {
+				if prev.Pubkey != reg.Pubkey {
+					it.Close()
+					return store.ErrNameTaken
+				}
+				continue
+			}
+			if prev.Claimed && prev.Pubkey == reg.Pubkey {
+				release = append(release, it.Item().KeyCopy(nil))
+			}
+		}
+		it.Close()
+		for _, k := range release {
+			if err = txn.Delete(k); chk.E(err) {
+				return
+			}
+		}
+		if err = txn.Set(key, b); chk.E(err) {
+			return
+		}
+		return
+	}
+	for {
+		if err = r.Update(claim); !errors.Is(err, badger.ErrConflict) {
+			return
+		}
+	}
+}
+
+// DeleteName removes the registration of a NIP-05 name.
+func (r *T) DeleteName(name string) (err error) {
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Delete(prefixes.Name.Key(arb.New(name))); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// Names returns all the registered NIP-05 names.
+func (r *T) Names() (regs []*dns.Registration, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Name.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			reg := &dns.Registration{}
+			if err = json.Unmarshal(b, reg); chk.E(err) {
+				continue
+			}
+			regs = append(regs, reg)
+		}
+		err = nil
+		return
+	})
+	return
+}
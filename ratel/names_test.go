@@ -0,0 +1,55 @@
+package ratel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/store"
+)
+
+func TestClaimNameConcurrent(t *testing.T) {
+	r := openTest(t)
+	const users = 8
+	var wg sync.WaitGroup
+	errs := make([]error, users)
+	for i := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.ClaimName(&dns.Registration{Name: "alice",
+				Pubkey: fmt.Sprintf("%064x", i+1), Claimed: true})
+		}()
+	}
+	wg.Wait()
+	var claimed int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			claimed++
+		case !errors.Is(err, store.ErrNameTaken):
+			t.Fatal(err)
+		}
+	}
+	if claimed != 1 {
+		t.Fatalf("%d users claimed the same name", claimed)
+	}
+	reg, err := r.GetName("alice")
+	if err != nil || reg == nil {
+		t.Fatalf("claimed name not found: %v", err)
+	}
+	// the owner of a name claims another, the first is released
+	if err = r.ClaimName(&dns.Registration{Name: "bob", Pubkey: reg.Pubkey,
+		Claimed: true}); err != nil {
+		t.Fatal(err)
+	}
+	regs, err := r.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 1 || regs[0].Name != "bob" {
+		t.Fatalf("names after claiming another are %v, expected only bob", regs)
+	}
+}
@@ -1,19 +1,34 @@
 package ratel
 
 import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/ratel/prefixes"
 )
 
-// Nuke wipes the database.
+// Nuke wipes the events and their indexes, the configuration and the NIP-05 names from the
+// database, keeping the payments, moderation, groups and the audit log.
 func (r *T) Nuke() (err error) {
+	if err = r.writable(); chk.E(err) {
+		return
+	}
 	log.W.F("nuking database at %s", r.dataDir)
 	log.I.S(prefixes.AllPrefixes)
 	if err = r.DB.DropPrefix(prefixes.AllPrefixes...); chk.E(err) {
 		return
 	}
-	if err = r.DB.RunValueLogGC(0.8); chk.E(err) {
+	r.pubkeys.reset()
+	r.stats.Lock()
+	r.stats.deltas = nil
+	r.stats.Unlock()
+	// there is nothing to collect if the events were small enough to be kept in the tables
+	if err = r.DB.RunValueLogGC(0.8); errors.Is(err, badger.ErrNoRewrite) {
+		err = nil
+	} else if chk.E(err) {
 		return
 	}
 	return
@@ -0,0 +1,54 @@
+package ratel
+
+import (
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/groups"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/moderation"
+)
+
+func TestNukeKeepsModerationAndGroups(t *testing.T) {
+	r := openTest(t)
+	evs := sampleEvents(t, 5, 50)
+	saveAll(t, r, evs...)
+	pubkey := hex.Enc(evs[0].Pubkey)
+	if err := r.SetBan(&moderation.Ban{Pubkey: pubkey, Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Hide(&moderation.Hide{Kind: moderation.TargetEvent,
+		Target: hex.Enc(evs[1].Id)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetCase(moderation.New(moderation.Target{Kind: moderation.TargetPubkey,
+		Id: evs[2].Pubkey})); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetGroup(groups.New("pizza", evs[0].Pubkey, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Nuke(); err != nil {
+		t.Fatal(err)
+	}
+	found, err := r.QueryEvents(context.Bg(), &filter.T{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("%d events left after a nuke", len(found))
+	}
+	if b, err := r.GetBan(evs[0].Pubkey); err != nil || b == nil {
+		t.Fatal("ban removed by a nuke")
+	}
+	if hs, err := r.Hidden(); err != nil || len(hs) != 1 {
+		t.Fatal("hidden event removed by a nuke")
+	}
+	if c, err := r.GetCase(evs[2].Pubkey); err != nil || c == nil {
+		t.Fatal("moderation case removed by a nuke")
+	}
+	if g, err := r.GetGroup("pizza"); err != nil || g == nil {
+		t.Fatal("group removed by a nuke")
+	}
+}
@@ -0,0 +1,429 @@
+package ratel
+
+import (
+	"encoding/binary"
+	"slices"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/ratel/keys/createdat"
+	"relay.mleku.dev/ratel/keys/pubkey"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/store"
+)
+
+const (
+	// planProbeKeys is the most index keys read from an index to count how many its searches
+	// for a filter find, with more than this the statistics are used to estimate it.
+	planProbeKeys = 1000
+	// planIntersectMin is the fewest keys the most selective index must be expected to find
+	// before other indexes are searched to intersect with it.
+	planIntersectMin = 256
+	// planIntersectRatio is how many times more keys than the most selective index another
+	// index may find and still be searched to intersect with it.
+	planIntersectRatio = 4
+)
+
+// planMaxKeys is the most keys collected from the searches of an index at once, the searches
+// continue from where they reached until the limit is found.
+var planMaxKeys = 100000
+
+// access is a way of finding the events that may match a filter, by a set of searches of
+// one index.
+type access struct {
+	index   string
+	queries []query
+	// estimate is the number of keys the searches are expected to find.
+	estimate int64
+	// exact is true if the estimate is a count of the keys, which are all in found.
+	exact bool
+	// covers is true if every event the searches find matches the filter.
+	covers bool
+	// statistic estimates the number of keys from the statistics.
+	statistic func() int64
+	// found is the created_at of each event serial the searches found.
+	found  map[uint64]uint64
+	chosen bool
+}
+
+// plan is how the events that match a filter are searched for.
+type plan struct {
+	candidates []*access
+	// ext is the filter the events found must be checked against, nil if the chosen index
+	// finds only events that match.
+	ext *filter.T
+	// since is the oldest created_at searched for and until is the one after the newest.
+	since, until uint64
+	// ascending searches the indexes oldest first.
+	ascending bool
+	// after is the position in the results the search starts after.
+	after *store.Cursor
+	// found is the created_at of each event serial found by all the chosen indexes.
+	found map[uint64]uint64
+	// next is the position the search continues after if the chosen index had more keys than
+	// could be collected at once, nil if it found them all.
+	next *store.Cursor
+	// scanned is the number of index keys read.
+	scanned int
+	// reached is the position the searches of the last incomplete scan all reached.
+	reached *store.Cursor
+}
+
+// candidates returns each of the indexes that can be searched for the events matching a
+// filter. Ids are exact and are only searched for alone.
+func (r *T) candidates(f *filter.T) (as []*access, err error) {
+	if f.IDs.Len() > 0 {
+		as = append(as, &access{index: "id", queries: idQueries(f),
+			estimate: int64(f.IDs.Len()), exact: true,
+			covers: f.Kinds.Len() == 0 && f.Authors.Len() == 0 && f.Tags.Len() == 0 &&
+				f.Since == nil && f.Until == nil})
+		return
+	}
+	var pubkeyPrefixes [][]byte
+	for _, pk := range f.Authors.ToSliceOfBytes() {
+		if len(pk) == schnorr.PubKeyBytesLen {
+			pubkeyPrefixes = append(pubkeyPrefixes, pk[:pubkey.Len])
+		}
+	}
+	kindCount := func(k uint16) int64 {
+		return r.stat(statKey(statKind, binary.BigEndian.AppendUint16(nil, k)))
+	}
+	switch {
+	case f.Authors.Len() > 0 && f.Kinds.Len() > 0:
+		as = append(as, &access{index: "pubkey-kind", queries: pubkeyKindQueries(f),
+			covers: f.Tags.Len() == 0,
+			statistic: func() (n int64) {
+				for _, pk := range pubkeyPrefixes {
+					byPubkey := r.stat(statKey(statPubkey, pk))
+					for _, k := range f.Kinds.K {
+						n += min(byPubkey, kindCount(k.K))
+					}
+				}
+				return
+			}})
+	case f.Authors.Len() > 0:
+		as = append(as, &access{index: "pubkey", queries: pubkeyQueries(f),
+			covers: f.Tags.Len() == 0,
+			statistic: func() (n int64) {
+				for _, pk := range pubkeyPrefixes {
+					n += r.stat(statKey(statPubkey, pk))
+				}
+				return
+			}})
+	case f.Kinds.Len() > 0:
+		as = append(as, &access{index: "kind", queries: kindQueries(f),
+			covers: f.Tags.Len() == 0,
+			statistic: func() (n int64) {
+				for _, k := range f.Kinds.K {
+					n += kindCount(k.K)
+				}
+				return
+			}})
+	}
+	for _, values := range f.Tags.ToSliceOfTags() {
+		qs := tagQueries(f, values)
+		if len(qs) == 0 {
+			continue
+		}
+		key := values.FilterKey()
+		// the tag indexes don't have the key, so the events they find must be checked, and
+		// the number of events with the key is more than the number with the values
+		as = append(as, &access{index: "tag " + string(key), queries: qs,
+			statistic: func() int64 { return r.stat(statKey(statTagKey, key)) }})
+	}
+	if f.Tags.Len() > 0 && len(as) == 0 {
+		err = errorf.E("empty tag filters")
+		return
+	}
+	if len(as) == 0 || f.Since != nil {
+		// a recent since can make the newest events the best to search
+		as = append(as, &access{index: "created_at",
+			queries: []query{{queryFilter: f, searchPrefix: prefixes.CreatedAt.Key()}},
+			covers:  len(as) == 0,
+			statistic: func() int64 {
+				return r.stat(statKey(statTotal, nil))
+			}})
+	}
+	return
+}
+
+// planQuery chooses the indexes to search for the events matching a filter and searches
+// them. The number of keys each index finds is counted by searching it, up to planProbeKeys
+// keys or the limit if it is less, and past that it is estimated from the statistics, which are
+// also used to choose the order the indexes are counted in. The index expected to find the
+// fewest is searched, and if its results must be checked against the filter, it is
+// intersected with the others expected to find not many more.
+//
+// If the chosen index covers the whole filter, each of its searches finds at most limit keys,
+// as they are found in order, newest first unless ascending is set. If after is not nil the
+// searches start after that position. If the chosen index has more than planMaxKeys keys, next
+// is set in the plan to where the search continues from to find more.
+func (r *T) planQuery(c context.T, f *filter.T, limit int, ascending bool,
+	after *store.Cursor) (p *plan, err error) {
+
+	if f == nil {
+		err = errorf.E("filter cannot be nil")
+		return
+	}
+	p = &plan{ascending: ascending, after: after}
+	if p.candidates, err = r.candidates(f); err != nil {
+		return
+	}
+	for _, a := range p.candidates {
+		p.since, p.until = queryRange(f, a.queries)
+	}
+	for _, a := range p.candidates {
+		if !a.exact {
+			a.estimate = a.statistic()
+		}
+	}
+	bySize := func(a, b *access) int {
+		switch {
+		case a.estimate < b.estimate:
+			return -1
+		case a.estimate > b.estimate:
+			return 1
+		}
+		return 0
+	}
+	// count the keys of the indexes expected to be smallest first, and stop when one is
+	// found to be small enough to need no other. There is nothing to choose between if there
+	// is one index, and no more keys than the limit are needed to tell the indexes apart.
+	slices.SortStableFunc(p.candidates, bySize)
+	probe := planProbeKeys
+	if limit > 0 {
+		probe = min(probe, limit)
+	}
+	for _, a := range p.candidates {
+		if len(p.candidates) == 1 {
+			break
+		}
+		if a.exact {
+			if a.estimate <= planIntersectMin {
+				break
+			}
+			continue
+		}
+		var complete bool
+		if a.found, complete, err = r.scan(c, p, a, 0, probe); err != nil {
+			return
+		}
+		if complete {
+			a.estimate, a.exact = int64(len(a.found)), true
+			if a.estimate <= planIntersectMin {
+				break
+			}
+		} else {
+			a.estimate, a.found = max(a.estimate, int64(probe)+1), nil
+		}
+	}
+	slices.SortStableFunc(p.candidates, bySize)
+	best := p.candidates[0]
+	best.chosen = true
+	if best.found == nil {
+		perQuery := 0
+		if best.covers {
+			perQuery = limit
+		}
+		var complete bool
+		if best.found, complete, err = r.scan(c, p, best, perQuery, planMaxKeys); err != nil {
+			return
+		}
+		if !complete {
+			// the keys found are those up to the position each search reached, the rest are
+			// searched for from there if the limit isn't reached with them
+			p.next = p.reached
+		}
+	}
+	p.found = best.found
+	if best.covers {
+		return
+	}
+	ext := *f
+	ext.Limit = nil
+	p.ext = &ext
+	if best.estimate <= planIntersectMin {
+		return
+	}
+	for _, a := range p.candidates[1:] {
+		if a.estimate > best.estimate*planIntersectRatio {
+			break
+		}
+		if a.found == nil {
+			var complete bool
+			if a.found, complete, err = r.scan(c, p, a, 0, planMaxKeys); err != nil {
+				return
+			}
+			if !complete {
+				// events it didn't find can't be excluded
+				a.found = nil
+				continue
+			}
+		}
+		a.chosen = true
+		for ser := range p.found {
+			if _, ok := a.found[ser]; !ok {
+				delete(p.found, ser)
+			}
+		}
+	}
+	return
+}
+
+// scan searches an index for the keys of an access in order, reading at most perQuery keys
+// from each search if it is not zero. If more than most keys are found complete is false, each
+// search reads its share of most, and only the keys up to the position all the searches reached
+// are returned, which is p.reached.
+func (r *T) scan(c context.T, p *plan, a *access, perQuery, most int) (
+	found map[uint64]uint64, complete bool, err error) {
+
+	found = make(map[uint64]uint64)
+	complete = true
+	share := max(most/len(a.queries), 1)
+	var reached *store.Cursor
+	err = r.View(func(txn *badger.Txn) (err error) {
+		for _, q := range a.queries {
+			// iterate only through keys
+			it := txn.NewIterator(badger.IteratorOptions{Reverse: !p.ascending})
+			var n int
+			for it.Seek(p.seek(q)); it.ValidForPrefix(q.searchPrefix); it.Next() {
+				if err = c.Err(); err != nil {
+					break
+				}
+				if err = r.Ctx.Err(); err != nil {
+					break
+				}
+				k := it.Item().Key()
+				var ts uint64
+				ser := serial.FromKey(k).Uint64()
+				if !q.skipTS {
+					if len(k) < len(q.searchPrefix)+createdat.Len+serial.Len {
+						continue
+					}
+					ts = createdat.FromKey(k).Val.U64()
+					if p.ascending && ts >= p.until || !p.ascending && ts < p.since {
+						break
+					}
+					if !p.isAfter(ts, ser) {
+						continue
+					}
+				}
+				p.scanned++
+				found[ser] = ts
+				if n++; perQuery > 0 && n >= perQuery {
+					break
+				}
+				if n >= share {
+					complete = false
+					if q.skipTS {
+						// searches without created_at are in no order to continue from
+						break
+					}
+					// the search that reached the least far limits where all are complete
+					pos := &store.Cursor{Ts: int64(ts), Ser: ser}
+					if reached == nil || pos.Before(reached.Ts, reached.Ser, p.ascending) {
+						reached = pos
+					}
+					break
+				}
+			}
+			it.Close()
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	if reached != nil {
+		for ser, ts := range found {
+			if reached.Before(int64(ts), ser, p.ascending) {
+				delete(found, ser)
+			}
+		}
+	}
+	p.reached = reached
+	return
+}
+
+// seek returns the key the search of an index starts from, the start of the time range of the
+// filter, or the position the search continues after.
+func (p *plan) seek(q query) (start []byte) {
+	switch {
+	case q.skipTS && p.ascending:
+		return q.searchPrefix
+	case q.skipTS:
+		return q.start
+	case p.ascending:
+		start = binary.BigEndian.AppendUint64(q.searchPrefix, p.since)
+		if p.after != nil && uint64(p.after.Ts) >= p.since {
+			start = binary.BigEndian.AppendUint64(q.searchPrefix, uint64(p.after.Ts))
+			start = binary.BigEndian.AppendUint64(start, p.after.Ser+1)
+		}
+	default:
+		start = q.start
+		if p.after != nil && uint64(p.after.Ts) < p.until {
+			start = binary.BigEndian.AppendUint64(q.searchPrefix, uint64(p.after.Ts))
+			start = binary.BigEndian.AppendUint64(start, p.after.Ser)
+		}
+	}
+	return
+}
+
+// isAfter returns true if an event at a created_at and serial is after the position the
+// search continues from, in the order of the search.
+func (p *plan) isAfter(ts, ser uint64) bool {
+	if p.after == nil {
+		return true
+	}
+	return p.after.Before(int64(ts), ser, p.ascending)
+}
+
+// serials returns the serials the plan found in order, newest first unless ascending.
+func (p *plan) serials() (sers []uint64) {
+	for ser := range p.found {
+		sers = append(sers, ser)
+	}
+	slices.SortFunc(sers, func(a, b uint64) (n int) {
+		// events found by id have no created_at, they are stored in order of their serial
+		switch ta, tb := p.found[a], p.found[b]; {
+		case ta > tb:
+			n = -1
+		case ta < tb:
+			n = 1
+		case a > b:
+			n = -1
+		case a < b:
+			n = 1
+		}
+		if p.ascending {
+			n = -n
+		}
+		return
+	})
+	return
+}
+
+// explain adds the indexes the plan considered to an explanation.
+func (p *plan) explain(ex *store.Explanation) {
+	for _, a := range p.candidates {
+		ex.Plan = append(ex.Plan, store.PlanIndex{Index: a.index, Queries: len(a.queries),
+			Estimate: a.estimate, Exact: a.exact, Chosen: a.chosen})
+	}
+	ex.KeysScanned += p.scanned
+}
+
+// Explain searches for the events matching a filter as QueryEvents does, and reports the
+// indexes that were considered and chosen, and how many keys and events were read.
+func (r *T) Explain(c context.T, f *filter.T) (ex *store.Explanation, err error) {
+	ex = &store.Explanation{Filter: string(f.Serialize())}
+	if _, err = r.queryEvents(c, f, ex); chk.E(err) {
+		return
+	}
+	return
+}
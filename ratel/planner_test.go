@@ -0,0 +1,97 @@
+package ratel
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+func TestPlanQueryProbes(t *testing.T) {
+	r := openTest(t)
+	evs := sampleEvents(t, 20, 3000)
+	saveAll(t, r, evs...)
+	c := context.Bg()
+	// one index, nothing to probe, and the search stops at the limit
+	p, err := r.planQuery(c, &filter.T{Kinds: kinds.New(kind.TextNote)}, 20, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.found) != 20 || p.scanned > 20 {
+		t.Fatalf("found %d events reading %d keys for a limit of 20", len(p.found), p.scanned)
+	}
+	// two indexes probed for no more than the limit still find the events that match
+	var pk string
+	for _, ev := range evs {
+		if ev.Kind.Equal(kind.Reaction) {
+			pk = string(ev.Tags.GetFirst(tag.New("p")).Value())
+			break
+		}
+	}
+	f := &filter.T{Kinds: kinds.New(kind.Reaction), Tags: tags.New(tag.New("#p", pk))}
+	limit := uint(5)
+	f.Limit = &limit
+	found, err := r.QueryEvents(c, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 5 {
+		t.Fatalf("expected 5 reactions, found %d", len(found))
+	}
+	for _, ev := range found {
+		if !f.Matches(ev) {
+			t.Fatalf("found an event that doesn't match the filter %s", ev.Serialize())
+		}
+	}
+}
+
+func TestPlanQueryMaxKeys(t *testing.T) {
+	r := openTest(t)
+	saved := planMaxKeys
+	t.Cleanup(func() { planMaxKeys = saved })
+	planMaxKeys = 40
+	now := timestamp.Now().I64()
+	evs, filters := pagingEvents(t, 250, func(i int) *timestamp.T {
+		return timestamp.FromUnix(now - int64(i*97%250))
+	})
+	saveAll(t, r, evs...)
+	// the searches continue from where they reached until the limit is found
+	since := timestamp.FromUnix(now - 200)
+	for name, f := range filters {
+		f.Since = since
+		limit := uint(45)
+		f.Limit = &limit
+		var want event.Ts
+		for _, ev := range evs {
+			if f.Matches(ev) {
+				want = append(want, ev)
+			}
+		}
+		sort.Sort(want)
+		want = want[:min(len(want), 45)]
+		found, err := r.QueryEvents(context.Bg(), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != len(want) {
+			t.Fatalf("%s: found %d events, expected %d", name, len(found), len(want))
+		}
+		for i := range found {
+			if !bytes.Equal(found[i].Id, want[i].Id) {
+				t.Fatalf("%s: event %d is %s, expected %s", name, i, found[i].Serialize(),
+					want[i].Serialize())
+			}
+		}
+		f.Limit = nil
+		filters[name] = f
+	}
+	testPaging(t, r, evs, filters, 45)
+}
@@ -86,11 +86,8 @@ const (
 	Tombstone
 
 	// PubkeyIndex is the prefix for an index that stores a mapping between pubkeys and a pubkey
-	// serial.
-	//
-	// todo: this is useful feature but rather than for saving space on pubkeys in
-	//       events might have a more useful place in some kind of search API. eg just
-	//       want pubkey from event id, combined with FullIndex.
+	// serial. The pubkey serial is used in place of the pubkey of stored events, their p tags
+	// and the FullIndex, and PubkeySerial maps it back to the pubkey.
 	//
 	// [ 12 ][ 32 bytes pubkey ][ 8 bytes pubkey serial ]
 	PubkeyIndex
@@ -104,7 +101,7 @@ const (
 	// created_at field. The serial acts as a "first seen" ordering, then you also have the
 	// (claimed) chronological ordering.
 	//
-	//   [ 13 ][ 8 bytes Serial ][ 32 bytes eventid.T ][ 32 bytes pubkey ][ 8 bytes timestamp.T ]
+	//   [ 13 ][ 8 bytes Serial ][ 32 bytes eventid.T ][ 8 bytes pubkey serial ][ 8 bytes timestamp.T ]
 	FullIndex
 
 	// Configuration is a free-form minified JSON object that contains a collection of
@@ -112,6 +109,99 @@ const (
 	//
 	// [ 14 ]
 	Configuration
+
+	// Group stores the JSON encoded state of a NIP-29 relay based group. It is not removed by a
+	// nuke, as the groups and their members are kept in memory while the relay runs.
+	//
+	//   [ 15 ][ group id ]
+	Group
+
+	// Identity stores the secret key the relay uses to sign the events it generates.
+	//
+	//   [ 16 ]
+	Identity
+
+	// Name stores the JSON encoded registration of a name served by the NIP-05 identity
+	// server.
+	//
+	//   [ 17 ][ name ]
+	Name
+
+	// Verification stores the JSON encoded result of verifying the NIP-05 identifier of a
+	// pubkey, with a TTL so stale results are eventually dropped.
+	//
+	//   [ 18 ][ 32 bytes pubkey ]
+	Verification
+
+	// Member stores the JSON encoded paid membership of a pubkey. It is not removed by a nuke,
+	// as it records payments.
+	//
+	//   [ 19 ][ 32 bytes pubkey ]
+	Member
+
+	// Invoice stores the JSON encoded unpaid invoices issued for paid admission.
+	//
+	//   [ 20 ][ payment hash ]
+	Invoice
+
+	// Migration is the checkpoint of a migration in progress, the version being migrated to
+	// and the last key that was processed, so an interrupted migration can resume.
+	//
+	//   [ 21 ] : value: [ 2 bytes version ][ last key ]
+	Migration
+
+	// PubkeySerial is the reverse of PubkeyIndex, mapping a pubkey serial to the pubkey.
+	//
+	//   [ 22 ][ 8 bytes pubkey serial ] : value: [ 32 bytes pubkey ]
+	PubkeySerial
+
+	// Dictionary stores a zstd dictionary that event records of a kind family are compressed
+	// with. The one with the highest id of a family is used for new events. It is not removed
+	// by a nuke, as it still suits the events that will be stored.
+	//
+	//   [ 23 ][ 1 byte kind family ][ 4 bytes dictionary id ] : value: [ zstd dictionary ]
+	//
+	// The key with only the prefix stores the serial of the newest event when training the
+	// dictionaries was last attempted.
+	//
+	//   [ 23 ] : value: [ 8 bytes serial ]
+	Dictionary
+
+	// Stats are the counts of the events of each kind, by each pubkey and with each tag key,
+	// that the query planner estimates the size of index searches with.
+	//
+	//   [ 24 ][ 1 byte statistic ][ kind, pubkey prefix or tag key ] : value: [ 8 bytes count ]
+	Stats
+
+	// Usage is the number of events and bytes of event records stored for each pubkey.
+	//
+	//   [ 25 ][ 32 bytes pubkey ] : value: [ 8 bytes events ][ 8 bytes bytes ]
+	Usage
+
+	// Case stores the JSON encoded moderation case opened by NIP-56 reports about an event or
+	// a user. It is not removed by a nuke, like the rest of the moderation state.
+	//
+	//   [ 26 ][ 32 bytes event id or pubkey ]
+	Case
+
+	// Ban stores the JSON encoded ban of a user from publishing to the relay. It is not removed
+	// by a nuke, as the bans are kept in memory while the relay runs.
+	//
+	//   [ 27 ][ 32 bytes pubkey ]
+	Ban
+
+	// Hidden flags an event, or all the events of a pubkey, as hidden from everyone but their
+	// author, the value is the JSON encoded record of who hid it and why. It is not removed by
+	// a nuke, as the hidden events and users are kept in memory while the relay runs.
+	//
+	//   [ 28 ][ 32 bytes event id or pubkey ]
+	Hidden
+
+	// Audit is the append only log of administrative and moderation actions, the value is the
+	// JSON encoded entry. It is not removed by a nuke, which is itself recorded in it.
+	//
+	//   [ 29 ][ 8 bytes unix nanoseconds ]
+	Audit
 )
 
 // FilterPrefixes is a slice of the prefixes used by filter index to enable a loop for pulling
@@ -141,8 +231,13 @@ var AllPrefixes = [][]byte{
 	{TagAddr.B()},
 	{Counter.B()},
 	{PubkeyIndex.B()},
+	{PubkeySerial.B()},
 	{FullIndex.B()},
+	{Stats.B()},
+	{Usage.B()},
 	{Configuration.B()},
+	{Name.B()},
+	{Verification.B()},
 }
 
 // KeySizes are the byte size of keys of each type of key prefix. int(P) or call the P.I()
@@ -174,5 +269,5 @@ var KeySizes = []int{
 	// PubkeyIndex
 	1 + schnorr.PubKeyBytesLen + serial2.Len,
 	// FullIndex
-	1 + fullid.Len + createdat.Len + serial2.Len,
+	1 + serial2.Len + fullid.Len + serial2.Len + createdat.Len,
 }
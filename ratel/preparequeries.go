@@ -10,12 +10,15 @@ import (
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/eventid"
 	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/ratel/keys/id"
 	"relay.mleku.dev/ratel/keys/kinder"
 	"relay.mleku.dev/ratel/keys/pubkey"
 	"relay.mleku.dev/ratel/keys/serial"
 	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/tag"
 	"relay.mleku.dev/timestamp"
 )
 
@@ -48,100 +51,31 @@ func PrepareQueries(f *filter.T) (
 	switch {
 	// first if there is IDs, just search for them, this overrides all other filters
 	case f.IDs.Len() > 0:
-		qs = make([]query, f.IDs.Len())
-		for i, idB := range f.IDs.ToSliceOfBytes() {
-			ih := id.New(eventid.NewWith(idB))
-			if ih == nil {
-				log.E.F("failed to decode event Id: %s", idB)
-				// just ignore it, clients will be clients
-				continue
-			}
-			prf := prefixes.Id.Key(ih)
-			qs[i] = query{
-				index:        i,
-				queryFilter:  f,
-				searchPrefix: prf,
-				skipTS:       true,
-			}
-		}
+		qs = idQueries(f)
 		// second we make a set of queries based on author pubkeys, optionally with kinds
 	case f.Authors.Len() > 0:
 		// if there is no kinds, we just make the queries based on the author pub keys
 		if f.Kinds.Len() == 0 {
-			qs = make([]query, f.Authors.Len())
-			for i, pubkeyHex := range f.Authors.ToSliceOfBytes() {
-				var pk *pubkey.T
-				if pk, err = pubkey.New(pubkeyHex); chk.E(err) {
-					// bogus filter, continue anyway
-					continue
-				}
-				sp := prefixes.Pubkey.Key(pk)
-				qs[i] = query{
-					index:        i,
-					queryFilter:  f,
-					searchPrefix: sp,
-				}
-			}
+			qs = pubkeyQueries(f)
 		} else {
 			// if there is kinds as well, we are searching via the kind/pubkey prefixes
-			qs = make([]query, f.Authors.Len()*f.Kinds.Len())
-			i := 0
-		authors:
-			for _, pubkeyHex := range f.Authors.ToSliceOfBytes() {
-				for _, kind := range f.Kinds.K {
-					var pk *pubkey.T
-					if pk, err = pubkey.New(pubkeyHex); chk.E(err) {
-						// skip this dodgy thing
-						continue authors
-					}
-					ki := kinder.New(kind.K)
-					sp := prefixes.PubkeyKind.Key(pk, ki)
-					qs[i] = query{index: i, queryFilter: f, searchPrefix: sp}
-					i++
-				}
-			}
+			qs = pubkeyKindQueries(f)
 		}
 		if f.Tags.Len() > 0 {
 			ext = &filter.T{Tags: f.Tags}
 		}
 	case f.Tags.Len() > 0:
-		// determine the size of the queries array by inspecting all tags sizes
-		size := 0
 		for _, values := range f.Tags.ToSliceOfTags() {
-			size += values.Len() - 1
+			qs = append(qs, tagQueries(f, values)...)
 		}
-		if size == 0 {
+		if len(qs) == 0 {
 			return nil, nil, 0, fmt.Errorf("empty tag filters")
 		}
-		// we need a query for each tag search
-		qs = make([]query, size)
 		// and any kinds mentioned as well in extra filter
 		ext = &filter.T{Kinds: f.Kinds}
-		i := 0
-		for _, values := range f.Tags.ToSliceOfTags() {
-			for _, value := range values.ToSliceOfBytes()[1:] {
-				// get key prefix (with full length) and offset where to write the last parts
-				var prf []byte
-				if prf, err = GetTagKeyPrefix(string(value)); chk.E(err) {
-					continue
-				}
-				// remove the last part to get just the prefix we want here
-				qs[i] = query{index: i, queryFilter: f, searchPrefix: prf}
-				i++
-			}
-		}
 	case f.Kinds.Len() > 0:
 		// if there is no ids, pubs or tags, we are just searching for kinds
-		qs = make([]query, f.Kinds.Len())
-		for i, kind := range f.Kinds.K {
-			kk := kinder.New(kind.K)
-			ki := prefixes.Kind.Key(kk)
-			qs[i] = query{
-				index:        i,
-				queryFilter:  f,
-				searchPrefix: ki,
-			}
-		}
+		qs = kindQueries(f)
 	default: // todo: this is appearing on queries with only since/until
 		log.I.F("nothing in filter, returning latest events")
 		qs = append(qs, query{index: 0, queryFilter: f, searchPrefix: []byte{1},
@@ -149,15 +83,24 @@ func PrepareQueries(f *filter.T) (
 			skipTS: true})
 		ext = nil
 	}
+	since, _ = queryRange(f, qs)
+	// if we got an empty filter, we still need a query for scraping the newest
+	if len(qs) == 0 {
+		qs = append(qs, query{index: 0, queryFilter: f, searchPrefix: []byte{1},
+			start: []byte{1, 255, 255, 255, 255, 255, 255, 255, 255}})
+	}
+	return
+}
 
-	// this is where we'll end the iteration
+// queryRange sets the key the queries start from to the until of the filter, and returns the
+// since of the filter, where the queries end, and the timestamp after the until.
+func queryRange(f *filter.T, qs []query) (since, until uint64) {
 	if f.Since != nil {
 		if fs := f.Since.U64(); fs > since {
 			since = fs
 		}
 	}
-
-	var until uint64 = math.MaxInt64
+	until = math.MaxInt64
 	if f.Until != nil {
 		if fu := f.Until.U64(); fu < until {
 			until = fu + 1
@@ -166,10 +109,89 @@ func PrepareQueries(f *filter.T) (
 	for i, q := range qs {
 		qs[i].start = binary.BigEndian.AppendUint64(q.searchPrefix, uint64(until))
 	}
-	// if we got an empty filter, we still need a query for scraping the newest
-	if len(qs) == 0 {
-		qs = append(qs, query{index: 0, queryFilter: f, searchPrefix: []byte{1},
-			start: []byte{1, 255, 255, 255, 255, 255, 255, 255, 255}})
+	return
+}
+
+// idQueries makes a query of the id index for each id in the filter.
+func idQueries(f *filter.T) (qs []query) {
+	for _, idB := range f.IDs.ToSliceOfBytes() {
+		ih := id.New(eventid.NewWith(idB))
+		if ih == nil {
+			log.E.F("failed to decode event Id: %s", idB)
+			// just ignore it, clients will be clients
+			continue
+		}
+		qs = append(qs, query{
+			index:        len(qs),
+			queryFilter:  f,
+			searchPrefix: prefixes.Id.Key(ih),
+			skipTS:       true,
+		})
+	}
+	return
+}
+
+// pubkeyQueries makes a query of the pubkey index for each author in the filter.
+func pubkeyQueries(f *filter.T) (qs []query) {
+	for _, pubkeyHex := range f.Authors.ToSliceOfBytes() {
+		pk, err := pubkey.New(pubkeyHex)
+		if chk.E(err) {
+			// bogus filter, continue anyway
+			continue
+		}
+		qs = append(qs, query{
+			index:        len(qs),
+			queryFilter:  f,
+			searchPrefix: prefixes.Pubkey.Key(pk),
+		})
+	}
+	return
+}
+
+// pubkeyKindQueries makes a query of the pubkey/kind index for each pair of an author and a
+// kind in the filter.
+func pubkeyKindQueries(f *filter.T) (qs []query) {
+	for _, pubkeyHex := range f.Authors.ToSliceOfBytes() {
+		pk, err := pubkey.New(pubkeyHex)
+		if chk.E(err) {
+			// skip this dodgy thing
+			continue
+		}
+		for _, kind := range f.Kinds.K {
+			qs = append(qs, query{index: len(qs), queryFilter: f,
+				searchPrefix: prefixes.PubkeyKind.Key(pk, kinder.New(kind.K))})
+		}
+	}
+	return
+}
+
+// tagQueries makes a query of the tag indexes for each value of a tag in the filter.
+func tagQueries(f *filter.T, values *tag.T) (qs []query) {
+	for _, value := range values.ToSliceOfBytes()[1:] {
+		// e and p filter tags are decoded to binary, but they are indexed from the hex
+		// form that is in the event tags.
+		if fk := values.FilterKey(); len(fk) == 1 && (fk[0] == 'e' || fk[0] == 'p') &&
+			len(value) == sha256.Size {
+			value = hex.EncAppend(nil, value)
+		}
+		// get key prefix (with full length) and offset where to write the last parts
+		prf, err := GetTagKeyPrefix(string(value))
+		if chk.E(err) {
+			continue
+		}
+		qs = append(qs, query{index: len(qs), queryFilter: f, searchPrefix: prf})
+	}
+	return
+}
+
+// kindQueries makes a query of the kind index for each kind in the filter.
+func kindQueries(f *filter.T) (qs []query) {
+	for _, kind := range f.Kinds.K {
+		qs = append(qs, query{
+			index:        len(qs),
+			queryFilter:  f,
+			searchPrefix: prefixes.Kind.Key(kinder.New(kind.K)),
+		})
 	}
 	return
 }
@@ -16,85 +16,41 @@ import (
 	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/pointers"
-	"relay.mleku.dev/ratel/keys/createdat"
 	"relay.mleku.dev/ratel/keys/serial"
 	"relay.mleku.dev/ratel/prefixes"
 	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/store"
 	"relay.mleku.dev/tag"
 	"relay.mleku.dev/timestamp"
 )
 
 func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
+	return r.queryEvents(c, f, nil)
+}
+
+// queryEvents searches for the events that match a filter, and if ex is not nil records the
+// plan and the work done in it.
+func (r *T) queryEvents(c context.T, f *filter.T, ex *store.Explanation) (evs event.Ts,
+	err error) {
+
 	log.T.F("QueryEvents %s\n", f.Serialize())
+	start := time.Now()
 	evMap := make(map[string]*event.T)
-	var queries []query
-	var ext *filter.T
-	var since uint64
-	if queries, ext, since, err = PrepareQueries(f); chk.E(err) {
-		return
-	}
-	// log.I.S(f, queries)
 	limit := r.MaxLimit
 	if f.Limit != nil {
 		limit = int(*f.Limit)
 	}
-	// search for the keys generated from the filter
-	var total int
-	eventKeys := make(map[string]struct{})
-	for _, q := range queries {
-		select {
-		case <-r.Ctx.Done():
-			return
-		case <-c.Done():
-			return
-		default:
-		}
-		err = r.View(func(txn *badger.Txn) (err error) {
-			// iterate only through keys and in reverse order
-			opts := badger.IteratorOptions{
-				Reverse: true,
-			}
-			it := txn.NewIterator(opts)
-			defer it.Close()
-			for it.Seek(q.start); it.ValidForPrefix(q.searchPrefix); it.Next() {
-				select {
-				case <-r.Ctx.Done():
-					return
-				case <-c.Done():
-					return
-				default:
-				}
-				item := it.Item()
-				k := item.KeyCopy(nil)
-				if !q.skipTS {
-					if len(k) < createdat.Len+serial.Len {
-						continue
-					}
-					createdAt := createdat.FromKey(k)
-					if createdAt.Val.U64() < since {
-						break
-					}
-				}
-				ser := serial.FromKey(k)
-				idx := prefixes.Event.Key(ser)
-				eventKeys[string(idx)] = struct{}{}
-				total++
-				// some queries just produce stupid amounts of matches, they are a resource
-				// exhaustion attack vector and only spiders make them
-				if total >= limit {
-					return
-				}
-			}
-			return
-		})
-		if chk.E(err) {
-			// this means shutdown, probably
-			if errors.Is(err, badger.ErrDBClosed) {
-				return
-			}
+	var p *plan
+	var scanned, decoded int
+	defer func() {
+		if ex != nil && p != nil {
+			p.scanned = scanned
+			p.explain(ex)
+			ex.EventsDecoded = decoded
+			ex.EventsReturned = len(evs)
+			ex.Duration = time.Since(start)
 		}
-	}
-	log.T.F("found %d event indexes from %d queries", len(eventKeys), len(queries))
+	}()
 	select {
 	case <-r.Ctx.Done():
 		return
@@ -104,27 +60,45 @@ func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
 	}
 	var delEvs [][]byte
 	defer func() {
+		if r.ReadOnly {
+			return
+		}
 		for _, d := range delEvs {
 			// if events were found that should be deleted, delete them
 			chk.E(r.DeleteEvent(r.Ctx, eventid.NewWith(d)))
 		}
 	}()
 	accessed := make(map[string]struct{})
-	for ek := range eventKeys {
-		eventKey := []byte(ek)
-		err = r.View(func(txn *badger.Txn) (err error) {
-			select {
-			case <-r.Ctx.Done():
-				return
-			case <-c.Done():
-				return
-			default:
+	var done bool
+	var after *store.Cursor
+	for !done {
+		if p, err = r.planQuery(c, f, limit, false, after); chk.E(err) {
+			return
+		}
+		scanned += p.scanned
+		// search for the keys generated from the filter
+		sers := p.serials()
+		log.T.F("found %d event indexes", len(sers))
+		for _, s := range sers {
+			if done {
+				break
 			}
-			opts := badger.IteratorOptions{Reverse: true}
-			it := txn.NewIterator(opts)
-			defer it.Close()
-			for it.Seek(eventKey); it.ValidForPrefix(eventKey); it.Next() {
-				item := it.Item()
+			eventKey := prefixes.Event.Key(serial.New(serial.Make(s)))
+			err = r.View(func(txn *badger.Txn) (err error) {
+				select {
+				case <-r.Ctx.Done():
+					return
+				case <-c.Done():
+					return
+				default:
+				}
+				var item *badger.Item
+				if item, err = txn.Get(eventKey); err != nil {
+					if errors.Is(err, badger.ErrKeyNotFound) {
+						err = nil
+					}
+					return
+				}
 				if r.HasL2 && item.ValueSize() == sha256.Size {
 					// todo: this isn't actually calling anything right now, it should be
 					//  accumulating to propagate the query (this means response lag also)
@@ -135,22 +109,15 @@ func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
 					var eventValue []byte
 					ev := &event.T{}
 					if eventValue, err = item.ValueCopy(nil); chk.E(err) {
-						continue
+						return
 					}
 					log.T.F("found event stub %0x must seek in L2", eventValue)
 					ev.Id = eventValue
-					select {
-					case <-c.Done():
-						return
-					case <-r.Ctx.Done():
-						log.T.Ln("backend context canceled")
-						return
-					default:
-					}
 					evMap[hex.Enc(ev.Id)] = ev
 					return
 				}
 				ev := &event.T{}
+				decoded++
 				if err = item.Value(func(eventValue []byte) (err error) {
 					var rem []byte
 					if rem, err = r.Unmarshal(ev, eventValue); chk.E(err) {
@@ -174,12 +141,12 @@ func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
 					}
 					return
 				}); chk.E(err) {
-					continue
+					return nil
 				}
 				if ev == nil {
-					continue
+					return
 				}
-				if ext == nil || ext.Matches(ev) {
+				if p.ext == nil || p.ext.Matches(ev) {
 					evMap[hex.Enc(ev.Id)] = ev
 					// add event counter key to accessed
 					ser := serial.FromKey(eventKey)
@@ -188,6 +155,7 @@ func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
 						*f.Limit--
 						if *f.Limit <= 0 {
 							log.I.F("found events: %d", len(evMap))
+							done = true
 							return
 						}
 					}
@@ -195,25 +163,31 @@ func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
 					// or the client is erroneous, if any limit greater is requested this will
 					// be used instead as the previous clause.
 					if len(evMap) >= r.MaxLimit {
-						return
+						done = true
 					}
 				}
+				return
+			})
+			if err != nil {
+				// this means shutdown, probably
+				if errors.Is(err, badger.ErrDBClosed) {
+					return
+				}
 			}
-			return
-		})
-		if err != nil {
-			// this means shutdown, probably
-			if errors.Is(err, badger.ErrDBClosed) {
+			select {
+			case <-r.Ctx.Done():
+				return
+			case <-c.Done():
 				return
+			default:
 			}
 		}
-		select {
-		case <-r.Ctx.Done():
-			return
-		case <-c.Done():
-			return
-		default:
+		// the index had more keys than could be collected at once, the rest are searched for
+		// if the limit has not been reached
+		if p.next == nil {
+			break
 		}
+		after = p.next
 	}
 	if len(evMap) > 0 {
 		for i := range evMap {
@@ -227,13 +201,20 @@ func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
 		if len(evs) > limit {
 			evs = evs[:limit]
 		}
+		if ex != nil || r.ReadOnly {
+			// explaining a query is not an access of its events, and a replica can't record
+			// them
+			return
+		}
 		// bump the access times on all retrieved events. do this in a goroutine so the
-		// user's events are delivered immediately
+		// user's events are delivered immediately, Close waits for it to finish.
+		r.WG.Add(1)
 		go func() {
+			defer r.WG.Done()
 			for ser := range accessed {
 				seri := serial.New([]byte(ser))
 				now := timestamp.Now()
-				err = r.Update(func(txn *badger.Txn) (err error) {
+				chk.E(r.Update(func(txn *badger.Txn) (err error) {
 					key := GetCounterKey(seri)
 					it := txn.NewIterator(badger.IteratorOptions{})
 					defer it.Close()
@@ -244,7 +225,7 @@ func (r *T) QueryEvents(c context.T, f *filter.T) (evs event.Ts, err error) {
 						}
 					}
 					return nil
-				})
+				}))
 			}
 		}()
 	} else {
@@ -2,6 +2,7 @@ package ratel
 
 import (
 	"errors"
+	"slices"
 	"strconv"
 	"time"
 
@@ -12,13 +13,11 @@ import (
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/eventid"
 	"relay.mleku.dev/filter"
-	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/pointers"
 	"relay.mleku.dev/ratel/keys"
 	"relay.mleku.dev/ratel/keys/createdat"
 	"relay.mleku.dev/ratel/keys/fullid"
-	"relay.mleku.dev/ratel/keys/fullpubkey"
 	"relay.mleku.dev/ratel/keys/index"
 	"relay.mleku.dev/ratel/keys/serial"
 	"relay.mleku.dev/ratel/prefixes"
@@ -28,91 +27,100 @@ import (
 	"relay.mleku.dev/timestamp"
 )
 
+// maxIds is the most ids a query for ids returns. Some queries just produce stupid amounts of
+// matches, they are a resource exhaustion attack vector and only spiders make them.
+const maxIds = 5000
+
 func (r *T) QueryForIds(c context.T, f *filter.T) (founds []store.IdTsPk, err error) {
 	log.T.F("QueryForIds %s\n", f.Serialize())
-	var queries []query
-	var ext *filter.T
-	var since uint64
-	if queries, ext, since, err = PrepareQueries(f); chk.E(err) {
+	limit := maxIds
+	if pointers.Present(f.Limit) {
+		limit = int(*f.Limit)
+	}
+	return r.queryForIds(c, f, limit, false, nil)
+}
+
+// QueryPage returns a page of the ids of the events matching a filter, in order of created_at
+// and serial, starting after the cursor in the options. The limit of the filter is ignored.
+func (r *T) QueryPage(c context.T, f *filter.T, opts *store.PageOptions) (
+	page []store.IdTsPk, next *store.Cursor, err error) {
+
+	log.T.F("QueryPage %s %+v\n", f.Serialize(), opts)
+	limit := opts.Limit
+	if limit <= 0 || limit > maxIds {
+		limit = maxIds
+	}
+	var founds []store.IdTsPk
+	if founds, err = r.queryForIds(c, f, limit, opts.Ascending, opts.After); err != nil {
 		return
 	}
-	// search for the keys generated from the filter
-	var total int
-	eventKeys := make(map[string]struct{})
-	var serials []*serial.T
-	for _, q := range queries {
-		err = r.View(func(txn *badger.Txn) (err error) {
-			// iterate only through keys and in reverse order
-			opts := badger.IteratorOptions{
-				Reverse: true,
-			}
-			it := txn.NewIterator(opts)
-			defer it.Close()
-			for it.Seek(q.start); it.ValidForPrefix(q.searchPrefix); it.Next() {
-				item := it.Item()
-				k := item.KeyCopy(nil)
-				if !q.skipTS {
-					if len(k) < createdat.Len+serial.Len {
-						continue
-					}
-					createdAt := createdat.FromKey(k)
-					if createdAt.Val.U64() < since {
-						break
-					}
-				}
-				ser := serial.FromKey(k)
-				serials = append(serials, ser)
-				idx := prefixes.Event.Key(ser)
-				eventKeys[string(idx)] = struct{}{}
-				total++
-				// some queries just produce stupid amounts of matches, they are a resource
-				// exhaustion attack vector and only spiders make them
-				if total > 5000 {
-					return
-				}
-			}
-			return
-		})
-		if chk.E(err) {
-			// this means shutdown, probably
-			if errors.Is(err, badger.ErrDBClosed) {
-				return
-			}
+	// events found by id are not in order, as their index has no created_at
+	for _, ff := range founds {
+		if opts.After == nil || opts.After.Before(ff.Ts, ff.Ser, opts.Ascending) {
+			page = append(page, ff)
+		}
+	}
+	slices.SortFunc(page, func(a, b store.IdTsPk) int {
+		switch {
+		case a.Ser == b.Ser:
+			return 0
+		case b.Position().Before(a.Ts, a.Ser, opts.Ascending):
+			return 1
 		}
+		return -1
+	})
+	if len(page) >= limit {
+		page = page[:limit]
+		next = page[len(page)-1].Position()
 	}
-	log.T.F("found %d event indexes from %d queries", len(eventKeys), len(queries))
-	l2Map := make(map[string]*event.T) // todo: this is not being used, it should be
+	return
+}
+
+// queryForIds finds the ids of at most limit events matching a filter, in order, newest first
+// unless ascending, and after the cursor if it is not nil.
+func (r *T) queryForIds(c context.T, f *filter.T, limit int, ascending bool,
+	after *store.Cursor) (founds []store.IdTsPk, err error) {
+
+	var serials []*serial.T
 	var delEvs [][]byte
 	defer func() {
+		if r.ReadOnly {
+			return
+		}
 		for _, d := range delEvs {
 			// if events were found that should be deleted, delete them
 			chk.E(r.DeleteEvent(r.Ctx, eventid.NewWith(d)))
 		}
 	}()
-	accessed := make(map[string]struct{})
-	if ext != nil {
-		// we have to fetch the event
-		for ek := range eventKeys {
-			eventKey := []byte(ek)
-			err = r.View(func(txn *badger.Txn) (err error) {
-				opts := badger.IteratorOptions{Reverse: true}
-				it := txn.NewIterator(opts)
-				defer it.Close()
-			done:
-				for it.Seek(eventKey); it.ValidForPrefix(eventKey); it.Next() {
-					item := it.Item()
-					if r.HasL2 && item.ValueSize() == sha256.Size {
-						// this is a stub entry that indicates an L2 needs to be accessed for
-						// it, so we populate only the event.T.Id and return the result, the
-						// caller will expect this as a signal to query the L2 event store.
-						var eventValue []byte
-						ev := &event.T{}
-						if eventValue, err = item.ValueCopy(nil); chk.E(err) {
-							continue
+	for {
+		var p *plan
+		if p, err = r.planQuery(c, f, limit, ascending, after); chk.E(err) {
+			return
+		}
+		sers := p.serials()
+		log.T.F("found %d event indexes", len(sers))
+		if p.ext == nil {
+			for _, s := range sers {
+				serials = append(serials, serial.New(serial.Make(s)))
+			}
+		} else {
+			// we have to fetch the event
+			for _, s := range sers {
+				if len(serials) >= limit {
+					break
+				}
+				ser := serial.New(serial.Make(s))
+				err = r.View(func(txn *badger.Txn) (err error) {
+					var item *badger.Item
+					if item, err = txn.Get(prefixes.Event.Key(ser)); err != nil {
+						if errors.Is(err, badger.ErrKeyNotFound) {
+							err = nil
 						}
-						log.T.F("found event stub %0x must seek in L2", eventValue)
-						ev.Id = eventValue
-						l2Map[hex.Enc(ev.Id)] = ev
+						return
+					}
+					if r.HasL2 && item.ValueSize() == sha256.Size {
+						// this is a stub entry that indicates an L2 needs to be accessed for it,
+						// it can't be checked against the filter.
 						return
 					}
 					ev := &event.T{}
@@ -133,38 +141,36 @@ func (r *T) QueryForIds(c context.T, f *filter.T) (founds []store.IdTsPk, err er
 							if int64(exp) > time.Now().Unix() {
 								// this needs to be deleted
 								delEvs = append(delEvs, ev.Id)
+								ev = nil
 								return
 							}
 						}
 						return
 					}); chk.E(err) {
-						continue
-					}
-					if ev == nil {
-						continue
+						return nil
 					}
-					if ext.Matches(ev) {
-						// add event counter key to accessed
-						ser := serial.FromKey(eventKey)
+					if ev != nil && p.ext.Matches(ev) {
 						serials = append(serials, ser)
-						accessed[string(ser.Val)] = struct{}{}
-						if pointers.Present(f.Limit) {
-							if *f.Limit < uint(len(serials)) {
-								// done
-								break done
-							}
-						}
 					}
-				}
-				return
-			})
-			if err != nil {
-				// this means shutdown, probably
-				if errors.Is(err, badger.ErrDBClosed) {
 					return
+				})
+				if err != nil {
+					// this means shutdown, probably
+					if errors.Is(err, badger.ErrDBClosed) {
+						return
+					}
 				}
 			}
 		}
+		// the index had more keys than could be collected at once, the rest are searched for
+		// if the limit has not been reached
+		if len(serials) >= limit || p.next == nil {
+			break
+		}
+		after = p.next
+	}
+	if len(serials) > limit {
+		serials = serials[:limit]
 	}
 	for _, ser := range serials {
 		err = r.View(func(txn *badger.Txn) (err error) {
@@ -177,12 +183,17 @@ func (r *T) QueryForIds(c context.T, f *filter.T) (founds []store.IdTsPk, err er
 				k := it.Item().KeyCopy(nil)
 				id := fullid.New()
 				ts := createdat.New(timestamp.New())
-				pk := fullpubkey.New()
-				keys.Read(k, index.New(0), serial.New(nil), id, pk, ts)
+				pks := serial.New(nil)
+				keys.Read(k, index.New(0), serial.New(nil), id, pks, ts)
+				var pk []byte
+				if pk, err = r.pubkeyOf(pks.Uint64()); chk.E(err) {
+					return
+				}
 				ff := store.IdTsPk{
 					Ts:  ts.Val.I64(),
 					Id:  id.Val,
-					Pub: pk.Val,
+					Pub: pk,
+					Ser: ser.Uint64(),
 				}
 				founds = append(founds, ff)
 			}
@@ -0,0 +1,215 @@
+package ratel
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/ratel/keys/createdat"
+	"relay.mleku.dev/ratel/keys/pubkey"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+// testPaging pages through the events matching each filter in both orders, and checks each
+// event that matches is found once, in order.
+func testPaging(t *testing.T, r *T, evs []*event.T, filters map[string]*filter.T, limit int) {
+	for name, f := range filters {
+		var want []*event.T
+		for _, ev := range evs {
+			if f.Matches(ev) {
+				want = append(want, ev)
+			}
+		}
+		for _, ascending := range []bool{false, true} {
+			seen := make(map[string]int)
+			var found []store.IdTsPk
+			opts := &store.PageOptions{Limit: limit, Ascending: ascending}
+			for pages := 0; ; pages++ {
+				if pages > len(evs)/limit+1 {
+					t.Fatalf("%s ascending %v: paging did not end", name, ascending)
+				}
+				page, next, err := r.QueryPage(context.Bg(), f, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page) > limit {
+					t.Fatalf("%s ascending %v: page of %d events, the limit is %d", name,
+						ascending, len(page), limit)
+				}
+				for _, ff := range page {
+					seen[string(ff.Id)]++
+				}
+				found = append(found, page...)
+				if next == nil {
+					break
+				}
+				opts.After = next
+			}
+			if len(seen) != len(want) {
+				t.Errorf("%s ascending %v: %d events found, expected %d", name, ascending,
+					len(seen), len(want))
+			}
+			for _, ev := range want {
+				if count := seen[string(ev.Id)]; count != 1 {
+					t.Errorf("%s ascending %v: event %0x found %d times", name, ascending,
+						ev.Id, count)
+				}
+			}
+			if !slices.IsSortedFunc(found, func(a, b store.IdTsPk) int {
+				if b.Position().Before(a.Ts, a.Ser, ascending) {
+					return 1
+				}
+				return -1
+			}) {
+				t.Errorf("%s ascending %v: events are not in order", name, ascending)
+			}
+		}
+	}
+}
+
+// pagingEvents makes n text notes by two authors, some with t, p and e tags, with the
+// created_at given by at.
+func pagingEvents(t *testing.T, n int, at func(i int) *timestamp.T) (evs []*event.T,
+	filters map[string]*filter.T) {
+
+	var signers []*p256k.Signer
+	for range 2 {
+		s := new(p256k.Signer)
+		if err := s.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+	}
+	// the pubkeys and event ids in p and e tags are in their own index
+	mentioned, replied := hex.Enc(signers[1].Pub()), hex.Enc(event.Hash([]byte("x")))
+	for i := range n {
+		ev := &event.T{CreatedAt: at(i), Kind: kind.TextNote, Tags: tags.New(),
+			Content: []byte{byte('a' + i%26), byte('a' + i/26)}}
+		if i%3 == 0 {
+			ev.Tags.AppendTags(tag.New("t", "x"))
+		}
+		if i%4 == 0 {
+			ev.Tags.AppendTags(tag.New("p", mentioned))
+		}
+		if i%5 == 0 {
+			ev.Tags.AppendTags(tag.New("e", replied))
+		}
+		if err := ev.Sign(signers[i%2]); err != nil {
+			t.Fatal(err)
+		}
+		evs = append(evs, ev)
+	}
+	filters = map[string]*filter.T{
+		"all":    {},
+		"kind":   {Kinds: kinds.New(kind.TextNote)},
+		"author": {Authors: tag.New(signers[0].Pub()), Kinds: kinds.New(kind.TextNote)},
+		"tag":    {Tags: tags.New(tag.New("#t", "x"))},
+		"p tag":  {Tags: tags.New(tag.New("#p", mentioned))},
+		"e tag":  {Tags: tags.New(tag.New("#e", replied))},
+	}
+	return
+}
+
+func TestQueryPageSameCreatedAt(t *testing.T) {
+	r := openTest(t)
+	// more than two pages of events, all with the same created_at, so only their serials
+	// tell them apart
+	now := timestamp.Now()
+	evs, filters := pagingEvents(t, 250, func(int) *timestamp.T { return now })
+	saveAll(t, r, evs...)
+	testPaging(t, r, evs, filters, 100)
+}
+
+func TestQueryPage(t *testing.T) {
+	r := openTest(t)
+	// the created_at of the events is not in the order they are stored
+	now := timestamp.Now().I64()
+	evs, filters := pagingEvents(t, 250, func(i int) *timestamp.T {
+		return timestamp.FromUnix(now - int64(i*97%250))
+	})
+	saveAll(t, r, evs...)
+	testPaging(t, r, evs, filters, 30)
+	// a since and until make the range the events are searched for in
+	since, until := timestamp.FromUnix(now-200), timestamp.FromUnix(now-50)
+	for name, f := range filters {
+		f.Since, f.Until = since, until
+		filters[name] = f
+	}
+	testPaging(t, r, evs, filters, 30)
+}
+
+func TestMigrateTag32(t *testing.T) {
+	r := openTest(t)
+	now := timestamp.Now().I64()
+	evs, filters := pagingEvents(t, 100, func(i int) *timestamp.T {
+		return timestamp.FromUnix(now - int64(i*37%100))
+	})
+	saveAll(t, r, evs...)
+	// the Tag32 keys of version 4 have no created_at
+	var converted int
+	for _, ev := range evs {
+		s, err := r.serialOf(ev.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ser := serial.New(serial.Make(s))
+		for _, k := range GetIndexKeysForEvent(ev, ser, ser) {
+			if k[0] != prefixes.Tag32.B() {
+				continue
+			}
+			old := append(bytes.Clone(k[:1+pubkey.Len]), ser.Val...)
+			if err = r.Update(func(txn *badger.Txn) (err error) {
+				if err = txn.Delete(k); err != nil {
+					return
+				}
+				return txn.Set(old, nil)
+			}); err != nil {
+				t.Fatal(err)
+			}
+			converted++
+		}
+	}
+	if converted == 0 {
+		t.Fatal("no Tag32 keys were made")
+	}
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = []*Migration{{Version: Version, Description: "test",
+		Prefix: prefixes.Event.Key(), Step: migrateTag32}}
+	if err := r.Update(func(txn *badger.Txn) error {
+		return r.bumpVersion(txn, Version-1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.View(func(txn *badger.Txn) error {
+		prf := prefixes.Tag32.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			if len(it.Item().Key()) != 1+pubkey.Len+createdat.Len+serial.Len {
+				t.Errorf("Tag32 key %0x was not migrated", it.Item().Key())
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	testPaging(t, r, evs, filters, 30)
+}
@@ -0,0 +1,24 @@
+package ratel
+
+import (
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+)
+
+// openTest opens a store in a temporary directory that is closed when the test ends.
+func openTest(t testing.TB) (r *T) {
+	r = openBench(t, t.TempDir(), "", false)
+	t.Cleanup(func() { r.Close() })
+	return
+}
+
+// saveAll stores events, failing the test if any can't be saved.
+func saveAll(t testing.TB, r *T, evs ...*event.T) {
+	for _, ev := range evs {
+		if err := r.SaveEvent(context.Bg(), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
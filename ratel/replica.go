@@ -0,0 +1,27 @@
+package ratel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+)
+
+// SnapshotId identifies the snapshot of a database at a path, which may be a symlink that is
+// pointed at each refreshed snapshot, by the directory and the state of its manifest, which
+// changes with any change to the database.
+func SnapshotId(path string) (id string, err error) {
+	var dir string
+	if dir, err = filepath.EvalSymlinks(path); chk.E(err) {
+		return
+	}
+	var fi os.FileInfo
+	if fi, err = os.Stat(filepath.Join(dir, badger.ManifestFilename)); chk.E(err) {
+		return
+	}
+	id = fmt.Sprintf("%s %d %d", dir, fi.Size(), fi.ModTime().UnixNano())
+	return
+}
@@ -1,9 +1,12 @@
 package ratel
 
 import (
+	"bytes"
+
 	"github.com/dgraph-io/badger/v4"
 
 	"relay.mleku.dev/chk"
+	"relay.mleku.dev/errorf"
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/ratel/keys"
@@ -14,65 +17,124 @@ import (
 	"relay.mleku.dev/timestamp"
 )
 
-// Rescan regenerates all indexes of events to add new indexes in a new version.
+// Rescan regenerates all indexes of events to add new indexes in a new version, and stores the
+// events again in the current encoding. With ZstdDictionary the dictionaries are trained again
+// first, and the old ones are deleted once all the events are compressed with the new ones.
+// The storage used by each pubkey is counted again, as the sizes of the records change.
 func (r *T) Rescan() (err error) {
+	if err = r.writable(); chk.E(err) {
+		return
+	}
+	if r.ZstdDictionary {
+		if err = r.TrainDictionaries(); chk.E(err) {
+			return
+		}
+	}
 	var evKeys [][]byte
+	if evKeys, err = r.eventKeysAfter(nil); chk.E(err) {
+		return
+	}
+	var n, failed int
+	for len(evKeys) > 0 {
+		for _, key := range evKeys {
+			if err = r.rescanEvent(key); err != nil {
+				failed++
+			}
+			if n++; n%1000 == 0 {
+				log.I.F("rescanned %d events", n)
+			}
+		}
+		if !r.ZstdDictionary || failed > 0 {
+			break
+		}
+		// events saved during the rescan may have been compressed with an old dictionary, so
+		// the events after the last one rescanned are rescanned until there are none left, and
+		// the old dictionaries are only dropped once every event up to the last serial is.
+		if evKeys, err = r.eventKeysAfter(evKeys[len(evKeys)-1]); chk.E(err) {
+			return
+		}
+	}
+	if failed > 0 {
+		// the old dictionaries may still be needed by the events that failed
+		return errorf.E("%d of %d events failed to be rescanned", failed, n)
+	}
+	log.I.F("completed rescanning %d events", n)
+	if err = r.recountUsage(); chk.E(err) {
+		return
+	}
+	return r.dropOldDictionaries()
+}
+
+// eventKeysAfter returns the keys of the event records after a key, or all of them if it is
+// nil, leaving out pruned stubs.
+func (r *T) eventKeysAfter(from []byte) (evKeys [][]byte, err error) {
 	err = r.View(func(txn *badger.Txn) (err error) {
-		prf := []byte{prefixes.Event.B()}
-		it := txn.NewIterator(badger.IteratorOptions{})
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
 		defer it.Close()
-		for it.Rewind(); it.ValidForPrefix(prf); it.Next() {
-			item := it.Item()
+		if from == nil {
+			it.Seek(prf)
+		} else {
+			it.Seek(from)
+			if it.ValidForPrefix(prf) && bytes.Equal(it.Item().Key(), from) {
+				it.Next()
+			}
+		}
+		for ; it.ValidForPrefix(prf); it.Next() {
 			if it.Item().ValueSize() == sha256.Size {
 				continue
 			}
-			evKeys = append(evKeys, item.KeyCopy(nil))
+			evKeys = append(evKeys, it.Item().KeyCopy(nil))
 		}
 		return
 	})
-	var i int
-	var key []byte
-	for i, key = range evKeys {
-		err = r.Update(func(txn *badger.Txn) (err error) {
-			it := txn.NewIterator(badger.IteratorOptions{})
-			defer it.Close()
-			it.Seek(key)
-			if it.Valid() {
-				item := it.Item()
-				var evB []byte
-				if evB, err = item.ValueCopy(nil); chk.E(err) {
-					return
-				}
-				ser := serial.FromKey(key)
-				var rem []byte
-				ev := &event.T{}
-				if rem, err = r.Unmarshal(ev, evB); chk.E(err) {
-					return
-				}
-				if len(rem) > 0 {
-					log.T.S(rem)
-				}
-				// 	add the indexes
-				var indexKeys [][]byte
-				indexKeys = GetIndexKeysForEvent(ev, ser)
-				// log.I.S(indexKeys)
-				for _, k := range indexKeys {
-					var val []byte
-					if k[0] == prefixes.Counter.B() {
-						val = keys.Write(createdat.New(timestamp.Now()))
-					}
-					if err = txn.Set(k, val); chk.E(err) {
-						return
-					}
-				}
-				if i%1000 == 0 {
-					log.I.F("rescanned %d events", i)
-				}
+	return
+}
+
+// rescanEvent stores an event again in the current encoding if it has changed, and writes its
+// indexes.
+func (r *T) rescanEvent(key []byte) (err error) {
+	return r.Update(func(txn *badger.Txn) (err error) {
+		it := txn.NewIterator(badger.IteratorOptions{})
+		defer it.Close()
+		it.Seek(key)
+		// the event may have been deleted since the keys were collected
+		if !it.Valid() || !bytes.Equal(it.Item().Key(), key) {
+			return
+		}
+		item := it.Item()
+		var evB []byte
+		if evB, err = item.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		ser := serial.FromKey(key)
+		var rem []byte
+		ev := &event.T{}
+		if rem, err = r.Unmarshal(ev, evB); chk.E(err) {
+			return
+		}
+		if len(rem) > 0 {
+			log.T.S(rem)
+		}
+		if bin := r.Marshal(ev, nil); !bytes.Equal(bin, evB) {
+			if err = txn.Set(key, bin); chk.E(err) {
+				return
 			}
+		}
+		// 	add the indexes
+		var indexKeys [][]byte
+		if indexKeys, err = r.indexKeysForEvent(ev, ser); chk.E(err) {
 			return
-		})
-	}
-	chk.E(err)
-	log.I.F("completed rescanning %d events", i)
-	return err
+		}
+		for _, k := range indexKeys {
+			var val []byte
+			if k[0] == prefixes.Counter.B() {
+				val = keys.Write(createdat.New(timestamp.Now()))
+			}
+			if err = txn.Set(k, val); chk.E(err) {
+				return
+			}
+		}
+		return
+	})
 }
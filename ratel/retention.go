@@ -0,0 +1,314 @@
+package ratel
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/eventid"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/keys/createdat"
+	"relay.mleku.dev/ratel/keys/pubkey"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/relayinfo"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/store"
+)
+
+// retentionInterval is how often the events the retention rules don't keep are deleted.
+const retentionInterval = 10 * time.Minute
+
+// retention is the rules for which events are kept.
+type retention struct {
+	sync.Mutex
+	rules  []store.RetentionRule
+	class  func(pubkey []byte) string
+	exempt func(ev *event.T) bool
+}
+
+// SetRetention sets the rules for which events are kept. The first rule that matches an event
+// applies to it, events that match none are kept. The class of the author of an event is given
+// by class, which is only called if a rule is for a class of authors. Events that exempt
+// returns true for are kept whatever the rules, it is only called for events that would be
+// pruned.
+func (r *T) SetRetention(rules []store.RetentionRule, class func(pubkey []byte) string,
+	exempt func(ev *event.T) bool) {
+
+	r.retention.Lock()
+	defer r.retention.Unlock()
+	r.retention.rules, r.retention.class, r.retention.exempt = rules, class, exempt
+}
+
+// governing returns the index of the first rule that matches an event, or -1 if none do.
+func governing(rules []store.RetentionRule, k uint16, class string) int {
+	for i := range rules {
+		if rules[i].Matches(k, class) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Prune deletes the events the retention rules don't keep. The events older than the maximum
+// age of a rule are found by the kind index, and the events of each author over the maximum
+// count by the pubkey-kind index. Exempt events are kept, though they count towards the maximum
+// count of their author. The pruned events are deleted without a tombstone, they can be saved
+// again, though they will be pruned again.
+func (r *T) Prune(c context.T) (deleted int, err error) {
+	if err = r.writable(); err != nil {
+		return
+	}
+	r.retention.Lock()
+	rules, class, exempt := r.retention.rules, r.retention.class, r.retention.exempt
+	r.retention.Unlock()
+	if len(rules) == 0 {
+		return
+	}
+	var classed, counted bool
+	for _, rule := range rules {
+		classed = classed || rule.Authors != ""
+		counted = counted || rule.MaxCount > 0
+	}
+	classOf := func(pk []byte) string {
+		if !classed || class == nil {
+			return ""
+		}
+		return class(pk)
+	}
+	now := time.Now()
+	cutoff := func(rule store.RetentionRule) uint64 {
+		return uint64(now.Add(-rule.MaxAge).Unix())
+	}
+	// the serials of the events to delete, true if the rule that applies to the event was
+	// found, otherwise it is found when the event is read
+	prune := make(map[uint64]bool)
+	if err = r.View(func(txn *badger.Txn) (err error) {
+		for _, rule := range rules {
+			if rule.MaxAge == 0 {
+				continue
+			}
+			kinds := rule.Kinds
+			if len(kinds) == 0 {
+				kinds = []relayinfo.KindRange{{From: 0, To: 65535}}
+			}
+			for _, kr := range kinds {
+				if err = r.olderThan(c, txn, kr, cutoff(rule), func(ser uint64) {
+					if _, ok := prune[ser]; !ok {
+						prune[ser] = false
+					}
+				}); err != nil {
+					return
+				}
+			}
+		}
+		if counted {
+			if err = r.overCount(c, txn, rules, classOf, func(ser uint64) {
+				prune[ser] = true
+			}); err != nil {
+				return
+			}
+		}
+		return
+	}); chk.E(err) {
+		return
+	}
+	sers := make([]uint64, 0, len(prune))
+	for ser := range prune {
+		sers = append(sers, ser)
+	}
+	slices.Sort(sers)
+	for _, ser := range sers {
+		if err = c.Err(); err != nil {
+			return
+		}
+		var ev *event.T
+		if err = r.View(func(txn *badger.Txn) (err error) {
+			ev, err = r.eventBySerial(txn, ser)
+			return
+		}); chk.E(err) {
+			return
+		}
+		if ev == nil {
+			continue
+		}
+		if !prune[ser] {
+			i := governing(rules, ev.Kind.K, classOf(ev.Pubkey))
+			if i < 0 || rules[i].MaxAge == 0 || ev.CreatedAt.U64() >= cutoff(rules[i]) {
+				continue
+			}
+		}
+		if exempt != nil && exempt(ev) {
+			continue
+		}
+		if err = r.DeleteEvent(c, eventid.NewWith(ev.Id), true); chk.E(err) {
+			return
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.I.F("retention rules pruned %d events", deleted)
+	}
+	return
+}
+
+// olderThan calls found with the serial of each event of a range of kinds created before a
+// time, seeking past the newer events of each kind.
+func (r *T) olderThan(c context.T, txn *badger.Txn, kr relayinfo.KindRange, before uint64,
+	found func(ser uint64)) (err error) {
+
+	prf := prefixes.Kind.Key()
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+	defer it.Close()
+	for k := uint32(kr.From); k <= uint32(kr.To); k++ {
+		it.Seek(binary.BigEndian.AppendUint16(prf, uint16(k)))
+		if !it.ValidForPrefix(prf) {
+			return
+		}
+		key := it.Item().Key()
+		if len(key) < len(prf)+2 {
+			continue
+		}
+		if k = uint32(binary.BigEndian.Uint16(key[len(prf):])); k > uint32(kr.To) {
+			return
+		}
+		kindPrf := binary.BigEndian.AppendUint16(prf, uint16(k))
+		for ; it.ValidForPrefix(kindPrf); it.Next() {
+			if err = c.Err(); err != nil {
+				return
+			}
+			key = it.Item().Key()
+			if len(key) < len(kindPrf)+createdat.Len+serial.Len {
+				continue
+			}
+			if createdat.FromKey(key).Val.U64() >= before {
+				break
+			}
+			found(serial.FromKey(key).Uint64())
+		}
+	}
+	return
+}
+
+// pubkeyKindEntry is an event found in the pubkey-kind index.
+type pubkeyKindEntry struct {
+	kind    uint16
+	ts, ser uint64
+}
+
+// overCount calls found with the serial of each event that is over the maximum count of the
+// rule that applies to it for its author, the oldest first.
+func (r *T) overCount(c context.T, txn *badger.Txn, rules []store.RetentionRule,
+	classOf func(pk []byte) string, found func(ser uint64)) (err error) {
+
+	prf := prefixes.PubkeyKind.Key()
+	var author []byte
+	var entries []pubkeyKindEntry
+	// count the events of an author by the rule that applies to them
+	countAuthor := func() (err error) {
+		if len(entries) == 0 {
+			return
+		}
+		var ev *event.T
+		if ev, err = r.eventBySerial(txn, entries[0].ser); err != nil || ev == nil {
+			return
+		}
+		class := classOf(ev.Pubkey)
+		byRule := make(map[int][]pubkeyKindEntry)
+		for _, e := range entries {
+			if i := governing(rules, e.kind, class); i >= 0 && rules[i].MaxCount > 0 {
+				byRule[i] = append(byRule[i], e)
+			}
+		}
+		for i, es := range byRule {
+			if len(es) <= rules[i].MaxCount {
+				continue
+			}
+			slices.SortFunc(es, func(a, b pubkeyKindEntry) int {
+				if a.ts != b.ts {
+					return cmp.Compare(b.ts, a.ts)
+				}
+				return cmp.Compare(b.ser, a.ser)
+			})
+			for _, e := range es[rules[i].MaxCount:] {
+				found(e.ser)
+			}
+		}
+		return
+	}
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+	defer it.Close()
+	for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+		if err = c.Err(); err != nil {
+			return
+		}
+		key := it.Item().Key()
+		if len(key) < len(prf)+pubkey.Len+2+createdat.Len+serial.Len {
+			continue
+		}
+		pk := key[len(prf) : len(prf)+pubkey.Len]
+		if author == nil || string(pk) != string(author) {
+			if err = countAuthor(); err != nil {
+				return
+			}
+			author, entries = slices.Clone(pk), entries[:0]
+		}
+		entries = append(entries, pubkeyKindEntry{
+			kind: binary.BigEndian.Uint16(key[len(prf)+pubkey.Len:]),
+			ts:   createdat.FromKey(key).Val.U64(),
+			ser:  serial.FromKey(key).Uint64(),
+		})
+	}
+	return countAuthor()
+}
+
+// eventBySerial reads and decodes the event with a serial, ev is nil if there is none or it is
+// a pruned stub.
+func (r *T) eventBySerial(txn *badger.Txn, ser uint64) (ev *event.T, err error) {
+	var item *badger.Item
+	if item, err = txn.Get(prefixes.Event.Key(serial.New(serial.Make(ser)))); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			err = nil
+		}
+		return
+	}
+	if item.ValueSize() == sha256.Size {
+		return
+	}
+	err = item.Value(func(val []byte) (err error) {
+		ev = event.New()
+		_, err = r.Unmarshal(ev, val)
+		return
+	})
+	return
+}
+
+// runRetention prunes the events the retention rules don't keep periodically until the
+// database is closed.
+func (r *T) runRetention() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Ctx.Done():
+			return
+		case <-ticker.C:
+			if r.DB.IsClosed() {
+				return
+			}
+			r.WG.Add(1)
+			if _, err := r.Prune(r.Ctx); err != nil && r.Ctx.Err() == nil {
+				log.E.F("pruning events: %v", err)
+			}
+			r.WG.Done()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package ratel
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/relayinfo"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+func TestRetentionGoverning(t *testing.T) {
+	rules := []store.RetentionRule{
+		{Kinds: []relayinfo.KindRange{{From: 7, To: 7}}, MaxCount: 10},
+		{Kinds: []relayinfo.KindRange{{From: 1, To: 1}, {From: 30000, To: 39999}},
+			Authors: "guest", MaxAge: time.Hour},
+		{Authors: "followed", MaxAge: 24 * time.Hour},
+	}
+	for _, tc := range []struct {
+		kind  uint16
+		class string
+		want  int
+	}{
+		{7, "owner", 0},
+		{7, "guest", 0},
+		{1, "guest", 1},
+		{30023, "guest", 1},
+		{40000, "guest", -1},
+		{1, "owner", -1},
+		{1, "followed", 2},
+		{0, "followed", 2},
+		{0, "", -1},
+	} {
+		if got := governing(rules, tc.kind, tc.class); got != tc.want {
+			t.Errorf("kind %d by %q is governed by rule %d, expected %d", tc.kind, tc.class,
+				got, tc.want)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	r := openTest(t)
+	owner, guest := new(p256k.Signer), new(p256k.Signer)
+	for _, s := range []*p256k.Signer{owner, guest} {
+		if err := s.Generate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	newEvent := func(sign *p256k.Signer, k uint16, age time.Duration, content string) *event.T {
+		ev := &event.T{CreatedAt: timestamp.FromUnix(now.Add(-age).Unix()), Kind: kind.New(k),
+			Tags: tags.New(tag.New("t", content)), Content: []byte(content)}
+		if err := ev.Sign(sign); err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+	kept := []*event.T{
+		// the newest two reactions of each author
+		newEvent(owner, 7, time.Minute, "+"),
+		newEvent(owner, 7, 2*time.Minute, "+"),
+		newEvent(guest, 7, time.Minute, "+"),
+		newEvent(guest, 7, 2*time.Minute, "+"),
+		// notes of owners are kept forever, those of guests for an hour
+		newEvent(owner, 1, 48*time.Hour, "owner"),
+		newEvent(guest, 1, 30*time.Minute, "recent"),
+		// exempt events are kept whatever the rules
+		newEvent(guest, 1, 48*time.Hour, "exempt"),
+		newEvent(owner, 7, 48*time.Hour, "exempt"),
+		// other kinds match no rule
+		newEvent(guest, 30023, 48*time.Hour, "article"),
+	}
+	pruned := []*event.T{
+		newEvent(owner, 7, 3*time.Minute, "+"),
+		newEvent(guest, 7, 3*time.Minute, "+"),
+		newEvent(guest, 7, 4*time.Minute, "+"),
+		newEvent(guest, 1, 2*time.Hour, "old"),
+	}
+	saveAll(t, r, append(append([]*event.T{}, kept...), pruned...)...)
+	r.SetRetention([]store.RetentionRule{
+		{Kinds: []relayinfo.KindRange{{From: 7, To: 7}}, MaxCount: 2},
+		{Kinds: []relayinfo.KindRange{{From: 1, To: 1}}, Authors: "guest", MaxAge: time.Hour},
+	}, func(pk []byte) string {
+		if bytes.Equal(pk, owner.Pub()) {
+			return "owner"
+		}
+		return "guest"
+	}, func(ev *event.T) bool { return string(ev.Content) == "exempt" })
+	deleted, err := r.Prune(context.Bg())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != len(pruned) {
+		t.Errorf("pruned %d events, expected %d", deleted, len(pruned))
+	}
+	found := func(ev *event.T) bool {
+		evs, err := r.QueryEvents(context.Bg(), &filter.T{IDs: tag.New(ev.Id)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(evs) == 1
+	}
+	for _, ev := range kept {
+		if !found(ev) {
+			t.Errorf("event was pruned: %s", ev.Serialize())
+		}
+	}
+	for _, ev := range pruned {
+		if found(ev) {
+			t.Errorf("event was not pruned: %s", ev.Serialize())
+		}
+	}
+	// pruned events can be saved again
+	saveAll(t, r, pruned[0])
+}
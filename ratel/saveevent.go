@@ -23,6 +23,9 @@ func (r *T) SaveEvent(c context.T, ev *event.T) (err error) {
 	if ev.Kind.IsEphemeral() {
 		return
 	}
+	if err = r.writable(); err != nil {
+		return
+	}
 	// make sure Close waits for this to complete
 	r.WG.Add(1)
 	defer r.WG.Done()
@@ -61,7 +64,7 @@ func (r *T) SaveEvent(c context.T, ev *event.T) (err error) {
 		return errorf.W("tombstone found %0x, event will not be saved", ts)
 	}
 	if foundSerial != nil {
-		err = r.Update(func(txn *badger.Txn) (err error) {
+		err = r.updateUsage(func(txn *badger.Txn) (err error) {
 			// retrieve the event record
 			evKey := keys.Write(index.New(prefixes.Event), seri)
 			it := txn.NewIterator(badger.IteratorOptions{})
@@ -79,6 +82,9 @@ func (r *T) SaveEvent(c context.T, ev *event.T) (err error) {
 				if err = txn.Set(it.Item().Key(), bin); chk.E(err) {
 					return
 				}
+				if err = addUsage(txn, ev.Pubkey, 1, int64(len(bin))); chk.E(err) {
+					return
+				}
 				// bump counter key
 				counterKey := GetCounterKey(seri)
 				val := keys.Write(createdat.New(timestamp.Now()))
@@ -98,16 +104,21 @@ func (r *T) SaveEvent(c context.T, ev *event.T) (err error) {
 	var bin []byte
 	bin = r.Marshal(ev, bin)
 	// otherwise, save new event record.
-	if err = r.Update(func(txn *badger.Txn) (err error) {
+	if err = r.updateUsage(func(txn *badger.Txn) (err error) {
 		var idx []byte
 		var ser *serial.T
 		idx, ser = r.SerialKey()
 		if err = txn.Set(idx, bin); chk.E(err) {
 			return
 		}
+		if err = addUsage(txn, ev.Pubkey, 1, int64(len(bin))); chk.E(err) {
+			return
+		}
 		// 	add the indexes
 		var indexKeys [][]byte
-		indexKeys = GetIndexKeysForEvent(ev, ser)
+		if indexKeys, err = r.indexKeysForEvent(ev, ser); chk.E(err) {
+			return
+		}
 		for _, k := range indexKeys {
 			var val []byte
 			if k[0] == prefixes.Counter.B() {
@@ -121,6 +132,7 @@ func (r *T) SaveEvent(c context.T, ev *event.T) (err error) {
 	}); chk.E(err) {
 		return
 	}
+	r.countEvent(ev, 1)
 	return
 }
 
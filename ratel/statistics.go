@@ -0,0 +1,200 @@
+package ratel
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/keys/pubkey"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+)
+
+// The statistics kept of the number of events, in the first byte of a Stats key after the
+// prefix.
+const (
+	// statTotal is the number of events.
+	statTotal byte = iota
+	// statKind is the number of events of a kind, followed by the 2 byte kind.
+	statKind
+	// statPubkey is the number of events by a pubkey, followed by the 8 byte pubkey prefix used
+	// in the indexes.
+	statPubkey
+	// statTagKey is the number of events with an indexed tag with a key, followed by the key.
+	statTagKey
+)
+
+// statsFlushInterval is how often the changes to the statistics are written to the database.
+const statsFlushInterval = 10 * time.Second
+
+// statistics are the changes to the counts of events that have not yet been written.
+type statistics struct {
+	sync.Mutex
+	deltas map[string]int64
+}
+
+func statKey(stat byte, key []byte) []byte {
+	return append(append(prefixes.Stats.Key(), stat), key...)
+}
+
+// eventStatKeys returns the keys of the statistics that count an event.
+func eventStatKeys(ev *event.T) (sk [][]byte) {
+	sk = append(sk, statKey(statTotal, nil),
+		statKey(statKind, binary.BigEndian.AppendUint16(nil, ev.Kind.ToU16())))
+	if len(ev.Pubkey) >= pubkey.Len {
+		sk = append(sk, statKey(statPubkey, ev.Pubkey[:pubkey.Len]))
+	}
+	seen := make(map[string]struct{})
+	for _, t := range ev.Tags.ToSliceOfTags() {
+		// only the tags that GetIndexKeysForEvent indexes
+		if t.Len() < 2 || len(t.Key()) != 1 || len(t.Value()) == 0 || len(t.Value()) > 100 {
+			continue
+		}
+		if _, ok := seen[string(t.Key())]; ok {
+			continue
+		}
+		seen[string(t.Key())] = struct{}{}
+		sk = append(sk, statKey(statTagKey, t.Key()))
+	}
+	return
+}
+
+// countEvent adds an event, or with a negative delta removes it, from the statistics.
+func (r *T) countEvent(ev *event.T, delta int64) {
+	r.stats.Lock()
+	defer r.stats.Unlock()
+	if r.stats.deltas == nil {
+		r.stats.deltas = make(map[string]int64)
+	}
+	for _, k := range eventStatKeys(ev) {
+		r.stats.deltas[string(k)] += delta
+	}
+}
+
+// addStat adds to a statistic in a transaction.
+func addStat(txn *badger.Txn, key []byte, delta int64) (err error) {
+	var n int64
+	var item *badger.Item
+	if item, err = txn.Get(key); err == nil {
+		if err = item.Value(func(val []byte) (err error) {
+			if len(val) == 8 {
+				n = int64(binary.BigEndian.Uint64(val))
+			}
+			return
+		}); chk.E(err) {
+			return
+		}
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		return
+	}
+	if n += delta; n <= 0 {
+		return txn.Delete(key)
+	}
+	return txn.Set(key, binary.BigEndian.AppendUint64(nil, uint64(n)))
+}
+
+// flushStats writes the changes to the statistics to the database.
+func (r *T) flushStats() (err error) {
+	r.stats.Lock()
+	deltas := r.stats.deltas
+	r.stats.deltas = nil
+	r.stats.Unlock()
+	if len(deltas) == 0 {
+		return
+	}
+	if err = r.Update(func(txn *badger.Txn) (err error) {
+		for k, d := range deltas {
+			if d == 0 {
+				continue
+			}
+			if err = addStat(txn, []byte(k), d); err != nil {
+				return
+			}
+		}
+		return
+	}); chk.E(err) {
+		// put them back to try again
+		r.stats.Lock()
+		if r.stats.deltas == nil {
+			r.stats.deltas = make(map[string]int64)
+		}
+		for k, d := range deltas {
+			r.stats.deltas[k] += d
+		}
+		r.stats.Unlock()
+	}
+	return
+}
+
+// runStats writes the changes to the statistics periodically until the database is closed.
+func (r *T) runStats() {
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Ctx.Done():
+			return
+		case <-ticker.C:
+			if r.DB.IsClosed() {
+				return
+			}
+			r.WG.Add(1)
+			chk.E(r.flushStats())
+			r.WG.Done()
+		}
+	}
+}
+
+// stat returns the value of a statistic, including the changes that are not yet written.
+func (r *T) stat(key []byte) (n int64) {
+	chk.E(r.View(func(txn *badger.Txn) (err error) {
+		var item *badger.Item
+		if item, err = txn.Get(key); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		return item.Value(func(val []byte) (err error) {
+			if len(val) == 8 {
+				n = int64(binary.BigEndian.Uint64(val))
+			}
+			return
+		})
+	}))
+	r.stats.Lock()
+	n += r.stats.deltas[string(key)]
+	r.stats.Unlock()
+	return max(n, 0)
+}
+
+func init() {
+	RegisterMigration(&Migration{
+		Version:     3,
+		Description: "count the events by kind, pubkey and tag key for the query planner",
+		Prefix:      prefixes.Event.Key(),
+		Step: func(r *T, txn *badger.Txn, key, val []byte) (err error) {
+			if len(val) == sha256.Size {
+				// a pruned event can't be decoded, the counts are only estimates
+				return
+			}
+			ev := event.New()
+			if _, err = r.Unmarshal(ev, val); err != nil {
+				log.W.F("event %0x can't be decoded, it is not counted: %v", key, err)
+				return nil
+			}
+			for _, k := range eventStatKeys(ev) {
+				if err = addStat(txn, k, 1); err != nil {
+					return
+				}
+			}
+			return
+		},
+	})
+}
@@ -0,0 +1,197 @@
+package ratel
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"slices"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/store"
+)
+
+// usageRetries is how many times a write that updates the usage of an author is tried again
+// when it conflicts with another write of the same author's usage.
+const usageRetries = 10
+
+func usageKey(pubkey []byte) []byte { return append(prefixes.Usage.Key(), pubkey...) }
+
+// decodeUsage returns the events and bytes of a usage record.
+func decodeUsage(val []byte) (events, bytes int64) {
+	if len(val) != 16 {
+		return
+	}
+	return int64(binary.BigEndian.Uint64(val)), int64(binary.BigEndian.Uint64(val[8:]))
+}
+
+// addUsage adds to the events and bytes used by a pubkey in a transaction.
+func addUsage(txn *badger.Txn, pubkey []byte, events, bytes int64) (err error) {
+	if len(pubkey) != schnorr.PubKeyBytesLen {
+		return
+	}
+	key := usageKey(pubkey)
+	var e, b int64
+	var item *badger.Item
+	if item, err = txn.Get(key); err == nil {
+		if err = item.Value(func(val []byte) (err error) {
+			e, b = decodeUsage(val)
+			return
+		}); chk.E(err) {
+			return
+		}
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		return
+	}
+	if e, b = e+events, b+bytes; e <= 0 {
+		return txn.Delete(key)
+	}
+	val := binary.BigEndian.AppendUint64(nil, uint64(e))
+	return txn.Set(key, binary.BigEndian.AppendUint64(val, uint64(max(b, 0))))
+}
+
+// updateUsage runs a transaction that updates the usage of an author, and runs it again if it
+// conflicts with another that updated the same author. It waits while the usage is recounted.
+func (r *T) updateUsage(fn func(txn *badger.Txn) error) (err error) {
+	r.usageMx.RLock()
+	defer r.usageMx.RUnlock()
+	for range usageRetries {
+		if err = r.Update(fn); !errors.Is(err, badger.ErrConflict) {
+			return
+		}
+	}
+	return
+}
+
+// Usage returns the number of events and bytes of event records stored for a pubkey.
+func (r *T) Usage(pubkey []byte) (u *store.Usage, err error) {
+	u = &store.Usage{Pubkey: hex.Enc(pubkey)}
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var item *badger.Item
+		if item, err = txn.Get(usageKey(pubkey)); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		return item.Value(func(val []byte) (err error) {
+			u.Events, u.Bytes = decodeUsage(val)
+			return
+		})
+	})
+	return
+}
+
+// TopUsage returns the n pubkeys with the most bytes of event records stored, the most first.
+func (r *T) TopUsage(n int) (us []*store.Usage, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Usage.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			item := it.Item()
+			u := &store.Usage{Pubkey: hex.Enc(item.Key()[len(prf):])}
+			if err = item.Value(func(val []byte) (err error) {
+				u.Events, u.Bytes = decodeUsage(val)
+				return
+			}); chk.E(err) {
+				return
+			}
+			i, _ := slices.BinarySearchFunc(us, u, func(a, b *store.Usage) int {
+				return cmp.Compare(b.Bytes, a.Bytes)
+			})
+			if i < n {
+				us = slices.Insert(us, i, u)
+				if len(us) > n {
+					us = us[:n]
+				}
+			}
+		}
+		return
+	})
+	return
+}
+
+// recountUsage counts the events and bytes of event records of each pubkey again, replacing the
+// usage records. Events are not saved or deleted while it runs, so none are missed or counted
+// twice.
+func (r *T) recountUsage() (err error) {
+	r.usageMx.Lock()
+	defer r.usageMx.Unlock()
+	type usage struct{ events, bytes int64 }
+	counts := make(map[string]*usage)
+	if err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			item := it.Item()
+			if item.ValueSize() == sha256.Size {
+				continue
+			}
+			ev := event.New()
+			if err = item.Value(func(val []byte) (err error) {
+				_, err = r.Unmarshal(ev, val)
+				return
+			}); err != nil {
+				log.W.F("event %0x can't be decoded, its usage is not counted: %v",
+					item.Key(), err)
+				err = nil
+				continue
+			}
+			u, ok := counts[string(ev.Pubkey)]
+			if !ok {
+				u = &usage{}
+				counts[string(ev.Pubkey)] = u
+			}
+			u.events++
+			u.bytes += item.ValueSize()
+		}
+		return
+	}); chk.E(err) {
+		return
+	}
+	if err = r.DB.DropPrefix(prefixes.Usage.Key()); chk.E(err) {
+		return
+	}
+	wb := r.DB.NewWriteBatch()
+	defer wb.Cancel()
+	for pk, u := range counts {
+		val := binary.BigEndian.AppendUint64(nil, uint64(u.events))
+		if err = wb.Set(usageKey([]byte(pk)),
+			binary.BigEndian.AppendUint64(val, uint64(u.bytes))); chk.E(err) {
+			return
+		}
+	}
+	if err = wb.Flush(); chk.E(err) {
+		return
+	}
+	log.I.F("counted the usage of %d pubkeys", len(counts))
+	return
+}
+
+func init() {
+	RegisterMigration(&Migration{
+		Version:     4,
+		Description: "count the events and bytes stored for each pubkey",
+		Prefix:      prefixes.Event.Key(),
+		Step: func(r *T, txn *badger.Txn, key, val []byte) (err error) {
+			if len(val) == sha256.Size {
+				return
+			}
+			ev := event.New()
+			if _, err = r.Unmarshal(ev, val); err != nil {
+				log.W.F("event %0x can't be decoded, its usage is not counted: %v", key, err)
+				return nil
+			}
+			return addUsage(txn, ev.Pubkey, 1, int64(len(val)))
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package ratel
+
+import (
+	"testing"
+	"time"
+
+	"relay.mleku.dev/context"
+)
+
+func TestRecountUsageWhileSaving(t *testing.T) {
+	r := openTest(t)
+	evs := sampleEvents(t, 5, 1000)
+	saveAll(t, r, evs[:500]...)
+	done := make(chan error)
+	go func() {
+		var err error
+		for _, ev := range evs[500:] {
+			if err = r.SaveEvent(context.Bg(), ev); err != nil {
+				break
+			}
+		}
+		done <- err
+	}()
+	for saving := true; saving; {
+		if err := r.recountUsage(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			saving = false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	counts := make(map[string]int64)
+	for _, ev := range evs {
+		counts[string(ev.Pubkey)]++
+	}
+	for pk, n := range counts {
+		u, err := r.Usage([]byte(pk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Events != n {
+			t.Fatalf("usage of %s counts %d events, %d are stored", u.Pubkey, u.Events, n)
+		}
+	}
+}
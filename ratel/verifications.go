@@ -0,0 +1,89 @@
+package ratel
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/ratel/keys/arb"
+	"relay.mleku.dev/ratel/prefixes"
+)
+
+// GetVerification returns the cached NIP-05 verification of a pubkey, or nil if there is none.
+func (r *T) GetVerification(pubkey []byte) (v *dns.Verification, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		var it *badger.Item
+		if it, err = txn.Get(prefixes.Verification.Key(arb.New(pubkey))); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = nil
+			}
+			return
+		}
+		var b []byte
+		if b, err = it.ValueCopy(nil); chk.E(err) {
+			return
+		}
+		v = &dns.Verification{}
+		if err = json.Unmarshal(b, v); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// SetVerification caches the NIP-05 verification of a pubkey, badger drops it after the ttl.
+func (r *T) SetVerification(pubkey []byte, v *dns.Verification,
+	ttl time.Duration) (err error) {
+
+	var b []byte
+	if b, err = json.Marshal(v); chk.E(err) {
+		return
+	}
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		e := badger.NewEntry(prefixes.Verification.Key(arb.New(pubkey)), b).WithTTL(ttl)
+		if err = txn.SetEntry(e); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// DeleteVerification removes the cached NIP-05 verification of a pubkey.
+func (r *T) DeleteVerification(pubkey []byte) (err error) {
+	err = r.Update(func(txn *badger.Txn) (err error) {
+		if err = txn.Delete(prefixes.Verification.Key(arb.New(pubkey))); chk.E(err) {
+			return
+		}
+		return
+	})
+	return
+}
+
+// Verifications returns all the cached NIP-05 verifications.
+func (r *T) Verifications() (vs []*dns.Verification, err error) {
+	err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Verification.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var b []byte
+			if b, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			v := &dns.Verification{}
+			if err = json.Unmarshal(b, v); chk.E(err) {
+				continue
+			}
+			vs = append(vs, v)
+		}
+		err = nil
+		return
+	})
+	return
+}
@@ -0,0 +1,413 @@
+package ratel
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/klauspost/compress/zstd"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/ratel/keys/serial"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/sha256"
+)
+
+// zstdEncoding is the first byte of an event record compressed with a zstd dictionary, the
+// rest is a zstd frame, which names the dictionary it was compressed with, of the event in one
+// of the other encodings.
+const zstdEncoding = 0x02
+
+const (
+	// dictionarySamples is the most event records of a kind family that are sampled to train
+	// its dictionary.
+	dictionarySamples = 4096
+	// dictionaryMinSamples is the fewest event records of a kind family a dictionary is
+	// trained from, with fewer the family is not compressed.
+	dictionaryMinSamples = 64
+	// dictionarySize is the largest size of the content of a dictionary.
+	dictionarySize = 64 * 1024
+)
+
+// The kind families, groups of kinds with similar content that share a dictionary.
+const (
+	familyOther byte = iota
+	familyMetadata
+	familyText
+	familyLists
+	familyReactions
+	familyAddressable
+)
+
+// kindFamily returns the family a kind is compressed with.
+func kindFamily(k *kind.T) byte {
+	switch {
+	case k.Equal(kind.ProfileMetadata):
+		return familyMetadata
+	case k.Equal(kind.TextNote) || k.ToU16() == 1111:
+		return familyText
+	case k.Equal(kind.Repost) || k.Equal(kind.Reaction) || k.Equal(kind.GenericRepost):
+		return familyReactions
+	case k.IsReplaceable():
+		return familyLists
+	case k.IsParameterizedReplaceable():
+		return familyAddressable
+	}
+	return familyOther
+}
+
+// zstdDictionaries are the encoders for the current dictionary of each kind family, and a
+// decoder with all of the dictionaries in the database.
+type zstdDictionaries struct {
+	sync.RWMutex
+	encoders map[byte]*zstd.Encoder
+	decoder  *zstd.Decoder
+	// current is the id of the dictionary of each family that events are compressed with.
+	current map[byte]uint32
+	last    uint32
+}
+
+func (d *zstdDictionaries) encode(family byte, b []byte) (c []byte, ok bool) {
+	d.RLock()
+	defer d.RUnlock()
+	var enc *zstd.Encoder
+	if enc, ok = d.encoders[family]; ok {
+		c = enc.EncodeAll(b, []byte{zstdEncoding})
+	}
+	return
+}
+
+func (d *zstdDictionaries) decode(b []byte) (out []byte, err error) {
+	d.RLock()
+	defer d.RUnlock()
+	if d.decoder == nil {
+		err = errorf.E("event record is compressed, but there are no dictionaries: %w",
+			errUnknownDictionary)
+		return
+	}
+	return d.decoder.DecodeAll(b, nil)
+}
+
+// close releases the encoders and decoder.
+func (d *zstdDictionaries) close() {
+	for _, enc := range d.encoders {
+		chk.E(enc.Close())
+	}
+	if d.decoder != nil {
+		d.decoder.Close()
+	}
+	d.encoders, d.decoder = nil, nil
+}
+
+// loadDictionaries reads the dictionaries in the database and makes the encoders and decoder
+// for them. The dictionary with the highest id of a family is the current one.
+func (r *T) loadDictionaries() (err error) {
+	var dicts [][]byte
+	current := make(map[byte][]byte)
+	currentIds := make(map[byte]uint32)
+	var last uint32
+	if err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Dictionary.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			key := it.Item().Key()
+			if len(key) != len(prf)+5 {
+				continue
+			}
+			family, id := key[len(prf)], binary.BigEndian.Uint32(key[len(prf)+1:])
+			var dict []byte
+			if dict, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			dicts = append(dicts, dict)
+			// keys are in order of id within a family
+			current[family], currentIds[family] = dict, id
+			last = max(last, id)
+		}
+		return
+	}); chk.E(err) {
+		return
+	}
+	d := &r.dictionaries
+	d.Lock()
+	defer d.Unlock()
+	d.close()
+	d.current, d.last = currentIds, last
+	if len(dicts) == 0 {
+		return
+	}
+	if d.decoder, err = zstd.NewReader(nil, zstd.WithDecoderDicts(dicts...),
+		zstd.WithDecoderConcurrency(0)); chk.E(err) {
+		return
+	}
+	d.encoders = make(map[byte]*zstd.Encoder)
+	for family, dict := range current {
+		if d.encoders[family], err = zstd.NewWriter(nil, zstd.WithEncoderDict(dict),
+			zstd.WithEncoderConcurrency(1)); chk.E(err) {
+			return
+		}
+	}
+	return
+}
+
+// compress an encoded event with the dictionary of the kind family, if there is one and it
+// makes it smaller. A record the size of an event id would be taken for a pruned event, so it
+// is left uncompressed.
+func (r *T) compress(k *kind.T, b []byte) (c []byte) {
+	var ok bool
+	if c, ok = r.dictionaries.encode(kindFamily(k), b); !ok || len(c) >= len(b) ||
+		len(c) == sha256.Size {
+		return b
+	}
+	return
+}
+
+// decompress an event record compressed with a zstd dictionary.
+func (r *T) decompress(b []byte) (d []byte, err error) {
+	if d, err = r.dictionaries.decode(b[1:]); errors.Is(err, zstd.ErrUnknownDictionary) {
+		err = errorf.E("failed to decompress event record: %w", errUnknownDictionary)
+	} else if err != nil {
+		err = errorf.E("failed to decompress event record: %w", err)
+	}
+	return
+}
+
+// TrainDictionaries trains a zstd dictionary for each kind family from a sample of the stored
+// events, and makes them the current ones that new events are compressed with. The existing
+// dictionaries are kept to decompress the events compressed with them, until a Rescan
+// compresses them again with the new ones.
+//
+// A family with fewer than dictionaryMinSamples events gets no dictionary. The last event
+// serial when training was attempted is stored, see dictionaryTrainingDue.
+func (r *T) TrainDictionaries() (err error) {
+	if err = r.writable(); chk.E(err) {
+		return
+	}
+	attempted := r.lastEventSerial()
+	samples := make(map[byte][][]byte)
+	seen := make(map[byte]int)
+	if err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			if it.Item().ValueSize() == sha256.Size {
+				continue
+			}
+			var val []byte
+			if val, err = it.Item().ValueCopy(nil); chk.E(err) {
+				return
+			}
+			ev := event.New()
+			if _, err = r.Unmarshal(ev, val); err != nil {
+				// fsck reports records that can't be decoded
+				err = nil
+				continue
+			}
+			if isCompressed(val) {
+				if val, err = r.decompress(val); chk.E(err) {
+					return
+				}
+			}
+			// reservoir sampling
+			family := kindFamily(ev.Kind)
+			seen[family]++
+			if len(samples[family]) < dictionarySamples {
+				samples[family] = append(samples[family], val)
+			} else if i := rand.IntN(seen[family]); i < dictionarySamples {
+				samples[family][i] = val
+			}
+		}
+		return
+	}); chk.E(err) {
+		return
+	}
+	r.dictionaries.RLock()
+	id := r.dictionaries.last
+	r.dictionaries.RUnlock()
+	var trained int
+	for family, content := range samples {
+		if len(content) < dictionaryMinSamples {
+			log.I.F("%d events in kind family %d, not enough to train a dictionary",
+				len(content), family)
+			continue
+		}
+		id++
+		var dict []byte
+		if dict, err = zstd.BuildDict(zstd.BuildDictOptions{
+			ID:       id,
+			Contents: content,
+			History:  dictionaryHistory(content),
+			Offsets:  [3]int{1, 4, 8},
+			Level:    zstd.SpeedDefault,
+		}); chk.E(err) {
+			return
+		}
+		key := binary.BigEndian.AppendUint32(append(prefixes.Dictionary.Key(), family), id)
+		if err = r.Update(func(txn *badger.Txn) error {
+			return txn.Set(key, dict)
+		}); chk.E(err) {
+			return
+		}
+		log.I.F("trained %d byte dictionary %d for kind family %d from %d events",
+			len(dict), id, family, len(content))
+		trained++
+	}
+	if err = r.Update(func(txn *badger.Txn) error {
+		return txn.Set(prefixes.Dictionary.Key(), binary.BigEndian.AppendUint64(nil, attempted))
+	}); chk.E(err) {
+		return
+	}
+	if trained == 0 {
+		return
+	}
+	return r.loadDictionaries()
+}
+
+// dictionaryTrainingDue returns true if there are no dictionaries and training them has not
+// been attempted, or dictionaryMinSamples events have been stored since it was, so the database
+// isn't scanned at every start while no kind family has enough events for one.
+func (r *T) dictionaryTrainingDue() (due bool) {
+	r.dictionaries.RLock()
+	trained := len(r.dictionaries.current) > 0
+	r.dictionaries.RUnlock()
+	if trained {
+		return
+	}
+	var attempted uint64
+	if err := r.View(func(txn *badger.Txn) (err error) {
+		var item *badger.Item
+		if item, err = txn.Get(prefixes.Dictionary.Key()); err != nil {
+			return
+		}
+		return item.Value(func(val []byte) (err error) {
+			if len(val) == 8 {
+				attempted = binary.BigEndian.Uint64(val)
+			}
+			return
+		})
+	}); err != nil {
+		return true
+	}
+	return r.lastEventSerial() >= attempted+dictionaryMinSamples
+}
+
+// lastEventSerial returns the serial of the newest event record, zero if there are none.
+func (r *T) lastEventSerial() (ser uint64) {
+	chk.E(r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf, Reverse: true})
+		defer it.Close()
+		it.Seek(append(prf, 0xff))
+		if it.ValidForPrefix(prf) && len(it.Item().Key()) == len(prf)+serial.Len {
+			ser = serial.FromKey(it.Item().Key()).Uint64()
+		}
+		return
+	}))
+	return
+}
+
+// dictionaryHistory makes the content of a dictionary from samples, the byte strings that
+// occur in the most samples, with the most common last as zstd finds the nearest matches with
+// the shortest offsets.
+func dictionaryHistory(samples [][]byte) (hist []byte) {
+	const gram = 8
+	counts := make(map[string]int)
+	for _, s := range samples {
+		found := make(map[string]struct{})
+		for i := 0; i+gram <= len(s); i += gram / 2 {
+			found[string(s[i:i+gram])] = struct{}{}
+		}
+		for g := range found {
+			counts[g]++
+		}
+	}
+	// only strings found in more than one sample are worth having
+	var common []string
+	for g, n := range counts {
+		if n > 1 {
+			common = append(common, g)
+		}
+	}
+	slices.SortFunc(common, func(a, b string) int {
+		if n := cmp.Compare(counts[b], counts[a]); n != 0 {
+			return n
+		}
+		return strings.Compare(a, b)
+	})
+	if len(common) > dictionarySize/gram {
+		common = common[:dictionarySize/gram]
+	}
+	for i := len(common) - 1; i >= 0; i-- {
+		hist = append(hist, common[i]...)
+	}
+	if len(hist) < gram {
+		// the samples have nothing in common, but a dictionary needs some history
+		for _, s := range samples {
+			if hist = append(hist, s...); len(hist) >= dictionarySize {
+				hist = hist[:dictionarySize]
+				break
+			}
+		}
+	}
+	return
+}
+
+// dropOldDictionaries deletes the dictionaries that are not the current one of their family,
+// after all the events have been compressed again with the current ones.
+func (r *T) dropOldDictionaries() (err error) {
+	r.dictionaries.RLock()
+	current := make(map[byte]uint32)
+	for family, id := range r.dictionaries.current {
+		current[family] = id
+	}
+	r.dictionaries.RUnlock()
+	var old [][]byte
+	if err = r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Dictionary.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			key := it.Item().Key()
+			if len(key) != len(prf)+5 {
+				continue
+			}
+			if binary.BigEndian.Uint32(key[len(prf)+1:]) != current[key[len(prf)]] {
+				old = append(old, it.Item().KeyCopy(nil))
+			}
+		}
+		return
+	}); chk.E(err) {
+		return
+	}
+	if len(old) == 0 {
+		return
+	}
+	if err = r.Update(func(txn *badger.Txn) (err error) {
+		for _, k := range old {
+			if err = txn.Delete(k); chk.E(err) {
+				return
+			}
+		}
+		return
+	}); chk.E(err) {
+		return
+	}
+	log.I.F("deleted %d old dictionaries", len(old))
+	return r.loadDictionaries()
+}
+
+// isCompressed returns true if an event record is compressed with a zstd dictionary.
+func isCompressed(val []byte) bool {
+	return len(val) != sha256.Size && len(val) > 0 && val[0] == zstdEncoding
+}
@@ -0,0 +1,334 @@
+package ratel
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/lol"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/ratel/prefixes"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+	"relay.mleku.dev/units"
+)
+
+var words = strings.Fields(`the of and to in is you that it he was for on are as with his
+	they at be this have from or one had by word but not what all were we when your can said
+	there use an each which she do how their if will up other about out many then them these
+	so some her would make like him into time has look two more write go see number no way
+	could people my than first water been call who oil its now find long down day did get come
+	made may part nostr relay zap bitcoin lightning note follow gm pubkey event`)
+
+// sampleEvents makes events that resemble those a relay stores, text notes, reactions, follow
+// lists and profiles, from a set of authors that refer to each other.
+func sampleEvents(t testing.TB, authors, n int) (evs []*event.T) {
+	var signers []*p256k.Signer
+	var pubkeys []string
+	for range authors {
+		s := new(p256k.Signer)
+		if err := s.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+		pubkeys = append(pubkeys, hex.Enc(s.Pub()))
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	text := func(n int) string {
+		var s []string
+		for range n {
+			s = append(s, words[rng.IntN(len(words))])
+		}
+		return strings.Join(s, " ")
+	}
+	now := timestamp.Now().I64()
+	var ids []string
+	for i := range n {
+		ev := &event.T{
+			CreatedAt: timestamp.FromUnix(now - int64(n-i)),
+			Tags:      tags.New(),
+		}
+		switch i % 10 {
+		case 0:
+			ev.Kind = kind.New(uint16(0))
+			ev.Content = []byte(fmt.Sprintf(`{"name":"%s","about":"%s","picture":`+
+				`"https://example.com/%d.png","nip05":"%s@example.com"}`,
+				text(1), text(12), i, text(1)))
+		case 1:
+			ev.Kind = kind.New(uint16(3))
+			for range 50 + rng.IntN(200) {
+				ev.Tags.AppendTags(tag.New("p", pubkeys[rng.IntN(len(pubkeys))]))
+			}
+		case 2, 3, 4:
+			ev.Kind = kind.New(uint16(7))
+			ev.Content = []byte("+")
+			if len(ids) > 0 {
+				ev.Tags.AppendTags(tag.New("e", ids[rng.IntN(len(ids))]))
+			}
+			ev.Tags.AppendTags(tag.New("p", pubkeys[rng.IntN(len(pubkeys))]))
+		default:
+			ev.Kind = kind.New(uint16(1))
+			ev.Content = []byte(text(5 + rng.IntN(60)))
+			if len(ids) > 0 && rng.IntN(2) == 0 {
+				ev.Tags.AppendTags(tag.New("e", ids[rng.IntN(len(ids))], "", "reply"))
+				ev.Tags.AppendTags(tag.New("p", pubkeys[rng.IntN(len(pubkeys))]))
+			}
+		}
+		if err := ev.Sign(signers[rng.IntN(len(signers))]); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, hex.Enc(ev.Id))
+		evs = append(evs, ev)
+	}
+	return
+}
+
+func openBench(t testing.TB, dir, compression string, dictionary bool) (r *T) {
+	r = New(BackendParams{Ctx: context.Bg(), WG: &sync.WaitGroup{},
+		BlockCacheSize: 16 * units.Mb, Compression: compression, ZstdDictionary: dictionary})
+	r.Logger = NewLogger(lol.Off, "RATEL")
+	if err := r.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// tableSize is the size of the sorted tables of a database, the event records are in them as
+// they are smaller than the value threshold.
+func tableSize(t testing.TB, dir string) (size int64) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		var fi os.FileInfo
+		if fi, err = os.Stat(f); err != nil {
+			t.Fatal(err)
+		}
+		size += fi.Size()
+	}
+	return
+}
+
+func TestZstdDictionary(t *testing.T) {
+	evs := sampleEvents(t, 50, 1000)
+	dir := t.TempDir()
+	r := openBench(t, dir, "none", true)
+	c := context.Bg()
+	for _, ev := range evs {
+		if err := r.SaveEvent(c, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Rescan(); err != nil {
+		t.Fatal(err)
+	}
+	var compressed int
+	if err := r.View(func(txn *badger.Txn) (err error) {
+		prf := prefixes.Event.Key()
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+		defer it.Close()
+		for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+			var val []byte
+			if val, err = it.Item().ValueCopy(nil); err != nil {
+				return
+			}
+			if isCompressed(val) {
+				compressed++
+			}
+		}
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if compressed == 0 {
+		t.Fatal("no event records were compressed")
+	}
+	// training again and rescanning replaces the dictionaries
+	if err := r.Rescan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r = openBench(t, dir, "none", false)
+	defer r.Close()
+	var buf strings.Builder
+	if err := r.FetchIds(c, tag.New(func() (ids [][]byte) {
+		for _, ev := range evs {
+			ids = append(ids, ev.Id)
+		}
+		return
+	}()...), &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(evs) {
+		t.Fatalf("fetched %d events, stored %d", len(lines), len(evs))
+	}
+	for i, l := range lines {
+		if l != string(evs[i].Serialize()) {
+			t.Fatalf("event %d does not match\n%s\n%s", i, l, evs[i].Serialize())
+		}
+	}
+}
+
+// BenchmarkEventRecords compares the disk usage and the time to read and decode an event
+// record with each of the badger block compression modes, with and without zstd dictionaries.
+// UseCompact only selects the encoding of events that can't use the pubkey dictionary, so it
+// makes no difference here.
+func BenchmarkEventRecords(b *testing.B) {
+	evs := sampleEvents(b, 200, 5000)
+	c := context.Bg()
+	for _, compression := range []string{"none", "snappy", "zstd"} {
+		for _, dictionary := range []bool{false, true} {
+			dir := b.TempDir()
+			r := openBench(b, dir, compression, dictionary)
+			for _, ev := range evs {
+				if err := r.SaveEvent(c, ev); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if dictionary {
+				if err := r.Rescan(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := r.Close(); err != nil {
+				b.Fatal(err)
+			}
+			disk := tableSize(b, dir)
+			b.Run(fmt.Sprintf("compression=%s/dictionary=%v", compression, dictionary),
+				func(b *testing.B) {
+					r := openBench(b, dir, compression, dictionary)
+					defer r.Close()
+					var records int
+					var keys [][]byte
+					if err := r.View(func(txn *badger.Txn) (err error) {
+						prf := prefixes.Event.Key()
+						it := txn.NewIterator(badger.IteratorOptions{Prefix: prf})
+						defer it.Close()
+						for it.Seek(prf); it.ValidForPrefix(prf); it.Next() {
+							keys = append(keys, it.Item().KeyCopy(nil))
+							records += int(it.Item().ValueSize())
+						}
+						return
+					}); err != nil {
+						b.Fatal(err)
+					}
+					rng := rand.New(rand.NewPCG(3, 4))
+					b.ResetTimer()
+					for range b.N {
+						if err := r.View(func(txn *badger.Txn) (err error) {
+							var item *badger.Item
+							if item, err = txn.Get(keys[rng.IntN(len(keys))]); err != nil {
+								return
+							}
+							return item.Value(func(val []byte) (err error) {
+								_, err = r.Unmarshal(event.New(), val)
+								return
+							})
+						}); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.ReportMetric(float64(disk)/float64(len(keys)), "disk-B/event")
+					b.ReportMetric(float64(records)/float64(len(keys)), "record-B/event")
+				})
+		}
+	}
+}
+
+func TestZstdDictionaryRescanWhileSaving(t *testing.T) {
+	evs := sampleEvents(t, 50, 3000)
+	dir := t.TempDir()
+	r := openBench(t, dir, "none", true)
+	defer r.Close()
+	saveAll(t, r, evs[:1000]...)
+	// events are saved while the dictionaries are trained again and the old ones dropped, none
+	// of them may be left compressed with a dropped dictionary
+	done := make(chan error)
+	go func() {
+		var err error
+		for _, ev := range evs[1000:] {
+			if err = r.SaveEvent(context.Bg(), ev); err != nil {
+				break
+			}
+		}
+		done <- err
+	}()
+	for saving := true; saving; {
+		if err := r.Rescan(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			saving = false
+		default:
+		}
+	}
+	var buf strings.Builder
+	if err := r.FetchIds(context.Bg(), tag.New(func() (ids [][]byte) {
+		for _, ev := range evs {
+			ids = append(ids, ev.Id)
+		}
+		return
+	}()...), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != len(evs) {
+		t.Fatalf("fetched %d events, stored %d", len(lines), len(evs))
+	}
+}
+
+func TestZstdDictionaryTrainingAttempt(t *testing.T) {
+	evs := sampleEvents(t, 5, 200)
+	dir := t.TempDir()
+	r := openBench(t, dir, "none", false)
+	// too few events of each kind family for a dictionary
+	saveAll(t, r, evs[:40]...)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r = openBench(t, dir, "none", true)
+	if len(r.dictionaries.current) != 0 {
+		t.Fatal("a dictionary was trained from too few events")
+	}
+	if r.dictionaryTrainingDue() {
+		t.Fatal("training is due again right after it was attempted")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the attempt is remembered when the database is opened again
+	r = openBench(t, dir, "none", true)
+	if r.dictionaryTrainingDue() {
+		t.Fatal("training is due again after reopening without new events")
+	}
+	saveAll(t, r, evs[40:]...)
+	if !r.dictionaryTrainingDue() {
+		t.Fatal("training is not due after more events were stored")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r = openBench(t, dir, "none", true)
+	defer r.Close()
+	if len(r.dictionaries.current) == 0 {
+		t.Fatal("no dictionary was trained when it was due")
+	}
+}
@@ -11,14 +11,62 @@ import (
 	"relay.mleku.dev/hex"
 	"relay.mleku.dev/kind"
 	"relay.mleku.dev/log"
+	"relay.mleku.dev/normalize"
+	"relay.mleku.dev/privileged"
 	"relay.mleku.dev/tag"
 	"relay.mleku.dev/tag/atag"
 )
 
 func (s *Server) acceptEvent(c context.T, evt *event.T, remote string,
 	authedPubkey []byte) (accept bool, notice string, afterSave func()) {
+	if s.ReadOnly {
+		return false, string(normalize.Restricted.F(
+			"this relay is a read-only replica, publish events to the primary")), nil
+	}
+	if s.isBanned(evt.Pubkey) {
+		return false, string(normalize.Blocked.F(
+			"banned by the moderators of this relay")), nil
+	}
+	// events authored by pubkeys on the owners' mute lists are rejected, even if they are
+	// followed, trusted or members of a group.
+	if !s.isOwner(evt.Pubkey) && s.isMuted(evt.Pubkey) {
+		return false, "rejecting event with pubkey " + hex.Enc(evt.Pubkey) +
+			" because on owner mute list", nil
+	}
+	if notice = s.overQuota(c, evt); notice != "" {
+		return false, notice, nil
+	}
+	// gift wraps are signed by a one-time key so they can't be authed, in inbox mode they are
+	// accepted if they are addressed to users of the relay and rejected otherwise.
+	if evt.Kind.IsGiftWrap() && s.NIP17InboxOnly() {
+		recipients := privileged.Recipients(evt)
+		if len(recipients) > 0 && s.areLocal(recipients) {
+			return true, "", nil
+		}
+		return false, string(normalize.Blocked.F(
+			"this relay only accepts gift wraps addressed to its users")), nil
+	}
+	if handled, accept, notice, afterSave := s.acceptGroupEvent(c, evt); handled {
+		return accept, notice, afterSave
+	}
+	if accept, notice = s.acceptNIP05(c, evt); !accept {
+		return
+	}
+	// paid membership and the web of trust stand in for the owners' follow lists when they are
+	// enabled, for the authed pubkey if auth is required and for the author otherwise.
+	publisher := evt.Pubkey
+	if s.AuthRequired() {
+		publisher = authedPubkey
+	}
+	admission, admitted, refusal := s.acceptPaid(publisher)
+	if !admission {
+		admission, admitted, refusal = s.acceptTrusted(publisher)
+	}
 	// if the authenticator is enabled we require auth to accept events
 	if !s.AuthRequired() && len(s.owners) < 1 {
+		if admission {
+			return admitted, refusal, nil
+		}
 		return true, "", nil
 	}
 	if len(authedPubkey) != 32 && !s.PublicReadable() {
@@ -32,12 +80,11 @@ func (s *Server) acceptEvent(c context.T, evt *event.T, remote string,
 			// list this ensures that immediately a follow changes their list that newly
 			// followed can access the relay and upload DM events and such for owner
 			// followed users.
-			for o := range s.ownersFollowed {
-				if bytes.Equal([]byte(o), evt.Pubkey) {
-					return true, "", func() {
-						s.ZeroLists()
-						s.CheckOwnerLists(context.Bg())
-					}
+			_, followed := s.ownersFollowed[string(evt.Pubkey)]
+			if followed || s.isOwner(evt.Pubkey) {
+				return true, "", func() {
+					s.ZeroLists()
+					s.CheckOwnerLists(context.Bg())
 				}
 			}
 		}
@@ -85,13 +132,8 @@ func (s *Server) acceptEvent(c context.T, evt *event.T, remote string,
 					return true, "", nil
 				}
 			}
-			// check the mute list, and reject events authored by muted pubkeys, even if
-			// they come from a pubkey that is on the follow list.
-			for pk := range s.Muted {
-				if bytes.Equal(evt.Pubkey, []byte(pk)) {
-					return false, "rejecting event with pubkey " + hex.Enc(evt.Pubkey) +
-						" because on owner mute list", nil
-				}
+			if admission {
+				return admitted, refusal, nil
 			}
 			// for all else, check the authed pubkey is in the follow list
 			for pk := range s.Followed {
@@ -104,6 +146,9 @@ func (s *Server) acceptEvent(c context.T, evt *event.T, remote string,
 			}
 		}
 	}
+	if admission {
+		return admitted, refusal, nil
+	}
 	// if auth is enabled and there is no moderators we just check that the pubkey
 	// has been loaded via the auth function.
 	if len(authedPubkey) == schnorr.PubKeyBytesLen && s.AuthRequired() {
@@ -111,3 +156,24 @@ func (s *Server) acceptEvent(c context.T, evt *event.T, remote string,
 	}
 	return
 }
+
+// isMuted returns true if the pubkey is on the mute list of an owner.
+func (s *Server) isMuted(pubkey []byte) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.Muted[string(pubkey)]
+	return ok
+}
+
+// areLocal returns true if all the pubkeys are users of the relay, that is, the owners and the
+// pubkeys on their follow lists.
+func (s *Server) areLocal(pubkeys [][]byte) bool {
+	s.Lock()
+	defer s.Unlock()
+	for _, pk := range pubkeys {
+		if _, ok := s.Followed[string(pk)]; !ok {
+			return false
+		}
+	}
+	return true
+}
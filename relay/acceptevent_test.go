@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/wot"
+)
+
+func TestAcceptEventWoTOwnerLists(t *testing.T) {
+	owner, friend := newSigner(t), newSigner(t)
+	s := newTestServer(t, &config.C{
+		Owners:         []string{hex.Enc(owner.Pub())},
+		PublicReadable: true,
+		WoT: config.WoT{Enabled: true, MaxDepth: 2, Damping: 0.85,
+			Tiers: []config.TrustTier{{Name: "follows", MaxDistance: 1, Read: true,
+				Write: true}}},
+	})
+	g := wot.New()
+	g.SetSeeds(owner.Pub())
+	g.SetFollows(owner.Pub(), [][]byte{friend.Pub()})
+	g.Compute(0.85, 2)
+	s.trust = g
+	c := context.Bg()
+	note := signed(t, friend, 1, "hello")
+	if accept, notice, _ := s.AcceptEvent(c, note, nil, friend.Pub(), "test"); !accept {
+		t.Fatalf("event of a trusted user was rejected: %s", notice)
+	}
+	// the owner mutes the friend, which must refresh the mute list when it is saved
+	mute := signed(t, owner, 10000, "", tag.New("p", hex.Enc(friend.Pub())))
+	accept, notice, afterSave := s.AcceptEvent(c, mute, nil, owner.Pub(), "test")
+	if !accept {
+		t.Fatalf("mute list of the owner was rejected: %s", notice)
+	}
+	if afterSave == nil {
+		t.Fatal("mute list of the owner does not update the owner lists")
+	}
+	if err := s.Publish(c, mute); err != nil {
+		t.Fatal(err)
+	}
+	afterSave()
+	if _, ok := s.Muted[string(friend.Pub())]; !ok {
+		t.Fatal("muted user is not on the mute list")
+	}
+	note = signed(t, friend, 1, "hello again")
+	if accept, _, _ = s.AcceptEvent(c, note, nil, friend.Pub(), "test"); accept {
+		t.Fatal("event of a muted user was accepted because they are trusted")
+	}
+	// owners may not delete their mute lists
+	del := signed(t, owner, 5, "", tag.New("a", "10000:"+hex.Enc(owner.Pub())+":"))
+	if accept, _, _ = s.AcceptEvent(c, del, nil, owner.Pub(), "test"); accept {
+		t.Fatal("deletion of the mute list of the owner was accepted")
+	}
+}
+
+func TestAcceptEventWoTAuthRequired(t *testing.T) {
+	owner := newSigner(t)
+	s := newTestServer(t, &config.C{
+		Owners:       []string{hex.Enc(owner.Pub())},
+		AuthRequired: true,
+		WoT: config.WoT{Enabled: true, MaxDepth: 2, Damping: 0.85,
+			Tiers: []config.TrustTier{{Name: "owners", MaxDistance: 1, Read: true,
+				Write: true}}},
+	})
+	c := context.Bg()
+	note := signed(t, owner, 1, "hello")
+	if accept, _, _ := s.AcceptEvent(c, note, nil, nil, "test"); accept {
+		t.Fatal("event of a trusted author was accepted without auth")
+	}
+	if accept, notice, _ := s.AcceptEvent(c, note, nil, owner.Pub(), "test"); !accept {
+		t.Fatalf("event of an authed owner was rejected: %s", notice)
+	}
+}
+
+func TestAcceptEventNIP17Inbox(t *testing.T) {
+	owner, friend, stranger := newSigner(t), newSigner(t), newSigner(t)
+	s := newTestServer(t, &config.C{
+		Owners:         []string{hex.Enc(owner.Pub())},
+		PublicReadable: true,
+		NIP17InboxOnly: true,
+	})
+	c := context.Bg()
+	follows := signed(t, owner, 3, "", tag.New("p", hex.Enc(friend.Pub())))
+	if err := s.Publish(c, follows); err != nil {
+		t.Fatal(err)
+	}
+	s.ZeroLists()
+	s.CheckOwnerLists(c)
+	for _, tt := range []struct {
+		name   string
+		p      [][]byte
+		accept bool
+	}{
+		{"to a user of the relay", [][]byte{friend.Pub()}, true},
+		{"to a stranger", [][]byte{stranger.Pub()}, false},
+		{"to a user and a stranger", [][]byte{friend.Pub(), stranger.Pub()}, false},
+		{"to nobody", nil, false},
+	} {
+		var ptags []*tag.T
+		for _, pk := range tt.p {
+			ptags = append(ptags, tag.New("p", hex.Enc(pk)))
+		}
+		// gift wraps are signed by a one-time key, and are not authed
+		wrap := signed(t, newSigner(t), 1059, "wrapped", ptags...)
+		if accept, notice, _ := s.AcceptEvent(c, wrap, nil, nil, "test"); accept != tt.accept {
+			t.Errorf("gift wrap %s: accepted %v, expected %v: %s", tt.name, accept, tt.accept,
+				notice)
+		}
+	}
+}
@@ -15,6 +15,18 @@ func (s *Server) AcceptReq(c context.T, hr *http.Request, id []byte,
 	modified bool) {
 
 	log.T.F("%s AcceptReq pubkey %0x", remote, authedPubkey)
+	// the events of private groups are only served to their members.
+	if ff, modified = s.groupFilters(ff, authedPubkey); modified && len(ff.F) == 0 {
+		return
+	}
+	if handled, trusted := s.acceptTrustedReq(authedPubkey, remote); handled {
+		if trusted {
+			allowed, ok = ff, true
+		}
+		return
+	}
+	// the membership is read from the store, so not while holding the lock.
+	member := s.isMember(authedPubkey)
 	s.Lock()
 	defer s.Unlock()
 	if s.PublicReadable() && len(s.Owners()) == 0 && !s.AuthRequired() {
@@ -24,6 +36,11 @@ func (s *Server) AcceptReq(c context.T, hr *http.Request, id []byte,
 		return
 	}
 	allowed = ff
+	// paid members may read as well as write.
+	if member {
+		ok = true
+		return
+	}
 	// client is permitted, pass through the filter so request/count processing does
 	// not need logic and can just use the returned filter.
 	// check that the client is authed to a pubkey in the owner follow list
@@ -9,8 +9,8 @@ import (
 
 	"relay.mleku.dev/context"
 	"relay.mleku.dev/event"
+	"relay.mleku.dev/kind"
 	"relay.mleku.dev/normalize"
-	"relay.mleku.dev/publish"
 	"relay.mleku.dev/store"
 
 	"relay.mleku.dev/log"
@@ -55,10 +55,17 @@ func (s *Server) addEvent(c context.T, ev *event.T,
 			}
 		}
 	}
+	switch {
+	case ev.Kind.Equal(kind.FollowList):
+		go s.trustFollowList(ev)
+	case ev.Kind.Equal(kind.Reporting):
+		go s.moderateReport(ev)
+	}
+	s.auditEvent(ev, remote)
 	var authRequired bool
 	authRequired = s.AuthRequired()
 	// notify subscribers
-	publish.P.Deliver(authRequired, s.PublicReadable(), ev)
+	s.Publisher().Deliver(authRequired, s.PublicReadable(), ev)
 	accepted = true
 	log.T.F("event id %0x stored", ev.Id)
 	return
@@ -13,7 +13,7 @@ import (
 )
 
 func (s *Server) UpdateConfiguration() (err error) {
-	if c, ok := s.Store.(store.Configurationer); ok {
+	if c, ok := s.Storage().(store.Configurationer); ok {
 		log.I.F("updating configuration")
 		var cfg *config.C
 		if cfg, err = c.GetConfiguration(); chk.E(err) {
@@ -25,7 +25,7 @@ func (s *Server) UpdateConfiguration() (err error) {
 		lol.SetLogLevel(cfg.LogLevel)
 		log.I.F("setting timestamp %v", cfg.LogTimestamp)
 		lol.NoTimeStamp.Store(!cfg.LogTimestamp)
-		s.Store.SetLogLevel(cfg.DBLogLevel)
+		s.Storage().SetLogLevel(cfg.DBLogLevel)
 		s.configuration = cfg
 		// first update the admins
 		var administrators []signer.I
@@ -63,6 +63,8 @@ func (s *Server) UpdateConfiguration() (err error) {
 			log.I.F("owner pubkey: %0x", dst)
 		}
 		s.SetOwners(owners)
+		s.applyRetention(cfg)
+		s.reloadTrust()
 	}
 	return
 }
@@ -0,0 +1,223 @@
+package relay
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"relay.mleku.dev/admission"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/normalize"
+	"relay.mleku.dev/nwc"
+	"relay.mleku.dev/store"
+)
+
+const (
+	// invoiceExpiry is how long an admission invoice can be paid, in seconds.
+	invoiceExpiry = 3600
+	// invoicePollInterval is how often the wallet is asked about unpaid invoices.
+	invoicePollInterval = 15 * time.Second
+	// walletTimeout is how long a wallet has to answer a request.
+	walletTimeout = 30 * time.Second
+)
+
+// PaidAdmission returns the admission fee in sats and the number of days it pays for, and
+// whether paid admission is enabled, which requires a fee and a wallet.
+func (s *Server) PaidAdmission() (fee, days int, ok bool) {
+	s.configurationMx.Lock()
+	defer s.configurationMx.Unlock()
+	if s.configuration == nil || s.configuration.AdmissionFee <= 0 {
+		return
+	}
+	if s.configuration.NWC == "" && s.Wallet == nil {
+		return
+	}
+	fee, days = s.configuration.AdmissionFee, s.configuration.AdmissionDays
+	if days <= 0 {
+		days = 30
+	}
+	return fee, days, true
+}
+
+// PaymentsURL returns the address of the HTTP API method that describes how to pay for access.
+func (s *Server) PaymentsURL(r *http.Request) string {
+	return strings.Replace(s.ServiceURL(r), "ws", "http", 1) + "/api/admission"
+}
+
+// getWallet returns the wallet that issues admission invoices, connecting to the one in the
+// configuration if it isn't already.
+func (s *Server) getWallet() (w admission.Wallet, err error) {
+	if s.Wallet != nil {
+		return s.Wallet, nil
+	}
+	uri := s.Configuration().NWC
+	s.walletMx.Lock()
+	defer s.walletMx.Unlock()
+	if s.wallet != nil && s.walletURI == uri {
+		return s.wallet, nil
+	}
+	var cl *nwc.Client
+	if cl, err = nwc.NewClient(uri); err != nil {
+		return
+	}
+	s.wallet, s.walletURI = cl, uri
+	return cl, nil
+}
+
+// RequestAdmission issues an invoice for the admission fee that makes the pubkey a member of
+// the relay once it is paid.
+func (s *Server) RequestAdmission(c context.T, pubkey []byte) (inv *admission.Invoice,
+	err error) {
+
+	fee, days, ok := s.PaidAdmission()
+	if !ok {
+		err = errorf.E("this relay does not have paid admission")
+		return
+	}
+	ms, ok := s.Storage().(store.Memberships)
+	if !ok {
+		err = errorf.E("event store does not support memberships")
+		return
+	}
+	var w admission.Wallet
+	if w, err = s.getWallet(); err != nil {
+		return
+	}
+	cc, cancel := context.Timeout(c, walletTimeout)
+	defer cancel()
+	var li *nwc.LookupInvoice
+	if li, err = w.MakeInvoice(cc, nwc.Msat(fee*1000),
+		"admission to "+s.Name+" for "+hex.Enc(pubkey), invoiceExpiry); err != nil {
+		return
+	}
+	if len(li.PaymentHash) == 0 || len(li.Invoice) == 0 {
+		err = errorf.E("wallet returned an incomplete invoice")
+		return
+	}
+	now := time.Now().Unix()
+	inv = &admission.Invoice{
+		PaymentHash: string(li.PaymentHash),
+		Invoice:     string(li.Invoice),
+		Pubkey:      hex.Enc(pubkey),
+		Amount:      fee,
+		Days:        days,
+		CreatedAt:   now,
+		ExpiresAt:   li.ExpiresAt,
+	}
+	if inv.ExpiresAt == 0 {
+		inv.ExpiresAt = now + invoiceExpiry
+	}
+	if err = ms.SetInvoice(inv); chk.E(err) {
+		return
+	}
+	log.I.F("issued admission invoice %s to %0x", inv.PaymentHash, pubkey)
+	return
+}
+
+// Member returns the paid membership of a pubkey, or nil if it has none.
+func (s *Server) Member(pubkey []byte) (m *admission.Member) {
+	ms, ok := s.Storage().(store.Memberships)
+	if !ok || len(pubkey) == 0 {
+		return
+	}
+	var err error
+	if m, err = ms.GetMember(pubkey); chk.E(err) {
+		return nil
+	}
+	return
+}
+
+// isMember returns true if paid admission is enabled and the pubkey has an active membership.
+func (s *Server) isMember(pubkey []byte) bool {
+	if _, _, ok := s.PaidAdmission(); !ok {
+		return false
+	}
+	return s.Member(pubkey).Active()
+}
+
+// acceptPaid applies the paid admission policy to the publisher of an event. Members are
+// admitted, and everyone else except the owners and their follows is told to pay. It only
+// stands in for the owners' follow lists, muted users and the guards on deletions still apply.
+// If handled is false the normal policy applies.
+func (s *Server) acceptPaid(pubkey []byte) (handled, accept bool, notice string) {
+	if _, _, ok := s.PaidAdmission(); !ok {
+		return
+	}
+	if s.Member(pubkey).Active() {
+		return true, true, ""
+	}
+	if s.isOwner(pubkey) {
+		return
+	}
+	s.Lock()
+	_, followed := s.Followed[string(pubkey)]
+	s.Unlock()
+	if followed {
+		return
+	}
+	return true, false, string(normalize.Restricted.F(
+		"payment required, see payments_url in the relay information document"))
+}
+
+// pollInvoices periodically asks the wallet about the unpaid admission invoices, admitting the
+// pubkeys whose invoices are paid and removing those that have expired.
+func (s *Server) pollInvoices() {
+	ms, ok := s.Storage().(store.Memberships)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(invoicePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.Ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var err error
+		var invs []*admission.Invoice
+		if invs, err = ms.Invoices(); chk.E(err) || len(invs) == 0 {
+			continue
+		}
+		var w admission.Wallet
+		if w, err = s.getWallet(); chk.E(err) {
+			continue
+		}
+		for _, inv := range invs {
+			s.checkInvoice(ms, w, inv)
+		}
+	}
+}
+
+// checkInvoice looks up an admission invoice and settles or expires it.
+func (s *Server) checkInvoice(ms store.Memberships, w admission.Wallet,
+	inv *admission.Invoice) {
+
+	c, cancel := context.Timeout(s.Ctx, walletTimeout)
+	defer cancel()
+	var err error
+	var li *nwc.LookupInvoice
+	if li, err = w.LookupInvoice(c, []byte(inv.PaymentHash)); err != nil {
+		log.D.F("failed to look up invoice %s: %v", inv.PaymentHash, err)
+		if inv.Expired() {
+			chk.E(ms.DeleteInvoice(inv.PaymentHash))
+		}
+		return
+	}
+	if !admission.Settled(li) {
+		if inv.Expired() {
+			log.D.F("admission invoice %s expired unpaid", inv.PaymentHash)
+			chk.E(ms.DeleteInvoice(inv.PaymentHash))
+		}
+		return
+	}
+	var m *admission.Member
+	if m, err = ms.SettleInvoice(inv.PaymentHash); chk.E(err) || m == nil {
+		return
+	}
+	log.I.F("admitted %s until %s", inv.Pubkey, time.Unix(m.Expires, 0))
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"relay.mleku.dev/admission"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/nwc"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+)
+
+func TestAcceptEventPaidMuted(t *testing.T) {
+	owner, member, stranger := newSigner(t), newSigner(t), newSigner(t)
+	s := newTestServer(t, &config.C{
+		Owners:         []string{hex.Enc(owner.Pub())},
+		PublicReadable: true,
+		AdmissionFee:   1000,
+		NWC:            "nostr+walletconnect://test",
+	})
+	ms := s.Storage().(store.Memberships)
+	if err := ms.SetMember(member.Pub(), &admission.Member{Pubkey: hex.Enc(member.Pub()),
+		Expires: time.Now().Add(time.Hour).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	c := context.Bg()
+	if accept, notice, _ := s.AcceptEvent(c, signed(t, member, 1, "paid"), nil, member.Pub(),
+		"test"); !accept {
+		t.Fatalf("event of a member was rejected: %s", notice)
+	}
+	if accept, _, _ := s.AcceptEvent(c, signed(t, stranger, 1, "free"), nil, stranger.Pub(),
+		"test"); accept {
+		t.Fatal("event of a user who did not pay was accepted")
+	}
+	mute := signed(t, owner, 10000, "", tag.New("p", hex.Enc(member.Pub())))
+	if err := s.Publish(c, mute); err != nil {
+		t.Fatal(err)
+	}
+	s.ZeroLists()
+	s.CheckOwnerLists(c)
+	if accept, _, _ := s.AcceptEvent(c, signed(t, member, 1, "muted"), nil, member.Pub(),
+		"test"); accept {
+		t.Fatal("event of a muted member was accepted because they paid")
+	}
+}
+
+// settledWallet is a wallet for which every invoice has been paid.
+type settledWallet struct{}
+
+func (settledWallet) MakeInvoice(c context.T, amount nwc.Msat, description string,
+	expiry int) (li *nwc.LookupInvoice, err error) {
+	return &nwc.LookupInvoice{}, nil
+}
+
+func (settledWallet) LookupInvoice(c context.T, paymentHash []byte) (li *nwc.LookupInvoice,
+	err error) {
+	return &nwc.LookupInvoice{SettledAt: time.Now().Unix()}, nil
+}
+
+func TestCheckInvoiceSettlesOnce(t *testing.T) {
+	member := newSigner(t)
+	s := newTestServer(t, &config.C{AdmissionFee: 1000, NWC: "nostr+walletconnect://test"})
+	s.Ctx = context.Bg()
+	ms := s.Storage().(store.Memberships)
+	inv := &admission.Invoice{PaymentHash: "00ff", Pubkey: hex.Enc(member.Pub()), Days: 30,
+		ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	if err := ms.SetInvoice(inv); err != nil {
+		t.Fatal(err)
+	}
+	// the invoice is checked again, as it would be if it were polled before it was removed
+	for range 2 {
+		s.checkInvoice(ms, settledWallet{}, inv)
+	}
+	m, err := ms.GetMember(member.Pub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Now().Add(30 * admission.Day).Unix()
+	if !m.Active() || m.Expires > want+5 || m.Expires < want-5 {
+		t.Fatalf("membership expires at %d, expected 30 days from now %d", m.Expires, want)
+	}
+	invs, err := ms.Invoices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invs) != 0 {
+		t.Fatal("settled invoice was not removed")
+	}
+}
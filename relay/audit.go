@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"strconv"
+	"strings"
+
+	"relay.mleku.dev/audit"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+)
+
+// Audit records an action in the audit log, with the pubkey and remote address of who took it,
+// its parameters and the error it failed with, if any. If an Auditor key is set the public part
+// of the entry, without the remote address and free text parameters, is also published as an
+// event signed by it.
+func (s *Server) Audit(actor []byte, remote, operation string, params map[string]string,
+	err error) {
+
+	e := audit.New(actor, remote, operation, params, err)
+	log.I.F("audit: %s %s by %s from %s: %s", e.Operation, e.Params, e.Actor, e.Remote,
+		e.Result)
+	if a, ok := s.Storage().(store.Auditor); ok {
+		if chk.E(a.Audit(e)) {
+			return
+		}
+	}
+	if s.Auditor == nil || s.ReadOnly {
+		return
+	}
+	var ev *event.T
+	if ev, err = e.Event(); chk.E(err) {
+		return
+	}
+	chk.E(s.publishSigned(s.Ctx, s.Auditor, ev))
+}
+
+// auditEvent records the stored events that are administrative actions, NIP-09 deletions by
+// the owners and admins and the follow and mute lists of the owners, which decide who may use
+// the relay. Deletions by other users are theirs to make and are not recorded.
+func (s *Server) auditEvent(ev *event.T, remote string) {
+	params := map[string]string{"id": hex.Enc(ev.Id)}
+	switch {
+	case ev.Kind.Equal(kind.Deletion) && (s.isOwner(ev.Pubkey) || s.isAdmin(ev.Pubkey)):
+		var targets []string
+		for _, t := range ev.Tags.ToSliceOfTags() {
+			if k := string(t.Key()); k == "e" || k == "a" {
+				targets = append(targets, string(t.Value()))
+			}
+		}
+		params["targets"] = strings.Join(targets, ",")
+		s.Audit(ev.Pubkey, remote, "delete", params, nil)
+	case ev.Kind.Equal(kind.FollowList) && s.isOwner(ev.Pubkey):
+		params["follows"] = strconv.Itoa(ev.Tags.GetAll(tag.New("p")).Len())
+		s.Audit(ev.Pubkey, remote, "owner-follow-list", params, nil)
+	case ev.Kind.Equal(kind.MuteList) && s.isOwner(ev.Pubkey):
+		params["mutes"] = strconv.Itoa(ev.Tags.GetAll(tag.New("p")).Len())
+		s.Audit(ev.Pubkey, remote, "owner-mute-list", params, nil)
+	}
+}
@@ -0,0 +1,29 @@
+package relay
+
+import (
+	"testing"
+
+	"relay.mleku.dev/audit"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+)
+
+func TestAuditEventDeletions(t *testing.T) {
+	owner, user := newSigner(t), newSigner(t)
+	s := newTestServer(t, &config.C{Owners: []string{hex.Enc(owner.Pub())},
+		PublicReadable: true})
+	target := hex.Enc(make([]byte, 32))
+	s.auditEvent(signed(t, user, 5, "", tag.New("e", target)), "10.0.0.1")
+	s.auditEvent(signed(t, owner, 5, "", tag.New("e", target)), "10.0.0.2")
+	var entries []*audit.Entry
+	if err := s.Storage().(store.Auditor).AuditLog(0, 0, false,
+		func(e *audit.Entry) bool { entries = append(entries, e); return true }); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != hex.Enc(owner.Pub()) ||
+		entries[0].Params["targets"] != target {
+		t.Fatalf("expected only the deletion of the owner to be audited, got %+v", entries)
+	}
+}
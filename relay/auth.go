@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"relay.mleku.dev/httpauth"
-	"relay.mleku.dev/log"
 
 	"relay.mleku.dev/chk"
 )
@@ -43,6 +42,18 @@ func (s *Server) adminAuth(r *http.Request, remote string,
 	return
 }
 
+// isAdmin returns true if the pubkey is one of the admins of the relay.
+func (s *Server) isAdmin(pubkey []byte) bool {
+	s.Lock()
+	defer s.Unlock()
+	for _, v := range s.admins {
+		if bytes.Equal(v.Pub(), pubkey) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) unauthorized(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 	http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -50,13 +61,10 @@ func (s *Server) unauthorized(w http.ResponseWriter, r *http.Request) {
 		"not authorized, either you did not provide an auth token or what you provided does not grant access\n")
 }
 
-// ServiceURL returns the address of the relay to send back in auth responses.
-// If auth is disabled this returns an empty string.
+// ServiceURL returns the address of the relay to send back in auth responses, including the
+// Path of a tenant. Auth is always available, as it is needed to read privileged events even
+// when it isn't required.
 func (s *Server) ServiceURL(req *http.Request) (st string) {
-	if !s.AuthRequired() && len(s.Owners()) == 0 {
-		log.T.F("auth not required")
-		return
-	}
 	host := req.Header.Get("X-Forwarded-Host")
 	if host == "" {
 		host = req.Host
@@ -80,5 +88,5 @@ func (s *Server) ServiceURL(req *http.Request) (st string) {
 	} else if proto == "http" {
 		proto = "ws"
 	}
-	return proto + "://" + host
+	return proto + "://" + host + s.Path
 }
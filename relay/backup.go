@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"time"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/store"
+)
+
+// backupCheckInterval is how often the backup schedule in the configuration is checked.
+const backupCheckInterval = time.Minute
+
+// backupPolicy returns the directory backups are written to and how often, if dir is empty
+// backups are disabled.
+func (s *Server) backupPolicy() (dir string, interval time.Duration) {
+	s.configurationMx.Lock()
+	defer s.configurationMx.Unlock()
+	if s.configuration == nil {
+		return
+	}
+	return s.configuration.BackupDir, parseTTL(s.configuration.BackupInterval, 24*time.Hour)
+}
+
+// runBackups writes an incremental backup of the event store to the backup directory in the
+// configuration each time the backup interval passes.
+func (s *Server) runBackups() {
+	if _, ok := s.Storage().(store.Backuper); !ok {
+		return
+	}
+	ticker := time.NewTicker(backupCheckInterval)
+	defer ticker.Stop()
+	// the time of the last backup is read from the backup directory, so a restart doesn't
+	// bring the next one forward
+	var last time.Time
+	var lastDir string
+	for {
+		select {
+		case <-s.Ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		dir, interval := s.backupPolicy()
+		if dir == "" {
+			continue
+		}
+		// a replica's store is replaced when its snapshot is refreshed
+		b, ok := s.Storage().(store.Backuper)
+		if !ok {
+			continue
+		}
+		if dir != lastDir {
+			var err error
+			if last, err = b.LastBackup(dir); chk.E(err) {
+				continue
+			}
+			lastDir = dir
+		}
+		if time.Since(last) < interval {
+			continue
+		}
+		last = time.Now()
+		log.I.F("writing scheduled backup to %s", dir)
+		chk.E(b.Backup(dir))
+	}
+}
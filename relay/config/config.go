@@ -1,14 +1,82 @@
 package config
 
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+)
+
 type C struct {
-	FirstTime      string   `json:"first_time" doc:"on first run, this is configured with a random string that must be used to set the first server admin"`
-	AllowList      []string `json:"allow_list" doc:"List of allowed IP addresses"`
-	BlockList      []string `json:"block_list" doc:"list of IP addresses that will be ignored"`
-	Admins         []string `json:"admins" doc:"list of npubs that have admin access"`
-	Owners         []string `json:"owners" doc:"list of owner npubs whose follow lists set the whitelisted users and enables auth implicitly for all writes"`
-	AuthRequired   bool     `json:"auth_required" doc:"authentication is required for read and write" default:"false"`
-	PublicReadable bool     `json:"public_readable" doc:"authentication is relaxed for read except privileged events" default:"false"`
-	LogLevel       string   `json:"log_level" doc:"Log level" doc:"info"`
-	DBLogLevel     string   `json:"db_log_level" default:"info" doc:"database log level"`
-	LogTimestamp   bool     `json:"log_timestamp" default:"false" doc:"print log timestamp"`
+	FirstTime      string      `json:"first_time" doc:"on first run, this is configured with a random string that must be used to set the first server admin"`
+	AllowList      []string    `json:"allow_list" doc:"List of allowed IP addresses"`
+	BlockList      []string    `json:"block_list" doc:"list of IP addresses that will be ignored"`
+	Admins         []string    `json:"admins" doc:"list of npubs that have admin access"`
+	Owners         []string    `json:"owners" doc:"list of owner npubs whose follow lists set the whitelisted users and enables auth implicitly for all writes"`
+	AuthRequired   bool        `json:"auth_required" doc:"authentication is required for read and write" default:"false"`
+	PublicReadable bool        `json:"public_readable" doc:"authentication is relaxed for read except privileged events" default:"false"`
+	NIP17InboxOnly bool        `json:"nip17_inbox_only" doc:"only accept nip-17 gift wrapped events addressed to users of the relay" default:"false"`
+	Groups         bool        `json:"groups" doc:"host nip-29 relay based groups" default:"false"`
+	NIP05Claims    bool        `json:"nip05_claims" doc:"users followed by the owners may claim a nip-05 name on the relay's domain" default:"false"`
+	NIP05Domains   []string    `json:"nip05_domains" doc:"if set, only users with a verified nip-05 identifier in one of these domains may write to the relay"`
+	NIP05TTL       string      `json:"nip05_ttl" doc:"how long a successful nip-05 verification is trusted before it is checked again" default:"24h"`
+	NIP05FailTTL   string      `json:"nip05_fail_ttl" doc:"how long a failed nip-05 verification is cached before it is checked again" default:"1h"`
+	NWC            string      `json:"nwc" doc:"nostr+walletconnect uri of the wallet that issues invoices for paid admission"`
+	AdmissionFee   int         `json:"admission_fee" doc:"fee in sats for access to the relay, if set along with nwc, writes require payment"`
+	AdmissionDays  int         `json:"admission_days" doc:"days of access the admission fee pays for" default:"30"`
+	BackupDir      string      `json:"backup_dir" doc:"directory to write incremental backups of the database to, backups are disabled if empty"`
+	BackupInterval string      `json:"backup_interval" doc:"how often an incremental backup is written to the backup directory" default:"24h"`
+	Retention      []Retention `json:"retention" doc:"rules for how long events are kept, the first rule matching the kind and author of an event applies to it"`
+	Quotas         []Quota     `json:"quotas" doc:"limits on the storage the events of each author may use, the first quota for the class of an author applies to them"`
+	WoT            WoT         `json:"wot" doc:"access to the relay by the trust of users in the follow graph of the owners"`
+	Moderation     Moderation  `json:"moderation" doc:"handling of nip-56 reports of events and users"`
+	Info           Info        `json:"info" doc:"the operator's part of the relay information document"`
+	LogLevel       string      `json:"log_level" doc:"Log level" doc:"info"`
+	DBLogLevel     string      `json:"db_log_level" default:"info" doc:"database log level"`
+	LogTimestamp   bool        `json:"log_timestamp" default:"false" doc:"print log timestamp"`
+}
+
+// Validate checks the parts of the configuration that must be well formed.
+func (c *C) Validate() (err error) {
+	if err = c.Info.Validate(); err != nil {
+		return
+	}
+	for i := range c.Retention {
+		if err = c.Retention[i].Validate(); err != nil {
+			return
+		}
+	}
+	if err = c.WoT.Validate(); err != nil {
+		return
+	}
+	if err = c.Moderation.Validate(); err != nil {
+		return
+	}
+	for i := range c.Quotas {
+		if err = c.Quotas[i].Validate(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Changes returns the names of the fields of the configuration that differ from a previous
+// one, as they are named in JSON, so a change can be recorded without the values, which may
+// be secrets such as the nwc uri.
+func (c *C) Changes(prev *C) (fields []string) {
+	var cur, old map[string]json.RawMessage
+	if b, err := json.Marshal(c); err == nil {
+		_ = json.Unmarshal(b, &cur)
+	}
+	if prev != nil {
+		if b, err := json.Marshal(prev); err == nil {
+			_ = json.Unmarshal(b, &old)
+		}
+	}
+	for k, v := range cur {
+		if !bytes.Equal(v, old[k]) {
+			fields = append(fields, k)
+		}
+	}
+	slices.Sort(fields)
+	return
 }
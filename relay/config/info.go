@@ -0,0 +1,126 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"relay.mleku.dev/bech32encoding"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/keys"
+	"relay.mleku.dev/relayinfo"
+)
+
+// Info is the part of the relay information document, NIP-11, written by the operator. The rest
+// of it is derived from the configuration of the relay.
+type Info struct {
+	Description    string          `json:"description,omitempty" doc:"description of the relay, the software's description if empty"`
+	Icon           string          `json:"icon,omitempty" doc:"url of an image to show for the relay"`
+	PubKey         string          `json:"pubkey,omitempty" doc:"npub or hex pubkey of the operator of the relay, the relay identity if empty, and replaced by it if groups are hosted, as group metadata is signed by it"`
+	Contact        string          `json:"contact,omitempty" doc:"another way to contact the operator, a uri such as mailto: or https:"`
+	PostingPolicy  string          `json:"posting_policy,omitempty" doc:"url of a page with the rules for posting to the relay"`
+	RelayCountries []string        `json:"relay_countries,omitempty" doc:"ISO 3166-1 alpha-2 codes of the countries whose laws apply to the relay, * for any"`
+	LanguageTags   []string        `json:"language_tags,omitempty" doc:"IETF language tags of the main languages used on the relay, * for any"`
+	Tags           []string        `json:"tags,omitempty" doc:"topics and rules of the relay, such as sfw-only"`
+	Fees           *relayinfo.Fees `json:"fees,omitempty" doc:"fees for using the relay, the paid admission fee is added to the subscriptions"`
+}
+
+var (
+	countryRegex  = regexp.MustCompile(`^([A-Z]{2}|\*)$`)
+	languageRegex = regexp.MustCompile(`^([a-zA-Z]{2,8}(-[a-zA-Z0-9]{1,8})*|\*)$`)
+)
+
+// Validate checks the values of the information document are well formed, and normalizes the
+// operator's pubkey to hex and the country codes to upper case.
+func (inf *Info) Validate() (err error) {
+	if inf.PubKey != "" {
+		pk := strings.ToLower(inf.PubKey)
+		if !keys.IsValidPublicKey(pk) {
+			var b []byte
+			if b, err = bech32encoding.NpubToBytes([]byte(pk)); err != nil {
+				return errorf.E("invalid pubkey '%s'", inf.PubKey)
+			}
+			pk = hex.Enc(b)
+		}
+		inf.PubKey = pk
+	}
+	for _, u := range []struct{ name, value string }{
+		{"icon", inf.Icon}, {"posting policy", inf.PostingPolicy},
+	} {
+		if u.value == "" {
+			continue
+		}
+		var p *url.URL
+		if p, err = url.Parse(u.value); err != nil ||
+			(p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+			return errorf.E("%s must be an http or https url: '%s'", u.name, u.value)
+		}
+	}
+	if inf.Contact != "" {
+		var p *url.URL
+		if p, err = url.Parse(inf.Contact); err != nil || p.Scheme == "" {
+			return errorf.E("contact must be a uri such as mailto:, got '%s'", inf.Contact)
+		}
+	}
+	for i, c := range inf.RelayCountries {
+		if inf.RelayCountries[i] = strings.ToUpper(c); !countryRegex.MatchString(
+			inf.RelayCountries[i]) {
+			return errorf.E("invalid country code '%s'", c)
+		}
+	}
+	for _, l := range inf.LanguageTags {
+		if !languageRegex.MatchString(l) {
+			return errorf.E("invalid language tag '%s'", l)
+		}
+	}
+	for _, t := range inf.Tags {
+		if t == "" {
+			return errorf.E("empty tag")
+		}
+	}
+	if inf.Fees != nil {
+		if err = validateFees(inf.Fees); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func validateFees(fees *relayinfo.Fees) (err error) {
+	check := func(fee string, amount int, unit string) error {
+		if amount <= 0 {
+			return errorf.E("%s fee amount must be positive, got %d", fee, amount)
+		}
+		if unit == "" {
+			return errorf.E("%s fee has no unit", fee)
+		}
+		return nil
+	}
+	for _, a := range fees.Admission {
+		if err = check("admission", a.Amount, a.Unit); err != nil {
+			return
+		}
+	}
+	for _, s := range fees.Subscription {
+		if err = check("subscription", s.Amount, s.Unit); err != nil {
+			return
+		}
+		if s.Period <= 0 {
+			return errorf.E("subscription fee period must be positive, got %d", s.Period)
+		}
+	}
+	for _, p := range fees.Publication {
+		for _, pub := range p {
+			if err = check("publication", pub.Amount, pub.Unit); err != nil {
+				return
+			}
+			for _, k := range pub.Kinds {
+				if k < 0 || k > 65535 {
+					return errorf.E("invalid kind %d in publication fee", k)
+				}
+			}
+		}
+	}
+	return
+}
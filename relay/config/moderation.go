@@ -0,0 +1,38 @@
+package config
+
+import (
+	"relay.mleku.dev/errorf"
+)
+
+// Moderation is how NIP-56 reports are weighed, the weight of a report is that of the class of
+// its reporter, and the reported events and users are hidden once the weights of the reports
+// about them reach the threshold, until a moderator decides their case.
+type Moderation struct {
+	Enabled        bool    `json:"enabled" doc:"open moderation cases for reported events and users, and hide them when the reports about them cross the threshold" default:"false"`
+	OwnerWeight    float64 `json:"owner_weight" doc:"weight of a report by an owner" default:"5"`
+	FollowedWeight float64 `json:"followed_weight" doc:"weight of a report by a user followed by the owners" default:"1"`
+	GuestWeight    float64 `json:"guest_weight" doc:"weight of a report by anyone else" default:"0.2"`
+	HideThreshold  float64 `json:"hide_threshold" doc:"the total weight of reports that hides a reported event or user, nothing is hidden if zero" default:"5"`
+}
+
+// Validate checks the weights and the threshold are not negative.
+func (m *Moderation) Validate() (err error) {
+	if m.OwnerWeight < 0 || m.FollowedWeight < 0 || m.GuestWeight < 0 {
+		return errorf.E("moderation report weights must not be negative")
+	}
+	if m.HideThreshold < 0 {
+		return errorf.E("moderation hide threshold must not be negative")
+	}
+	return
+}
+
+// Weight returns the weight of a report by a reporter of a class of authors.
+func (m *Moderation) Weight(class string) float64 {
+	switch class {
+	case AuthorOwner:
+		return m.OwnerWeight
+	case AuthorFollowed:
+		return m.FollowedWeight
+	}
+	return m.GuestWeight
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"relay.mleku.dev/errorf"
+)
+
+// Quota limits the storage the events of each author of a class may use. The first quota for
+// the class of the author of an event applies to them, and authors with none have no limit.
+type Quota struct {
+	Authors   string `json:"authors,omitempty" doc:"class of authors the quota applies to, owner, followed or guest, all authors if empty"`
+	MaxEvents int64  `json:"max_events,omitempty" doc:"the most events each author may have stored, no limit if zero"`
+	MaxBytes  int64  `json:"max_bytes,omitempty" doc:"the most bytes of events each author may have stored, no limit if zero"`
+}
+
+// Validate checks the quota applies to a class of authors and limits their storage.
+func (q *Quota) Validate() (err error) {
+	if err = validAuthors(q.Authors); err != nil {
+		return
+	}
+	if q.MaxEvents < 0 || q.MaxBytes < 0 {
+		return errorf.E("invalid quota of %d events and %d bytes", q.MaxEvents, q.MaxBytes)
+	}
+	if q.MaxEvents == 0 && q.MaxBytes == 0 {
+		return errorf.E("quota for authors '%s' has no max events or bytes", q.Authors)
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/relayinfo"
+)
+
+// The classes of authors a retention rule can apply to.
+const (
+	// AuthorOwner is the owners of the relay.
+	AuthorOwner = "owner"
+	// AuthorFollowed is the users followed by the owners, and those they follow.
+	AuthorFollowed = "followed"
+	// AuthorGuest is everyone else.
+	AuthorGuest = "guest"
+)
+
+// validAuthors checks a class of authors is one of the classes, or empty for all of them.
+func validAuthors(class string) (err error) {
+	switch class {
+	case "", AuthorOwner, AuthorFollowed, AuthorGuest:
+		return
+	}
+	return errorf.E("invalid author class '%s'", class)
+}
+
+// Retention is a rule for how long events are kept. The first rule that matches the kind and
+// author of an event applies to it, and events that match none are kept until they are deleted.
+type Retention struct {
+	Kinds    []string `json:"kinds,omitempty" doc:"kinds and inclusive ranges of kinds the rule applies to, such as 7 or 30000-39999, all kinds if empty"`
+	Authors  string   `json:"authors,omitempty" doc:"class of authors the rule applies to, owner, followed or guest, all authors if empty"`
+	MaxAge   string   `json:"max_age,omitempty" doc:"how long events are kept after they were created, such as 720h, forever if empty"`
+	MaxCount int      `json:"max_count,omitempty" doc:"the most events each author may have kept, the oldest are deleted first, no limit if zero"`
+}
+
+// KindRanges returns the ranges of kinds the rule applies to.
+func (rt *Retention) KindRanges() (kr []relayinfo.KindRange, err error) {
+	for _, k := range rt.Kinds {
+		from, to, isRange := strings.Cut(k, "-")
+		var f, t uint64
+		if f, err = strconv.ParseUint(strings.TrimSpace(from), 10, 16); err != nil {
+			return nil, errorf.E("invalid kind '%s'", k)
+		}
+		t = f
+		if isRange {
+			if t, err = strconv.ParseUint(strings.TrimSpace(to), 10, 16); err != nil || t < f {
+				return nil, errorf.E("invalid kind range '%s'", k)
+			}
+		}
+		kr = append(kr, relayinfo.KindRange{From: uint16(f), To: uint16(t)})
+	}
+	return
+}
+
+// Age returns the maximum age of the events the rule applies to, zero if they are kept forever.
+func (rt *Retention) Age() (age time.Duration, err error) {
+	if rt.MaxAge == "" {
+		return
+	}
+	if age, err = time.ParseDuration(rt.MaxAge); err != nil || age <= 0 {
+		return 0, errorf.E("invalid max age '%s'", rt.MaxAge)
+	}
+	return
+}
+
+// Validate checks the rule can be applied, and that it limits the events it applies to.
+func (rt *Retention) Validate() (err error) {
+	if _, err = rt.KindRanges(); err != nil {
+		return
+	}
+	if err = validAuthors(rt.Authors); err != nil {
+		return
+	}
+	var age time.Duration
+	if age, err = rt.Age(); err != nil {
+		return
+	}
+	if rt.MaxCount < 0 {
+		return errorf.E("invalid max count %d", rt.MaxCount)
+	}
+	if age == 0 && rt.MaxCount == 0 {
+		return errorf.E("retention rule for kinds %v has no max age or count", rt.Kinds)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"relay.mleku.dev/errorf"
+)
+
+// WoT is the web of trust, the trust in users derived from the follow lists of the owners, the
+// users they follow, and so on, which sets what each user may do on the relay.
+type WoT struct {
+	Enabled  bool        `json:"enabled" doc:"control access to the relay by the trust of users in the follow graph of the owners" default:"false"`
+	MaxDepth int         `json:"max_depth,omitempty" doc:"how many hops of follows from the owners are in the web of trust" default:"3"`
+	Damping  float64     `json:"damping,omitempty" doc:"the chance a random walk through the follows goes on at each step rather than going back to an owner, higher spreads trust further" default:"0.85"`
+	Tiers    []TrustTier `json:"tiers,omitempty" doc:"access by trust, the first tier a user is in applies to them, and users in no tier may not read or write"`
+}
+
+// TrustTier is the access given to the users who are trusted enough to be in it.
+type TrustTier struct {
+	Name        string  `json:"name" doc:"name of the tier"`
+	MinScore    float64 `json:"min_score,omitempty" doc:"the lowest trust score in the tier, from 0 to 1, the most trusted user who is not an owner has a score of 1"`
+	MaxDistance int     `json:"max_distance,omitempty" doc:"the most hops of follows from the owners in the tier, owners are 0 hops away, no limit if zero"`
+	Read        bool    `json:"read" doc:"users in the tier may read from the relay"`
+	Write       bool    `json:"write" doc:"users in the tier may publish events to the relay"`
+	RateLimit   int     `json:"rate_limit,omitempty" doc:"the most events and the most requests users in the tier may send a minute, no limit if zero"`
+}
+
+// Validate checks the web of trust can be computed and its tiers can be applied.
+func (w *WoT) Validate() (err error) {
+	if !w.Enabled {
+		return
+	}
+	if w.MaxDepth < 1 || w.MaxDepth > 6 {
+		return errorf.E("web of trust max depth must be from 1 to 6, got %d", w.MaxDepth)
+	}
+	if w.Damping <= 0 || w.Damping >= 1 {
+		return errorf.E("web of trust damping must be between 0 and 1, got %f", w.Damping)
+	}
+	for _, t := range w.Tiers {
+		if t.Name == "" {
+			return errorf.E("trust tier has no name")
+		}
+		if t.MinScore < 0 || t.MinScore > 1 {
+			return errorf.E("min score of trust tier %s must be from 0 to 1", t.Name)
+		}
+		if t.MaxDistance < 0 || t.RateLimit < 0 {
+			return errorf.E("invalid max distance or rate limit of trust tier %s", t.Name)
+		}
+	}
+	return
+}
+
+// Tier returns the first tier that a user with a distance from the owners, -1 if they are not
+// in the follow graph, and a trust score is in, or nil if they are in none.
+func (w *WoT) Tier(distance int, score float64) (t *TrustTier) {
+	for i := range w.Tiers {
+		t = &w.Tiers[i]
+		if score < t.MinScore {
+			continue
+		}
+		if t.MaxDistance > 0 && (distance < 0 || distance > t.MaxDistance) {
+			continue
+		}
+		return
+	}
+	return nil
+}
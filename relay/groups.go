@@ -0,0 +1,340 @@
+package relay
+
+import (
+	"bytes"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/filters"
+	"relay.mleku.dev/groups"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/normalize"
+	"relay.mleku.dev/sha256"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+)
+
+// GroupsEnabled returns true if the relay hosts NIP-29 relay based groups.
+func (s *Server) GroupsEnabled() bool {
+	s.configurationMx.Lock()
+	defer s.configurationMx.Unlock()
+	return s.configuration.Groups
+}
+
+// loadGroups reads the state of all groups from the store into memory, so that checks on reads
+// and writes don't need to touch the database.
+func (s *Server) loadGroups() {
+	s.groupsMx.Lock()
+	defer s.groupsMx.Unlock()
+	s.groups = make(map[string]*groups.Group)
+	gs, ok := s.Storage().(store.Grouper)
+	if !ok {
+		return
+	}
+	var err error
+	var all []*groups.Group
+	if all, err = gs.Groups(); chk.E(err) {
+		return
+	}
+	for _, g := range all {
+		s.groups[g.Id] = g
+	}
+	log.I.F("loaded %d groups", len(s.groups))
+}
+
+// Group returns a copy of the state of a group, or nil if it doesn't exist.
+func (s *Server) Group(id string) (g *groups.Group) {
+	s.groupsMx.Lock()
+	defer s.groupsMx.Unlock()
+	var ok bool
+	if g, ok = s.groups[id]; !ok {
+		return nil
+	}
+	return g.Clone()
+}
+
+// saveGroup stores the state of a group and publishes the relay signed metadata describing it.
+func (s *Server) saveGroup(c context.T, g *groups.Group) (err error) {
+	if gs, ok := s.Storage().(store.Grouper); ok {
+		if err = gs.SetGroup(g); chk.E(err) {
+			return
+		}
+	}
+	s.groupsMx.Lock()
+	s.groups[g.Id] = g
+	s.groupsMx.Unlock()
+	if s.Identity() == nil {
+		log.W.F("no relay identity, not publishing metadata of group %s", g.Id)
+		return
+	}
+	for _, ev := range g.Metadata() {
+		if err = s.PublishAsRelay(c, ev); chk.E(err) {
+			return
+		}
+	}
+	return
+}
+
+// deleteGroup removes the state of a group and its relay signed metadata.
+func (s *Server) deleteGroup(c context.T, id string) (err error) {
+	if gs, ok := s.Storage().(store.Grouper); ok {
+		if err = gs.DeleteGroup(id); chk.E(err) {
+			return
+		}
+	}
+	s.groupsMx.Lock()
+	delete(s.groups, id)
+	s.groupsMx.Unlock()
+	sign := s.Identity()
+	if sign == nil {
+		return
+	}
+	return s.deleteGroupMetadata(c, sign.Pub(), id)
+}
+
+// deleteGroupMetadata removes the metadata of a group signed by a relay identity.
+func (s *Server) deleteGroupMetadata(c context.T, identity []byte, id string) (err error) {
+	var evs event.Ts
+	if evs, err = s.Storage().QueryEvents(c, &filter.T{
+		Authors: tag.New(identity),
+		Kinds: kinds.New(kind.GroupMetadata, kind.GroupAdmins, kind.GroupMembers,
+			kind.GroupRoles),
+		Tags: tags.New(tag.New("#d", id)),
+	}); chk.E(err) {
+		return
+	}
+	for _, ev := range evs {
+		if err = s.Storage().DeleteEvent(c, ev.EventId(), true); chk.E(err) {
+			return
+		}
+	}
+	return
+}
+
+// resignGroups replaces the metadata of the groups signed by a previous relay identity with
+// metadata signed by the current one.
+func (s *Server) resignGroups(c context.T, prev []byte) {
+	s.groupUpdateMx.Lock()
+	defer s.groupUpdateMx.Unlock()
+	s.groupsMx.Lock()
+	gs := make([]*groups.Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		gs = append(gs, g.Clone())
+	}
+	s.groupsMx.Unlock()
+	for _, g := range gs {
+		if chk.E(s.deleteGroupMetadata(c, prev, g.Id)) {
+			continue
+		}
+		chk.E(s.saveGroup(c, g))
+	}
+}
+
+// acceptGroupEvent applies the NIP-29 rules to events that concern a group, if the relay hosts
+// groups. If handled is false the event is not a group event and the normal policy applies.
+//
+// Group events are accepted from members regardless of the other relay policies, moderation
+// events only from those with a suitable role in the group, and the changes they make are
+// applied after the event has been saved.
+func (s *Server) acceptGroupEvent(c context.T, ev *event.T) (handled, accept bool,
+	notice string, afterSave func()) {
+
+	// relays that don't host groups store the events of groups like any others, such as those
+	// mirrored from the relays that do.
+	if !s.GroupsEnabled() {
+		return
+	}
+	if ev.Kind.IsGroupMetadata() {
+		return true, false, string(normalize.Blocked.F(
+			"group metadata is only published by the relay")), nil
+	}
+	id := groups.GetId(ev)
+	if id == "" {
+		if ev.Kind.IsGroupModeration() || ev.Kind.Equal(kind.GroupJoinRequest) ||
+			ev.Kind.Equal(kind.GroupLeaveRequest) {
+			return true, false, string(normalize.Invalid.F("group event without h tag")), nil
+		}
+		return
+	}
+	handled = true
+	g := s.Group(id)
+	switch {
+	case ev.Kind.Equal(kind.GroupCreate):
+		if g != nil {
+			notice = string(normalize.Duplicate.F("group %s already exists", id))
+			return
+		}
+		if !groups.ValidId.MatchString(id) {
+			notice = string(normalize.Invalid.F("invalid group id '%s'", id))
+			return
+		}
+		if !s.mayCreateGroup(ev.Pubkey) {
+			notice = string(normalize.Restricted.F("not permitted to create groups on this relay"))
+			return
+		}
+		return true, true, "", func() {
+			chk.E(s.saveGroup(c, groups.New(id, ev.Pubkey, ev.CreatedAt.I64())))
+		}
+	case g == nil:
+		notice = string(normalize.Invalid.F("group %s does not exist", id))
+		return
+	case ev.Kind.Equal(kind.GroupJoinRequest):
+		if g.IsMember(ev.Pubkey) {
+			notice = string(normalize.Duplicate.F("already a member of group %s", id))
+			return
+		}
+		// requests that don't carry a valid invite to a closed group are kept for the admins
+		// to act on.
+		return true, true, "", s.updateGroup(c, id, func(g *groups.Group) bool {
+			return g.Join(ev)
+		})
+	case ev.Kind.Equal(kind.GroupLeaveRequest):
+		if !g.IsMember(ev.Pubkey) {
+			notice = string(normalize.Invalid.F("not a member of group %s", id))
+			return
+		}
+		return true, true, "", s.updateGroup(c, id, func(g *groups.Group) bool {
+			return g.Leave(ev)
+		})
+	case ev.Kind.IsGroupModeration():
+		if !g.CanModerate(ev.Pubkey, ev.Kind) && !s.isOwner(ev.Pubkey) {
+			notice = string(normalize.Restricted.F("not permitted to moderate group %s", id))
+			return
+		}
+		// check the action is valid before accepting it.
+		var err error
+		if err = g.Apply(ev); err != nil {
+			notice = string(normalize.Invalid.F(err.Error()))
+			return
+		}
+		switch {
+		case ev.Kind.Equal(kind.GroupDelete):
+			return true, true, "", func() { chk.E(s.deleteGroup(c, id)) }
+		case ev.Kind.Equal(kind.GroupDeleteEvent):
+			return true, true, "", func() { s.deleteGroupEvents(c, id, ev) }
+		}
+		return true, true, "", s.updateGroup(c, id, func(g *groups.Group) bool {
+			return !chk.E(g.Apply(ev))
+		})
+	default:
+		if !g.IsMember(ev.Pubkey) {
+			notice = string(normalize.Restricted.F("not a member of group %s", id))
+			return
+		}
+		accept = true
+	}
+	return
+}
+
+// updateGroup returns a function that applies a change to the current state of a group and
+// saves it if it changed.
+func (s *Server) updateGroup(c context.T, id string,
+	change func(g *groups.Group) (changed bool)) func() {
+
+	return func() {
+		s.groupUpdateMx.Lock()
+		defer s.groupUpdateMx.Unlock()
+		g := s.Group(id)
+		if g == nil || !change(g) {
+			return
+		}
+		chk.E(s.saveGroup(c, g))
+	}
+}
+
+// deleteGroupEvents removes the events referred to by the e tags of a GroupDeleteEvent, as long
+// as they belong to the group.
+func (s *Server) deleteGroupEvents(c context.T, id string, ev *event.T) {
+	var err error
+	for _, t := range ev.Tags.GetAll(tag.New("e")).ToSliceOfTags() {
+		evId := make([]byte, sha256.Size)
+		if _, err = hex.DecBytes(evId, t.Value()); chk.E(err) {
+			continue
+		}
+		var evs event.Ts
+		if evs, err = s.Storage().QueryEvents(c, &filter.T{IDs: tag.New(evId)}); chk.E(err) {
+			continue
+		}
+		for _, target := range evs {
+			if groups.GetId(target) != id {
+				log.I.F("not deleting event %0x, it isn't in group %s", target.Id, id)
+				continue
+			}
+			chk.E(s.Storage().DeleteEvent(c, target.EventId()))
+		}
+	}
+}
+
+// mayCreateGroup returns true if the pubkey may create new groups. If the relay has owners
+// this is limited to them and the users they follow.
+func (s *Server) mayCreateGroup(pubkey []byte) bool {
+	if len(s.Owners()) == 0 {
+		return true
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.Followed[string(pubkey)]
+	return ok
+}
+
+// isOwner returns true if the pubkey is one of the relay owners.
+func (s *Server) isOwner(pubkey []byte) bool {
+	for _, o := range s.Owners() {
+		if bytes.Equal(o, pubkey) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupReadable returns true if the event is not in a private group, or the pubkey is a member
+// of the group.
+func (s *Server) groupReadable(ev *event.T, pubkey []byte) bool {
+	id := groups.GetId(ev)
+	if id == "" {
+		return true
+	}
+	s.groupsMx.Lock()
+	defer s.groupsMx.Unlock()
+	g, ok := s.groups[id]
+	if !ok || !g.Private {
+		return true
+	}
+	return g.IsMember(pubkey)
+}
+
+// groupFilters removes the filters that ask for the events of private groups the pubkey isn't
+// a member of.
+func (s *Server) groupFilters(ff *filters.T, pubkey []byte) (allowed *filters.T,
+	modified bool) {
+
+	s.groupsMx.Lock()
+	defer s.groupsMx.Unlock()
+	allowed = ff
+	var permitted []*filter.T
+next:
+	for _, f := range ff.F {
+		if f.Tags != nil {
+			for _, t := range f.Tags.GetAll(tag.New("#h")).ToSliceOfTags() {
+				for _, id := range t.ToSliceOfBytes()[1:] {
+					if g, ok := s.groups[string(id)]; ok && g.Private && !g.IsMember(pubkey) {
+						log.T.F("removing filter for private group %s", id)
+						modified = true
+						continue next
+					}
+				}
+			}
+		}
+		permitted = append(permitted, f)
+	}
+	if modified {
+		allowed = filters.New(permitted...)
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/tag"
+)
+
+func TestAcceptGroupEventsWithoutGroups(t *testing.T) {
+	s := newTestServer(t, &config.C{PublicReadable: true})
+	user := newSigner(t)
+	c := context.Bg()
+	for _, ev := range []struct {
+		name string
+		k    uint16
+		tags []*tag.T
+	}{
+		{"message in a group", 9, []*tag.T{tag.New("h", "pizza")}},
+		{"group metadata", 39000, []*tag.T{tag.New("d", "pizza")}},
+		{"group moderation", 9000, []*tag.T{tag.New("h", "pizza")}},
+	} {
+		if accept, notice, _ := s.AcceptEvent(c, signed(t, user, ev.k, "", ev.tags...), nil,
+			user.Pub(), "test"); !accept {
+			t.Errorf("%s rejected by a relay that doesn't host groups: %s", ev.name, notice)
+		}
+	}
+	s.configuration.Groups = true
+	if accept, _, _ := s.AcceptEvent(c, signed(t, user, 39000, "", tag.New("d", "pizza")), nil,
+		user.Pub(), "test"); accept {
+		t.Error("group metadata not published by the relay accepted by a relay hosting groups")
+	}
+}
+
+func TestAcceptGroupEventsMutedAndBanned(t *testing.T) {
+	owner, user := newSigner(t), newSigner(t)
+	s := newTestServer(t, &config.C{Owners: []string{hex.Enc(owner.Pub())},
+		PublicReadable: true, Groups: true})
+	c := context.Bg()
+	accept := func(ev *event.T) (ok bool) {
+		ok, _, afterSave := s.AcceptEvent(c, ev, nil, ev.Pubkey, "test")
+		if ok && afterSave != nil {
+			afterSave()
+		}
+		return
+	}
+	if !accept(signed(t, owner, 9007, "", tag.New("h", "pizza"))) {
+		t.Fatal("owner could not create a group")
+	}
+	if !accept(signed(t, user, 9021, "", tag.New("h", "pizza"))) {
+		t.Fatal("user could not join an open group")
+	}
+	if !accept(signed(t, user, 9, "hello", tag.New("h", "pizza"))) {
+		t.Fatal("member could not post to the group")
+	}
+	// muted and banned users can't post to the groups they are members of
+	s.Lock()
+	s.Muted = List{string(user.Pub()): {}}
+	s.Unlock()
+	if accept(signed(t, user, 9, "muted", tag.New("h", "pizza"))) {
+		t.Error("muted member posted to the group")
+	}
+	if accept(signed(t, user, 9022, "", tag.New("h", "pizza"))) {
+		t.Error("muted member sent a group request")
+	}
+	s.Lock()
+	s.Muted = nil
+	s.Unlock()
+	s.moderationMx.Lock()
+	s.banned = List{string(user.Pub()): {}}
+	s.moderationMx.Unlock()
+	if accept(signed(t, user, 9, "banned", tag.New("h", "pizza"))) {
+		t.Error("banned member posted to the group")
+	}
+}
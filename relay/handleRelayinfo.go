@@ -5,7 +5,10 @@ import (
 	"net/http"
 	"sort"
 
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/number"
 	"relay.mleku.dev/relayinfo"
+	"relay.mleku.dev/store"
 	"relay.mleku.dev/version"
 
 	"relay.mleku.dev/chk"
@@ -13,10 +16,68 @@ import (
 )
 
 func (s *Server) HandleRelayInfo(w http.ResponseWriter, r *http.Request) {
-	r.Header.Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "application/json")
 	log.I.Ln("handling relay information document")
-	var info *relayinfo.T
-	supportedNIPs := relayinfo.GetList(
+	if err := json.NewEncoder(w).Encode(s.RelayInfo(r)); chk.E(err) {
+	}
+}
+
+// RelayInfo returns the relay information document, NIP-11, as served for a request.
+func (s *Server) RelayInfo(r *http.Request) (info *relayinfo.T) {
+	cfg := s.Configuration()
+	info = &relayinfo.T{Name: s.Name,
+		Description: cfg.Info.Description,
+		PubKey:      cfg.Info.PubKey,
+		Contact:     cfg.Info.Contact,
+		Nips:        s.supportedNIPs(),
+		Software:    version.URL, Version: version.V,
+		Limitation: relayinfo.Limits{
+			MaxLimit:         s.MaxLimit,
+			AuthRequired:     s.AuthRequired(),
+			RestrictedWrites: !s.PublicReadable() || s.AuthRequired() || len(s.owners) > 0,
+		},
+		Retention:      s.retention(),
+		RelayCountries: cfg.Info.RelayCountries,
+		LanguageTags:   cfg.Info.LanguageTags,
+		Tags:           cfg.Info.Tags,
+		PostingPolicy:  cfg.Info.PostingPolicy,
+		Icon:           cfg.Info.Icon,
+	}
+	if info.Description == "" {
+		info.Description = version.Description
+	}
+	if s.ReadOnly {
+		info.Limitation.RestrictedWrites = true
+	}
+	// group metadata is signed by the relay identity, so clients need to know it, and it is
+	// the contact if the operator hasn't named one.
+	if sign := s.Identity(); sign != nil {
+		info.Self = hex.Enc(sign.Pub())
+		if info.PubKey == "" || s.GroupsEnabled() {
+			info.PubKey = info.Self
+		}
+	}
+	if cfg.Info.Fees != nil {
+		fees := *cfg.Info.Fees
+		info.Fees = &fees
+	}
+	if fee, days, ok := s.PaidAdmission(); ok {
+		info.Limitation.PaymentRequired = true
+		info.Limitation.RestrictedWrites = true
+		info.PaymentsURL = s.PaymentsURL(r)
+		if info.Fees == nil {
+			info.Fees = &relayinfo.Fees{}
+		}
+		info.Fees.Subscription = append([]relayinfo.Subscription{
+			{Amount: fee * 1000, Unit: "msats", Period: days * 86400},
+		}, info.Fees.Subscription...)
+	}
+	return
+}
+
+// supportedNIPs returns the NIPs supported by the parts of the relay that are enabled.
+func (s *Server) supportedNIPs() (nips number.List) {
+	nips = relayinfo.GetList(
 		relayinfo.BasicProtocol,
 		relayinfo.EncryptedDirectMessage,
 		relayinfo.EventDeletion,
@@ -30,20 +91,26 @@ func (s *Server) HandleRelayInfo(w http.ResponseWriter, r *http.Request) {
 		relayinfo.ProtectedEvents,
 		relayinfo.RelayListMetadata,
 	)
-	if s.ServiceURL(r) != "" {
-		supportedNIPs = append(supportedNIPs, relayinfo.Authentication.N())
+	cfg := s.Configuration()
+	// names are only served by a store that keeps them, and only claimed if that is enabled.
+	if _, ok := s.Storage().(store.Namer); ok && cfg.NIP05Claims {
+		nips = append(nips, relayinfo.MappingNostrKeysToDNS.N())
 	}
-	sort.Sort(supportedNIPs)
-	log.T.Ln("supported NIPs", supportedNIPs)
-	info = &relayinfo.T{Name: s.Name,
-		Description: version.Description,
-		Nips:        supportedNIPs, Software: version.URL, Version: version.V,
-		Limitation: relayinfo.Limits{
-			MaxLimit:         s.MaxLimit,
-			AuthRequired:     s.AuthRequired(),
-			RestrictedWrites: !s.PublicReadable() || s.AuthRequired() || len(s.owners) > 0,
-		},
-		Icon: "https://cdn.satellite.earth/ac9778868fbf23b63c47c769a74e163377e6ea94d3f0f31711931663d035c4f6.png"}
-	if err := json.NewEncoder(w).Encode(info); chk.E(err) {
+	// clients are asked to auth for everything when it is required, and for reading gift wraps
+	// and private groups otherwise.
+	if cfg.AuthRequired || cfg.NIP17InboxOnly || cfg.Groups {
+		nips = append(nips, relayinfo.Authentication.N())
+	}
+	if cfg.NIP17InboxOnly {
+		nips = append(nips, relayinfo.PrivateDirectMessages.N())
+	}
+	if cfg.Groups {
+		nips = append(nips, relayinfo.RelayBasedGroups.N())
+	}
+	if cfg.Moderation.Enabled {
+		nips = append(nips, relayinfo.Reporting.N())
 	}
+	sort.Sort(nips)
+	log.T.Ln("supported NIPs", nips)
+	return
 }
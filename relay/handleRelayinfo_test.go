@@ -0,0 +1,46 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/relayinfo"
+)
+
+func TestSupportedNIPs(t *testing.T) {
+	optional := []relayinfo.NIP{relayinfo.MappingNostrKeysToDNS, relayinfo.PrivateDirectMessages,
+		relayinfo.RelayBasedGroups, relayinfo.Authentication, relayinfo.Reporting}
+	for _, tt := range []struct {
+		name   string
+		cfg    *config.C
+		listed []relayinfo.NIP
+	}{
+		{"nothing enabled", &config.C{}, nil},
+		{"everything enabled", &config.C{AuthRequired: true, NIP17InboxOnly: true, Groups: true,
+			NIP05Claims: true, Moderation: config.Moderation{Enabled: true}}, optional},
+		{"auth required", &config.C{AuthRequired: true},
+			[]relayinfo.NIP{relayinfo.Authentication}},
+		{"nip-17 inbox", &config.C{NIP17InboxOnly: true},
+			[]relayinfo.NIP{relayinfo.Authentication, relayinfo.PrivateDirectMessages}},
+		{"nip-05 claims", &config.C{NIP05Claims: true},
+			[]relayinfo.NIP{relayinfo.MappingNostrKeysToDNS}},
+		{"moderation", &config.C{Moderation: config.Moderation{Enabled: true}},
+			[]relayinfo.NIP{relayinfo.Reporting}},
+	} {
+		s := newTestServer(t, tt.cfg)
+		info := s.RelayInfo(httptest.NewRequest("GET", "http://relay.example/", nil))
+		for _, n := range optional {
+			var want bool
+			for _, l := range tt.listed {
+				want = want || l == n
+			}
+			if _, has := info.Nips.HasNumber(n.N()); has != want {
+				t.Errorf("%s: NIP-%02d listed %v, expected %v", tt.name, n.N(), has, want)
+			}
+		}
+		if _, has := info.Nips.HasNumber(relayinfo.BasicProtocol.N()); !has {
+			t.Errorf("%s: NIP-01 not listed", tt.name)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package relay
+
+import (
+	"bytes"
+
+	"relay.mleku.dev/bech32encoding"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/encryption"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/signer"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+// SuccessorTag is the d tag of the statement a relay identity signs to name the key that
+// replaces it.
+const SuccessorTag = "relay-identity-successor"
+
+// Identity returns the key the relay signs the events it generates with, such as NIP-29 group
+// metadata.
+func (s *Server) Identity() (sign signer.I) {
+	s.Lock()
+	defer s.Unlock()
+	return s.identity
+}
+
+// initIdentity loads the relay identity key from the store, generating and storing a new one
+// on first run. If the store can't keep it, an ephemeral key is used.
+//
+// With an IdentityPassword the key is stored encrypted with it as a NIP-49 ncryptsec, and a key
+// that was stored before the password was set is encrypted. A key stored encrypted can't be
+// loaded without the password, and the relay then has no identity. Without one, which is the
+// default, the key is stored unencrypted and a warning is logged at every start.
+func (s *Server) initIdentity() {
+	if s.IdentityPassword == "" {
+		log.W.F("no identity password is set, the identity key of relay %s is stored "+
+			"UNENCRYPTED in the database, set IDENTITY_PASSWORD to encrypt it", s.Name)
+	}
+	var err error
+	sign := &p256k.Signer{}
+	id, ok := s.Storage().(store.Identifier)
+	if ok {
+		var stored []byte
+		if stored, err = id.GetIdentity(); chk.E(err) {
+			return
+		}
+		if stored != nil {
+			var sec []byte
+			if sec, err = s.openIdentity(stored); err != nil {
+				log.E.F("failed to load the relay identity: %s", err)
+				return
+			}
+			if err = sign.InitSec(sec); chk.E(err) {
+				return
+			}
+			if s.IdentityPassword != "" && !s.ReadOnly &&
+				!bytes.HasPrefix(stored, encryption.EncryptedKeyHRP) {
+				log.I.Ln("encrypting the stored relay identity")
+				chk.E(s.storeIdentity(id, sec))
+			}
+			log.I.F("relay identity pubkey: %0x", sign.Pub())
+			s.Lock()
+			s.identity = sign
+			s.Unlock()
+			return
+		}
+	}
+	if err = sign.Generate(); chk.E(err) {
+		return
+	}
+	if ok {
+		if err = s.storeIdentity(id, sign.Sec()); chk.E(err) {
+			return
+		}
+	} else {
+		log.W.Ln("event store can't store the relay identity, using an ephemeral key")
+	}
+	log.I.F("generated relay identity pubkey: %0x", sign.Pub())
+	s.Lock()
+	s.identity = sign
+	s.Unlock()
+}
+
+// storeIdentity stores a relay identity secret key, encrypted if there is an IdentityPassword.
+func (s *Server) storeIdentity(id store.Identifier, sec []byte) (err error) {
+	stored := sec
+	if s.IdentityPassword != "" {
+		if stored, err = encryption.EncryptKey(sec, s.IdentityPassword,
+			encryption.DefaultLogN); chk.E(err) {
+			return
+		}
+	}
+	return id.SetIdentity(stored)
+}
+
+// openIdentity returns the secret key of a stored relay identity, decrypting it with the
+// IdentityPassword if it is encrypted.
+func (s *Server) openIdentity(stored []byte) (sec []byte, err error) {
+	if !bytes.HasPrefix(stored, encryption.EncryptedKeyHRP) {
+		return stored, nil
+	}
+	if s.IdentityPassword == "" {
+		err = errorf.E("the relay identity is encrypted, a password is needed to load it")
+		return
+	}
+	return encryption.DecryptKey(stored, s.IdentityPassword)
+}
+
+// relaySigned returns true for the events signed by the relay identity, such as the metadata of
+// groups, and for the successor statements signed by the keys it was rotated from. The retention
+// rules don't prune them.
+func (s *Server) relaySigned(ev *event.T) bool {
+	if sign := s.Identity(); sign != nil && bytes.Equal(ev.Pubkey, sign.Pub()) {
+		return true
+	}
+	if !ev.Kind.Equal(kind.ApplicationSpecificData) {
+		return false
+	}
+	if d := ev.Tags.GetFirst(tag.New("d")); d == nil || string(d.Value()) != SuccessorTag {
+		return false
+	}
+	return s.pastIdentity(ev.Pubkey)
+}
+
+// pastIdentity returns true if a pubkey is one the relay identity was rotated from, following
+// the successor statements back from the current identity. Anyone can publish a statement naming
+// a key as its successor, but only the statements are exempt from the retention rules, so a
+// forged one keeps no more than itself.
+func (s *Server) pastIdentity(pubkey []byte) bool {
+	sign := s.Identity()
+	if sign == nil {
+		return false
+	}
+	seen := make(map[string]struct{})
+	for next := [][]byte{sign.Pub()}; len(next) > 0; {
+		pk := next[0]
+		next = next[1:]
+		if _, ok := seen[string(pk)]; ok {
+			continue
+		}
+		seen[string(pk)] = struct{}{}
+		evs, err := s.Storage().QueryEvents(context.Bg(), &filter.T{
+			Kinds: kinds.New(kind.ApplicationSpecificData),
+			Tags:  tags.New(tag.New("#d", SuccessorTag), tag.New("#p", hex.Enc(pk)))})
+		if chk.E(err) {
+			return false
+		}
+		for _, ev := range evs {
+			if bytes.Equal(ev.Pubkey, pubkey) {
+				return true
+			}
+			next = append(next, ev.Pubkey)
+		}
+	}
+	return false
+}
+
+// PublishAsRelay signs an event with the relay identity, stores it and delivers it to the
+// subscriptions it matches, as if it had been published to the relay.
+func (s *Server) PublishAsRelay(c context.T, ev *event.T) (err error) {
+	sign := s.Identity()
+	if sign == nil {
+		return errorf.E("the relay has no identity to sign events with")
+	}
+	return s.publishSigned(c, sign, ev)
+}
+
+// publishSigned signs an event with a key, stores it and delivers it to the subscriptions it
+// matches.
+func (s *Server) publishSigned(c context.T, sign signer.I, ev *event.T) (err error) {
+	if err = ev.Sign(sign); chk.E(err) {
+		return
+	}
+	if err = s.Publish(c, ev); chk.E(err) {
+		return
+	}
+	s.Publisher().Deliver(s.AuthRequired(), s.PublicReadable(), ev)
+	return
+}
+
+// RotateIdentity replaces the relay identity with a new key. The previous key signs a statement
+// naming the new one as its successor, so clients that trusted it can follow the change, and
+// the metadata of the groups is signed again with the new key. It returns the statement.
+func (s *Server) RotateIdentity(c context.T) (statement *event.T, err error) {
+	if s.ReadOnly {
+		return nil, errorf.E("a read only replica can't rotate the relay identity")
+	}
+	prev := s.Identity()
+	if prev == nil {
+		return nil, errorf.E("the relay has no identity to rotate")
+	}
+	next := &p256k.Signer{}
+	if err = next.Generate(); chk.E(err) {
+		return
+	}
+	var npub []byte
+	if npub, err = bech32encoding.BinToNpub(next.Pub()); chk.E(err) {
+		return
+	}
+	statement = &event.T{
+		CreatedAt: timestamp.Now(),
+		Kind:      kind.ApplicationSpecificData,
+		Tags: tags.New(tag.New("d", SuccessorTag),
+			tag.New("p", hex.Enc(next.Pub()), "", "successor")),
+		Content: []byte("the identity of this relay is now " + string(npub)),
+	}
+	if err = s.publishSigned(c, prev, statement); chk.E(err) {
+		return
+	}
+	// the new key is only kept once the statement naming it is stored, so the stored key and
+	// the one in use don't differ if publishing it fails.
+	if id, ok := s.Storage().(store.Identifier); ok {
+		if err = s.storeIdentity(id, next.Sec()); chk.E(err) {
+			return
+		}
+	}
+	s.Lock()
+	s.identity = next
+	s.Unlock()
+	log.I.F("rotated relay identity from %0x to %0x", prev.Pub(), next.Pub())
+	s.resignGroups(c, prev.Pub())
+	return
+}
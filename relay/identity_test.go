@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/encryption"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+// storedIdentity returns the public key of the identity stored for a relay.
+func storedIdentity(t *testing.T, s *Server) (pub []byte) {
+	stored, err := s.Storage().(store.Identifier).GetIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(stored, encryption.EncryptedKeyHRP) {
+		t.Fatal("the identity is not encrypted at rest")
+	}
+	var sec []byte
+	if sec, err = s.openIdentity(stored); err != nil {
+		t.Fatal(err)
+	}
+	sign := &p256k.Signer{}
+	if err = sign.InitSec(sec); err != nil {
+		t.Fatal(err)
+	}
+	return sign.Pub()
+}
+
+func TestRotateIdentity(t *testing.T) {
+	r := newTestStore(t, t.TempDir())
+	if err := r.SetConfiguration(&config.C{PublicReadable: true}); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Name: "test", Store: r, IdentityPassword: "password"}
+	s.Init()
+	prev := s.Identity()
+	if prev == nil || !bytes.Equal(storedIdentity(t, s), prev.Pub()) {
+		t.Fatal("the relay identity was not stored")
+	}
+	c := context.Bg()
+	statement, err := s.RotateIdentity(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := s.Identity()
+	if bytes.Equal(next.Pub(), prev.Pub()) {
+		t.Fatal("the identity was not replaced")
+	}
+	if !bytes.Equal(statement.Pubkey, prev.Pub()) {
+		t.Fatal("the successor statement is not signed by the previous identity")
+	}
+	p := statement.Tags.GetFirst(tag.New("p"))
+	if p == nil || string(p.Value()) != hex.Enc(next.Pub()) {
+		t.Fatal("the successor statement does not name the new identity")
+	}
+	if !bytes.Equal(storedIdentity(t, s), next.Pub()) {
+		t.Fatal("the new identity was not stored")
+	}
+	reloaded := &Server{Name: "test", Store: r, IdentityPassword: "password"}
+	reloaded.Init()
+	if !bytes.Equal(reloaded.Identity().Pub(), next.Pub()) {
+		t.Fatal("the new identity was not loaded after a restart")
+	}
+}
+
+func TestRotateIdentityPublishFails(t *testing.T) {
+	r := newTestStore(t, t.TempDir())
+	if err := r.SetConfiguration(&config.C{PublicReadable: true}); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Name: "test", Store: r, IdentityPassword: "password"}
+	s.Init()
+	prev := s.Identity()
+	// a newer statement of the identity can't be replaced, so publishing the rotation fails
+	newer := &event.T{CreatedAt: timestamp.FromUnix(time.Now().Add(time.Hour).Unix()),
+		Kind: kind.ApplicationSpecificData, Tags: tags.New(tag.New("d", SuccessorTag))}
+	c := context.Bg()
+	if err := s.PublishAsRelay(c, newer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RotateIdentity(c); err == nil {
+		t.Fatal("rotation succeeded though its statement was not stored")
+	}
+	if !bytes.Equal(s.Identity().Pub(), prev.Pub()) ||
+		!bytes.Equal(storedIdentity(t, s), prev.Pub()) {
+		t.Fatal("a failed rotation changed the identity")
+	}
+}
@@ -0,0 +1,91 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/httpauth"
+	"relay.mleku.dev/openapi"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/servemux"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/wot"
+)
+
+func TestImportPolicyAuthedAsAdmin(t *testing.T) {
+	owner, friend, admin := newSigner(t), newSigner(t), newSigner(t)
+	s := newTestServer(t, &config.C{
+		Owners:       []string{hex.Enc(owner.Pub())},
+		Admins:       []string{hex.Enc(admin.Pub())},
+		AuthRequired: true,
+		WoT: config.WoT{Enabled: true, MaxDepth: 2, Damping: 0.85,
+			Tiers: []config.TrustTier{{Name: "follows", MaxDistance: 1, Read: true,
+				Write: true}}},
+	})
+	g := wot.New()
+	g.SetSeeds(owner.Pub())
+	g.SetFollows(owner.Pub(), [][]byte{friend.Pub()})
+	g.Compute(0.85, 2)
+	s.trust = g
+	c, cancel := context.Cancel(context.Bg())
+	t.Cleanup(cancel)
+	s.Ctx, s.Mux = c, servemux.New()
+	openapi.New(s, "test", "test", "test", "/api", s.Mux)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	// the events are signed by a trusted user, but it is the admin that is authed, who isn't
+	// trusted to publish
+	var body []byte
+	var ids [][]byte
+	for _, content := range []string{"one", "two"} {
+		ev := signed(t, friend, 1, content)
+		body = append(ev.Marshal(body), '\n')
+		ids = append(ids, ev.Id)
+	}
+	r, err := http.NewRequest(http.MethodPost, srv.URL+"/api/import?policy=true",
+		bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = httpauth.AddNIP98Header(r, r.URL, http.MethodPost, "", admin, 0); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("import returned status %d", res.StatusCode)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	rep := &store.ImportReport{}
+	if err = json.Unmarshal(lines[len(lines)-1], rep); err != nil {
+		t.Fatalf("%s: %v", b, err)
+	}
+	if rep.Read != 2 || rep.Saved != 0 {
+		t.Fatalf("import read %d and saved %d events, expected 2 and none", rep.Read,
+			rep.Saved)
+	}
+	var evs []*event.T
+	if evs, err = s.Storage().QueryEvents(context.Bg(),
+		&filter.T{IDs: tag.New(ids...)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 0 {
+		t.Fatalf("%d events were imported as if their author was authed", len(evs))
+	}
+}
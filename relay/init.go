@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	"strings"
+	"sync"
 
 	"relay.mleku.dev/bech32encoding"
 	"relay.mleku.dev/chk"
@@ -35,6 +36,10 @@ func (s *Server) Init() {
 	var err error
 	s.configurationMx.Lock()
 	defer s.configurationMx.Unlock()
+	s.trustKick = make(chan struct{}, 1)
+	s.storeMx.Lock()
+	s.storeRefs = &sync.WaitGroup{}
+	s.storeMx.Unlock()
 	if err = s.UpdateConfiguration(); chk.E(err) {
 		return
 	}
@@ -47,9 +52,9 @@ func (s *Server) Init() {
 			AuthRequired:   false,
 			PublicReadable: true,
 		}
-		log.W.F(`first time configuration password: %s
+		log.W.F(`first time configuration password of %s: %s
     use with Authorization header to set at least 1 Admin`,
-			s.configuration.FirstTime)
+			s.Name, s.configuration.FirstTime)
 	} else {
 		s.configured = true
 	}
@@ -65,6 +70,17 @@ func (s *Server) Init() {
 		}
 		s.owners = append(s.owners, dst)
 	}
+	s.initIdentity()
+	s.loadGroups()
+	s.loadModeration()
+	if s.Ctx != nil {
+		if !s.ReadOnly {
+			go s.reverifyNIP05()
+			go s.pollInvoices()
+		}
+		go s.runBackups()
+		go s.runTrust()
+	}
 	if len(s.owners) > 0 {
 		log.T.C(func() string {
 			ownerIds := make([]string, len(s.owners))
@@ -106,7 +122,7 @@ func (s *Server) CheckOwnerLists(c context.T) {
 				s.Followed[string(s.owners[i])] = struct{}{}
 			}
 			log.D.Ln("regenerating owners follow lists")
-			if evs, err = s.Store.QueryEvents(c,
+			if evs, err = s.Storage().QueryEvents(c,
 				&filter.T{Authors: tag.New(s.owners...),
 					Kinds: kinds.New(kind.FollowList)}); chk.E(err) {
 			}
@@ -130,7 +146,7 @@ func (s *Server) CheckOwnerLists(c context.T) {
 			for f := range s.Followed {
 				followed = append(followed, f)
 			}
-			if evs, err = s.Store.QueryEvents(c,
+			if evs, err = s.Storage().QueryEvents(c,
 				&filter.T{Authors: tag.New(followed...),
 					Kinds: kinds.New(kind.FollowList)}); chk.E(err) {
 			}
@@ -153,7 +169,7 @@ func (s *Server) CheckOwnerLists(c context.T) {
 		if len(s.Muted) < 1 {
 			log.D.Ln("regenerating owners mute lists")
 			s.Muted = make(map[string]struct{})
-			if evs, err = s.Store.QueryEvents(c,
+			if evs, err = s.Storage().QueryEvents(c,
 				&filter.T{Authors: tag.New(s.owners...),
 					Kinds: kinds.New(kind.MuteList)}); chk.E(err) {
 			}
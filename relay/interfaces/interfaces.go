@@ -4,37 +4,93 @@ import (
 	"net/http"
 	"time"
 
+	"relay.mleku.dev/admission"
 	"relay.mleku.dev/context"
+	"relay.mleku.dev/dns"
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/filters"
+	"relay.mleku.dev/moderation"
+	"relay.mleku.dev/publish"
 	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/relayinfo"
+	"relay.mleku.dev/signer"
 	"relay.mleku.dev/store"
 )
 
 type Server interface {
 	AcceptEvent(c context.T, ev *event.T, hr *http.Request,
 		authedPubkey []byte, remote string) (accept bool, notice string, afterSave func())
+	// AcquireStorage returns the event store, which is not closed if it is replaced until
+	// release is called, for uses of it that may outlast a replacement.
+	AcquireStorage() (sto store.I, release func())
 	AcceptReq(c context.T, hr *http.Request, id []byte, ff *filters.T,
 		authedPubkey []byte, remote string) (allowed *filters.T, ok bool, modified bool)
 	AddEvent(c context.T, ev *event.T, hr *http.Request,
 		authedPubkey []byte, remote string) (accepted bool, message []byte)
 	AdminAuth(r *http.Request, remote string, tolerance ...time.Duration) (authed bool,
 		pubkey []byte)
+	// Audit records an action in the audit log, with the pubkey and remote address of who
+	// took it, its parameters and the error it failed with, if any.
+	Audit(actor []byte, remote, operation string, params map[string]string, err error)
 	AuthRequired() bool
+	// Ban bans a user from publishing to the relay.
+	Ban(b *moderation.Ban) (err error)
 	CheckOwnerLists(c context.T)
 	Configuration() config.C
 	Configured() bool
 	Context() context.T
 	HandleRelayInfo(w http.ResponseWriter, r *http.Request)
+	// Hide hides an event, or all the events of a user, from everyone but their author.
+	Hide(h *moderation.Hide) (err error)
 	Lock()
+	NIP05Claims() bool
 	Owners() [][]byte
+	// Identity returns the key the relay signs its own events with.
+	Identity() (sign signer.I)
+	// Member returns the paid membership of a pubkey, or nil if it has none.
+	Member(pubkey []byte) (m *admission.Member)
+	// Moderate decides the moderation case about an event id or pubkey with an action, and
+	// returns the case, or nil if there is none.
+	Moderate(c context.T, target []byte, action, reason string,
+		moderator []byte) (cs *moderation.Case, err error)
+	// ModerationCases returns the moderation cases with a status, or all of them if it is
+	// empty, the most reported first.
+	ModerationCases(status string) (cs []*moderation.Case, err error)
+	// PaidAdmission returns the admission fee and the days it pays for, if it is enabled.
+	PaidAdmission() (fee, days int, ok bool)
 	OwnersFollowed(pubkey string) (ok bool)
+	// Publisher returns the publishers that deliver the events stored by the relay to the
+	// subscriptions of its APIs.
+	Publisher() *publish.S
+	// PublishAsRelay signs an event with the relay identity, stores it and delivers it to the
+	// subscriptions it matches.
+	PublishAsRelay(c context.T, ev *event.T) (err error)
 	PublicReadable() bool
+	// Quota returns the storage quota that applies to a pubkey, or nil if it has none.
+	Quota(pubkey []byte) (q *config.Quota)
+	// Readable returns true if the holder of the pubkey may be sent the event.
+	Readable(ev *event.T, pubkey []byte) bool
+	// RelayInfo returns the relay information document, NIP-11, as served for a request.
+	RelayInfo(r *http.Request) (info *relayinfo.T)
+	// RequestAdmission issues an invoice that makes the pubkey a member once it is paid.
+	RequestAdmission(c context.T, pubkey []byte) (inv *admission.Invoice, err error)
+	// RotateIdentity replaces the relay identity with a new key, publishing a statement signed
+	// by the previous key naming it as the successor.
+	RotateIdentity(c context.T) (statement *event.T, err error)
 	ServiceURL(req *http.Request) (s string)
 	SetConfiguration(*config.C)
 	UpdateConfiguration() (err error)
+	// VerifyNIP05 returns the NIP-05 verification of a pubkey, cached unless refresh is set.
+	VerifyNIP05(c context.T, pubkey []byte, refresh bool) (v *dns.Verification)
 	Shutdown()
 	Storage() store.I
+	// Unban lifts the ban of a user.
+	Unban(pubkey []byte) (err error)
+	// Unhide makes a hidden event or user visible again.
+	Unhide(target []byte) (err error)
 	Unlock()
+	// Visible returns true if the holder of the pubkey may see the event with an id by an
+	// author, which is false if either is hidden, unless they are its author.
+	Visible(id, author, pubkey []byte) bool
 	ZeroLists()
 }
@@ -6,19 +6,24 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/rs/cors"
 
+	"relay.mleku.dev/admission"
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/context"
+	"relay.mleku.dev/groups"
 	"relay.mleku.dev/log"
+	"relay.mleku.dev/publish"
 	"relay.mleku.dev/relay/config"
 	"relay.mleku.dev/relay/helpers"
 	"relay.mleku.dev/servemux"
 	"relay.mleku.dev/signer"
 	"relay.mleku.dev/store"
+	"relay.mleku.dev/wot"
 )
 
 type List map[string]struct{}
@@ -32,9 +37,51 @@ type Server struct {
 	HTTPServer *http.Server
 	Mux        *servemux.S
 	huma.API
+	// Store is the event store, use Storage to get it, as a read only replica replaces it when
+	// its snapshot is refreshed.
 	Store      store.I
 	MaxLimit   int
 	configured bool
+	// ReadOnly is set for a replica serving a read only snapshot of another relay's event
+	// store, it rejects events.
+	ReadOnly bool
+
+	// Tenants are virtual relays served by the same listener, each with its own event store,
+	// configuration, admins and APIs, selected by the Host header or the path of requests.
+	Tenants []*Server
+	// Host is the host name that selects a tenant.
+	Host string
+	// Path is the path prefix that selects a tenant, such as /community, its APIs are served
+	// under it and it is part of the URLs it gives out.
+	Path string
+
+	// storeMx protects Store while it is replaced.
+	storeMx sync.RWMutex
+	// storeRefs counts the uses of Store from AcquireStorage, so a replaced store is only
+	// closed once they are done.
+	storeRefs *sync.WaitGroup
+
+	// publisher delivers the events stored by the relay to the subscriptions of its APIs.
+	publisherOnce sync.Once
+	publisher     *publish.S
+
+	// NIP05Client is the HTTP client used to verify NIP-05 identifiers, if nil a default
+	// client is used.
+	NIP05Client *http.Client
+	// Wallet issues the invoices for paid admission, if nil one is connected with the nwc uri
+	// in the configuration.
+	Wallet admission.Wallet
+	// Auditor signs the entries of the audit log, which are published as events, if nil they
+	// are only stored.
+	Auditor signer.I
+	// IdentityPassword encrypts the stored relay identity key, it is stored unencrypted if
+	// empty.
+	IdentityPassword string
+
+	// walletMx protects wallet, the client connected with walletURI.
+	walletMx  sync.Mutex
+	wallet    admission.Wallet
+	walletURI string
 
 	configurationMx sync.Mutex
 	configuration   *config.C
@@ -57,10 +104,42 @@ type Server struct {
 	// OwnersMuteLists are the event IDs of owners mute lists, which must not be
 	// deleted, only replaced.
 	OwnersMuteLists [][]byte
+	// identity is the key the relay signs its own events with.
+	identity signer.I
+
+	// groupsMx protects groups, the in-memory state of NIP-29 groups, and groupUpdateMx
+	// serializes changes to them.
+	groupsMx      sync.Mutex
+	groupUpdateMx sync.Mutex
+	groups        map[string]*groups.Group
+
+	// trustMx protects trust, the web of trust computed from the follow lists of the owners
+	// when it is enabled, which is loaded again when trustKick is sent, and computed again
+	// if trustDirty is set.
+	trustMx    sync.Mutex
+	trust      *wot.Graph
+	trustKick  chan struct{}
+	trustDirty atomic.Bool
+	// rates counts the events and requests of users for the rate limits of the trust tiers.
+	rates rateLimiter
+
+	// moderationMx protects hidden, the event ids and pubkeys hidden by reports, and banned,
+	// the pubkeys banned by the moderators, and moderationUpdateMx serializes changes to the
+	// moderation cases.
+	moderationMx       sync.Mutex
+	moderationUpdateMx sync.Mutex
+	hidden             List
+	banned             List
+
+	// nip05Mx protects nip05Pending, the pubkeys with a NIP-05 lookup of the identifier in a
+	// profile they published in progress.
+	nip05Mx      sync.Mutex
+	nip05Pending List
 }
 
 func (s *Server) Start() (err error) {
 	s.Init()
+	s.initTenants()
 	var listener net.Listener
 	if listener, err = net.Listen("tcp", s.Address); chk.E(err) {
 		return
@@ -82,6 +161,10 @@ func (s *Server) Start() (err error) {
 
 // ServeHTTP is the server http.Handler.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t := s.tenant(r); t != nil {
+		t.ServeHTTP(w, r)
+		return
+	}
 	remote := helpers.GetRemoteFromReq(r)
 	allowList := s.Configuration().AllowList
 	if len(allowList) > 0 {
@@ -107,11 +190,19 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.Mux.ServeHTTP(w, r)
 }
 
+// Publisher returns the publishers that deliver the events stored by the relay to the
+// subscriptions of its APIs.
+func (s *Server) Publisher() *publish.S {
+	s.publisherOnce.Do(func() { s.publisher = &publish.S{} })
+	return s.publisher
+}
+
 func (s *Server) Shutdown() {
 	log.W.Ln("shutting down relay")
 	s.Cancel()
 	log.W.Ln("closing event store")
-	chk.E(s.Store.Close())
+	chk.E(s.Storage().Close())
+	s.shutdownTenants()
 	log.W.Ln("shutting down relay listener")
 	chk.E(s.HTTPServer.Shutdown(s.Ctx))
 }
@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"sync"
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/lol"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/ratel"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+	"relay.mleku.dev/units"
+)
+
+// newTestStore opens an event store in a temporary directory, closed when the test ends.
+func newTestStore(t testing.TB, dir string) (r *ratel.T) {
+	r = ratel.New(ratel.BackendParams{Ctx: context.Bg(), WG: &sync.WaitGroup{},
+		BlockCacheSize: 16 * units.Mb})
+	r.Logger = ratel.NewLogger(lol.Off, "RATEL")
+	if err := r.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return
+}
+
+// newTestServer makes a relay with a configuration on a new store, without its background
+// tasks.
+func newTestServer(t testing.TB, cfg *config.C) (s *Server) {
+	r := newTestStore(t, t.TempDir())
+	if cfg != nil {
+		if err := r.SetConfiguration(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s = &Server{Name: "test", Store: r, MaxLimit: ratel.DefaultMaxLimit}
+	s.Init()
+	return
+}
+
+// newSigner generates a new key.
+func newSigner(t testing.TB) (sign *p256k.Signer) {
+	sign = &p256k.Signer{}
+	if err := sign.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// signed makes an event of a kind with content and tags signed by a key.
+func signed(t testing.TB, sign *p256k.Signer, k uint16, content string,
+	tt ...*tag.T) (ev *event.T) {
+
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.New(k), Content: []byte(content),
+		Tags: tags.New(tt...)}
+	if err := ev.Sign(sign); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
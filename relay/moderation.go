@@ -0,0 +1,325 @@
+package relay
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/errorf"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/eventid"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/moderation"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/timestamp"
+)
+
+// loadModeration reads the hidden events and users and the banned users from the store into
+// memory, so that checks on reads and writes don't need to touch the database.
+func (s *Server) loadModeration() {
+	s.moderationMx.Lock()
+	defer s.moderationMx.Unlock()
+	s.hidden = make(map[string]struct{})
+	s.banned = make(map[string]struct{})
+	var err error
+	if h, ok := s.Storage().(store.Hider); ok {
+		var hs []*moderation.Hide
+		if hs, err = h.Hidden(); chk.E(err) {
+			return
+		}
+		for _, hd := range hs {
+			if target, err := hex.Dec(hd.Target); err == nil {
+				s.hidden[string(target)] = struct{}{}
+			}
+		}
+	}
+	if m, ok := s.Storage().(store.Moderator); ok {
+		var bs []*moderation.Ban
+		if bs, err = m.Bans(); chk.E(err) {
+			return
+		}
+		for _, b := range bs {
+			if pk, err := hex.Dec(b.Pubkey); err == nil {
+				s.banned[string(pk)] = struct{}{}
+			}
+		}
+	}
+	log.I.F("loaded %d hidden events and users, and %d bans", len(s.hidden), len(s.banned))
+}
+
+// isBanned returns true if a pubkey is banned from publishing to the relay.
+func (s *Server) isBanned(pubkey []byte) bool {
+	s.moderationMx.Lock()
+	defer s.moderationMx.Unlock()
+	_, ok := s.banned[string(pubkey)]
+	return ok
+}
+
+// Visible returns true if the holder of the pubkey may see the event with an id by an author,
+// that is, neither the event nor its author is hidden, or they are its author.
+func (s *Server) Visible(id, author, pubkey []byte) bool {
+	if len(pubkey) > 0 && bytes.Equal(author, pubkey) {
+		return true
+	}
+	s.moderationMx.Lock()
+	defer s.moderationMx.Unlock()
+	if _, ok := s.hidden[string(id)]; ok {
+		return false
+	}
+	_, ok := s.hidden[string(author)]
+	return !ok
+}
+
+// Hide hides an event, or all the events of a user, from everyone but their author. Events of a
+// hidden user are still accepted, so they can't tell they are hidden, and the owners can't be
+// hidden.
+func (s *Server) Hide(h *moderation.Hide) (err error) {
+	var target []byte
+	if target, err = hex.Dec(h.Target); err != nil {
+		return
+	}
+	if h.Kind == moderation.TargetPubkey && s.isOwner(target) {
+		return errorf.E("owners of the relay can't be hidden")
+	}
+	if hd, ok := s.Storage().(store.Hider); ok {
+		if h.CreatedAt == 0 {
+			h.CreatedAt = timestamp.Now().I64()
+		}
+		if err = hd.Hide(h); chk.E(err) {
+			return
+		}
+	}
+	s.moderationMx.Lock()
+	s.hidden[string(target)] = struct{}{}
+	s.moderationMx.Unlock()
+	log.I.F("hid %s %s: %s", h.Kind, h.Target, h.Reason)
+	return
+}
+
+// Unhide makes a hidden event or user visible again.
+func (s *Server) Unhide(target []byte) (err error) {
+	if hd, ok := s.Storage().(store.Hider); ok {
+		if err = hd.Unhide(target); chk.E(err) {
+			return
+		}
+	}
+	s.moderationMx.Lock()
+	delete(s.hidden, string(target))
+	s.moderationMx.Unlock()
+	log.I.F("unhid %0x", target)
+	return
+}
+
+// hideCase hides or unhides the target of a case as it is hidden or not.
+func (s *Server) hideCase(c *moderation.Case) (err error) {
+	var target []byte
+	if target, err = hex.Dec(c.Target); chk.E(err) {
+		return
+	}
+	if !c.Hidden {
+		return s.Unhide(target)
+	}
+	reason := "reported"
+	if c.Reason != "" {
+		reason = c.Reason
+	}
+	return s.Hide(&moderation.Hide{Kind: c.Kind, Target: c.Target, Reason: reason,
+		Moderator: c.Moderator})
+}
+
+// moderateReport adds a stored NIP-56 report to the cases about the events and users it reports,
+// and hides them if the weight of the reports about them crosses the threshold. The owners
+// can't be hidden by reports.
+func (s *Server) moderateReport(ev *event.T) {
+	cfg := s.Configuration().Moderation
+	m, ok := s.Storage().(store.Moderator)
+	if !cfg.Enabled || !ok {
+		return
+	}
+	weight := func(reporter []byte) float64 { return cfg.Weight(s.authorClass(reporter)) }
+	s.moderationUpdateMx.Lock()
+	defer s.moderationUpdateMx.Unlock()
+	for _, t := range moderation.Targets(ev) {
+		if t.Kind == moderation.TargetPubkey && s.isOwner(t.Id) ||
+			t.Kind == moderation.TargetEvent && s.isOwner(t.Pubkey) {
+			continue
+		}
+		c, err := m.GetCase(t.Id)
+		if chk.E(err) {
+			continue
+		}
+		if c == nil {
+			c = moderation.New(t)
+		}
+		if !c.Add(moderation.Report{Id: hex.Enc(ev.Id), Reporter: hex.Enc(ev.Pubkey),
+			Type: t.Type, Content: string(ev.Content), CreatedAt: ev.CreatedAt.I64()}) {
+			continue
+		}
+		wasHidden := c.Hidden
+		c.Weigh(weight, cfg.HideThreshold)
+		c.UpdatedAt = timestamp.Now().I64()
+		if chk.E(m.SetCase(c)) {
+			continue
+		}
+		if c.Hidden && !wasHidden {
+			log.I.F("%s %s hidden by reports with a weight of %v", c.Kind, c.Target, c.Score)
+			chk.E(s.hideCase(c))
+		}
+	}
+}
+
+// ModerationCases returns the moderation cases with a status, or all of them if it is empty,
+// the most reported first.
+func (s *Server) ModerationCases(status string) (cs []*moderation.Case, err error) {
+	m, ok := s.Storage().(store.Moderator)
+	if !ok {
+		return
+	}
+	var all []*moderation.Case
+	if all, err = m.Cases(); chk.E(err) {
+		return
+	}
+	for _, c := range all {
+		if status == "" || c.Status == status {
+			cs = append(cs, c)
+		}
+	}
+	slices.SortFunc(cs, func(a, b *moderation.Case) int {
+		if a.Score != b.Score {
+			return cmp.Compare(b.Score, a.Score)
+		}
+		return cmp.Compare(b.UpdatedAt, a.UpdatedAt)
+	})
+	return
+}
+
+// Moderate decides the case about an event id or pubkey with an action of moderation.Actions,
+// and returns the case, or nil if there is none. Hiding the target keeps it but serves it only to
+// its author, removing it deletes the reported event or all the events of the reported user,
+// leaving tombstones so they can't be published again, and banning also bans the author.
+func (s *Server) Moderate(c context.T, target []byte, action, reason string,
+	moderator []byte) (cs *moderation.Case, err error) {
+
+	status, ok := moderation.Actions[action]
+	if !ok {
+		err = errorf.E("unknown moderation action '%s'", action)
+		return
+	}
+	m, ok := s.Storage().(store.Moderator)
+	if !ok {
+		err = errorf.E("event store does not support moderation")
+		return
+	}
+	s.moderationUpdateMx.Lock()
+	defer s.moderationUpdateMx.Unlock()
+	if cs, err = m.GetCase(target); err != nil || cs == nil {
+		return
+	}
+	if status == moderation.Removed || status == moderation.Banned {
+		if err = s.removeTarget(c, cs); chk.E(err) {
+			return
+		}
+	}
+	if status == moderation.Banned {
+		author := cs.Author()
+		if len(author) == 0 {
+			err = errorf.E("the author of event %s is not known, it can't be banned", cs.Target)
+			return
+		}
+		if err = s.Ban(&moderation.Ban{Pubkey: hex.Enc(author), Reason: reason,
+			Moderator: hex.Enc(moderator), Case: cs.Target}); chk.E(err) {
+			return
+		}
+	}
+	cs.Decide(status, hex.Enc(moderator), reason, timestamp.Now().I64())
+	if err = m.SetCase(cs); chk.E(err) {
+		return
+	}
+	if err = s.hideCase(cs); chk.E(err) {
+		return
+	}
+	log.I.F("moderator %0x decided %s %s is %s", moderator, cs.Kind, cs.Target, status)
+	return
+}
+
+// removeTarget deletes the event a case is about, or all the events of the user it is about.
+// The author of a reported event is recorded in the case if the report didn't name them.
+func (s *Server) removeTarget(c context.T, cs *moderation.Case) (err error) {
+	var target []byte
+	if target, err = hex.Dec(cs.Target); chk.E(err) {
+		return
+	}
+	f := &filter.T{Authors: tag.New(target)}
+	if cs.Kind == moderation.TargetEvent {
+		f = &filter.T{IDs: tag.New(target)}
+	}
+	// queries return at most the limit of events, so query until none are left that weren't
+	// already deleted
+	deleted := make(map[string]struct{})
+	for {
+		var evs event.Ts
+		if evs, err = s.Storage().QueryEvents(c, f); chk.E(err) {
+			return
+		}
+		var progress bool
+		for _, ev := range evs {
+			if _, ok := deleted[string(ev.Id)]; ok {
+				continue
+			}
+			deleted[string(ev.Id)], progress = struct{}{}, true
+			if cs.Kind == moderation.TargetEvent && cs.Pubkey == "" {
+				cs.Pubkey = hex.Enc(ev.Pubkey)
+			}
+			if err = s.Storage().DeleteEvent(c, eventid.NewWith(ev.Id), false); chk.E(err) {
+				return
+			}
+		}
+		if !progress {
+			log.I.F("removed %d events of %s %s", len(deleted), cs.Kind, cs.Target)
+			return
+		}
+	}
+}
+
+// Ban bans a user from publishing to the relay.
+func (s *Server) Ban(b *moderation.Ban) (err error) {
+	var pubkey []byte
+	if pubkey, err = hex.Dec(b.Pubkey); err != nil {
+		return
+	}
+	if s.isOwner(pubkey) {
+		return errorf.E("owners of the relay can't be banned")
+	}
+	if m, ok := s.Storage().(store.Moderator); ok {
+		if b.CreatedAt == 0 {
+			b.CreatedAt = timestamp.Now().I64()
+		}
+		if err = m.SetBan(b); chk.E(err) {
+			return
+		}
+	}
+	s.moderationMx.Lock()
+	s.banned[string(pubkey)] = struct{}{}
+	s.moderationMx.Unlock()
+	log.I.F("banned %s: %s", b.Pubkey, b.Reason)
+	return
+}
+
+// Unban lifts the ban of a user.
+func (s *Server) Unban(pubkey []byte) (err error) {
+	if m, ok := s.Storage().(store.Moderator); ok {
+		if err = m.DeleteBan(pubkey); chk.E(err) {
+			return
+		}
+	}
+	s.moderationMx.Lock()
+	delete(s.banned, string(pubkey))
+	s.moderationMx.Unlock()
+	log.I.F("unbanned %0x", pubkey)
+	return
+}
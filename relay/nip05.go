@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/store"
+)
+
+// HandleNIP05 serves the /.well-known/nostr.json NIP-05 identity document from the names
+// registered with the relay. If a name is given only that name is returned, otherwise all of
+// them are.
+func (s *Server) HandleNIP05(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	namer, ok := s.Storage().(store.Namer)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	var err error
+	var regs []*dns.Registration
+	if name := strings.ToLower(r.URL.Query().Get("name")); name != "" {
+		var reg *dns.Registration
+		if reg, err = namer.GetName(name); chk.E(err) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		if reg != nil {
+			regs = append(regs, reg)
+		}
+	} else if regs, err = namer.Names(); chk.E(err) {
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	log.T.F("serving %d nip-05 names", len(regs))
+	if err = json.NewEncoder(w).Encode(
+		dns.NewRegistryResponse(regs, s.ServiceURL(r))); chk.E(err) {
+	}
+}
+
+// NIP05Claims returns true if users followed by the owners may claim a NIP-05 name for
+// themselves.
+func (s *Server) NIP05Claims() bool {
+	s.configurationMx.Lock()
+	defer s.configurationMx.Unlock()
+	return s.configuration.NIP05Claims
+}
@@ -0,0 +1,238 @@
+package relay
+
+import (
+	"time"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/keys"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/normalize"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+)
+
+const (
+	// nip05Timeout is how long a NIP-05 lookup may take before it counts as failed.
+	nip05Timeout = 10 * time.Second
+	// nip05ReverifyInterval is how often the cache is scanned for verifications to renew.
+	nip05ReverifyInterval = 10 * time.Minute
+	// nip05Retry is the shortest time between lookups of the identifiers in the profiles a
+	// pubkey publishes, so publishing profiles can't make the relay fetch one for each.
+	nip05Retry = time.Minute
+)
+
+// nip05Policy returns the domains writers must have a verified NIP-05 identifier in, and how
+// long successful and failed verifications are trusted. If domains is empty the policy is off.
+func (s *Server) nip05Policy() (domains []string, ttl, failTTL time.Duration) {
+	s.configurationMx.Lock()
+	defer s.configurationMx.Unlock()
+	if s.configuration == nil {
+		return
+	}
+	domains = s.configuration.NIP05Domains
+	ttl = parseTTL(s.configuration.NIP05TTL, 24*time.Hour)
+	failTTL = parseTTL(s.configuration.NIP05FailTTL, time.Hour)
+	return
+}
+
+// parseTTL parses a duration from the configuration, returning def if it is missing or
+// invalid.
+func parseTTL(v string, def time.Duration) (ttl time.Duration) {
+	var err error
+	if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+		return def
+	}
+	return
+}
+
+// acceptNIP05 applies the NIP-05 admission policy, only accepting events from authors with a
+// verified identifier in one of the allowed domains. A profile event is checked against the
+// identifier it contains, so a user can gain write access by publishing one.
+func (s *Server) acceptNIP05(c context.T, ev *event.T) (accept bool, notice string) {
+	domains, _, _ := s.nip05Policy()
+	if len(domains) == 0 || s.isOwner(ev.Pubkey) {
+		return true, ""
+	}
+	var v *dns.Verification
+	if ev.Kind.Equal(kind.ProfileMetadata) {
+		v = s.profileNIP05(c, ev.Pubkey, dns.ProfileIdentifier(ev.Content))
+	} else {
+		v = s.VerifyNIP05(c, ev.Pubkey, false)
+	}
+	if !v.Valid {
+		return false, string(normalize.Restricted.F("nip-05 verification failed: %s", v.Error))
+	}
+	return true, ""
+}
+
+// profileNIP05 returns the NIP-05 verification of the identifier in a profile a pubkey
+// publishes. The cached result is used while the identifier is the same. A verified author that
+// changes it keeps their access while the new one is looked up in the background, others wait
+// for the lookup, which is done at most once each nip05Retry for a pubkey.
+func (s *Server) profileNIP05(c context.T, pubkey []byte, identifier string) (
+	v *dns.Verification) {
+
+	_, ttl, failTTL := s.nip05Policy()
+	var cached *dns.Verification
+	if cache, ok := s.Storage().(store.Verifications); ok {
+		var err error
+		if cached, err = cache.GetVerification(pubkey); chk.E(err) {
+			cached = nil
+		}
+	}
+	switch {
+	case cached == nil:
+	case cached.Identifier == identifier && !cached.Stale(ttl, failTTL):
+		return cached
+	case cached.Valid && !cached.Stale(ttl, failTTL):
+		if s.startNIP05(pubkey) {
+			go func() {
+				defer s.endNIP05(pubkey)
+				s.verifyNIP05(s.Ctx, pubkey, identifier)
+			}()
+		}
+		return cached
+	case time.Since(time.Unix(cached.CheckedAt, 0)) < nip05Retry:
+		return &dns.Verification{
+			Pubkey:     cached.Pubkey,
+			Identifier: identifier,
+			Error:      "nip-05 identifier was looked up too recently, try again later",
+			CheckedAt:  cached.CheckedAt,
+		}
+	}
+	if !s.startNIP05(pubkey) {
+		return &dns.Verification{
+			Pubkey:     hex.Enc(pubkey),
+			Identifier: identifier,
+			Error:      "nip-05 identifier is being looked up, try again later",
+			CheckedAt:  time.Now().Unix(),
+		}
+	}
+	defer s.endNIP05(pubkey)
+	return s.verifyNIP05(c, pubkey, identifier)
+}
+
+// startNIP05 marks a lookup of the identifier in a profile of a pubkey as in progress, and
+// returns false if one already is.
+func (s *Server) startNIP05(pubkey []byte) (started bool) {
+	s.nip05Mx.Lock()
+	defer s.nip05Mx.Unlock()
+	if _, ok := s.nip05Pending[string(pubkey)]; ok {
+		return false
+	}
+	if s.nip05Pending == nil {
+		s.nip05Pending = make(List)
+	}
+	s.nip05Pending[string(pubkey)] = struct{}{}
+	return true
+}
+
+// endNIP05 marks the lookup of the identifier in a profile of a pubkey as done.
+func (s *Server) endNIP05(pubkey []byte) {
+	s.nip05Mx.Lock()
+	defer s.nip05Mx.Unlock()
+	delete(s.nip05Pending, string(pubkey))
+}
+
+// VerifyNIP05 returns the NIP-05 verification of a pubkey. Unless refresh is set, a cached
+// result is used if it is not stale, otherwise the identifier in the stored profile of the
+// pubkey is looked up.
+func (s *Server) VerifyNIP05(c context.T, pubkey []byte, refresh bool) (v *dns.Verification) {
+	_, ttl, failTTL := s.nip05Policy()
+	if cache, ok := s.Storage().(store.Verifications); ok && !refresh {
+		var err error
+		if v, err = cache.GetVerification(pubkey); !chk.E(err) && v != nil &&
+			!v.Stale(ttl, failTTL) {
+			return
+		}
+	}
+	return s.verifyNIP05(c, pubkey, s.profileIdentifier(c, pubkey))
+}
+
+// verifyNIP05 verifies the identifier of a pubkey and caches the result. Successful results are
+// kept for twice their ttl so they can be renewed in the background before they are dropped.
+func (s *Server) verifyNIP05(c context.T, pubkey []byte, identifier string) (
+	v *dns.Verification) {
+
+	domains, ttl, failTTL := s.nip05Policy()
+	cc, cancel := context.Timeout(c, nip05Timeout)
+	defer cancel()
+	v = dns.Verify(cc, s.NIP05Client, identifier, pubkey, domains)
+	if v.Valid {
+		log.D.F("verified nip-05 identifier %s for %0x", identifier, pubkey)
+	} else {
+		log.D.F("failed to verify nip-05 of %0x: %s", pubkey, v.Error)
+		ttl = failTTL
+	}
+	if cache, ok := s.Storage().(store.Verifications); ok {
+		if v.Valid {
+			ttl *= 2
+		}
+		chk.E(cache.SetVerification(pubkey, v, ttl))
+	}
+	return
+}
+
+// profileIdentifier returns the NIP-05 identifier in the newest stored profile of a pubkey.
+func (s *Server) profileIdentifier(c context.T, pubkey []byte) (identifier string) {
+	var err error
+	var evs event.Ts
+	if evs, err = s.Storage().QueryEvents(c, &filter.T{Authors: tag.New(pubkey),
+		Kinds: kinds.New(kind.ProfileMetadata)}); chk.E(err) {
+		return
+	}
+	var newest *event.T
+	for _, ev := range evs {
+		if newest == nil || ev.CreatedAt.I64() > newest.CreatedAt.I64() {
+			newest = ev
+		}
+	}
+	if newest == nil {
+		return
+	}
+	return dns.ProfileIdentifier(newest.Content)
+}
+
+// reverifyNIP05 periodically renews the cached verifications that have gone stale, so that
+// users don't wait on a lookup when they write, and those that no longer verify lose access.
+func (s *Server) reverifyNIP05() {
+	cache, ok := s.Storage().(store.Verifications)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(nip05ReverifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.Ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		domains, ttl, failTTL := s.nip05Policy()
+		if len(domains) == 0 {
+			continue
+		}
+		var err error
+		var vs []*dns.Verification
+		if vs, err = cache.Verifications(); chk.E(err) {
+			continue
+		}
+		for _, v := range vs {
+			if !v.Valid || !v.Stale(ttl, failTTL) {
+				continue
+			}
+			var pubkey []byte
+			if pubkey, err = keys.HexPubkeyToBytes(v.Pubkey); chk.E(err) {
+				continue
+			}
+			s.VerifyNIP05(s.Ctx, pubkey, true)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/dns"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/store"
+)
+
+func TestProfileNIP05(t *testing.T) {
+	alice, bob := newSigner(t), newSigner(t)
+	names := map[string]string{"alice": hex.Enc(alice.Pub()), "al": hex.Enc(alice.Pub())}
+	var lookups atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		lookups.Add(1)
+		resp := dns.NewWellKnownResponse()
+		if pk, ok := names[r.URL.Query().Get("name")]; ok {
+			resp.Names[r.URL.Query().Get("name")] = pk
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	s := newTestServer(t, &config.C{NIP05Domains: []string{"example.com"}})
+	s.Ctx = context.Bg()
+	s.NIP05Client = &http.Client{Transport: &http.Transport{
+		DialContext: func(c context.T, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(c, network, srv.Listener.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	profile := func(identifier string) string { return `{"nip05":"` + identifier + `"}` }
+	// the identifier is looked up once while it is the same
+	for range 3 {
+		if ok, notice := s.acceptNIP05(context.Bg(), signed(t, alice, 0,
+			profile("alice@example.com"))); !ok {
+			t.Fatalf("profile with a verified identifier rejected: %s", notice)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Fatalf("unchanged identifier looked up %d times", n)
+	}
+	// a verified author that changes it keeps access while it is looked up
+	if ok, notice := s.acceptNIP05(context.Bg(), signed(t, alice, 0,
+		profile("al@example.com"))); !ok {
+		t.Fatalf("profile of a verified author with a new identifier rejected: %s", notice)
+	}
+	cache := s.Storage().(store.Verifications)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		v, err := cache.GetVerification(alice.Pub())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Identifier == "al@example.com" && v.Valid {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new identifier was not verified in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// an author that isn't verified waits for the lookup, at most one each nip05Retry
+	if ok, _ := s.acceptNIP05(context.Bg(), signed(t, bob, 0,
+		profile("bob@example.com"))); ok {
+		t.Fatal("profile with an identifier of no one accepted")
+	}
+	before := lookups.Load()
+	if ok, _ := s.acceptNIP05(context.Bg(), signed(t, bob, 0,
+		profile("robert@example.com"))); ok {
+		t.Fatal("profile changed again before the retry accepted")
+	}
+	if n := lookups.Load(); n != before {
+		t.Fatalf("identifier changed again before the retry was looked up")
+	}
+}
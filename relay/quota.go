@@ -0,0 +1,91 @@
+package relay
+
+import (
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/normalize"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+)
+
+// Quota returns the first storage quota for the class of the author with a pubkey, or nil if
+// there is none.
+func (s *Server) Quota(pubkey []byte) (q *config.Quota) {
+	cfg := s.Configuration()
+	if len(cfg.Quotas) == 0 {
+		return
+	}
+	class := s.authorClass(pubkey)
+	for i := range cfg.Quotas {
+		if cfg.Quotas[i].Authors == "" || cfg.Quotas[i].Authors == class {
+			return &cfg.Quotas[i]
+		}
+	}
+	return
+}
+
+// overQuota returns a notice if storing an event would take its author over their storage
+// quota. The size of the event is taken to be that of its JSON, the stored record is usually
+// smaller. Deletions are accepted so authors can free their storage, and a replaceable or
+// addressable event only counts by how much it is larger than the one it replaces.
+func (s *Server) overQuota(c context.T, ev *event.T) (notice string) {
+	if ev.Kind.IsEphemeral() || ev.Kind.Equal(kind.Deletion) {
+		return
+	}
+	acc, ok := s.Storage().(store.Accountant)
+	if !ok {
+		return
+	}
+	q := s.Quota(ev.Pubkey)
+	if q == nil {
+		return
+	}
+	u, err := acc.Usage(ev.Pubkey)
+	if chk.E(err) {
+		return
+	}
+	events, bytes := int64(1), int64(len(ev.Serialize()))
+	if prev := s.replaced(c, ev); prev != nil {
+		events, bytes = 0, bytes-int64(len(prev.Serialize()))
+	}
+	switch {
+	case q.MaxEvents > 0 && events > 0 && u.Events+events > q.MaxEvents:
+		return string(normalize.Blocked.F("storage quota of %d events exceeded", q.MaxEvents))
+	case q.MaxBytes > 0 && bytes > 0 && u.Bytes+bytes > q.MaxBytes:
+		return string(normalize.Blocked.F("storage quota of %d bytes exceeded", q.MaxBytes))
+	}
+	return
+}
+
+// replaced returns the stored event that a replaceable or addressable event replaces, the
+// latest of its author and kind, and d tag if it is addressable, or nil if there is none.
+func (s *Server) replaced(c context.T, ev *event.T) (prev *event.T) {
+	f := &filter.T{Authors: tag.New(ev.Pubkey), Kinds: kinds.New(ev.Kind)}
+	switch {
+	case ev.Kind.IsReplaceable():
+	case ev.Kind.IsParameterizedReplaceable():
+		var d []byte
+		if t := ev.Tags.GetFirst(tag.New("d")); t != nil {
+			d = t.Value()
+		}
+		f.Tags = tags.New(tag.New([]byte("#d"), d))
+	default:
+		return
+	}
+	evs, err := s.Storage().QueryEvents(c, f)
+	if chk.E(err) {
+		return
+	}
+	for _, e := range evs {
+		if prev == nil || e.CreatedAt.I64() > prev.CreatedAt.I64() {
+			prev = e
+		}
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package relay
+
+import (
+	"testing"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/timestamp"
+)
+
+func TestOverQuotaReplaceable(t *testing.T) {
+	s := newTestServer(t, &config.C{PublicReadable: true,
+		Quotas: []config.Quota{{MaxEvents: 3}}})
+	user := newSigner(t)
+	c := context.Bg()
+	at := func(ev *event.T, ts int64) *event.T {
+		ev.CreatedAt = timestamp.FromUnix(ts)
+		if err := ev.Sign(user); err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+	now := timestamp.Now().I64()
+	for _, ev := range []*event.T{
+		signed(t, user, 1, "note"),
+		at(signed(t, user, 0, `{"name":"user"}`), now-10),
+		at(signed(t, user, 30023, "article", tag.New("d", "a")), now-10),
+	} {
+		if notice := s.overQuota(c, ev); notice != "" {
+			t.Fatalf("event under the quota rejected: %s", notice)
+		}
+		if err := s.Publish(c, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if notice := s.overQuota(c, signed(t, user, 1, "another note")); notice == "" {
+		t.Fatal("event over the quota accepted")
+	}
+	if notice := s.overQuota(c, signed(t, user, 0, `{"name":"renamed"}`)); notice != "" {
+		t.Fatalf("replacement of a profile at the quota rejected: %s", notice)
+	}
+	if notice := s.overQuota(c, signed(t, user, 30023, "edited", tag.New("d", "a"))); notice != "" {
+		t.Fatalf("replacement of an article at the quota rejected: %s", notice)
+	}
+	if notice := s.overQuota(c, signed(t, user, 30023, "new", tag.New("d", "b"))); notice == "" {
+		t.Fatal("new article over the quota accepted")
+	}
+}
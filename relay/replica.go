@@ -0,0 +1,101 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/store"
+)
+
+// replicaCloseDelay is how long the replaced store of a replica is kept open at least, for the
+// short uses of it from Storage to finish. Longer ones use AcquireStorage, and the store is not
+// closed until they are done.
+var replicaCloseDelay = time.Minute
+
+// AcquireStorage returns the event store, which is not closed if it is replaced until release
+// is called. It is for the uses of the store that may outlast a replacement, such as queries
+// and exports.
+func (s *Server) AcquireStorage() (sto store.I, release func()) {
+	s.storeMx.RLock()
+	defer s.storeMx.RUnlock()
+	if s.storeRefs == nil {
+		return s.Store, func() {}
+	}
+	refs := s.storeRefs
+	refs.Add(1)
+	return s.Store, sync.OnceFunc(refs.Done)
+}
+
+// ReplaceStore makes the server use a new event store and loads the state kept in it, the
+// configuration, identity, groups, moderation and owner lists, as Init does. The old store is
+// closed once the uses of it have finished. Connections are not dropped, subscriptions are
+// served from the new store.
+func (s *Server) ReplaceStore(sto store.I) {
+	s.storeMx.Lock()
+	old, refs := s.Store, s.storeRefs
+	s.Store, s.storeRefs = sto, &sync.WaitGroup{}
+	s.storeMx.Unlock()
+	log.I.F("event store replaced with %s", sto.Path())
+	s.loadState()
+	if old == nil {
+		return
+	}
+	go func() {
+		var done <-chan struct{}
+		if s.Ctx != nil {
+			done = s.Ctx.Done()
+		}
+		select {
+		case <-done:
+			// Shutdown only closes the current store
+		case <-time.After(replicaCloseDelay):
+		}
+		if refs != nil {
+			refs.Wait()
+		}
+		log.I.F("closing replaced event store %s", old.Path())
+		chk.E(old.Close())
+	}()
+}
+
+// loadState reads the state the relay keeps in its event store into memory, after the store
+// has been replaced.
+func (s *Server) loadState() {
+	s.configurationMx.Lock()
+	err := s.UpdateConfiguration()
+	s.configurationMx.Unlock()
+	if chk.E(err) {
+		return
+	}
+	s.initIdentity()
+	s.loadGroups()
+	s.loadModeration()
+	s.ZeroLists()
+	s.CheckOwnerLists(context.Bg())
+}
+
+// RunReplica checks each interval for a refreshed snapshot of the event store of a read only
+// replica, with refresh, which returns the snapshot opened as a new store, or nil if it has not
+// changed. The store is replaced with the new one.
+func (s *Server) RunReplica(interval time.Duration, refresh func() (sto store.I, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.Ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sto, err := refresh()
+		if chk.E(err) {
+			// keep serving the snapshot that is open
+			continue
+		}
+		if sto != nil {
+			s.ReplaceStore(sto)
+		}
+	}
+}
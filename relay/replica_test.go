@@ -0,0 +1,58 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/moderation"
+	"relay.mleku.dev/relay/config"
+)
+
+func TestReplaceStoreLoadsState(t *testing.T) {
+	s := newTestServer(t, &config.C{PublicReadable: true})
+	owner, banned := newSigner(t), newSigner(t)
+	next := newTestStore(t, t.TempDir())
+	if err := next.SetConfiguration(&config.C{Owners: []string{hex.Enc(owner.Pub())},
+		AuthRequired: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.SetBan(&moderation.Ban{Pubkey: hex.Enc(banned.Pub())}); err != nil {
+		t.Fatal(err)
+	}
+	s.ReplaceStore(next)
+	if !s.AuthRequired() || !s.isOwner(owner.Pub()) {
+		t.Fatal("the configuration of the new store was not loaded")
+	}
+	if !s.isBanned(banned.Pub()) {
+		t.Fatal("the bans of the new store were not loaded")
+	}
+	if _, ok := s.Followed[string(owner.Pub())]; !ok {
+		t.Fatal("the owner lists were not loaded")
+	}
+}
+
+func TestReplaceStoreWaitsForUses(t *testing.T) {
+	delay := replicaCloseDelay
+	replicaCloseDelay = 0
+	defer func() { replicaCloseDelay = delay }()
+	s := newTestServer(t, &config.C{PublicReadable: true})
+	old := newTestStore(t, t.TempDir())
+	s.ReplaceStore(old)
+	sto, release := s.AcquireStorage()
+	if sto != old {
+		t.Fatal("acquired a store that is not in use")
+	}
+	s.ReplaceStore(newTestStore(t, t.TempDir()))
+	time.Sleep(100 * time.Millisecond)
+	if old.DB.IsClosed() {
+		t.Fatal("replaced store closed while it is in use")
+	}
+	release()
+	for deadline := time.Now().Add(5 * time.Second); !old.DB.IsClosed(); {
+		if time.Now().After(deadline) {
+			t.Fatal("replaced store not closed after it is no longer used")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
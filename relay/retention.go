@@ -0,0 +1,79 @@
+package relay
+
+import (
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/relayinfo"
+	"relay.mleku.dev/store"
+)
+
+// authorClass returns the class of an author the retention rules can apply to.
+func (s *Server) authorClass(pubkey []byte) string {
+	if s.isOwner(pubkey) {
+		return config.AuthorOwner
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.Followed[string(pubkey)]; ok {
+		return config.AuthorFollowed
+	}
+	return config.AuthorGuest
+}
+
+// retentionRules returns the retention rules of the configuration, skipping those that are
+// invalid.
+func retentionRules(cfg *config.C) (rules []store.RetentionRule) {
+	for _, rt := range cfg.Retention {
+		if err := rt.Validate(); err != nil {
+			log.E.F("ignoring retention rule: %v", err)
+			continue
+		}
+		kinds, _ := rt.KindRanges()
+		age, _ := rt.Age()
+		rules = append(rules, store.RetentionRule{Kinds: kinds, Authors: rt.Authors,
+			MaxAge: age, MaxCount: rt.MaxCount})
+	}
+	return
+}
+
+// applyRetention gives the retention rules of the configuration to the store to enforce.
+func (s *Server) applyRetention(cfg *config.C) {
+	if rt, ok := s.Storage().(store.Retainer); ok {
+		rules := retentionRules(cfg)
+		log.I.F("applying %d retention rules", len(rules))
+		rt.SetRetention(rules, s.authorClass, s.relaySigned)
+	}
+}
+
+// retention returns the rules for how long the relay keeps events. Ephemeral events are not
+// stored, and events with an expiration tag are deleted when they expire, otherwise events are
+// kept until they are deleted or the retention rules of the configuration prune them. Rules for
+// the owners or the users they follow are left out as they don't apply to most users.
+func (s *Server) retention() (rules []relayinfo.Retention) {
+	notStored := int64(0)
+	rules = append(rules, relayinfo.Retention{
+		Kinds: []relayinfo.KindRange{{From: kind.EphemeralStart.K, To: kind.EphemeralEnd.K - 1}},
+		Time:  &notStored,
+	})
+	if _, ok := s.Storage().(store.Retainer); !ok {
+		return
+	}
+	cfg := s.Configuration()
+	for _, rule := range retentionRules(&cfg) {
+		if rule.Authors != "" && rule.Authors != config.AuthorGuest {
+			continue
+		}
+		rt := relayinfo.Retention{Kinds: rule.Kinds}
+		if rule.MaxAge > 0 {
+			seconds := int64(rule.MaxAge.Seconds())
+			rt.Time = &seconds
+		}
+		if rule.MaxCount > 0 {
+			count := rule.MaxCount
+			rt.Count = &count
+		}
+		rules = append(rules, rt)
+	}
+	return
+}
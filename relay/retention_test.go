@@ -0,0 +1,83 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/store"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+)
+
+func TestRetentionKeepsRelaySigned(t *testing.T) {
+	s := newTestServer(t, &config.C{PublicReadable: true,
+		Retention: []config.Retention{{MaxAge: "1h"}}})
+	c := context.Bg()
+	// the statements of the keys the identity was rotated from are kept
+	var statements []*event.T
+	for range 2 {
+		statement, err := s.RotateIdentity(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statements = append(statements, statement)
+	}
+	old := timestamp.FromUnix(time.Now().Add(-2 * time.Hour).Unix())
+	relayNote := &event.T{CreatedAt: old, Kind: kind.TextNote, Tags: tags.New(),
+		Content: []byte("from the relay")}
+	if err := s.PublishAsRelay(c, relayNote); err != nil {
+		t.Fatal(err)
+	}
+	user := newSigner(t)
+	userNote := signed(t, user, 1, "from a user")
+	userNote.CreatedAt = old
+	if err := userNote.Sign(user); err != nil {
+		t.Fatal(err)
+	}
+	// a statement forged by a user naming the relay as its successor
+	forged := signed(t, user, kind.ApplicationSpecificData.K, "",
+		tag.New("d", SuccessorTag), tag.New("p", hex.Enc(s.Identity().Pub()), "", "successor"))
+	forgedNote := signed(t, user, 1, "forged")
+	for _, ev := range []*event.T{userNote, forged, forgedNote} {
+		if err := s.Publish(c, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, tc := range map[string]struct {
+		ev   *event.T
+		want bool
+	}{
+		"relay note":        {relayNote, true},
+		"first statement":   {statements[0], true},
+		"second statement":  {statements[1], true},
+		"user note":         {userNote, false},
+		"forged note":       {forgedNote, false},
+		"unrelated 30078":   {signed(t, user, 30078, "", tag.New("d", "x")), false},
+		"forged by a stray": {signed(t, newSigner(t), 30078, "", tag.New("d", SuccessorTag)), false},
+	} {
+		if got := s.relaySigned(tc.ev); got != tc.want {
+			t.Errorf("%s is relay signed %v, expected %v", name, got, tc.want)
+		}
+	}
+	deleted, err := s.Storage().(store.Retainer).Prune(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("pruned %d events, expected only the note of the user", deleted)
+	}
+	evs, err := s.Storage().QueryEvents(c, &filter.T{IDs: tag.New(relayNote.Id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 1 {
+		t.Error("event of the relay was pruned")
+	}
+}
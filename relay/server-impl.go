@@ -8,6 +8,7 @@ import (
 	"relay.mleku.dev/context"
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/log"
+	"relay.mleku.dev/privileged"
 	"relay.mleku.dev/relay/config"
 	"relay.mleku.dev/relay/interfaces"
 	"relay.mleku.dev/signer"
@@ -20,7 +21,11 @@ func (s *Server) AdminAuth(r *http.Request, remote string,
 	return s.adminAuth(r, remote, tolerance...)
 }
 
-func (s *Server) Storage() store.I { return s.Store }
+func (s *Server) Storage() store.I {
+	s.storeMx.RLock()
+	defer s.storeMx.RUnlock()
+	return s.Store
+}
 
 func (s *Server) Configuration() config.C {
 	s.configurationMx.Lock()
@@ -37,7 +42,7 @@ func (s *Server) SetConfiguration(cfg *config.C) {
 	s.configuration = cfg
 	s.configured = true
 	s.configurationMx.Unlock()
-	if c, ok := s.Store.(store.Configurationer); ok {
+	if c, ok := s.Storage().(store.Configurationer); ok {
 		chk.E(c.SetConfiguration(cfg))
 		chk.E(s.UpdateConfiguration())
 	}
@@ -81,6 +86,21 @@ func (s *Server) AuthRequired() bool {
 	return s.configuration.AuthRequired
 }
 
+// Readable returns true if the holder of the pubkey may be sent the event. Privileged events are
+// only readable by the parties to them, the events of private groups by their members, and
+// hidden events by their authors.
+func (s *Server) Readable(ev *event.T, pubkey []byte) bool {
+	return privileged.Readable(ev, pubkey) && s.groupReadable(ev, pubkey) &&
+		s.Visible(ev.Id, ev.Pubkey, pubkey)
+}
+
+// NIP17InboxOnly returns true if the relay only accepts gift wraps addressed to its own users.
+func (s *Server) NIP17InboxOnly() bool {
+	s.configurationMx.Lock()
+	defer s.configurationMx.Unlock()
+	return s.configuration.NIP17InboxOnly
+}
+
 func (s *Server) OwnersFollowed(pubkey string) (ok bool) {
 	s.Lock()
 	defer s.Unlock()
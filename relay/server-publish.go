@@ -19,7 +19,7 @@ import (
 )
 
 func (s *Server) Publish(c context.T, evt *event.T) (err error) {
-	sto := s.Store
+	sto := s.Storage()
 	if evt.Kind.IsEphemeral() {
 		// do not store ephemeral events
 		return nil
@@ -0,0 +1,53 @@
+package relay
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/log"
+)
+
+// tenant returns the virtual relay a request is for, or nil if it is for the relay itself.
+// Tenants are selected by their Host, or by their Path being a prefix of the request path.
+func (s *Server) tenant(r *http.Request) *Server {
+	if len(s.Tenants) == 0 {
+		return nil
+	}
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, t := range s.Tenants {
+		switch {
+		case t.Host != "" && strings.EqualFold(t.Host, host):
+			return t
+		case t.Path != "" && (r.URL.Path == t.Path || strings.HasPrefix(r.URL.Path, t.Path+"/")):
+			return t
+		}
+	}
+	return nil
+}
+
+// initTenants initializes the virtual relays served along with the relay.
+func (s *Server) initTenants() {
+	for _, t := range s.Tenants {
+		log.I.F("serving virtual relay %s at %s%s", t.Name, t.Host, t.Path)
+		t.Init()
+	}
+}
+
+// shutdownTenants closes the event stores of the virtual relays served along with the relay.
+func (s *Server) shutdownTenants() {
+	for _, t := range s.Tenants {
+		log.W.F("closing event store of virtual relay %s", t.Name)
+		if t.Cancel != nil {
+			t.Cancel()
+		}
+		chk.E(t.Storage().Close())
+	}
+}
@@ -0,0 +1,235 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/httpauth"
+	"relay.mleku.dev/openapi"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/servemux"
+	"relay.mleku.dev/socketapi"
+	"relay.mleku.dev/tag"
+)
+
+// newTestRelay makes a relay with its APIs, selected by a host or a path if it is a tenant,
+// with an admin.
+func newTestRelay(t *testing.T, name, host, path string, admin *p256k.Signer) (s *Server) {
+	s = newTestServer(t, &config.C{Admins: []string{hex.Enc(admin.Pub())},
+		PublicReadable: true})
+	c, cancel := context.Cancel(context.Bg())
+	t.Cleanup(cancel)
+	s.Name, s.Host, s.Path, s.Ctx, s.Mux = name, host, path, c, servemux.New()
+	openapi.New(s, name, "test", "test", path+"/api", s.Mux)
+	if path != "" {
+		socketapi.New(s, path, s.Mux)
+	} else {
+		socketapi.New(s, "/{$}", s.Mux)
+	}
+	return
+}
+
+// newTestTenants serves a relay with a tenant selected by host and another by path.
+func newTestTenants(t *testing.T) (srv *httptest.Server, main, a, b *Server,
+	adminMain, adminA, adminB *p256k.Signer) {
+
+	adminMain, adminA, adminB = newSigner(t), newSigner(t), newSigner(t)
+	main = newTestRelay(t, "main", "", "", adminMain)
+	a = newTestRelay(t, "a", "a.example", "", adminA)
+	b = newTestRelay(t, "b", "", "/b", adminB)
+	main.Tenants = []*Server{a, b}
+	srv = httptest.NewServer(main)
+	t.Cleanup(srv.Close)
+	return
+}
+
+func TestTenantSelection(t *testing.T) {
+	srv, main, a, b, _, _, _ := newTestTenants(t)
+	for _, tc := range []struct {
+		host, forwarded, path string
+		want                  *Server
+	}{
+		{"a.example", "", "/", a},
+		{"A.Example:8080", "", "/", a},
+		{"relay.example", "a.example", "/", a},
+		{"relay.example", "", "/b", b},
+		{"relay.example", "", "/b/api/relay", b},
+		{"a.example", "", "/b", a},
+		{"relay.example", "", "/", nil},
+		{"relay.example", "", "/bee", nil},
+		{"relay.example", "b.example", "/", nil},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://"+tc.host+tc.path, nil)
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-Host", tc.forwarded)
+		}
+		if got := main.tenant(r); got != tc.want {
+			t.Errorf("host %s forwarded %s path %s selected %v", tc.host, tc.forwarded,
+				tc.path, got)
+		}
+	}
+	// the relay information is served by the relay the request is for
+	for _, tc := range []struct{ host, path, name string }{
+		{"", "/", "main"},
+		{"a.example", "/", "a"},
+		{"", "/b", "b"},
+	} {
+		r, err := http.NewRequest(http.MethodGet, srv.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.host != "" {
+			r.Host = tc.host
+		}
+		r.Header.Set("Accept", "application/nostr+json")
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK ||
+			!strings.Contains(string(body), `"name":"`+tc.name+`"`) {
+			t.Errorf("relay information at %s%s is not of %s: %d %s", tc.host, tc.path,
+				tc.name, res.StatusCode, body)
+		}
+	}
+}
+
+// dialTestRelay opens a websocket to a relay, selected by host or by path.
+func dialTestRelay(t *testing.T, srv *httptest.Server, host, path string) (conn *websocket.Conn) {
+	h := http.Header{}
+	if host != "" {
+		h.Set("Host", host)
+	}
+	var err error
+	if conn, _, err = websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL,
+		"http")+path, h); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return
+}
+
+// readTestRelay returns the next message from a relay, or nil if there is none within wait.
+func readTestRelay(t *testing.T, conn *websocket.Conn, wait time.Duration) (msg []byte) {
+	if err := conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if _, msg, err = conn.ReadMessage(); err != nil {
+		if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+			return nil
+		}
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestTenantEvents(t *testing.T) {
+	srv, main, a, b, _, _, _ := newTestTenants(t)
+	conns := map[*Server]*websocket.Conn{
+		main: dialTestRelay(t, srv, "", "/"),
+		a:    dialTestRelay(t, srv, "a.example", "/"),
+		b:    dialTestRelay(t, srv, "", "/b"),
+	}
+	for s, conn := range conns {
+		if err := conn.WriteMessage(websocket.TextMessage,
+			[]byte(`["REQ","sub",{"kinds":[1]}]`)); err != nil {
+			t.Fatal(err)
+		}
+		if msg := readTestRelay(t, conn, 5*time.Second); !strings.HasPrefix(string(msg),
+			`["EOSE"`) {
+			t.Fatalf("subscription to %s was not opened: %s", s.Name, msg)
+		}
+	}
+	ev := signed(t, newSigner(t), 1, "hello a")
+	if err := conns[a].WriteMessage(websocket.TextMessage,
+		append(append([]byte(`["EVENT",`), ev.Serialize()...), ']')); err != nil {
+		t.Fatal(err)
+	}
+	var ok, delivered bool
+	for !ok || !delivered {
+		msg := string(readTestRelay(t, conns[a], 5*time.Second))
+		switch {
+		case strings.HasPrefix(msg, `["OK","`+hex.Enc(ev.Id)+`",true`):
+			ok = true
+		case strings.HasPrefix(msg, `["EVENT","sub"`) &&
+			strings.Contains(msg, hex.Enc(ev.Id)):
+			delivered = true
+		default:
+			t.Fatalf("unexpected message from a: %s", msg)
+		}
+	}
+	for _, s := range []*Server{main, b} {
+		if msg := readTestRelay(t, conns[s], 500*time.Millisecond); msg != nil {
+			t.Errorf("event of a was sent to a subscriber of %s: %s", s.Name, msg)
+		}
+	}
+	for s, want := range map[*Server]int{main: 0, a: 1, b: 0} {
+		evs, err := s.Storage().QueryEvents(context.Bg(), &filter.T{IDs: tag.New(ev.Id)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evs) != want {
+			t.Errorf("%s stored %d copies of the event of a, expected %d", s.Name, len(evs),
+				want)
+		}
+	}
+}
+
+func TestTenantAdmins(t *testing.T) {
+	srv, _, _, _, adminMain, adminA, adminB := newTestTenants(t)
+	relays := []struct {
+		name, host, path string
+		admin            *p256k.Signer
+	}{
+		{"main", "", "", adminMain},
+		{"a", "a.example", "", adminA},
+		{"b", "", "/b", adminB},
+	}
+	for _, rl := range relays {
+		for _, by := range relays {
+			r, err := http.NewRequest(http.MethodGet, srv.URL+rl.path+"/api/configuration/get",
+				nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rl.host != "" {
+				r.Host = rl.host
+			}
+			u := &url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+			if err = httpauth.AddNIP98Header(r, u, http.MethodGet, "", by.admin,
+				0); err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			want := http.StatusUnauthorized
+			if rl.name == by.name {
+				want = http.StatusOK
+			}
+			if res.StatusCode != want {
+				t.Errorf("admin of %s getting the configuration of %s: %d, expected %d",
+					by.name, rl.name, res.StatusCode, want)
+			}
+		}
+	}
+}
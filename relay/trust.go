@@ -0,0 +1,216 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/normalize"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/wot"
+)
+
+const (
+	// trustInterval is how often the trust scores are computed again if follow lists in the
+	// web of trust have changed.
+	trustInterval = time.Minute
+	// trustReloadInterval is how often the web of trust is loaded again from all the stored
+	// follow lists.
+	trustReloadInterval = time.Hour
+	// trustBatch is the most authors whose follow lists are fetched in one query.
+	trustBatch = 500
+)
+
+// rateLimiter counts the events and requests of each user in the current minute.
+type rateLimiter struct {
+	sync.Mutex
+	minute int64
+	counts map[string]int
+}
+
+// allow counts an action of a user, and returns false if they have done it more than limit
+// times this minute.
+func (rl *rateLimiter) allow(action, key string, limit int) bool {
+	rl.Lock()
+	defer rl.Unlock()
+	if m := time.Now().Unix() / 60; m != rl.minute || rl.counts == nil {
+		rl.minute, rl.counts = m, make(map[string]int)
+	}
+	rl.counts[action+key]++
+	return rl.counts[action+key] <= limit
+}
+
+// trustGraph returns the web of trust, nil if it has not been loaded.
+func (s *Server) trustGraph() *wot.Graph {
+	s.trustMx.Lock()
+	defer s.trustMx.Unlock()
+	return s.trust
+}
+
+// reloadTrust makes the web of trust be loaded again, after the configuration has changed.
+func (s *Server) reloadTrust() {
+	select {
+	case s.trustKick <- struct{}{}:
+	default:
+	}
+}
+
+// runTrust loads the web of trust when it is enabled, and keeps it up to date until the relay
+// shuts down.
+func (s *Server) runTrust() {
+	ticker := time.NewTicker(trustInterval)
+	defer ticker.Stop()
+	var loaded time.Time
+	reload := true
+	for {
+		if w := s.Configuration().WoT; w.Enabled {
+			switch {
+			case reload || time.Since(loaded) > trustReloadInterval:
+				s.loadTrust(w)
+				loaded = time.Now()
+			case s.trustDirty.Swap(false):
+				if g := s.trustGraph(); g != nil {
+					g.Compute(w.Damping, w.MaxDepth)
+				}
+			}
+		}
+		reload = false
+		select {
+		case <-s.Ctx.Done():
+			return
+		case <-s.trustKick:
+			reload = true
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadTrust builds the web of trust from the follow lists of the owners, and those of the
+// users they follow, up to the maximum depth.
+func (s *Server) loadTrust(w config.WoT) {
+	start := time.Now()
+	owners := s.Owners()
+	g := wot.New()
+	g.SetSeeds(owners...)
+	s.loadFollows(g, owners, 0, w.MaxDepth)
+	g.Compute(w.Damping, w.MaxDepth)
+	s.trustMx.Lock()
+	s.trust = g
+	s.trustMx.Unlock()
+	s.trustDirty.Store(false)
+	log.I.F("web of trust of %d users loaded in %v", g.Size(), time.Since(start))
+}
+
+// loadFollows adds the follow lists of the users at a depth to the web of trust, and those of
+// the users they follow that are not in it yet, up to the maximum depth.
+func (s *Server) loadFollows(g *wot.Graph, frontier [][]byte, depth, maxDepth int) {
+	seen := make(map[string]struct{})
+	for _, pk := range frontier {
+		seen[string(pk)] = struct{}{}
+	}
+	for ; depth < maxDepth && len(frontier) > 0; depth++ {
+		var next [][]byte
+		for len(frontier) > 0 {
+			batch := frontier[:min(trustBatch, len(frontier))]
+			frontier = frontier[len(batch):]
+			evs, err := s.Storage().QueryEvents(s.Ctx, &filter.T{Authors: tag.New(batch...),
+				Kinds: kinds.New(kind.FollowList)})
+			if chk.E(err) {
+				continue
+			}
+			for _, ev := range evs {
+				for _, f := range g.SetFollows(ev.Pubkey, wot.Follows(ev)) {
+					if _, ok := seen[string(f)]; !ok {
+						seen[string(f)] = struct{}{}
+						next = append(next, f)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+}
+
+// trustFollowList updates the web of trust with a new follow list, if its author is in it. The
+// follow lists of the users it adds are loaded if they are within the maximum depth, and the
+// scores are computed again within trustInterval.
+func (s *Server) trustFollowList(ev *event.T) {
+	w := s.Configuration().WoT
+	g := s.trustGraph()
+	if !w.Enabled || g == nil || !ev.Kind.Equal(kind.FollowList) {
+		return
+	}
+	distance, _ := g.Trust(ev.Pubkey)
+	if distance < 0 || distance >= w.MaxDepth {
+		return
+	}
+	added := g.SetFollows(ev.Pubkey, wot.Follows(ev))
+	if len(added) > 0 && distance+1 < w.MaxDepth {
+		s.loadFollows(g, added, distance+1, w.MaxDepth)
+	}
+	s.trustDirty.Store(true)
+}
+
+// trustTier returns the trust tier of a user, nil if they are in none, and enabled is false if
+// the web of trust is not enabled. Until it is loaded only the owners are trusted.
+func (s *Server) trustTier(pubkey []byte) (t *config.TrustTier, enabled bool) {
+	cfg := s.Configuration()
+	if !cfg.WoT.Enabled {
+		return
+	}
+	distance, score := -1, 0.0
+	if g := s.trustGraph(); g != nil && len(pubkey) > 0 {
+		distance, score = g.Trust(pubkey)
+	} else if s.isOwner(pubkey) {
+		distance, score = 0, 1
+	}
+	return cfg.WoT.Tier(distance, score), true
+}
+
+// acceptTrusted applies the web of trust to the publisher of an event, if it is enabled. Users
+// in a tier that may write are admitted, unless they are over the rate limit of their tier. It
+// only stands in for the owners' follow lists, muted users and the guards on deletions still
+// apply. If handled is false the normal policy applies.
+func (s *Server) acceptTrusted(pubkey []byte) (handled, accept bool, notice string) {
+	t, enabled := s.trustTier(pubkey)
+	if !enabled {
+		return
+	}
+	if t == nil || !t.Write {
+		return true, false, string(normalize.Restricted.F(
+			"not trusted enough by the owners of this relay to publish to it"))
+	}
+	if t.RateLimit > 0 && !s.rates.allow("event", string(pubkey), t.RateLimit) {
+		return true, false, string(normalize.RateLimited.F(
+			"more than %d events a minute", t.RateLimit))
+	}
+	return true, true, ""
+}
+
+// acceptTrustedReq applies the web of trust to a request, if it is enabled. Users in a tier that
+// may read are allowed, unless they are over the rate limit of their tier, counted by their
+// address if they are not authenticated. If handled is false the normal policy applies.
+func (s *Server) acceptTrustedReq(authedPubkey []byte, remote string) (handled, ok bool) {
+	t, enabled := s.trustTier(authedPubkey)
+	if !enabled {
+		return
+	}
+	if t == nil || !t.Read {
+		return true, false
+	}
+	key := string(authedPubkey)
+	if key == "" {
+		key = remote
+	}
+	if t.RateLimit > 0 && !s.rates.allow("req", key, t.RateLimit) {
+		log.D.F("%s over the request rate limit of trust tier %s", remote, t.Name)
+		return true, false
+	}
+	return true, true
+}
@@ -1,6 +1,9 @@
 package relayinfo
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestAddSupportedNIP(t *testing.T) {
 	info := NewInfo(nil)
@@ -13,3 +16,23 @@ func TestAddSupportedNIP(t *testing.T) {
 		}
 	}
 }
+
+func TestRetention(t *testing.T) {
+	zero := int64(0)
+	r := []Retention{{Kinds: []KindRange{{1, 1}, {20000, 29999}}, Time: &zero}, {}}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[{"kinds":[1,[20000,29999]],"time":0},{}]` {
+		t.Fatalf("unexpected encoding %s", b)
+	}
+	var r2 []Retention
+	if err = json.Unmarshal(b, &r2); err != nil {
+		t.Fatal(err)
+	}
+	if len(r2) != 2 || r2[0].Kinds[1] != r[0].Kinds[1] || *r2[0].Time != 0 ||
+		r2[1].Time != nil {
+		t.Fatalf("unexpected decoding %+v", r2)
+	}
+}
@@ -1,5 +1,7 @@
 package relayinfo
 
+import "encoding/json"
+
 // AddSupportedNIP appends a supported NIP number to a RelayInfo.
 func (ri *T) AddSupportedNIP(n int) {
 	idx, exists := ri.Nips.HasNumber(n)
@@ -37,3 +39,43 @@ type Fees struct {
 	Subscription []Subscription `json:"subscription,omitempty"`
 	Publication  []Publication  `json:"publication,omitempty"`
 }
+
+// KindRange is a range of event kinds, From and To inclusive. A range of one kind is encoded as
+// just the number, a range of several as an array of the first and last.
+type KindRange struct {
+	From, To uint16
+}
+
+// MarshalJSON encodes a KindRange as a number if it is a single kind, otherwise as a pair.
+func (k KindRange) MarshalJSON() (b []byte, err error) {
+	if k.From == k.To {
+		return json.Marshal(k.From)
+	}
+	return json.Marshal([2]uint16{k.From, k.To})
+}
+
+// UnmarshalJSON decodes a KindRange from a number or a pair of numbers.
+func (k *KindRange) UnmarshalJSON(b []byte) (err error) {
+	var single uint16
+	if err = json.Unmarshal(b, &single); err == nil {
+		k.From, k.To = single, single
+		return
+	}
+	var pair [2]uint16
+	if err = json.Unmarshal(b, &pair); err != nil {
+		return
+	}
+	k.From, k.To = pair[0], pair[1]
+	return
+}
+
+// Retention is a rule for how long a relay keeps events of some kinds, or all events if Kinds
+// is empty. A Time of zero means the events are not stored at all, and a rule without a Time
+// or Count means they are kept indefinitely.
+type Retention struct {
+	Kinds []KindRange `json:"kinds,omitempty"`
+	// Time is the number of seconds events are kept for.
+	Time *int64 `json:"time,omitempty"`
+	// Count is the most events kept.
+	Count *int `json:"count,omitempty"`
+}
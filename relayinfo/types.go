@@ -59,6 +59,8 @@ var (
 	NIP15                          = NostrMarketplace
 	EventTreatment                 = NIP{"EVent Treatment", 16}
 	NIP16                          = EventTreatment
+	PrivateDirectMessages          = NIP{"Private Direct Messages", 17}
+	NIP17                          = PrivateDirectMessages
 	Reposts                        = NIP{"Reposts", 18}
 	NIP18                          = Reposts
 	Bech32EncodedEntities          = NIP{"bech32-encoded entities", 19}
@@ -81,6 +83,8 @@ var (
 	NIP27                          = TextNoteReferences
 	PublicChat                     = NIP{"Public Chat", 28}
 	NIP28                          = PublicChat
+	RelayBasedGroups               = NIP{"Relay-based Groups", 29}
+	NIP29                          = RelayBasedGroups
 	CustomEmoji                    = NIP{"Custom Emoji", 30}
 	NIP30                          = CustomEmoji
 	Labeling                       = NIP{"Labeling", 32}
@@ -150,7 +154,7 @@ var (
 var NIPMap = map[int]NIP{1: NIP1, 2: NIP2, 3: NIP3, 4: NIP4, 5: NIP5, 8: NIP8, 9: NIP9,
 	11: NIP11, 12: NIP12, 14: NIP14, 15: NIP15, 16: NIP16, 18: NIP18, 19: NIP19, 20: NIP20,
 	21: NIP21, 22: NIP22, 23: NIP23, 24: NIP24, 25: NIP25, 26: NIP26, 27: NIP27, 28: NIP28,
-	30: NIP30, 32: NIP32, 33: NIP33, 36: NIP36, 38: NIP38, 39: NIP39, 40: NIP40, 42: NIP42,
+	29: NIP29, 30: NIP30, 32: NIP32, 33: NIP33, 36: NIP36, 38: NIP38, 39: NIP39, 40: NIP40, 42: NIP42,
 	44: NIP44, 45: NIP45, 46: NIP46, 47: NIP47, 48: NIP48, 50: NIP50, 51: NIP51, 52: NIP52,
 	53: NIP53, 56: NIP56, 57: NIP57, 58: NIP58, 65: NIP65, 72: NIP72, 75: NIP75, 78: NIP78,
 	84: NIP84, 89: NIP89, 90: NIP90, 94: NIP94, 96: NIP96, 98: NIP98, 99: NIP99}
@@ -227,6 +231,7 @@ type T struct {
 	Name           string      `json:"name"`
 	Description    string      `json:"description,omitempty"`
 	PubKey         string      `json:"pubkey,omitempty"`
+	Self           string      `json:"self,omitempty"`
 	Contact        string      `json:"contact,omitempty"`
 	Nips           number.List `json:"supported_nips"`
 	Software       string      `json:"software"`
@@ -4,7 +4,6 @@ import (
 	"relay.mleku.dev/chk"
 	"relay.mleku.dev/envelopes/closeenvelope"
 	"relay.mleku.dev/log"
-	"relay.mleku.dev/publish"
 	"relay.mleku.dev/relay/interfaces"
 )
 
@@ -24,7 +23,7 @@ func (a *A) HandleClose(req []byte,
 		return []byte("CLOSE has no <id>")
 	}
 	log.T.F("%s cancelling subscription %s", remote, env.ID.String())
-	publish.P.Receive(&W{
+	a.Server.Publisher().Receive(&W{
 		Cancel:   true,
 		Listener: a.Listener,
 		Id:       env.ID.String(),
@@ -43,6 +43,13 @@ func (a *A) HandleEvent(c context.T, req []byte, srv interfaces.Server,
 		a.Listener.AuthedBytes(), remote)
 	log.T.F("%s accepted %s %v", remote, accept)
 	if !accept {
+		if NIP20prefixmatcher.MatchString(notice) {
+			// the notice already carries its reason, send it as is.
+			if err = okenvelope.NewFrom(env.Id, false,
+				[]byte(notice)).Write(a.Listener); chk.T(err) {
+			}
+			return
+		}
 		if strings.Contains(notice, "mute") {
 			if err = okenvelope.NewFrom(env.Id, false,
 				normalize.Blocked.F(notice)).Write(a.Listener); chk.T(err) {
@@ -242,7 +249,7 @@ func (a *A) HandleEvent(c context.T, req []byte, srv interfaces.Server,
 	if err = okenvelope.NewFrom(env.Id, ok, reason).Write(a.Listener); chk.E(err) {
 		return
 	}
-	if after != nil {
+	if ok && after != nil {
 		after()
 	}
 	return
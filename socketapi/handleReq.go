@@ -21,7 +21,6 @@ import (
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/normalize"
 	"relay.mleku.dev/pointers"
-	"relay.mleku.dev/publish"
 	"relay.mleku.dev/relay/interfaces"
 	"relay.mleku.dev/tag"
 )
@@ -30,7 +29,8 @@ func (a *A) HandleReq(c context.T, req []byte, srv interfaces.Server,
 	remote string) (r []byte) {
 
 	log.T.F("%s handleReq %s", remote, req)
-	sto := srv.Storage()
+	sto, release := srv.AcquireStorage()
+	defer release()
 	var err error
 	var rem []byte
 	env := reqenvelope.New()
@@ -82,6 +82,11 @@ func (a *A) HandleReq(c context.T, req []byte, srv interfaces.Server,
 		}()
 	}
 	if allowed == nil {
+		if modified {
+			if err = closedenvelope.NewFrom(env.Subscription,
+				normalize.Restricted.F("not permitted to read the requested events")).Write(a.Listener); chk.E(err) {
+			}
+		}
 		return
 	}
 	for _, f := range allowed.F {
@@ -92,34 +97,22 @@ func (a *A) HandleReq(c context.T, req []byte, srv interfaces.Server,
 			}
 			i = *f.Limit
 		}
-		if a.Server.AuthRequired() {
-			if f.Kinds.IsPrivileged() {
-				log.T.F("privileged request\n%s", f.Serialize())
-				senders := f.Authors
-				receivers := f.Tags.GetAll(tag.New("#p"))
-				switch {
-				case len(a.Listener.Authed()) == 0:
-					// a.RequestAuth()
-					if err = closedenvelope.NewFrom(env.Subscription,
-						normalize.AuthRequired.F("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")).Write(a.Listener); chk.E(err) {
-					}
-					log.I.F("requesting auth from client from %s", a.Listener.RealRemote())
-					if err = authenvelope.NewChallengeWith(a.Listener.Challenge()).Write(a.Listener); chk.E(err) {
-						return
-					}
-					notice := normalize.Restricted.F("this realy does not serve DMs or Application Specific Data " +
-						"to unauthenticated users or to npubs not found in the event tags or author fields, does your " +
-						"client implement NIP-42?")
-					return notice
-				case senders.Contains(a.Listener.AuthedBytes()) ||
-					receivers.ContainsAny([]byte("#p"), tag.New(a.Listener.AuthedBytes())):
-					log.T.F("user %0x from %s allowed to query for privileged event",
-						a.Listener.AuthedBytes(), a.Listener.RealRemote())
-				default:
-					return normalize.Restricted.F("authenticated user %0x does not have authorization for "+
-						"requested filters", a.Listener.AuthedBytes())
-				}
+		// privileged kinds (DMs, gift wraps, app specific data) are only served to
+		// authenticated parties of the conversation, so ask for auth first.
+		if f.Kinds.IsPrivileged() && !a.Listener.IsAuthed() {
+			log.T.F("privileged request\n%s", f.Serialize())
+			a.Listener.RequestAuth()
+			if err = closedenvelope.NewFrom(env.Subscription,
+				normalize.AuthRequired.F("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")).Write(a.Listener); chk.E(err) {
+			}
+			log.I.F("requesting auth from client from %s", a.Listener.RealRemote())
+			if err = authenvelope.NewChallengeWith(a.Listener.Challenge()).Write(a.Listener); chk.E(err) {
+				return
 			}
+			notice := normalize.Restricted.F("this realy does not serve DMs or Application Specific Data " +
+				"to unauthenticated users or to npubs not found in the event tags or author fields, does your " +
+				"client implement NIP-42?")
+			return notice
 		}
 		var events event.Ts
 		log.D.F("query from %s %0x,%s", a.Listener.RealRemote(), a.Listener.AuthedBytes(),
@@ -150,55 +143,27 @@ func (a *A) HandleReq(c context.T, req []byte, srv interfaces.Server,
 					}
 				}
 				var tmp event.Ts
+			next:
 				for _, ev := range events {
 					for _, pk := range mutePubs {
 						if bytes.Equal(ev.Pubkey, pk) {
-							continue
+							continue next
 						}
-						tmp = append(tmp, ev)
 					}
+					tmp = append(tmp, ev)
 				}
-				// remove privileged events
 				events = tmp
 			}
 		}
-		// remove privileged events as they come through in scrape queries
+		// remove privileged events as they come through in scrape queries, only the parties
+		// of the conversation may see them, gift wraps only their recipient, and private
+		// group events only the group members.
 		var tmp event.Ts
 		for _, ev := range events {
-			receivers := f.Tags.GetAll(tag.New("#p"))
-			// if auth is required, kind is privileged and there is no authed pubkey, skip
-			if srv.AuthRequired() && ev.Kind.IsPrivileged() && len(aut) == 0 {
-				// log.I.ToSliceOfBytes("skipping event because event kind is %d and no auth", ev.Kind.K)
-				if err = closedenvelope.NewFrom(env.Subscription,
-					normalize.AuthRequired.F("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")).Write(a.Listener); chk.E(err) {
-				}
-				log.I.F("requesting auth from client from %s", a.Listener.RealRemote())
-				if err = authenvelope.NewChallengeWith(a.Listener.Challenge()).Write(a.Listener); chk.E(err) {
-					return
-				}
-				notice := normalize.Restricted.F("this realy does not serve DMs or Application Specific Data " +
-					"to unauthenticated users or to npubs not found in the event tags or author fields, does your " +
-					"client implement NIP-42?")
-				return notice
+			if !a.Server.Readable(ev, aut) {
+				log.T.F("skipping unreadable event %0x for %0x", ev.Id, aut)
 				continue
 			}
-			// if the authed pubkey is not present in the pubkey or p tags, skip
-			if ev.Kind.IsPrivileged() && (!bytes.Equal(ev.Pubkey, aut) ||
-				!receivers.ContainsAny([]byte("#p"), tag.New(a.Listener.AuthedBytes()))) {
-				// log.I.ToSliceOfBytes("skipping event %0x because authed key %0x is in neither pubkey or p tag",
-				// 	ev.Id, aut)
-				if err = closedenvelope.NewFrom(env.Subscription,
-					normalize.AuthRequired.F("auth required for processing request due to presence of privileged kinds (DMs, app specific data)")).Write(a.Listener); chk.E(err) {
-				}
-				log.I.F("requesting auth from client from %s", a.Listener.RealRemote())
-				if err = authenvelope.NewChallengeWith(a.Listener.Challenge()).Write(a.Listener); chk.E(err) {
-					return
-				}
-				notice := normalize.Restricted.F("this realy does not serve DMs or Application Specific Data " +
-					"to unauthenticated users or to npubs not found in the event tags or author fields, does your " +
-					"client implement NIP-42?")
-				return notice
-			}
 			tmp = append(tmp, ev)
 		}
 		events = tmp
@@ -225,7 +190,7 @@ func (a *A) HandleReq(c context.T, req []byte, srv interfaces.Server,
 		return
 	}
 	receiver := make(event.C, 32)
-	publish.P.Receive(&W{
+	a.Server.Publisher().Receive(&W{
 		Listener: a.Listener,
 		Id:       env.Subscription.String(),
 		Receiver: receiver,
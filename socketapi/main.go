@@ -11,7 +11,6 @@ import (
 	"relay.mleku.dev/context"
 	"relay.mleku.dev/envelopes/authenvelope"
 	"relay.mleku.dev/log"
-	"relay.mleku.dev/publish"
 	"relay.mleku.dev/relay/helpers"
 	"relay.mleku.dev/relay/interfaces"
 	"relay.mleku.dev/servemux"
@@ -30,11 +29,17 @@ type A struct {
 	Ctx      context.T
 	Listener *ws.Listener
 	interfaces.Server
+	// base is the path prefix of the relay, that the web views are served under.
+	base string
 }
 
 func New(s interfaces.Server, path string, sm *servemux.S) {
-	a := &A{Server: s}
+	a := &A{Server: s, base: strings.TrimSuffix(strings.TrimSuffix(path, "{$}"), "/")}
+	pub := NewPublisher()
+	pub.Server = s
+	s.Publisher().Register(pub)
 	sm.Handle(path, a)
+	a.registerWeb(sm)
 	return
 }
 
@@ -52,10 +57,16 @@ func (a *A) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Header.Get("Upgrade") != "websocket" {
-		// todo: we can put a website here
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			log.T.F("serving landing page %s", remote)
+			a.serveLanding(w, r)
+			return
+		}
 		http.Error(w, http.StatusText(http.StatusUpgradeRequired), http.StatusUpgradeRequired)
 		return
 	}
+	// the listener and context are those of this connection, so each connection has its own.
+	a = &A{Server: a.Server, base: a.base}
 	var err error
 	ticker := time.NewTicker(DefaultPingWait)
 	var cancel context.F
@@ -72,7 +83,7 @@ func (a *A) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.D.F("%s closing connection", remote)
 		cancel()
 		ticker.Stop()
-		publish.P.Receive(&W{
+		a.Server.Publisher().Receive(&W{
 			Cancel:   true,
 			Listener: a.Listener,
 		})
@@ -0,0 +1,188 @@
+package socketapi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+
+	"relay.mleku.dev/auth"
+	"relay.mleku.dev/envelopes"
+	"relay.mleku.dev/envelopes/authenvelope"
+	"relay.mleku.dev/envelopes/eoseenvelope"
+	"relay.mleku.dev/envelopes/eventenvelope"
+	"relay.mleku.dev/envelopes/okenvelope"
+	"relay.mleku.dev/envelopes/reqenvelope"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/filters"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/relay"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/subscription"
+	"relay.mleku.dev/tag"
+)
+
+// testConn is a websocket connection to a relay under test.
+type testConn struct {
+	*testing.T
+	*websocket.Conn
+}
+
+// read returns the label and the rest of the next message from the relay.
+func (c *testConn) read() (label string, rem []byte) {
+	c.Helper()
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		c.Fatal(err)
+	}
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		c.Fatal(err)
+	}
+	if label, rem, err = envelopes.Identify(msg); err != nil {
+		c.Fatal(err)
+	}
+	return
+}
+
+// write sends a message to the relay.
+func (c *testConn) write(b []byte) {
+	c.Helper()
+	if err := c.WriteMessage(websocket.TextMessage, b); err != nil {
+		c.Fatal(err)
+	}
+}
+
+// events returns the events the relay sends until a message with the label, or until the
+// event with the id, which is not returned.
+func (c *testConn) events(until string, id []byte) (evs []*event.T) {
+	c.Helper()
+	for {
+		label, rem := c.read()
+		switch label {
+		case until:
+			return
+		case eventenvelope.L:
+			res, _, err := eventenvelope.ParseResult(rem)
+			if err != nil {
+				c.Fatal(err)
+			}
+			if id != nil && bytes.Equal(res.Event.Id, id) {
+				return
+			}
+			evs = append(evs, res.Event)
+		}
+	}
+}
+
+// newTestUser connects to a relay that requires auth, and authenticates with a new key.
+func newTestUser(t *testing.T, url string) (sign *p256k.Signer, c *testConn) {
+	sign = &p256k.Signer{}
+	if err := sign.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	url = "ws" + strings.TrimPrefix(url, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c = &testConn{t, conn}
+	// the challenge is sent when the client connects
+	label, rem := c.read()
+	if label != authenvelope.L {
+		t.Fatalf("relay sent %s before the auth challenge", label)
+	}
+	var challenge *authenvelope.Challenge
+	if challenge, _, err = authenvelope.ParseChallenge(rem); err != nil {
+		t.Fatal(err)
+	}
+	ev := auth.CreateUnsigned(sign.Pub(), bytes.Clone(challenge.Challenge), url)
+	if err = ev.Sign(sign); err != nil {
+		t.Fatal(err)
+	}
+	c.write(authenvelope.NewResponseWith(ev).Marshal(nil))
+	for label, rem = c.read(); label != okenvelope.L; label, rem = c.read() {
+	}
+	var ok *okenvelope.T
+	if ok, _, err = okenvelope.Parse(rem); err != nil || !ok.OK {
+		t.Fatalf("auth failed: %v %s", err, ok.Reason)
+	}
+	return
+}
+
+// privilegedTo stores a gift wrap and a DM addressed to a pubkey by new keys.
+func privilegedTo(t *testing.T, s *relay.Server, pubkey []byte) (evs []*event.T) {
+	p := tag.New("p", hex.Enc(pubkey))
+	return []*event.T{saveTestEvent(t, s, kind.GiftWrap.K, "wrapped", p),
+		saveTestEvent(t, s, kind.EncryptedDirectMessage.K, "direct", p)}
+}
+
+// sameEvents fails the test if the events sent to a user are not the expected ones.
+func sameEvents(t *testing.T, name string, got, want []*event.T) {
+	t.Helper()
+	ids := make(map[string]bool)
+	for _, ev := range want {
+		ids[string(ev.Id)] = true
+	}
+	for _, ev := range got {
+		if !ids[string(ev.Id)] {
+			t.Errorf("%s was sent an event addressed to another: %s", name, ev.Serialize())
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("%s was sent %d events, expected %d", name, len(got), len(want))
+	}
+}
+
+// privilegedReq is a subscription to gift wraps, DMs and notes.
+func privilegedReq() []byte {
+	return reqenvelope.NewFrom(subscription.MustNew("dms"), filters.New(&filter.T{
+		Kinds: kinds.New(kind.GiftWrap, kind.EncryptedDirectMessage, kind.TextNote)})).
+		Marshal(nil)
+}
+
+func TestReqPrivileged(t *testing.T) {
+	srv, s := newTestWeb(t, &config.C{AuthRequired: true, PublicReadable: true})
+	alice, ac := newTestUser(t, srv.URL)
+	bob, bc := newTestUser(t, srv.URL)
+	toAlice, toBob := privilegedTo(t, s, alice.Pub()), privilegedTo(t, s, bob.Pub())
+	for name, c := range map[string]struct {
+		conn *testConn
+		want []*event.T
+	}{"alice": {ac, toAlice}, "bob": {bc, toBob}} {
+		c.conn.write(privilegedReq())
+		sameEvents(t, name, c.conn.events(eoseenvelope.L, nil), c.want)
+	}
+}
+
+func TestDeliverPrivileged(t *testing.T) {
+	srv, s := newTestWeb(t, &config.C{AuthRequired: true, PublicReadable: true})
+	alice, ac := newTestUser(t, srv.URL)
+	bob, bc := newTestUser(t, srv.URL)
+	for _, c := range []*testConn{ac, bc} {
+		c.write(privilegedReq())
+		if evs := c.events(eoseenvelope.L, nil); len(evs) != 0 {
+			t.Fatalf("%d stored events were sent", len(evs))
+		}
+	}
+	toAlice, toBob := privilegedTo(t, s, alice.Pub()), privilegedTo(t, s, bob.Pub())
+	for _, ev := range append(toAlice, toBob...) {
+		s.Publisher().Deliver(s.AuthRequired(), s.PublicReadable(), ev)
+	}
+	// a note is delivered to both after those, the events before it are all that were
+	// delivered to each user
+	note := saveTestEvent(t, s, kind.TextNote.K, "everyone")
+	s.Publisher().Deliver(s.AuthRequired(), s.PublicReadable(), note)
+	for name, c := range map[string]struct {
+		conn *testConn
+		want []*event.T
+	}{"alice": {ac, toAlice}, "bob": {bc, toBob}} {
+		sameEvents(t, name, c.conn.events("", note.Id), c.want)
+	}
+}
@@ -1,7 +1,6 @@
 package socketapi
 
 import (
-	"bytes"
 	"regexp"
 	"sync"
 
@@ -9,9 +8,9 @@ import (
 	"relay.mleku.dev/envelopes/eventenvelope"
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/filters"
-	"relay.mleku.dev/publish"
+	"relay.mleku.dev/privileged"
 	"relay.mleku.dev/publish/publisher"
-	"relay.mleku.dev/tag"
+	"relay.mleku.dev/relay/interfaces"
 	"relay.mleku.dev/typer"
 	"relay.mleku.dev/ws"
 )
@@ -48,14 +47,13 @@ type S struct {
 	Mx sync.Mutex
 	// Map is the map of subscribers and subscriptions from the websocket api.
 	Map
+	// Server decides which events subscribers may read, if it is not set only the rules for
+	// privileged events apply.
+	Server interfaces.Server
 }
 
 var _ publisher.I = &S{}
 
-func init() {
-	publish.Register(NewPublisher())
-}
-
 func NewPublisher() *S { return &S{Map: make(Map)} }
 
 func (p *S) Type() string { return Type }
@@ -71,12 +69,12 @@ func (p *S) Receive(msg typer.T) {
 			return
 		}
 		p.Mx.Lock()
-		if subs, ok := p.Map[m.Listener]; !ok {
+		subs, ok := p.Map[m.Listener]
+		if !ok {
 			subs = make(map[string]*filters.T)
 			p.Map[m.Listener] = subs
-		} else {
-			subs[m.Id] = m.Filters
 		}
+		subs[m.Id] = m.Filters
 		p.Mx.Unlock()
 
 	}
@@ -95,18 +93,10 @@ func (p *S) Deliver(authRequired, publicReadable bool, ev *event.T) {
 			if !subscriber.Match(ev) {
 				continue
 			}
-			if ev.Kind.IsPrivileged() {
-				ab := w.AuthedBytes()
-				var containsPubkey bool
-				if ev.Tags != nil {
-					containsPubkey = ev.Tags.ContainsAny([]byte{'p'}, tag.New(ab))
-				}
-				if !bytes.Equal(ev.Pubkey, ab) || containsPubkey {
-					if ab == nil {
-						continue
-					}
-					continue
-				}
+			// privileged events only go to the parties of the conversation, gift wraps only
+			// to their recipients and private group events to the group members.
+			if !p.readable(ev, w.AuthedBytes()) {
+				continue
 			}
 			var res *eventenvelope.Result
 			if res, err = eventenvelope.NewResultWith(id, ev); chk.E(err) {
@@ -120,6 +110,14 @@ func (p *S) Deliver(authRequired, publicReadable bool, ev *event.T) {
 	p.Mx.Unlock()
 }
 
+// readable returns true if the holder of the pubkey may be sent the event.
+func (p *S) readable(ev *event.T, pubkey []byte) bool {
+	if p.Server == nil {
+		return privileged.Readable(ev, pubkey)
+	}
+	return p.Server.Readable(ev, pubkey)
+}
+
 // removeSubscriberId removes a specific subscription from a subscriber websocket.
 func (p *S) removeSubscriberId(ws *ws.Listener, id string) {
 	p.Mx.Lock()
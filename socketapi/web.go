@@ -0,0 +1,395 @@
+package socketapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"relay.mleku.dev/bech32encoding"
+	"relay.mleku.dev/bech32encoding/pointers"
+	"relay.mleku.dev/chk"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/eventid"
+	"relay.mleku.dev/filter"
+	"relay.mleku.dev/filters"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/kinds"
+	"relay.mleku.dev/log"
+	"relay.mleku.dev/relay/helpers"
+	"relay.mleku.dev/relayinfo"
+	"relay.mleku.dev/servemux"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+)
+
+// DefaultWebNotes is the number of recent notes shown on the page of a profile.
+const DefaultWebNotes = 20
+
+// page is the data the web templates are rendered from.
+type page struct {
+	// Base is the path prefix of the relay, for the links between pages.
+	Base    string
+	Relay   string
+	Title   string
+	Summary string
+	Image   string
+	// Body selects the template of the content of the page.
+	Body    string
+	Info    *relayinfo.T
+	URL     string
+	Self    string
+	Owner   string
+	Events  []*eventView
+	Profile *profileView
+	Message string
+}
+
+// eventView is an event as it is shown on a page.
+type eventView struct {
+	Link       string
+	Author     string
+	AuthorLink string
+	Kind       string
+	Created    string
+	Content    string
+	Tags       [][]string
+}
+
+// profileView is the kind 0 metadata of a user as it is shown on a page.
+type profileView struct {
+	Npub        string
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	About       string `json:"about"`
+	Picture     string `json:"picture"`
+	Website     string `json:"website"`
+	NIP05       string `json:"nip05"`
+}
+
+// registerWeb adds the read only views of events, profiles and addressable events under the
+// path prefix of the relay.
+func (a *A) registerWeb(sm *servemux.S) {
+	sm.HandleFunc("GET "+a.base+"/e/{code}", a.serveEvent)
+	sm.HandleFunc("GET "+a.base+"/p/{code}", a.serveProfile)
+	sm.HandleFunc("GET "+a.base+"/a/{code}", a.serveAddress)
+}
+
+// render writes a page with a status, with the name of the relay and its base path filled in.
+func (a *A) render(w http.ResponseWriter, r *http.Request, status int, p *page) {
+	if p.Info == nil {
+		p.Info = a.Server.RelayInfo(r)
+	}
+	p.Base, p.Relay = a.base, p.Info.Name
+	if p.Title == "" {
+		p.Title = p.Relay
+	} else {
+		p.Title += " - " + p.Relay
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	chk.E(webTemplates.Execute(w, p))
+}
+
+// message renders a page that only has a message, such as why an event can't be shown.
+func (a *A) message(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	a.render(w, r, status, &page{Body: "message", Title: http.StatusText(status),
+		Summary: msg, Message: msg})
+}
+
+// serveLanding renders the front page of the relay, with its information document, policies
+// and contacts.
+func (a *A) serveLanding(w http.ResponseWriter, r *http.Request) {
+	info := a.Server.RelayInfo(r)
+	p := &page{Body: "landing", Info: info, Summary: info.Description, Image: info.Icon,
+		URL: a.Server.ServiceURL(r)}
+	if info.Self != "" {
+		p.Self = npub(info.Self)
+	}
+	if info.PubKey != "" && info.PubKey != info.Self {
+		p.Owner = npub(info.PubKey)
+	}
+	a.render(w, r, http.StatusOK, p)
+}
+
+// serveEvent renders the event of a nevent, note or hex event id.
+func (a *A) serveEvent(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	var id []byte
+	if prefix, value, err := bech32encoding.Decode([]byte(code)); err == nil {
+		switch v := value.(type) {
+		case pointers.Event:
+			id = v.ID.Bytes()
+		case []byte:
+			if bytes.Equal(prefix, bech32encoding.NoteHRP) {
+				id, _ = hex.Dec(string(v))
+			}
+		}
+	} else {
+		id, _ = hex.Dec(code)
+	}
+	if len(id) != 32 {
+		a.message(w, r, http.StatusBadRequest, "not an event id, nevent or note: "+code)
+		return
+	}
+	evs, ok := a.query(r, &filter.T{IDs: tag.New(id)})
+	if !ok {
+		a.message(w, r, http.StatusForbidden, "this relay only serves its events to "+
+			"authenticated users")
+		return
+	}
+	if len(evs) == 0 {
+		a.message(w, r, http.StatusNotFound, "event not found on this relay")
+		return
+	}
+	a.renderEvents(w, r, evs[:1])
+}
+
+// serveProfile renders the metadata and recent notes of the user of an npub, nprofile or hex
+// pubkey.
+func (a *A) serveProfile(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	var pk []byte
+	if prefix, value, err := bech32encoding.Decode([]byte(code)); err == nil {
+		switch v := value.(type) {
+		case pointers.Profile:
+			pk, _ = hex.Dec(string(v.PublicKey))
+		case []byte:
+			if bytes.Equal(prefix, bech32encoding.NpubHRP) {
+				pk, _ = hex.Dec(string(v))
+			}
+		}
+	} else {
+		pk, _ = hex.Dec(code)
+	}
+	if len(pk) != 32 {
+		a.message(w, r, http.StatusBadRequest, "not a pubkey, npub or nprofile: "+code)
+		return
+	}
+	one, limit := uint(1), uint(DefaultWebNotes)
+	meta, ok := a.query(r, &filter.T{Authors: tag.New(pk),
+		Kinds: kinds.New(kind.ProfileMetadata), Limit: &one})
+	if !ok {
+		a.message(w, r, http.StatusForbidden, "this relay only serves its events to "+
+			"authenticated users")
+		return
+	}
+	notes, _ := a.query(r, &filter.T{Authors: tag.New(pk), Kinds: kinds.New(kind.TextNote),
+		Limit: &limit})
+	prof := &profileView{Npub: npub(hex.Enc(pk))}
+	if len(meta) > 0 {
+		if err := json.Unmarshal(meta[0].Content, prof); err != nil {
+			log.D.F("invalid profile metadata of %0x: %s", pk, err)
+		}
+	}
+	if prof.DisplayName == "" {
+		prof.DisplayName = prof.Name
+	}
+	if len(meta) == 0 && len(notes) == 0 {
+		a.message(w, r, http.StatusNotFound, "no events of this user on this relay")
+		return
+	}
+	p := &page{Body: "profile", Profile: prof, Title: prof.DisplayName, Summary: prof.About,
+		Image: prof.Picture, Events: a.eventViews(notes)}
+	if p.Title == "" {
+		p.Title = short(prof.Npub)
+	}
+	a.render(w, r, http.StatusOK, p)
+}
+
+// serveAddress renders the latest version of the addressable event of a naddr.
+func (a *A) serveAddress(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	prefix, value, err := bech32encoding.Decode([]byte(code))
+	ent, ok := value.(pointers.Entity)
+	if err != nil || !ok || !bytes.Equal(prefix, bech32encoding.NentityHRP) {
+		a.message(w, r, http.StatusBadRequest, "not a naddr: "+code)
+		return
+	}
+	var pk []byte
+	if pk, err = hex.Dec(string(ent.PublicKey)); err != nil {
+		a.message(w, r, http.StatusBadRequest, "not a naddr: "+code)
+		return
+	}
+	one := uint(1)
+	evs, ok := a.query(r, &filter.T{Authors: tag.New(pk), Kinds: kinds.New(ent.Kind),
+		Tags: tags.New(tag.New([]byte("#d"), ent.Identifier)), Limit: &one})
+	if !ok {
+		a.message(w, r, http.StatusForbidden, "this relay only serves its events to "+
+			"authenticated users")
+		return
+	}
+	if len(evs) == 0 {
+		a.message(w, r, http.StatusNotFound, "event not found on this relay")
+		return
+	}
+	a.renderEvents(w, r, evs[:1])
+}
+
+// renderEvents renders a page of events, titled and summarized by the first of them.
+func (a *A) renderEvents(w http.ResponseWriter, r *http.Request, evs event.Ts) {
+	views := a.eventViews(evs)
+	summary := []rune(views[0].Content)
+	if len(summary) > 200 {
+		summary = append(summary[:200], '…')
+	}
+	a.render(w, r, http.StatusOK, &page{Body: "events", Events: views,
+		Title: views[0].Kind + " by " + short(views[0].Author), Summary: string(summary)})
+}
+
+// query returns the events matching a filter that may be sent to an unauthenticated client,
+// applying the same rules as a subscription, and false if the relay doesn't serve them without
+// authentication.
+func (a *A) query(r *http.Request, f *filter.T) (evs event.Ts, ok bool) {
+	remote := helpers.GetRemoteFromReq(r)
+	var allowed *filters.T
+	if allowed, ok, _ = a.Server.AcceptReq(r.Context(), r, nil, filters.New(f), nil,
+		remote); !ok || allowed == nil {
+		return nil, false
+	}
+	sto, release := a.Server.AcquireStorage()
+	defer release()
+	for _, af := range allowed.F {
+		var found event.Ts
+		var err error
+		if found, err = sto.QueryEvents(r.Context(), af); chk.E(err) {
+			continue
+		}
+		for _, ev := range found {
+			// privileged events are only readable by the parties to them, and hidden events
+			// only by their authors.
+			if a.Server.Readable(ev, nil) {
+				evs = append(evs, ev)
+			}
+		}
+	}
+	return
+}
+
+// eventViews returns the events as they are shown on a page.
+func (a *A) eventViews(evs event.Ts) (views []*eventView) {
+	for _, ev := range evs {
+		v := &eventView{
+			Author:  npub(hex.Enc(ev.Pubkey)),
+			Kind:    kind.GetString(ev.Kind),
+			Created: ev.CreatedAt.Time().UTC().Format("2006-01-02 15:04 UTC"),
+			Content: string(ev.Content),
+			Tags:    ev.Tags.ToStringsSlice(),
+		}
+		v.AuthorLink = a.base + "/p/" + v.Author
+		if nevent, err := bech32encoding.EncodeEvent(eventid.NewWith(ev.Id), nil,
+			[]byte(hex.Enc(ev.Pubkey))); err == nil {
+			v.Link = a.base + "/e/" + string(nevent)
+		}
+		views = append(views, v)
+	}
+	return
+}
+
+// npub returns the npub of a hex encoded pubkey, or the pubkey if it isn't valid.
+func npub(pk string) string {
+	b, err := hex.Dec(pk)
+	if err != nil {
+		return pk
+	}
+	var n []byte
+	if n, err = bech32encoding.BinToNpub(b); err != nil {
+		return pk
+	}
+	return string(n)
+}
+
+// short abbreviates a long identifier such as an npub for a title.
+func short(s string) string {
+	if len(s) <= 20 {
+		return s
+	}
+	return s[:12] + "…" + s[len(s)-6:]
+}
+
+var webTemplates = template.Must(template.New("page").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<meta property="og:site_name" content="{{.Relay}}">
+<meta property="og:title" content="{{.Title}}">
+{{with .Summary}}<meta property="og:description" content="{{.}}">
+<meta name="description" content="{{.}}">{{end}}
+{{with .Image}}<meta property="og:image" content="{{.}}">{{end}}
+<style>
+body{font-family:system-ui,sans-serif;max-width:44rem;margin:0 auto;padding:1rem;line-height:1.5;color:#222;background:#fafafa}
+header{border-bottom:1px solid #ddd;margin-bottom:1rem;padding-bottom:.5rem}
+header a{font-weight:bold;color:inherit;text-decoration:none}
+article{background:#fff;border:1px solid #e3e3e3;border-radius:.5rem;padding:1rem;margin-bottom:1rem}
+.content{white-space:pre-wrap;overflow-wrap:anywhere}
+.meta,dt{color:#666;font-size:.9rem}
+.mono{font-family:monospace;overflow-wrap:anywhere}
+img.icon{max-width:6rem;max-height:6rem;border-radius:.5rem;float:right}
+dd{margin:0 0 .5rem 0}
+</style>
+</head>
+<body>
+<header><a href="{{if .Base}}{{.Base}}{{else}}/{{end}}">{{.Relay}}</a></header>
+<main>
+{{if eq .Body "landing"}}{{with .Info}}
+<article>
+{{with .Icon}}<img class="icon" src="{{.}}" alt="">{{end}}
+<h1>{{.Name}}</h1>
+{{with .Description}}<p class="content">{{.}}</p>{{end}}
+<dl>
+{{with $.URL}}<dt>relay address</dt><dd class="mono">{{.}}</dd>{{end}}
+{{with $.Owner}}<dt>operator</dt><dd class="mono"><a href="{{$.Base}}/p/{{.}}">{{.}}</a></dd>{{end}}
+{{with .Contact}}<dt>contact</dt><dd><a href="{{.}}">{{.}}</a></dd>{{end}}
+{{with $.Self}}<dt>relay identity</dt><dd class="mono"><a href="{{$.Base}}/p/{{.}}">{{.}}</a></dd>{{end}}
+</dl>
+</article>
+<article>
+<h2>Policies</h2>
+<ul>
+{{if .Limitation.AuthRequired}}<li>authentication (NIP-42) is required</li>{{end}}
+{{if .Limitation.PaymentRequired}}<li>payment is required to publish{{with .PaymentsURL}}, see <a href="{{.}}">{{.}}</a>{{end}}</li>{{end}}
+{{if .Limitation.RestrictedWrites}}<li>publishing is restricted to permitted users</li>{{else}}<li>anyone may publish</li>{{end}}
+{{with .PostingPolicy}}<li><a href="{{.}}">posting policy</a></li>{{end}}
+{{with .Limitation.MaxLimit}}<li>at most {{.}} events are returned for each filter</li>{{end}}
+</ul>
+{{with .Fees}}<h3>Fees</h3><ul>
+{{range .Admission}}<li>admission: {{.Amount}} {{.Unit}}</li>{{end}}
+{{range .Subscription}}<li>subscription: {{.Amount}} {{.Unit}} for {{.Period}} seconds</li>{{end}}
+</ul>{{end}}
+<dl>
+{{with .RelayCountries}}<dt>countries</dt><dd>{{join . ", "}}</dd>{{end}}
+{{with .LanguageTags}}<dt>languages</dt><dd>{{join . ", "}}</dd>{{end}}
+{{with .Tags}}<dt>tags</dt><dd>{{join . ", "}}</dd>{{end}}
+<dt>supported NIPs</dt><dd>{{.Nips}}</dd>
+<dt>software</dt><dd><a href="{{.Software}}">{{.Software}}</a> {{.Version}}</dd>
+</dl>
+</article>
+{{end}}{{else if eq .Body "profile"}}{{with .Profile}}
+<article>
+{{with .Picture}}<img class="icon" src="{{.}}" alt="">{{end}}
+<h1>{{if .DisplayName}}{{.DisplayName}}{{else}}{{$.Title}}{{end}}</h1>
+<p class="mono meta">{{.Npub}}</p>
+{{with .NIP05}}<p class="meta">{{.}}</p>{{end}}
+{{with .About}}<p class="content">{{.}}</p>{{end}}
+{{with .Website}}<p><a href="{{.}}" rel="nofollow">{{.}}</a></p>{{end}}
+</article>
+{{end}}{{range .Events}}{{template "event" .}}{{end}}
+{{else if eq .Body "events"}}{{range .Events}}{{template "event" .}}{{end}}
+{{else}}<article><p>{{.Message}}</p></article>{{end}}
+</main>
+</body>
+</html>
+{{define "event"}}<article>
+<p class="meta"><a class="mono" href="{{.AuthorLink}}">{{.Author}}</a><br>{{.Kind}} · <a href="{{.Link}}">{{.Created}}</a></p>
+<div class="content">{{.Content}}</div>
+{{with .Tags}}<details><summary class="meta">tags</summary><ul class="mono">{{range .}}<li>{{join . ", "}}</li>{{end}}</ul></details>{{end}}
+</article>{{end}}`))
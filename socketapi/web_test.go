@@ -0,0 +1,193 @@
+package socketapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"relay.mleku.dev/bech32encoding"
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/eventid"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/lol"
+	"relay.mleku.dev/moderation"
+	"relay.mleku.dev/p256k"
+	"relay.mleku.dev/ratel"
+	"relay.mleku.dev/relay"
+	"relay.mleku.dev/relay/config"
+	"relay.mleku.dev/servemux"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+	"relay.mleku.dev/timestamp"
+	"relay.mleku.dev/units"
+)
+
+// newTestWeb serves the web views of a relay with a configuration on a new store.
+func newTestWeb(t *testing.T, cfg *config.C) (srv *httptest.Server, s *relay.Server) {
+	sto := ratel.New(ratel.BackendParams{Ctx: context.Bg(), WG: &sync.WaitGroup{},
+		BlockCacheSize: 16 * units.Mb})
+	sto.Logger = ratel.NewLogger(lol.Off, "RATEL")
+	if err := sto.Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sto.Close() })
+	if err := sto.SetConfiguration(cfg); err != nil {
+		t.Fatal(err)
+	}
+	s = &relay.Server{Name: "test <relay>", Store: sto, Mux: servemux.New(),
+		MaxLimit: ratel.DefaultMaxLimit}
+	s.Init()
+	c, cancel := context.Cancel(context.Bg())
+	t.Cleanup(cancel)
+	s.Ctx = c
+	New(s, "/{$}", s.Mux)
+	srv = httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return
+}
+
+// saveTestEvent signs an event of a kind with content and tags by a new key and stores it.
+func saveTestEvent(t *testing.T, s *relay.Server, k uint16, content string,
+	tt ...*tag.T) (ev *event.T) {
+
+	sign := &p256k.Signer{}
+	if err := sign.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.New(k), Content: []byte(content),
+		Tags: tags.New(tt...)}
+	if err := ev.Sign(sign); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Storage().SaveEvent(context.Bg(), ev); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// getTestWeb fetches a page, and returns its status and body.
+func getTestWeb(t *testing.T, srv *httptest.Server, path string) (status int, body string) {
+	res, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var b []byte
+	if b, err = io.ReadAll(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func TestWebLanding(t *testing.T) {
+	srv, _ := newTestWeb(t, &config.C{PublicReadable: true,
+		Info: config.Info{Description: "notes & <b>more</b>",
+			Contact: "mailto:op@example.com"}})
+	status, body := getTestWeb(t, srv, "/")
+	if status != http.StatusOK {
+		t.Fatalf("landing page: %d %s", status, body)
+	}
+	for _, want := range []string{"test &lt;relay&gt;", "notes &amp; &lt;b&gt;more&lt;/b&gt;",
+		"mailto:op@example.com", "relay address", "anyone may publish"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("landing page does not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "<b>more</b>") || strings.Contains(body, "test <relay>") {
+		t.Errorf("landing page is not escaped:\n%s", body)
+	}
+}
+
+func TestWebEvent(t *testing.T) {
+	srv, s := newTestWeb(t, &config.C{PublicReadable: true})
+	ev := saveTestEvent(t, s, 1, `<script>alert("hi")</script>`)
+	nevent, err := bech32encoding.EncodeEvent(eventid.NewWith(ev.Id), nil,
+		[]byte(hex.Enc(ev.Pubkey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{hex.Enc(ev.Id), string(nevent)} {
+		status, body := getTestWeb(t, srv, "/e/"+code)
+		if status != http.StatusOK {
+			t.Fatalf("event at %s: %d %s", code, status, body)
+		}
+		if strings.Contains(body, "<script>") ||
+			!strings.Contains(body, "&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;") {
+			t.Errorf("content of the event at %s is not escaped:\n%s", code, body)
+		}
+	}
+	npub, err := bech32encoding.BinToNpub(ev.Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body := getTestWeb(t, srv, "/p/"+string(npub))
+	if status != http.StatusOK || strings.Contains(body, "<script>") ||
+		!strings.Contains(body, "&lt;script&gt;") {
+		t.Errorf("profile of the author: %d %s", status, body)
+	}
+	long := saveTestEvent(t, s, 30023, "an article", tag.New("d", "<id>"))
+	naddr, err := bech32encoding.EncodeEntity([]byte(hex.Enc(long.Pubkey)), long.Kind,
+		[]byte("<id>"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body = getTestWeb(t, srv, "/a/"+string(naddr)); status != http.StatusOK ||
+		!strings.Contains(body, "an article") {
+		t.Errorf("addressable event: %d %s", status, body)
+	}
+}
+
+func TestWebHidden(t *testing.T) {
+	srv, s := newTestWeb(t, &config.C{PublicReadable: true})
+	dm := saveTestEvent(t, s, 4, "secret", tag.New("p", strings.Repeat("ab", 32)))
+	hidden := saveTestEvent(t, s, 1, "hidden")
+	if err := s.Hide(&moderation.Hide{Kind: moderation.TargetEvent,
+		Target: hex.Enc(hidden.Id)}); err != nil {
+		t.Fatal(err)
+	}
+	for name, ev := range map[string]*event.T{"privileged": dm, "hidden": hidden} {
+		if status, body := getTestWeb(t, srv, "/e/"+hex.Enc(ev.Id)); status !=
+			http.StatusNotFound || strings.Contains(body, string(ev.Content)) {
+			t.Errorf("%s event was served: %d %s", name, status, body)
+		}
+	}
+}
+
+func TestWebNotPublicReadable(t *testing.T) {
+	srv, s := newTestWeb(t, &config.C{PublicReadable: false})
+	ev := saveTestEvent(t, s, 1, "members only")
+	for _, path := range []string{"/e/" + hex.Enc(ev.Id), "/p/" + hex.Enc(ev.Pubkey)} {
+		if status, body := getTestWeb(t, srv, path); status != http.StatusForbidden ||
+			strings.Contains(body, "members only") {
+			t.Errorf("%s was served by a relay that isn't public readable: %d %s", path,
+				status, body)
+		}
+	}
+}
+
+func TestWebBadCodes(t *testing.T) {
+	srv, _ := newTestWeb(t, &config.C{PublicReadable: true})
+	npub, err := bech32encoding.BinToNpub(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"/e/note1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq",
+		"/e/nevent1notbech32",
+		"/e/" + string(npub),
+		"/e/abcd",
+		"/p/npub1notbech32",
+		"/p/xyz",
+		"/a/naddr1notbech32",
+		"/a/" + string(npub),
+	} {
+		if status, body := getTestWeb(t, srv, path); status != http.StatusBadRequest {
+			t.Errorf("%s: %d, expected %d: %s", path, status, http.StatusBadRequest, body)
+		}
+	}
+}
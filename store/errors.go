@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrDupEvent       = errors.New("duplicate: event already exists")
 	ErrEventNotExists = errors.New("unknown: event not known by any source of this realy")
+	ErrReadOnly       = errors.New("restricted: the event store is a read-only replica")
+	ErrNameTaken      = errors.New("duplicate: name is already taken")
 )
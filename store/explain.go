@@ -0,0 +1,44 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Explanation describes how the events matching a filter were searched for, the indexes that
+// could have been used and the ones that were chosen, and how much work the search took.
+type Explanation struct {
+	// Filter is the filter that was searched for.
+	Filter string
+	// Plan is each of the ways the filter could be searched for with its estimated cost.
+	Plan []PlanIndex
+	// KeysScanned is the number of index keys read, including those read to make estimates.
+	KeysScanned int
+	// EventsDecoded is the number of event records read and decoded.
+	EventsDecoded int
+	// EventsReturned is the number of events that matched the filter.
+	EventsReturned int
+	// Duration is how long the search took.
+	Duration time.Duration
+}
+
+// PlanIndex is one of the ways a filter can be searched for, by a set of searches of an
+// index.
+type PlanIndex struct {
+	// Index is the name of the index.
+	Index string
+	// Queries is the number of searches of the index, one for each value in the filter.
+	Queries int
+	// Estimate is the number of index keys the searches are expected to find.
+	Estimate int64
+	// Exact is true if the estimate is a count of the keys rather than from the statistics.
+	Exact bool
+	// Chosen is true if the index was searched, if more than one was chosen the results
+	// were intersected.
+	Chosen bool
+}
+
+func (e *Explanation) String() string {
+	return fmt.Sprintf("%d keys scanned, %d events decoded, %d returned in %v",
+		e.KeysScanned, e.EventsDecoded, e.EventsReturned, e.Duration)
+}
@@ -0,0 +1,42 @@
+package store
+
+import "fmt"
+
+// FsckReport counts the problems found by a consistency check of the database.
+type FsckReport struct {
+	// Events is the number of event records checked.
+	Events int
+	// Stubs is the number of event records that have been pruned to their hash.
+	Stubs int
+	// Undecodable is the number of event records that can't be decoded.
+	Undecodable int
+	// UnknownDictionary is the number of event records compressed with a dictionary, or
+	// referring to a pubkey serial, that is not in the database. They are not repaired.
+	UnknownDictionary int
+	// IdMismatches is the number of events whose id is not the hash of their content.
+	IdMismatches int
+	// BadSignatures is the number of events with an invalid signature.
+	BadSignatures int
+	// MissingIndexes is the number of index keys missing for the events.
+	MissingIndexes int
+	// OrphanIndexes is the number of index keys that refer to an event that doesn't exist.
+	OrphanIndexes int
+	// OrphanCounters is the number of access counters of events that don't exist.
+	OrphanCounters int
+	// Repaired is the number of keys that were written or deleted to repair the database.
+	Repaired int
+}
+
+// Problems returns the total number of problems found.
+func (f *FsckReport) Problems() int {
+	return f.Undecodable + f.UnknownDictionary + f.IdMismatches + f.BadSignatures + f.MissingIndexes +
+		f.OrphanIndexes + f.OrphanCounters
+}
+
+func (f *FsckReport) String() string {
+	return fmt.Sprintf("%d events, %d stubs, %d undecodable, %d unknown dictionary, "+
+		"%d id mismatches, %d bad signatures, %d missing indexes, %d orphan indexes, "+
+		"%d orphan counters, %d keys repaired", f.Events, f.Stubs, f.Undecodable,
+		f.UnknownDictionary, f.IdMismatches, f.BadSignatures, f.MissingIndexes, f.OrphanIndexes,
+		f.OrphanCounters, f.Repaired)
+}
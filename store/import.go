@@ -0,0 +1,82 @@
+package store
+
+import (
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+)
+
+// The reasons an event in an import is not saved.
+const (
+	// ImportInvalid is a record that can't be decoded as an event.
+	ImportInvalid = "invalid"
+	// ImportBadId is an event whose id is not the hash of its content.
+	ImportBadId = "bad id"
+	// ImportBadSignature is an event with an invalid signature.
+	ImportBadSignature = "bad signature"
+	// ImportDuplicate is an event that is already in the store.
+	ImportDuplicate = "duplicate"
+	// ImportTombstoned is an event that was deleted and may not be saved again.
+	ImportTombstoned = "tombstoned"
+	// ImportRejected is an event the relay's policy does not accept.
+	ImportRejected = "rejected"
+	// ImportError is an event that could not be saved.
+	ImportError = "error"
+)
+
+// MaxImportFailures is the number of failures an ImportReport lists, they are all counted.
+const MaxImportFailures = 1000
+
+// ImportOptions sets how an import is done.
+type ImportOptions struct {
+	// DryRun checks the events without saving them.
+	DryRun bool
+	// Accept applies the policy of the relay to each event if it is set. The afterSave function
+	// it returns, if any, is called when the event is saved.
+	Accept func(c context.T, ev *event.T) (accept bool, notice string, afterSave func())
+	// OnFailure is called with each event that is not saved, as it is found.
+	OnFailure func(f *ImportFailure)
+}
+
+// ImportFailure is a record of an import that was not saved.
+type ImportFailure struct {
+	// Line is the line of JSONL, or the record of the binary format, counting from 1.
+	Line int `json:"line"`
+	// Id is the hex encoded id of the event, if it could be decoded.
+	Id string `json:"id,omitempty"`
+	// Reason is one of the Import reasons an event is not saved.
+	Reason string `json:"reason"`
+	// Message describes the failure.
+	Message string `json:"message,omitempty"`
+}
+
+// ImportReport is the outcome of an import.
+type ImportReport struct {
+	// Format is the format of the import that was detected.
+	Format string `json:"format"`
+	// DryRun is true if the events were checked but not saved.
+	DryRun bool `json:"dry_run"`
+	// Read is the number of records read.
+	Read int `json:"read"`
+	// Saved is the number of events saved, or that would be in a dry run.
+	Saved int `json:"saved"`
+	// Failed is the number of events not saved for each reason.
+	Failed map[string]int `json:"failed"`
+	// Failures lists the first MaxImportFailures events that were not saved.
+	Failures []*ImportFailure `json:"failures,omitempty"`
+	// Error is set if the import stopped before the end of the stream.
+	Error string `json:"error,omitempty"`
+}
+
+// Fail records an event that was not saved.
+func (r *ImportReport) Fail(f *ImportFailure, opts *ImportOptions) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]int)
+	}
+	r.Failed[f.Reason]++
+	if len(r.Failures) < MaxImportFailures {
+		r.Failures = append(r.Failures, f)
+	}
+	if opts != nil && opts.OnFailure != nil {
+		opts.OnFailure(f)
+	}
+}
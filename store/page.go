@@ -0,0 +1,56 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+
+	"relay.mleku.dev/errorf"
+)
+
+// Cursor is a position in the results of a query, the created_at and serial of the last
+// event of a page. Events with the same created_at are ordered by their serial, so a page can
+// end between them.
+type Cursor struct {
+	Ts  int64
+	Ser uint64
+}
+
+// Position returns the cursor of the position of an event in the results.
+func (r IdTsPk) Position() *Cursor { return &Cursor{Ts: r.Ts, Ser: r.Ser} }
+
+// Before returns true if the position is before an event at a created_at and serial, in
+// ascending or descending order.
+func (c *Cursor) Before(ts int64, ser uint64, ascending bool) bool {
+	if ascending {
+		return ts > c.Ts || ts == c.Ts && ser > c.Ser
+	}
+	return ts < c.Ts || ts == c.Ts && ser < c.Ser
+}
+
+// String encodes the cursor as the opaque token given to clients.
+func (c *Cursor) String() string {
+	b := binary.BigEndian.AppendUint64(nil, uint64(c.Ts))
+	b = binary.BigEndian.AppendUint64(b, c.Ser)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a cursor token made by Cursor.String.
+func ParseCursor(s string) (c *Cursor, err error) {
+	var b []byte
+	if b, err = base64.RawURLEncoding.DecodeString(s); err != nil || len(b) != 16 {
+		err = errorf.E("invalid cursor %q", s)
+		return
+	}
+	c = &Cursor{Ts: int64(binary.BigEndian.Uint64(b)), Ser: binary.BigEndian.Uint64(b[8:])}
+	return
+}
+
+// PageOptions selects a page of the results of a query.
+type PageOptions struct {
+	// Limit is the most results in the page.
+	Limit int
+	// Ascending orders the results oldest first, otherwise they are newest first.
+	Ascending bool
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *Cursor
+}
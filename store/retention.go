@@ -0,0 +1,52 @@
+package store
+
+import (
+	"time"
+
+	"relay.mleku.dev/context"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/relayinfo"
+)
+
+// RetentionRule limits how long events of some kinds are kept, and how many of them each
+// author may have kept.
+type RetentionRule struct {
+	// Kinds are the kinds of events the rule applies to, all kinds if empty.
+	Kinds []relayinfo.KindRange
+	// Authors is the class of authors the rule applies to, as given by the classifier passed
+	// to the store with the rules, all authors if empty.
+	Authors string
+	// MaxAge is how long after they were created events are kept, forever if zero.
+	MaxAge time.Duration
+	// MaxCount is the most events each author may have kept, the oldest are deleted first.
+	// There is no limit if it is zero.
+	MaxCount int
+}
+
+// Matches returns true if the rule applies to an event of a kind by an author of a class.
+func (rr *RetentionRule) Matches(k uint16, class string) bool {
+	if rr.Authors != "" && rr.Authors != class {
+		return false
+	}
+	if len(rr.Kinds) == 0 {
+		return true
+	}
+	for _, kr := range rr.Kinds {
+		if k >= kr.From && k <= kr.To {
+			return true
+		}
+	}
+	return false
+}
+
+// Retainer is a store that deletes the events its retention rules don't keep.
+type Retainer interface {
+	// SetRetention sets the rules for which events are kept. The first rule that matches an
+	// event applies to it, events that match none are kept. The class of the author of an
+	// event is given by class, and events that exempt returns true for are always kept.
+	SetRetention(rules []RetentionRule, class func(pubkey []byte) string,
+		exempt func(ev *event.T) bool)
+	// Prune deletes the events the retention rules don't keep, and returns how many it
+	// deleted. It is run periodically by the store.
+	Prune(c context.T) (deleted int, err error)
+}
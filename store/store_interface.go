@@ -5,11 +5,18 @@ package store
 
 import (
 	"io"
+	"time"
 
+	"relay.mleku.dev/admission"
+	"relay.mleku.dev/archive"
+	"relay.mleku.dev/audit"
 	"relay.mleku.dev/context"
+	"relay.mleku.dev/dns"
 	"relay.mleku.dev/event"
 	"relay.mleku.dev/eventid"
 	"relay.mleku.dev/filter"
+	"relay.mleku.dev/groups"
+	"relay.mleku.dev/moderation"
 	"relay.mleku.dev/relay/config"
 	"relay.mleku.dev/tag"
 )
@@ -58,12 +65,23 @@ type IdTsPk struct {
 	Ts  int64
 	Id  []byte
 	Pub []byte
+	// Ser is the serial of the event in the store, which orders events with the same Ts.
+	Ser uint64
 }
 
 type Querier interface {
 	QueryForIds(c context.T, f *filter.T) (evs []IdTsPk, err error)
 }
 
+// Pager finds the events matching a filter a page at a time, in a stable order of created_at
+// and then the order the events were stored.
+type Pager interface {
+	// QueryPage returns a page of the ids of the events matching a filter, and the cursor to
+	// get the next page with, which is nil if there are no more.
+	QueryPage(c context.T, f *filter.T, opts *PageOptions) (page []IdTsPk, next *Cursor,
+		err error)
+}
+
 type GetIdsWriter interface {
 	FetchIds(c context.T, evIds *tag.T, out io.Writer) (err error)
 }
@@ -79,16 +97,26 @@ type Saver interface {
 }
 
 type Importer interface {
-	// Import reads in a stream of line structured JSON of events to save into the
-	// store.
-	Import(r io.Reader)
+	// Import reads in a stream of events to save into the store, in any of the archive
+	// formats, verifying them, and reports the events that were not saved and why.
+	Import(r io.Reader, opts *ImportOptions) (rep *ImportReport)
 }
 
 type Exporter interface {
-	// Export writes a stream of line structured JSON of all events in the store. If pubkeys are
-	// present, only those with these pubkeys in the `pubkey` field and in `p` tags will be
-	// included.
-	Export(c context.T, w io.Writer, pubkeys ...[]byte)
+	// Export writes a stream of the events in the store that match the filter in the options,
+	// or all of them, in the order they were stored. If the After cursor is set the export
+	// continues from the event after it.
+	Export(c context.T, w io.Writer, opts *ExportOptions) (err error)
+}
+
+// ExportOptions selects the events to export and how they are encoded.
+type ExportOptions struct {
+	// Filter selects the events to export, all of them if it is nil. The limit is ignored.
+	Filter *filter.T
+	// Format is the encoding of the export, JSONL if it is empty.
+	Format archive.Format
+	// After is the id of the last event received from an interrupted export, to resume it.
+	After []byte
 }
 
 type Rescanner interface {
@@ -97,6 +125,29 @@ type Rescanner interface {
 	Rescan() (err error)
 }
 
+// Checker checks the consistency of the store and repairs it.
+type Checker interface {
+	// Fsck writes a line for each problem it finds in the store to w, and if repair is set
+	// fixes those it can.
+	Fsck(c context.T, w io.Writer, repair bool) (rep *FsckReport, err error)
+}
+
+// Explainer reports how the store searches for the events that match a filter.
+type Explainer interface {
+	// Explain searches for the events that match a filter, and reports the plan chosen for
+	// the search and how much work it took.
+	Explain(c context.T, f *filter.T) (ex *Explanation, err error)
+}
+
+// Backuper writes incremental backups of the store.
+type Backuper interface {
+	// Backup writes the changes since the last backup in the directory to a new backup in it,
+	// or a full backup if there is none.
+	Backup(dir string) (err error)
+	// LastBackup returns when the last backup in the directory was made, zero if there is none.
+	LastBackup(dir string) (last time.Time, err error)
+}
+
 type Syncer interface {
 	// Sync signals the event store to flush its buffers.
 	Sync() (err error)
@@ -107,6 +158,91 @@ type Configurationer interface {
 	SetConfiguration(c *config.C) (err error)
 }
 
+// Grouper stores the state of NIP-29 relay based groups.
+type Grouper interface {
+	// GetGroup returns the state of a group, or nil if it doesn't exist.
+	GetGroup(id string) (g *groups.Group, err error)
+	SetGroup(g *groups.Group) (err error)
+	DeleteGroup(id string) (err error)
+	Groups() (gs []*groups.Group, err error)
+}
+
+// Identifier stores the secret key the relay signs its own events with.
+type Identifier interface {
+	// GetIdentity returns the stored secret key, or nil if there is none.
+	GetIdentity() (sec []byte, err error)
+	SetIdentity(sec []byte) (err error)
+}
+
+// Namer stores the names served by the NIP-05 identity server.
+type Namer interface {
+	// GetName returns the registration of a name, or nil if it isn't registered.
+	GetName(name string) (r *dns.Registration, err error)
+	SetName(r *dns.Registration) (err error)
+	// ClaimName stores the registration of a name claimed by its pubkey, and releases the names
+	// the pubkey claimed before. It returns ErrNameTaken if another pubkey has the name.
+	ClaimName(r *dns.Registration) (err error)
+	DeleteName(name string) (err error)
+	Names() (rs []*dns.Registration, err error)
+}
+
+// Verifications caches the results of NIP-05 verification of pubkeys.
+type Verifications interface {
+	// GetVerification returns the cached verification of a pubkey, or nil if there is none.
+	GetVerification(pubkey []byte) (v *dns.Verification, err error)
+	// SetVerification caches a verification, it is dropped after the ttl.
+	SetVerification(pubkey []byte, v *dns.Verification, ttl time.Duration) (err error)
+	DeleteVerification(pubkey []byte) (err error)
+	Verifications() (vs []*dns.Verification, err error)
+}
+
+// Memberships stores the paid members of the relay and the invoices issued for admission.
+type Memberships interface {
+	// GetMember returns the membership of a pubkey, or nil if it has none.
+	GetMember(pubkey []byte) (m *admission.Member, err error)
+	SetMember(pubkey []byte, m *admission.Member) (err error)
+	Members() (ms []*admission.Member, err error)
+	SetInvoice(inv *admission.Invoice) (err error)
+	DeleteInvoice(paymentHash string) (err error)
+	// SettleInvoice extends the membership paid for by an invoice and removes the invoice in
+	// one transaction. m is nil if the invoice is no longer stored.
+	SettleInvoice(paymentHash string) (m *admission.Member, err error)
+	Invoices() (invs []*admission.Invoice, err error)
+}
+
+// Moderator stores the moderation cases opened by NIP-56 reports, and the users banned by the
+// moderators.
+type Moderator interface {
+	// GetCase returns the case about an event id or pubkey, or nil if there is none.
+	GetCase(target []byte) (c *moderation.Case, err error)
+	SetCase(c *moderation.Case) (err error)
+	DeleteCase(target []byte) (err error)
+	Cases() (cs []*moderation.Case, err error)
+	// GetBan returns the ban of a pubkey, or nil if it is not banned.
+	GetBan(pubkey []byte) (b *moderation.Ban, err error)
+	SetBan(b *moderation.Ban) (err error)
+	DeleteBan(pubkey []byte) (err error)
+	Bans() (bs []*moderation.Ban, err error)
+}
+
+// Hider stores the events and users hidden from everyone but the authors of the events, which
+// are kept so hiding them can be undone.
+type Hider interface {
+	Hide(h *moderation.Hide) (err error)
+	// Unhide makes the event id or pubkey visible again.
+	Unhide(target []byte) (err error)
+	Hidden() (hs []*moderation.Hide, err error)
+}
+
+// Auditor stores the append only audit log of administrative and moderation actions.
+type Auditor interface {
+	// Audit appends an entry to the audit log.
+	Audit(e *audit.Entry) (err error)
+	// AuditLog calls fn with each entry of the audit log from since until before until, in
+	// unix nanoseconds, oldest first or newest first if reverse is set, until it returns false.
+	AuditLog(since, until int64, reverse bool, fn func(e *audit.Entry) (more bool)) (err error)
+}
+
 type LogLeveler interface {
 	SetLogLevel(level string)
 }
@@ -0,0 +1,16 @@
+package store
+
+// Usage is the storage used by the events of an author.
+type Usage struct {
+	Pubkey string `json:"pubkey" doc:"hex encoded pubkey of the author"`
+	Events int64  `json:"events" doc:"number of events stored"`
+	Bytes  int64  `json:"bytes" doc:"size of the stored event records in bytes"`
+}
+
+// Accountant is a store that keeps account of the storage used by each author.
+type Accountant interface {
+	// Usage returns the storage used by the events of a pubkey.
+	Usage(pubkey []byte) (u *Usage, err error)
+	// TopUsage returns the n authors using the most storage, the most first.
+	TopUsage(n int) (us []*Usage, err error)
+}
@@ -11,8 +11,10 @@ import (
 	"sort"
 
 	"relay.mleku.dev/chk"
+	"relay.mleku.dev/hex"
 	"relay.mleku.dev/log"
 	"relay.mleku.dev/lol"
+	"relay.mleku.dev/sha256"
 	"relay.mleku.dev/tag"
 )
 
@@ -251,27 +253,42 @@ func (t *T) Scan(src any) (err error) {
 // Intersects returns true if a filter tags.T has a match. This means the second character of
 // the filter tag key matches, (ignoring the stupid # prefix in the filter) and one of the
 // following values in the tag matches the first tag of this tag.
+//
+// Filter `#e` and `#p` values are decoded to binary when a filter is unmarshalled, while the
+// event tags keep their hex form, so these are compared by their hex encoding.
 func (t *T) Intersects(f *T) (has bool) {
 	if t == nil || f == nil {
 		// if either are empty there can't be a match (if caller wants to know if both are empty
 		// that's not the same as an intersection).
 		return
 	}
-	matches := len(f.element)
+	// every tag in the filter must have a match, however many tags of the event match it
+filterTags:
 	for _, v := range f.element {
 		for _, w := range t.element {
 			if bytes.Equal(v.FilterKey(), w.Key()) {
 				// we have a matching tag key, and both have a first field, check if tag has any
 				// of the subsequent values in the filter tag.
 				for _, val := range v.ToSliceOfBytes()[1:] {
-					if bytes.Equal(val, w.Value()) {
-						matches--
+					if bytes.Equal(val, w.Value()) || isBinaryTagValue(v.FilterKey(), val) &&
+						bytes.Equal(hex.EncAppend(nil, val), w.Value()) {
+						continue filterTags
 					}
 				}
 			}
 		}
+		return false
 	}
-	return matches == 0
+	return true
+}
+
+// isBinaryTagValue returns true if a filter tag value for the given key is one of the 32 byte
+// binary forms the filter decoder produces for `e` and `p` tags.
+func isBinaryTagValue(key, val []byte) bool {
+	if len(key) != 1 || len(val) != sha256.Size {
+		return false
+	}
+	return key[0] == 'e' || key[0] == 'p'
 }
 
 // ContainsProtectedMarker returns true if an event may only be published to the relay by a user
@@ -334,13 +351,10 @@ func (t *T) MarshalTo(dst []byte) []byte {
 func (t *T) Marshal(dst []byte) (b []byte) {
 	b = dst
 	b = append(b, '[')
-	if t == nil || t.element == nil {
+	if t == nil {
 		b = append(b, ']')
 		return
 	}
-	if len(t.element) == 0 {
-		b = append(b, '[', ']')
-	}
 	for i, s := range t.element {
 		if i > 0 {
 			b = append(b, ',')
@@ -215,3 +215,27 @@ func TestT_ContainsAny(t *testing.T) {
 	// log.I.S(ttt.ContainsAny(by{'b'}, z))
 
 }
+
+func TestT_Intersects(t *testing.T) {
+	pk := "4c800257a588a82849d049817c2bdaad984b25a45ad9f6dad66e47d3b47e3b2f"
+	other := "3c800257a588a82849d049817c2bdaad984b25a45ad9f6dad66e47d3b47e3b2f"
+	// a follow list can have the same pubkey more than once
+	ev := New(tag.New("p", pk), tag.New("p", other), tag.New("p", pk), tag.New("t", "nostr"))
+	bin, _ := hex.Dec(pk)
+	for _, c := range []struct {
+		f    *T
+		want bool
+	}{
+		{New(tag.New("#p", pk)), true},
+		{New(tag.New("#p", string(bin))), true},
+		{New(tag.New("#p", pk, other)), true},
+		{New(tag.New("#p", pk), tag.New("#t", "nostr")), true},
+		{New(tag.New("#p", pk), tag.New("#t", "bitcoin")), false},
+		{New(tag.New("#e", pk)), false},
+	} {
+		if got := ev.Intersects(c.f); got != c.want {
+			t.Errorf("%s intersects %s: got %v want %v", ev.Marshal(nil), c.f.Marshal(nil),
+				got, c.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package wot computes a web of trust over the follow lists of nostr users, the distance of
+// each user from a set of trusted seeds in the follow graph, and a trust score by personalized
+// PageRank, the chance a random walk through the follows that starts from a seed, and jumps
+// back to one with a chance of 1-damping at each step, is at the user.
+//
+// Scores are recomputed starting from the previous ones, so a change to a few follow lists
+// converges in a few iterations.
+package wot
+
+import (
+	"math"
+	"slices"
+	"sync"
+
+	"relay.mleku.dev/ec/schnorr"
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+)
+
+const (
+	// MaxIterations is the most iterations of PageRank that are run to compute the scores.
+	MaxIterations = 100
+	// Tolerance is the total change of the scores in an iteration below which they are taken
+	// to have converged.
+	Tolerance = 1e-9
+)
+
+// Graph is the follow graph of the users within some distance of the seeds, and the trust
+// computed over it.
+type Graph struct {
+	mx      sync.RWMutex
+	seeds   map[string]struct{}
+	follows map[string][]string
+	// the results of Compute
+	distance map[string]int
+	rank     map[string]float64
+	maxRank  float64
+}
+
+// New creates an empty Graph.
+func New() (g *Graph) {
+	return &Graph{
+		seeds:    make(map[string]struct{}),
+		follows:  make(map[string][]string),
+		distance: make(map[string]int),
+		rank:     make(map[string]float64),
+	}
+}
+
+// SetSeeds sets the pubkeys of the users that are trusted by definition, the trust of everyone
+// else is derived from whom they follow.
+func (g *Graph) SetSeeds(seeds ...[]byte) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.seeds = make(map[string]struct{})
+	for _, s := range seeds {
+		g.seeds[string(s)] = struct{}{}
+	}
+}
+
+// SetFollows sets the pubkeys a user follows, and returns the ones that were not followed
+// before.
+func (g *Graph) SetFollows(pubkey []byte, follows [][]byte) (added [][]byte) {
+	var fs []string
+	seen := make(map[string]struct{})
+	for _, f := range follows {
+		if len(f) != schnorr.PubKeyBytesLen || string(f) == string(pubkey) {
+			continue
+		}
+		if _, ok := seen[string(f)]; ok {
+			continue
+		}
+		seen[string(f)] = struct{}{}
+		fs = append(fs, string(f))
+	}
+	slices.Sort(fs)
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	old := g.follows[string(pubkey)]
+	for _, f := range fs {
+		if _, found := slices.BinarySearch(old, f); !found {
+			added = append(added, []byte(f))
+		}
+	}
+	if len(fs) == 0 {
+		delete(g.follows, string(pubkey))
+		return
+	}
+	g.follows[string(pubkey)] = fs
+	return
+}
+
+// Follows returns the pubkeys followed in a follow list event, from its p tags.
+func Follows(ev *event.T) (follows [][]byte) {
+	if !ev.Kind.Equal(kind.FollowList) {
+		return
+	}
+	for _, t := range ev.Tags.ToSliceOfTags() {
+		if t.Len() < 2 || string(t.Key()) != "p" {
+			continue
+		}
+		if pk, err := hex.Dec(string(t.Value())); err == nil {
+			follows = append(follows, pk)
+		}
+	}
+	return
+}
+
+// Compute finds the distance of each user from the seeds by the follows, up to maxDepth, and
+// their trust scores. The follows of users at maxDepth are not followed, they are only
+// reached.
+func (g *Graph) Compute(damping float64, maxDepth int) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	// the distances, by a breadth first search from the seeds
+	distance := make(map[string]int)
+	var frontier []string
+	for s := range g.seeds {
+		distance[s] = 0
+		frontier = append(frontier, s)
+	}
+	for d := 1; d <= maxDepth && len(frontier) > 0; d++ {
+		var next []string
+		for _, u := range frontier {
+			for _, f := range g.follows[u] {
+				if _, ok := distance[f]; !ok {
+					distance[f] = d
+					next = append(next, f)
+				}
+			}
+		}
+		frontier = next
+	}
+	g.distance = distance
+	if len(g.seeds) == 0 {
+		g.rank, g.maxRank = make(map[string]float64), 0
+		return
+	}
+	// the walk only goes through the users within maxDepth, those at maxDepth have no follows
+	// and the walk jumps back to a seed from them
+	out := make(map[string][]string)
+	for u, d := range distance {
+		if d < maxDepth {
+			out[u] = g.follows[u]
+		}
+	}
+	teleport := 1 / float64(len(g.seeds))
+	// start from the previous ranks, scaled to sum to one
+	rank := make(map[string]float64, len(distance))
+	var sum float64
+	for u := range distance {
+		rank[u] = g.rank[u]
+		sum += rank[u]
+	}
+	if sum == 0 {
+		for s := range g.seeds {
+			rank[s] = teleport
+		}
+	} else {
+		for u := range rank {
+			rank[u] /= sum
+		}
+	}
+	for range MaxIterations {
+		next := make(map[string]float64, len(distance))
+		var dangling float64
+		for u, r := range rank {
+			if len(out[u]) == 0 {
+				dangling += r
+				continue
+			}
+			share := damping * r / float64(len(out[u]))
+			for _, f := range out[u] {
+				next[f] += share
+			}
+		}
+		jump := (1 - damping + damping*dangling) * teleport
+		for s := range g.seeds {
+			next[s] += jump
+		}
+		var change float64
+		for u := range distance {
+			change += math.Abs(next[u] - rank[u])
+		}
+		rank = next
+		if change < Tolerance {
+			break
+		}
+	}
+	var maxRank float64
+	for u, r := range rank {
+		if _, seed := g.seeds[u]; !seed && r > maxRank {
+			maxRank = r
+		}
+	}
+	g.rank, g.maxRank = rank, maxRank
+}
+
+// Trust returns the distance of a user from the seeds, -1 if they were not reached, and their
+// score from 0 to 1. Scores are scaled so the most trusted user who is not a seed has a score
+// of 1, and the seeds always have a score of 1.
+func (g *Graph) Trust(pubkey []byte) (distance int, score float64) {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	var ok bool
+	if distance, ok = g.distance[string(pubkey)]; !ok {
+		return -1, 0
+	}
+	if distance == 0 {
+		return 0, 1
+	}
+	if g.maxRank > 0 {
+		score = g.rank[string(pubkey)] / g.maxRank
+	}
+	return
+}
+
+// Size returns the number of users that have been reached from the seeds.
+func (g *Graph) Size() int {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	return len(g.distance)
+}
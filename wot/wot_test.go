@@ -0,0 +1,74 @@
+package wot
+
+import (
+	"testing"
+
+	"lukechampine.com/frand"
+
+	"relay.mleku.dev/event"
+	"relay.mleku.dev/hex"
+	"relay.mleku.dev/kind"
+	"relay.mleku.dev/tag"
+	"relay.mleku.dev/tags"
+)
+
+func TestCompute(t *testing.T) {
+	var users [][]byte
+	for range 6 {
+		users = append(users, frand.Bytes(32))
+	}
+	owner, a, b, c, d, stranger := users[0], users[1], users[2], users[3], users[4], users[5]
+	g := New()
+	g.SetSeeds(owner)
+	g.SetFollows(owner, [][]byte{a, b})
+	g.SetFollows(a, [][]byte{c})
+	g.SetFollows(b, [][]byte{c})
+	g.SetFollows(c, [][]byte{d})
+	// followed by no one
+	g.SetFollows(stranger, [][]byte{owner})
+	g.Compute(0.85, 2)
+	for _, tc := range []struct {
+		pubkey   []byte
+		distance int
+	}{{owner, 0}, {a, 1}, {b, 1}, {c, 2}, {d, -1}, {stranger, -1}} {
+		distance, score := g.Trust(tc.pubkey)
+		if distance != tc.distance {
+			t.Errorf("distance %d, expected %d", distance, tc.distance)
+		}
+		if distance < 0 && score != 0 {
+			t.Errorf("unreached user has score %f", score)
+		}
+	}
+	// c is followed by everyone a and b pass their trust to
+	_, sa := g.Trust(a)
+	_, sb := g.Trust(b)
+	_, sc := g.Trust(c)
+	if sa != sb || sc != 1 || sa <= 0 || sa >= 1 {
+		t.Errorf("unexpected scores a %f b %f c %f", sa, sb, sc)
+	}
+	// b is followed only by a, who also follows c
+	g.SetFollows(owner, [][]byte{a})
+	added := g.SetFollows(a, [][]byte{b, c})
+	if len(added) != 1 || string(added[0]) != string(b) {
+		t.Fatalf("expected b to be added, got %d", len(added))
+	}
+	g.Compute(0.85, 3)
+	if distance, _ := g.Trust(d); distance != 3 {
+		t.Errorf("distance of d %d, expected 3", distance)
+	}
+	_, sb = g.Trust(b)
+	_, sc = g.Trust(c)
+	if sc <= sb {
+		t.Errorf("c %f should be trusted more than b %f", sc, sb)
+	}
+}
+
+func TestFollows(t *testing.T) {
+	a, b := frand.Bytes(32), frand.Bytes(32)
+	ev := &event.T{Kind: kind.FollowList, Tags: tags.New(tag.New("p", hex.Enc(a)),
+		tag.New("e", hex.Enc(b)), tag.New("p", "invalid"), tag.New("p", hex.Enc(b)))}
+	follows := Follows(ev)
+	if len(follows) != 2 || string(follows[0]) != string(a) || string(follows[1]) != string(b) {
+		t.Fatalf("unexpected follows %x", follows)
+	}
+}